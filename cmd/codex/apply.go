@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"codex-go/internal/applypatch"
+)
+
+// apply implements `codex apply [--dry-run] [patch-file]`: it applies a
+// patch in the codex format (read from stdin without a file) to the
+// working directory and prints the changed files. Nothing is written when
+// any part of the patch fails to apply.
+func apply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Check that the patch applies and print the files it would change")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: codex apply [--dry-run] [patch-file]")
+		return 2
+	}
+
+	var data []byte
+	var err error
+	if fs.NArg() == 1 && fs.Arg(0) != "-" {
+		data, err = os.ReadFile(fs.Arg(0))
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "apply error: %v\n", err)
+		return 1
+	}
+	patch, err := applypatch.Parse(string(data))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "apply error: %v\n", err)
+		return 1
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "apply error: %v\n", err)
+		return 1
+	}
+
+	changes, err := applypatch.Plan(root, patch)
+	if err == nil && !*dryRun {
+		err = applypatch.Write(changes)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "apply error: %v\n", err)
+		return 1
+	}
+	fmt.Print(applypatch.Summary(root, changes))
+	return 0
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"codex-go/internal/config"
+)
+
+const configUsage = "usage: codex config get <key> | set <key> <value> | unset <key> | list | validate [file] | schema [-o file]"
+
+// configCmd implements `codex config`: reading and editing keys of the user
+// config file by dotted path, e.g. `codex config set model o4-mini`.
+func configCmd(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	path, err := config.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		return 1
+	}
+	switch {
+	case args[0] == "get" && len(args) == 2:
+		return configGet(path, args[1])
+	case args[0] == "set" && len(args) == 3:
+		return configSet(path, args[1], args[2])
+	case args[0] == "unset" && len(args) == 2:
+		ok, err := config.UnsetValue(path, args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+			return 1
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "config error: %s is not set in %s\n", args[1], path)
+			return 1
+		}
+		fmt.Printf("Removed %s from %s\n", args[1], path)
+		return 0
+	case args[0] == "validate" && len(args) <= 2:
+		if len(args) == 2 {
+			path = args[1]
+		}
+		return configValidate(path)
+	case args[0] == "schema":
+		fs := flag.NewFlagSet("config schema", flag.ContinueOnError)
+		out := fs.String("o", "", "Write the schema to this file instead of stdout")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, configUsage)
+			return 2
+		}
+		b, err := config.SchemaJSON()
+		if err == nil {
+			if *out == "" {
+				_, err = os.Stdout.Write(b)
+			} else {
+				err = os.WriteFile(*out, b, 0o644)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+			return 1
+		}
+		return 0
+	case args[0] == "list" && len(args) == 1:
+		settings, err := config.ListValues(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+			return 1
+		}
+		for _, kv := range settings {
+			fmt.Printf("%s = %s\n", kv.Key, config.FormatValue(kv.Value))
+		}
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, configUsage)
+	return 2
+}
+
+// configGet prints the value of key: strings as they are, so scripts can
+// use them directly, other values in TOML syntax, tables key by key.
+func configGet(path, key string) int {
+	v, ok, err := config.GetValue(path, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		return 1
+	}
+	if !ok {
+		fmt.Fprintf(os.Stderr, "config error: %s is not set in %s\n", key, path)
+		return 1
+	}
+	switch v := v.(type) {
+	case string:
+		fmt.Println(v)
+	case map[string]any:
+		for _, kv := range config.Flatten(v) {
+			fmt.Printf("%s = %s\n", kv.Key, config.FormatValue(kv.Value))
+		}
+	default:
+		fmt.Println(config.FormatValue(v))
+	}
+	return 0
+}
+
+// configValidate reports the problems of the config file at path, one per
+// line as <path>:<line>: error|warning: <key>: <message>. Only errors fail.
+func configValidate(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		return 1
+	}
+	problems, err := config.Validate(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+	code := 0
+	for _, p := range problems {
+		fmt.Printf("%s:%s\n", path, p)
+		if !p.Warning {
+			code = 1
+		}
+	}
+	if len(problems) == 0 {
+		fmt.Printf("%s: ok\n", path)
+	}
+	return code
+}
+
+// configSet checks value against the key's type, then writes it.
+func configSet(path, key, raw string) int {
+	v, err := config.ParseValue(key, raw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		return 2
+	}
+	if err := config.SetValue(path, key, v); err != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Set %s = %s in %s\n", key, config.FormatValue(v), path)
+	return 0
+}
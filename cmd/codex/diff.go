@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"codex-go/internal/protocol"
+	"codex-go/internal/rollout"
+)
+
+// diffCmd implements `codex diff [--all] [<session-id>]`: it prints the
+// changes the last turn of a recorded session made to the worktree (every
+// turn's with --all), as reported by its turn_diff events. Without a
+// session id the most recent session is used.
+func diffCmd(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	all := fs.Bool("all", false, "Print the changes of every turn, oldest first")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: codex diff [--all] [<session-id>]")
+		return 2
+	}
+	dir, err := rollout.DefaultDir()
+	var path string
+	if err == nil {
+		if fs.NArg() == 1 {
+			path, err = rollout.Find(dir, fs.Arg(0))
+		} else {
+			path, err = rollout.Latest(dir)
+		}
+	}
+	var r *rollout.Rollout
+	if err == nil {
+		r, err = rollout.Load(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diff error: %v\n", err)
+		return 1
+	}
+
+	var diffs []protocol.Event
+	for _, ev := range r.Events {
+		if _, ok := ev.Msg.(protocol.TurnDiffEvent); ok {
+			diffs = append(diffs, ev)
+		}
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintf(os.Stderr, "session %s changed no files\n", r.Meta.ID)
+		return 0
+	}
+	if !*all {
+		diffs = diffs[len(diffs)-1:]
+	}
+	for _, ev := range diffs {
+		if *all {
+			fmt.Printf("# %s\n", ev.TurnID)
+		}
+		fmt.Print(ev.Msg.(protocol.TurnDiffEvent).UnifiedDiff)
+	}
+	return 0
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"codex-go/internal/auth"
+	"codex-go/internal/config"
+	"codex-go/internal/model"
+)
+
+const loginUsage = "usage: codex login [--name <name>] [--api-key <key | -> | --azure-tenant-id <id> --azure-client-id <id> --azure-client-secret <secret | ->] | --list"
+
+// loginCmd implements `codex login`: signing in with a ChatGPT account in
+// the browser, or with --api-key saving an OpenAI API key, to the
+// credential store (auth.json or the keychain, see
+// cli_auth_credentials_store). Without --name this is the default
+// credential, which takes precedence over $OPENAI_API_KEY; with it, a
+// named credential that the credential config keys select, which may also
+// be an Azure service principal. Secrets given as "-" are read from stdin,
+// which keeps them out of the shell history.
+func loginCmd(args []string, timeout time.Duration, storeKind string) int {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	name := fs.String("name", "", "Save a named credential instead of the default one")
+	list := fs.Bool("list", false, "List the saved credentials")
+	apiKey := fs.String("api-key", "", "OpenAI API key to save, or - to read it from stdin")
+	tenant := fs.String("azure-tenant-id", "", "Tenant of an Azure service principal (needs --name)")
+	clientID := fs.String("azure-client-id", "", "Application (client) id of the service principal")
+	clientSecret := fs.String("azure-client-secret", "", "Client secret of the service principal, or - to read it from stdin")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, loginUsage)
+		return 2
+	}
+	azure := *tenant != "" || *clientID != "" || *clientSecret != ""
+	if azure && (*tenant == "" || *clientID == "" || *clientSecret == "" || *apiKey != "") {
+		fmt.Fprintln(os.Stderr, "login error: an Azure service principal needs --azure-tenant-id, --azure-client-id and --azure-client-secret, and no --api-key")
+		return 2
+	}
+	if azure && *name == "" {
+		fmt.Fprintln(os.Stderr, "login error: an Azure service principal can only be saved under a --name")
+		return 2
+	}
+	store, err := auth.OpenStore(storeKind)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "login error: %v\n", err)
+		return 1
+	}
+	if *list {
+		return loginList(store)
+	}
+
+	var cred auth.Credential
+	switch {
+	case azure:
+		secret, err := readSecret(*clientSecret)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "login error: client secret: %v\n", err)
+			return 2
+		}
+		cred.Azure = &auth.AzurePrincipal{TenantID: *tenant, ClientID: *clientID, ClientSecret: secret}
+	case *apiKey != "":
+		if cred.APIKey, err = readSecret(*apiKey); err != nil {
+			fmt.Fprintf(os.Stderr, "login error: API key: %v\n", err)
+			return 2
+		}
+	default:
+		if cred.Tokens, err = chatGPTTokens(timeout); err != nil {
+			fmt.Fprintf(os.Stderr, "login error: %v\n", err)
+			return 1
+		}
+	}
+
+	creds, err := store.Load()
+	if err == nil {
+		if *name == "" {
+			creds.OpenAIAPIKey, creds.Tokens = cred.APIKey, cred.Tokens
+		} else {
+			if creds.Credentials == nil {
+				creds.Credentials = map[string]*auth.Credential{}
+			}
+			creds.Credentials[*name] = &cred
+		}
+		err = store.Save(creds)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "login error: %v\n", err)
+		return 1
+	}
+	what := "credential"
+	if *name != "" {
+		what = fmt.Sprintf("credential %q", *name)
+	}
+	fmt.Printf("Saved %s (%s) to %s\n", what, cred.Kind(), store.Location())
+	return 0
+}
+
+// readSecret returns v, or a line of stdin for "-", trimmed.
+func readSecret(v string) (string, error) {
+	if v == "-" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading stdin: %v", err)
+		}
+		v = line
+	}
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return "", errors.New("empty")
+	}
+	return v, nil
+}
+
+// loginList prints the saved credentials, secrets masked.
+func loginList(store auth.Store) int {
+	creds, err := store.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "login error: %v\n", err)
+		return 1
+	}
+	def := auth.Credential{APIKey: creds.OpenAIAPIKey, Tokens: creds.Tokens}
+	if def.APIKey != "" || def.Tokens != nil {
+		fmt.Printf("(default)\t%s\n", def.Kind())
+	}
+	names := make([]string, 0, len(creds.Credentials))
+	for name := range creds.Credentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s\t%s\n", name, creds.Credentials[name].Kind())
+	}
+	if len(names) == 0 && def.APIKey == "" && def.Tokens == nil {
+		fmt.Println("Not logged in")
+	}
+	return 0
+}
+
+// chatGPTTokens signs in with a ChatGPT account through the browser.
+func chatGPTTokens(timeout time.Duration) (*auth.Tokens, error) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if timeout <= 0 {
+		timeout = loginTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return auth.OAuth{}.Login(ctx, func(authURL string) {
+		fmt.Fprintf(os.Stderr, "Sign in with ChatGPT in your browser. If it does not open, visit:\n\n  %s\n\n", authURL)
+		_ = openBrowser(authURL)
+	})
+}
+
+// loginTimeout bounds the browser sign-in unless --timeout is given.
+const loginTimeout = 10 * time.Minute
+
+// openBrowser opens url in the user's browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// useChatGPT makes p authenticate with the tokens of a ChatGPT sign-in,
+// refreshed as they expire and saved back to the credential named name
+// ("" for the default one). The built-in openai provider is moved to the
+// ChatGPT backend unless its base URL was changed.
+func useChatGPT(p *model.Provider, id string, c config.ModelProviderConfig, store auth.Store, name string, tokens *auth.Tokens) {
+	if id == "openai" && c.BaseURL == "" && os.Getenv("OPENAI_BASE_URL") == "" {
+		p.BaseURL = auth.ChatGPTBaseURL
+		if c.WireAPI == "" {
+			p.WireAPI = model.WireResponses
+		}
+	}
+	if tokens.AccountID != "" {
+		headers := map[string]string{auth.AccountHeader: tokens.AccountID}
+		for k, v := range p.HTTPHeaders {
+			headers[k] = v
+		}
+		p.HTTPHeaders = headers
+	}
+	p.Token = auth.NewTokenSource(store, name, auth.OAuth{}, tokens).Token
+}
+
+// logoutCmd implements `codex logout`: deleting the default credential,
+// or with --name a named one. The store is removed once it holds none.
+func logoutCmd(args []string, storeKind string) int {
+	fs := flag.NewFlagSet("logout", flag.ContinueOnError)
+	name := fs.String("name", "", "Delete the named credential instead of the default one")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: codex logout [--name <name>]")
+		return 2
+	}
+	store, err := auth.OpenStore(storeKind)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logout error: %v\n", err)
+		return 1
+	}
+	creds, err := store.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logout error: %v\n", err)
+		return 1
+	}
+	what := "the credential"
+	if *name == "" {
+		if creds.OpenAIAPIKey == "" && creds.Tokens == nil {
+			fmt.Println("Not logged in")
+			return 0
+		}
+		creds.OpenAIAPIKey, creds.Tokens = "", nil
+	} else {
+		if _, ok := creds.Credentials[*name]; !ok {
+			fmt.Fprintf(os.Stderr, "logout error: no credential named %q\n", *name)
+			return 1
+		}
+		delete(creds.Credentials, *name)
+		what = fmt.Sprintf("credential %q", *name)
+	}
+	if creds.OpenAIAPIKey == "" && creds.Tokens == nil && len(creds.Credentials) == 0 {
+		_, err = store.Remove()
+	} else {
+		err = store.Save(creds)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "logout error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Removed %s from %s\n", what, store.Location())
+	return 0
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -14,7 +18,16 @@ import (
 	// internal/ so the API surface can evolve freely without breaking users.
 	iexec "codex-go/internal/exec"
 	"codex-go/internal/agent"
+	"codex-go/internal/auth"
+	"codex-go/internal/config"
+	"codex-go/internal/jsonl"
+	"codex-go/internal/jsonschema"
+	"codex-go/internal/logging"
+	"codex-go/internal/model"
+	"codex-go/internal/protocol/schema"
+	"codex-go/internal/server/listener"
 	"codex-go/internal/server/mcp"
+	"codex-go/internal/tokens"
 	"codex-go/internal/version"
 )
 
@@ -23,31 +36,71 @@ import (
 func usage() {
 	fmt.Println("Usage:")
 	fmt.Println("  codex [flags] version")
-	fmt.Println("  codex [flags] mcp serve")
-	fmt.Println("  codex [flags] serve   # protocol v1 minimal loop (phase 1)")
-	fmt.Println("  codex [flags] run -- <cmd...>")
+	fmt.Println("  codex [flags] mcp serve [--http <addr> | --listen <unix://path|tcp://addr>] [--framing auto|ndjson|lsp] [--auth-token <tok> | --auth-token-file <path>]")
+	fmt.Println("  codex [flags] mcp add [--env KEY=VALUE]... [--url <url>] [--no-validate] <name> [-- <command...>]")
+	fmt.Println("  codex [flags] mcp list | mcp remove <name>")
+	fmt.Println("  codex [flags] serve [--listen <unix://path|tcp://addr>]   # protocol v1 minimal loop (phase 1)")
+	fmt.Println("  codex [flags] resume [--fork-at <turn-id>] [--last | <session-id>]   # serve on stdio, continuing (or forking) a recorded session")
+	fmt.Println("  codex [flags] run [--pty] [--stdin] [--in-container image] -- <cmd...>")
+	fmt.Println("  codex [flags] apply [--dry-run] [patch-file]   # apply a *** Begin Patch patch (stdin by default)")
+	fmt.Println("  codex [flags] diff [--all] [<session-id>]   # changes of a recorded session's last turn (default: latest session)")
+	fmt.Println("  codex [flags] undo [<session-id>]   # revert the files changed by the latest agent turn in this repository")
+	fmt.Println("  codex [flags] sessions show [--usage] [<session-id>]   # a recorded session and its token usage and cost (default: latest session)")
+	fmt.Println("  codex [flags] review [--base <rev> | --range <a..b>] [--instructions <text>] [paths...]")
+	fmt.Println("  codex [flags] config get <key> | set <key> <value> | unset <key> | list   # read or edit ~/.codex/config.toml by dotted key")
+	fmt.Println("  codex [flags] config validate [file] | schema [-o <file>]   # check config.toml (default ~/.codex/config.toml); its JSON Schema")
+	fmt.Println("  codex [flags] login [--api-key <key | ->] # sign in with ChatGPT in the browser, or save an OpenAI API key (- reads stdin)")
+	fmt.Println("  codex [flags] logout                      # delete the saved credentials")
+	fmt.Println("  codex [flags] generate-schema [-o <file>]   # JSON Schema of the serve protocol")
 	fmt.Println("")
 	fmt.Println("Flags:")
 	fmt.Println("  --cwd <dir>         Set working directory")
 	fmt.Println("  --env <key=value>   Set environment variable (can be used multiple times)")
 	fmt.Println("  --timeout <duration> Set timeout for command execution (e.g., 30s, 5m)")
+	fmt.Println("  --log-level <level> Diagnostics on stderr: debug, info, warn, error (default log_level, else warn)")
+	fmt.Println("  --max-frame-size <bytes> Maximum size of one incoming protocol frame (default 8MiB)")
+	fmt.Println("  --profile <name>    Use the settings of [profiles.<name>] in config.toml (default: default_profile)")
+	fmt.Println("  -c <key=value>      Override a config.toml setting, e.g. -c model=o3 (can be used multiple times)")
+	fmt.Println("  --search            Let the model search the web (see [web_search] in config.toml)")
+	fmt.Println("  --output-schema <file> JSON Schema final answers must conform to; reported in task_complete")
+	fmt.Println("  --oss               Use a local Ollama server and an installed model (runs offline)")
+	fmt.Println("  --oss-pull          With --oss, download the model first when it is not installed")
+	fmt.Println("  --trust             Trust the current project, allowing a writable sandbox and auto-approval (remembered)")
 }
 
 // parseFlags parses global flags and returns remaining arguments
 type GlobalFlags struct {
-	cwd     string
-	env     []string
-	timeout time.Duration
+	cwd          string
+	env          []string
+	timeout      time.Duration
+	maxFrameSize int
+	logLevel     string
+	search       bool
+	overrides    []string
+	profile      string
+	outputSchema string
+	oss          bool
+	ossPull      bool
+	trust        bool
 }
 
 func parseFlags(args []string) (GlobalFlags, []string, error) {
 	var flags GlobalFlags
-	var envFlags arrayFlags
+	var envFlags, overrides arrayFlags
 	
 	flagSet := flag.NewFlagSet("codex", flag.ContinueOnError)
 	flagSet.StringVar(&flags.cwd, "cwd", "", "Set working directory")
 	flagSet.Var(&envFlags, "env", "Set environment variable (key=value)")
 	flagSet.DurationVar(&flags.timeout, "timeout", 0, "Set timeout for command execution")
+	flagSet.StringVar(&flags.logLevel, "log-level", "", "Minimum level for diagnostics on stderr (debug, info, warn, error; default log_level, else warn)")
+	flagSet.IntVar(&flags.maxFrameSize, "max-frame-size", jsonl.DefaultMaxFrameSize, "Maximum size in bytes of one incoming protocol frame")
+	flagSet.Var(&overrides, "c", "Override a config setting (key=value)")
+	flagSet.StringVar(&flags.profile, "profile", "", "Config profile to use")
+	flagSet.BoolVar(&flags.search, "search", false, "Let the model search the web")
+	flagSet.StringVar(&flags.outputSchema, "output-schema", "", "JSON Schema file final answers must conform to")
+	flagSet.BoolVar(&flags.oss, "oss", false, "Use the models of a local Ollama server")
+	flagSet.BoolVar(&flags.ossPull, "oss-pull", false, "With --oss, download the model when it is not installed")
+	flagSet.BoolVar(&flags.trust, "trust", false, "Trust the current project with a writable sandbox and auto-approval")
 	
 	// Parse flags
 	err := flagSet.Parse(args)
@@ -56,6 +109,7 @@ func parseFlags(args []string) (GlobalFlags, []string, error) {
 	}
 	
 	flags.env = envFlags
+	flags.overrides = overrides
 	return flags, flagSet.Args(), nil
 }
 
@@ -94,6 +148,327 @@ func applyGlobalFlags(flags GlobalFlags) error {
 	return nil
 }
 
+// serveListener runs handler for every connection accepted on spec until ctx
+// ends, exiting the process on listener failure. Unless handler
+// authenticates its clients, spec must be a unix socket or a loopback TCP
+// address: whoever connects can run commands as this user.
+func serveListener(ctx context.Context, spec string, handler listener.ConnHandler, name string, authenticated bool) {
+	logf := func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, name+": "+format+"\n", args...)
+	}
+	local, err := listener.Loopback(spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s error: %v\n", name, err)
+		os.Exit(2)
+	}
+	if !local && !authenticated {
+		fmt.Fprintf(os.Stderr, "%s error: %s is reachable from other machines and needs authentication; listen on a unix socket or a loopback address\n", name, spec)
+		os.Exit(2)
+	}
+	logf("listening on %s", spec)
+	if err := listener.Serve(ctx, spec, handler, logf); err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "%s error: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// logLevel controls the minimum level of the logger main creates. Unless
+// --log-level is given, loadConfig sets it from log_level.
+var logLevel = new(slog.LevelVar)
+
+// loadConfig merges the config layers: the user config file, the project's
+// .codex/config.toml, the selected profile, CODEX_* variables and the -c
+// and --search flags. Problems are logged rather than fatal: every setting
+// has a usable default. They are fatal with --profile, which asks for
+// settings that would otherwise be silently missing. With --oss the config
+// is pointed at the local Ollama server, and failing that is fatal.
+func loadConfig(logger *slog.Logger, flags GlobalFlags) *config.EffectiveConfig {
+	cfg, err := config.LoadEffective(loadOptions(flags))
+	if err != nil && flags.profile != "" {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+		os.Exit(2)
+	}
+	if err != nil {
+		logger.Warn("config not loaded", "error", err)
+		cfg = &config.EffectiveConfig{}
+	}
+	applyLogLevel(&cfg.Config, flags)
+	for _, l := range cfg.Layers {
+		if l.Name == config.LayerProfile {
+			logger.Debug("config layer", "layer", l.Name, "profile", cfg.Profile)
+			if len(l.Ignored) > 0 {
+				logger.Warn("config keys a profile cannot set ignored", "profile", cfg.Profile, "keys", l.Ignored)
+			}
+			continue
+		}
+		logger.Debug("config layer", "layer", l.Name, "path", l.Path)
+		if len(l.Ignored) > 0 {
+			logger.Warn("config keys not allowed in a project config ignored", "path", l.Path, "keys", l.Ignored)
+		}
+	}
+	if flags.oss {
+		model := cfg.Model
+		if cfg.ModelProvider != ossProvider {
+			// The model is meant for another provider.
+			cfg.Model = ""
+		}
+		if err := setupOSS(context.Background(), &cfg.Config, flags.ossPull, logger); err != nil {
+			fmt.Fprintf(os.Stderr, "oss error: %v\n", err)
+			os.Exit(1)
+		}
+		// --oss chose these, whatever the layers said.
+		if cfg.Sources == nil {
+			cfg.Sources = map[string]string{}
+		}
+		cfg.Sources["model_provider"] = config.LayerFlags
+		if cfg.Model != model {
+			cfg.Sources["model"] = config.LayerFlags
+		}
+	}
+	return cfg
+}
+
+// loadOptions selects the config layers for flags.
+func loadOptions(flags GlobalFlags) config.LoadOptions {
+	opts := config.LoadOptions{Profile: flags.profile, Overrides: flags.overrides}
+	if flags.search {
+		opts.Overrides = append(opts.Overrides, "web_search.enabled=true")
+	}
+	if wd, err := os.Getwd(); err == nil {
+		opts.Cwd = wd
+	}
+	return opts
+}
+
+// applyLogLevel sets logLevel from cfg unless --log-level was given.
+func applyLogLevel(cfg *config.Config, flags GlobalFlags) {
+	if flags.logLevel != "" {
+		return
+	}
+	level := slog.LevelWarn
+	if cfg.LogLevel != "" {
+		level, _ = logging.ParseLevel(cfg.LogLevel)
+	}
+	logLevel.Set(level)
+}
+
+// prices converts the configured price table.
+func prices(cfg *config.Config) map[string]tokens.Price {
+	out := make(map[string]tokens.Price, len(cfg.ModelPrices))
+	for name, p := range cfg.ModelPrices {
+		cached := p.Input
+		if p.CachedInput != nil {
+			cached = *p.CachedInput
+		}
+		out[name] = tokens.Price{Input: p.Input, CachedInput: cached, Output: p.Output}
+	}
+	return out
+}
+
+// agentConfig derives the agent's model settings from the config file.
+// When the provider cannot be used (typically its API key is not set) the
+// agent falls back to its offline echo backend.
+func agentConfig(cfg *config.Config, logger *slog.Logger) agent.Config {
+	ac := agent.Config{
+		Model:                  cfg.Model,
+		ReasoningEffort:        cfg.ModelReasoningEffort,
+		Verbosity:              cfg.ModelVerbosity,
+		MaxOutputTokens:        cfg.ModelMaxOutputTokens,
+		ContextWindow:          cfg.ModelContextWindow,
+		AutoCompactTokenLimit:  cfg.ModelAutoCompactTokenLimit,
+		MaxRetries:             model.DefaultMaxRetries,
+		ApprovalPolicy:         cfg.ApprovalPolicy,
+		Sandbox:                cfg.SandboxWorkspaceWrite.Policy(cfg.SandboxMode),
+		Runner:                 cfg.SandboxContainer.Runner(),
+		ShellEnvironmentPolicy: cfg.ShellEnvironmentPolicy.Policy(),
+		Notify:                 cfg.Notify,
+		Prices:                 prices(cfg),
+	}
+	if n := cfg.ModelProviders[providerID(cfg)].RequestMaxRetries; n != nil {
+		ac.MaxRetries = *n
+	}
+	if ws := cfg.WebSearch; ws.Enabled {
+		ac.WebSearch = true
+		if ws.URL != "" {
+			ac.WebSearchAPI = &agent.WebSearchAPI{URL: ws.URL, Header: http.Header{}, MaxResults: ws.MaxResults}
+			for k, v := range ws.HTTPHeaders {
+				ac.WebSearchAPI.Header.Set(k, v)
+			}
+			for k, env := range ws.EnvHTTPHeaders {
+				if v := os.Getenv(env); v != "" {
+					ac.WebSearchAPI.Header.Set(k, v)
+				}
+			}
+		}
+	}
+	if n := cfg.ProjectDocMaxBytes; n != nil {
+		ac.ProjectDocMaxBytes = *n
+		if *n == 0 {
+			ac.ProjectDocMaxBytes = -1
+		}
+	}
+	p, err := modelProvider(cfg)
+	if err == nil {
+		ac.Client, err = p.Client()
+	}
+	if err != nil {
+		logger.Warn("model provider unavailable; replies are canned", "error", err)
+		return ac
+	}
+	ac.Model = p.Model(ac.Model)
+	if ac.WebSearch && ac.WebSearchAPI == nil && !model.SearchesWeb(ac.Client) {
+		logger.Warn("web search unavailable: the provider has no search tool and web_search.url is not set")
+	}
+	return ac
+}
+
+// readOutputSchema reads the --output-schema file, checking that it is a
+// usable JSON Schema. An empty path means no schema.
+func readOutputSchema(path string) (json.RawMessage, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("output schema: %w", err)
+	}
+	if _, err := jsonschema.Compile(data); err != nil {
+		return nil, fmt.Errorf("output schema %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// modelProvider resolves model_provider against the built-in providers,
+// with fields set in model_providers taking precedence. Credentials saved
+// by `codex login` take precedence over the provider's env_key variable.
+func modelProvider(cfg *config.Config) (model.Provider, error) {
+	id := providerID(cfg)
+	p, builtin := model.BuiltinProviders()[id]
+	c, configured := cfg.ModelProviders[id]
+	if !builtin && !configured {
+		return model.Provider{}, fmt.Errorf("unknown model_provider %q (built-in: %s)", id, strings.Join(model.ProviderIDs(), ", "))
+	}
+	if p.Name == "" {
+		p.Name = id
+	}
+	if c.Name != "" {
+		p.Name = c.Name
+	}
+	if c.BaseURL != "" {
+		p.BaseURL = c.BaseURL
+	}
+	if c.EnvKey != "" {
+		p.EnvKey = c.EnvKey
+	}
+	if c.WireAPI != "" {
+		p.WireAPI = c.WireAPI
+	}
+	if c.QueryParams != nil {
+		p.QueryParams = c.QueryParams
+	}
+	if c.APIVersion != "" {
+		p.APIVersion = c.APIVersion
+	}
+	if c.Azure {
+		p.Azure = true
+	}
+	if c.Deployments != nil {
+		p.Deployments = c.Deployments
+	}
+	if c.HTTPHeaders != nil {
+		p.HTTPHeaders = c.HTTPHeaders
+	}
+	if c.EnvHTTPHeaders != nil {
+		p.EnvHTTPHeaders = c.EnvHTTPHeaders
+	}
+	// A credential selected by name (the top-level key, which profiles
+	// set, before the provider's) replaces the default one and the env key.
+	name := cfg.Credential
+	if name == "" {
+		name = c.Credential
+	}
+	if name != "" || p.EnvKey != "" {
+		store, err := auth.OpenStore(cfg.CLIAuthCredentialsStore)
+		if err != nil {
+			return model.Provider{}, err
+		}
+		creds, err := store.Load()
+		if err != nil {
+			return model.Provider{}, err
+		}
+		if name != "" {
+			cred, ok := creds.Credentials[name]
+			if !ok {
+				return model.Provider{}, fmt.Errorf("credential %q not found; run codex login --name %s", name, name)
+			}
+			switch {
+			case cred.APIKey != "":
+				p.APIKey = cred.APIKey
+			case cred.Tokens != nil:
+				useChatGPT(&p, id, c, store, name, cred.Tokens)
+			case cred.Azure != nil:
+				p.Token = cred.Azure.TokenSource(nil)
+			}
+			return p, nil
+		}
+		p.APIKey = creds.APIKey(p.EnvKey)
+		if p.APIKey == "" && p.EnvKey == auth.OpenAIAPIKeyEnv && creds.Tokens != nil {
+			useChatGPT(&p, id, c, store, "", creds.Tokens)
+		}
+	}
+	return p, nil
+}
+
+// providerID returns the configured model_provider, or the default.
+func providerID(cfg *config.Config) string {
+	if cfg.ModelProvider == "" {
+		return config.DefaultModelProvider
+	}
+	return cfg.ModelProvider
+}
+
+// loadAgentTools connects to the configured MCP servers, returning their
+// tools for the agent. Servers that fail are logged and skipped.
+func loadAgentTools(ctx context.Context, cfg *config.Config, logger *slog.Logger) (*agent.ToolRegistry, func()) {
+	if len(cfg.MCPServers) == 0 {
+		return agent.NewToolRegistry(), func() {}
+	}
+	conns := connectMCPServers(ctx, cfg.MCPServers, logger)
+	return toolRegistry(conns, logger), conns.Close
+}
+
+// connectMCPServers connects to servers, logging those that fail.
+func connectMCPServers(ctx context.Context, servers map[string]config.MCPServerConfig, logger *slog.Logger) *agent.MCPConnections {
+	conns, errs := agent.ConnectMCPServers(ctx, servers)
+	for _, err := range errs {
+		logger.Warn("mcp server unavailable", "error", err)
+	}
+	return conns
+}
+
+// toolRegistry registers the tools of conns.
+func toolRegistry(conns *agent.MCPConnections, logger *slog.Logger) *agent.ToolRegistry {
+	registry := agent.NewToolRegistry()
+	for _, t := range conns.Tools() {
+		if err := registry.Register(t); err != nil {
+			logger.Warn("mcp tool skipped", "error", err)
+			continue
+		}
+		logger.Debug("mcp tool available", "name", t.Spec().Name)
+	}
+	return registry
+}
+
+// mcpServeToolLimits converts the [mcp_serve] limits for mcp.Options.
+func mcpServeToolLimits(c config.MCPServeConfig) (agent.ToolLimits, map[string]agent.ToolLimits) {
+	def := agent.LimitsFromConfig(c.Default(), agent.ToolLimits{})
+	byName := make(map[string]agent.ToolLimits, len(c.Tools))
+	for name := range c.Tools {
+		byName[name] = agent.LimitsFromConfig(c.LimitsFor(name), agent.ToolLimits{})
+	}
+	return def, byName
+}
+
 // main dispatches on the first CLI arg. The goal here is approachability:
 // a few clear subcommands that we can evolve into a fuller CLI later.
 func main() {
@@ -121,52 +496,235 @@ func main() {
 		os.Exit(1)
 	}
 
+	level := slog.LevelWarn
+	if globalFlags.logLevel != "" {
+		if level, err = logging.ParseLevel(globalFlags.logLevel); err != nil {
+			fmt.Fprintf(os.Stderr, "flag parsing error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	var logger *slog.Logger
+	logger, logLevel = logging.New(os.Stderr, level)
+
 	switch remainingArgs[0] {
 	case "version":
 		// Prints version string (optionally includes commit/date via -ldflags).
 		fmt.Println(version.String())
 	case "mcp":
-		// Minimal stdio JSON loop. Initially only supports a ping method.
+		// JSON-RPC 2.0 over newline-delimited stdio (MCP transport).
 		if len(remainingArgs) >= 2 && remainingArgs[1] == "serve" {
-			ctx := context.Background()
+			serveFlags := flag.NewFlagSet("mcp serve", flag.ContinueOnError)
+			httpAddr := serveFlags.String("http", "", "Serve MCP over streamable HTTP on this address (e.g. :8080, on loopback; other hosts need an auth token) instead of stdio")
+			allowOrigins := serveFlags.String("allow-origins", "", "Comma-separated origins besides loopback ones whose web pages may use --http (e.g. https://app.example.com)")
+			listenSpec := serveFlags.String("listen", "", "Accept connections on unix:///path or tcp://host:port instead of stdio (other than loopback hosts need an auth token)")
+			framingName := serveFlags.String("framing", "auto", "Stream framing: auto, ndjson or lsp (Content-Length headers)")
+			authToken := serveFlags.String("auth-token", "", "Bearer token required from clients of --http/--listen (default $"+mcp.AuthTokenEnv+")")
+			authTokenFile := serveFlags.String("auth-token-file", "", "Read the bearer token for --http/--listen from this file")
+			allowUnsandboxed := serveFlags.Bool("allow-unsandboxed-shell", false, "Let the shell tool run commands without a sandbox (under danger-full-access, or where the host cannot sandbox)")
+			if err := serveFlags.Parse(remainingArgs[2:]); err != nil {
+				os.Exit(2)
+			}
+			framing, err := mcp.ParseFraming(*framingName)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "flag parsing error: %v\n", err)
+				os.Exit(2)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
 			// Apply timeout if specified
 			if globalFlags.timeout > 0 {
 				var cancel context.CancelFunc
 				ctx, cancel = context.WithTimeout(ctx, globalFlags.timeout)
 				defer cancel()
 			}
-			if err := mcp.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+			cfg := loadConfig(logger, globalFlags)
+			trusted := enforceTrust(&cfg.Config, globalFlags, logger)
+			agentCfg := agentConfig(&cfg.Config, logger)
+			agentCfg.Trusted = trusted
+			if agentCfg.OutputSchema, err = readOutputSchema(globalFlags.outputSchema); err != nil {
+				fmt.Fprintf(os.Stderr, "mcp serve error: %v\n", err)
+				os.Exit(2)
+			}
+			conns := connectMCPServers(ctx, cfg.MCPServers, logger)
+			defer conns.Close()
+			agentCfg.Tools = toolRegistry(conns, logger)
+			limits, limitsByName := mcpServeToolLimits(cfg.MCPServe)
+			mcpOpts := mcp.Options{
+				MaxFrameSize:     globalFlags.maxFrameSize,
+				Framing:          framing,
+				Logger:           logger,
+				Agent:            agentCfg,
+				ToolLimits:       limits,
+				ToolLimitsByName: limitsByName,
+				Config:           cfg,
+			}
+			mcpOpts.AllowUnsandboxedShell = *allowUnsandboxed
+			for _, o := range strings.Split(*allowOrigins, ",") {
+				if o = strings.TrimSpace(o); o != "" {
+					mcpOpts.AllowedOrigins = append(mcpOpts.AllowedOrigins, o)
+				}
+			}
+			if *httpAddr != "" || *listenSpec != "" {
+				// Only networked transports authenticate; stdio is trusted.
+				mcpOpts.AuthToken, err = mcp.ResolveAuthToken(*authToken, *authTokenFile)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "mcp serve error: %v\n", err)
+					os.Exit(2)
+				}
+				if mcpOpts.AuthToken == "" {
+					logger.Warn("mcp: no bearer token configured; any client that can reach the listener has full access")
+				}
+			}
+			srv := mcp.NewServer(mcpOpts)
+			reloader := &configReloader{flags: globalFlags, logger: logger, srv: srv, cfg: cfg, conns: conns}
+			go reloader.watch(ctx)
+			if *httpAddr != "" {
+				fmt.Fprintf(os.Stderr, "mcp: serving streamable HTTP on %s/mcp\n", mcp.HTTPAddr(*httpAddr))
+				err := srv.ListenHTTP(ctx, *httpAddr)
+				if err != nil && ctx.Err() == nil {
+					fmt.Fprintf(os.Stderr, "mcp serve error: %v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+			if *listenSpec != "" {
+				serveListener(ctx, *listenSpec, srv.Serve, "mcp serve", mcpOpts.AuthToken != "")
+				return
+			}
+			// Cancellation (Ctrl-C, --timeout) is a normal way to stop serving.
+			if err := srv.Serve(ctx, os.Stdin, os.Stdout); err != nil && ctx.Err() == nil {
 				// Errors go to stderr and a non‑zero exit code.
 				fmt.Fprintf(os.Stderr, "mcp serve error: %v\n", err)
 				os.Exit(1)
 			}
 			return
 		}
-		fmt.Println("usage: codex mcp serve")
+		if len(remainingArgs) >= 2 {
+			switch remainingArgs[1] {
+			case "add":
+				os.Exit(mcpAdd(remainingArgs[2:], globalFlags.timeout))
+			case "list":
+				os.Exit(mcpList(remainingArgs[2:]))
+			case "remove":
+				os.Exit(mcpRemove(remainingArgs[2:]))
+			}
+		}
+		fmt.Println("usage: codex mcp serve [--http <addr> | --listen <unix://path|tcp://addr>] [--framing auto|ndjson|lsp] [--auth-token <tok> | --auth-token-file <path>] [--allow-origins <origins>] [--allow-unsandboxed-shell]")
+		fmt.Println("       codex mcp add [--env KEY=VALUE]... [--url <url>] [--no-validate] <name> [-- <command...>]")
+		fmt.Println("       codex mcp list")
+		fmt.Println("       codex mcp remove <name>")
 		os.Exit(2)
-	case "serve":
+	case "serve", "resume":
 		// Headless protocol v1 minimal loop (Phase 1):
 		// Reads newline-delimited Submissions from stdin and writes Events to stdout.
-		ctx := context.Background()
+		// resume serves stdio only, starting with a recorded session.
+		serveFlags := flag.NewFlagSet("serve", flag.ContinueOnError)
+		listenSpec := serveFlags.String("listen", "", "Accept connections on unix:///path or tcp://host:port (loopback hosts only) instead of stdio")
+		resumePath, forkAt := "", ""
+		if remainingArgs[0] == "resume" {
+			path, turn, code, ok := resumeTarget(remainingArgs[1:])
+			if !ok {
+				os.Exit(code)
+			}
+			resumePath, forkAt = path, turn
+		} else if err := serveFlags.Parse(remainingArgs[1:]); err != nil {
+			os.Exit(2)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 		if globalFlags.timeout > 0 {
 			var cancel context.CancelFunc
 			ctx, cancel = context.WithTimeout(ctx, globalFlags.timeout)
 			defer cancel()
 		}
-		if err := agent.Serve(ctx, os.Stdin, os.Stdout); err != nil {
+		cfg := loadConfig(logger, globalFlags)
+		trusted := enforceTrust(&cfg.Config, globalFlags, logger)
+		agentCfg := agentConfig(&cfg.Config, logger)
+		agentCfg.Trusted = trusted
+		schema, err := readOutputSchema(globalFlags.outputSchema)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "serve error: %v\n", err)
+			os.Exit(2)
+		}
+		agentCfg.OutputSchema = schema
+		tools, closeTools := loadAgentTools(ctx, &cfg.Config, logger)
+		defer closeTools()
+		agentCfg.Tools = tools
+		agentOpts := agent.ServeOptions{MaxFrameSize: globalFlags.maxFrameSize, Agent: agentCfg, Resume: resumePath, ForkAt: forkAt}
+		serveConn := func(ctx context.Context, r io.Reader, w io.Writer) error {
+			return agent.ServeWithOptions(ctx, r, w, agentOpts)
+		}
+		if *listenSpec != "" {
+			// The agent protocol has no authentication.
+			serveListener(ctx, *listenSpec, serveConn, "serve", false)
+			return
+		}
+		if err := serveConn(ctx, os.Stdin, os.Stdout); err != nil && ctx.Err() == nil {
 			fmt.Fprintf(os.Stderr, "serve error: %v\n", err)
 			os.Exit(1)
 		}
 		return
+	case "apply":
+		// Applies a patch in the agent's apply_patch format to the cwd.
+		os.Exit(apply(remainingArgs[1:]))
+	case "diff":
+		// Shows what the last turn of a recorded session changed.
+		os.Exit(diffCmd(remainingArgs[1:]))
+	case "undo":
+		// Reverts the files changed by the latest agent turn.
+		os.Exit(undoCmd(remainingArgs[1:]))
+	case "config":
+		// Reads and edits the user config file.
+		os.Exit(configCmd(remainingArgs[1:]))
+	case "login":
+		// Saves credentials to auth.json.
+		os.Exit(loginCmd(remainingArgs[1:], globalFlags.timeout, loadConfig(logger, globalFlags).CLIAuthCredentialsStore))
+	case "logout":
+		os.Exit(logoutCmd(remainingArgs[1:], loadConfig(logger, globalFlags).CLIAuthCredentialsStore))
+	case "sessions":
+		// Inspects recorded sessions.
+		os.Exit(sessionsCmd(remainingArgs[1:], prices(&loadConfig(logger, globalFlags).Config)))
+	case "review":
+		// One review turn over the working tree, a commit range or files.
+		cfg := loadConfig(logger, globalFlags)
+		trusted := enforceTrust(&cfg.Config, globalFlags, logger)
+		agentCfg := agentConfig(&cfg.Config, logger)
+		agentCfg.Trusted = trusted
+		os.Exit(review(remainingArgs[1:], globalFlags.timeout, agentCfg))
+	case "generate-schema":
+		// JSON Schema for Submission/Event frames, for non-Go clients.
+		// Also run by `go generate ./internal/protocol/schema`.
+		schemaFlags := flag.NewFlagSet("generate-schema", flag.ContinueOnError)
+		out := schemaFlags.String("o", "", "Write the schema to this file instead of stdout")
+		if err := schemaFlags.Parse(remainingArgs[1:]); err != nil {
+			os.Exit(2)
+		}
+		b, err := schema.JSON()
+		if err == nil {
+			if *out == "" {
+				_, err = os.Stdout.Write(b)
+			} else {
+				err = os.WriteFile(*out, b, 0o644)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "generate-schema error: %v\n", err)
+			os.Exit(1)
+		}
 	case "run":
-		// Minimal event-streaming runner: codex run -- <cmd...>
-		// Example: codex run -- echo hello
-		argv := remainingArgs[1:]
-		if len(argv) > 0 && argv[0] == "--" {
-			argv = argv[1:]
+		// Minimal event-streaming runner: codex run [--pty] [--stdin] [--in-container image] -- <cmd...>
+		// Example: cat data | codex run --stdin -- sort
+		runFlags := flag.NewFlagSet("run", flag.ContinueOnError)
+		pty := runFlags.Bool("pty", false, "Run the command on a pseudo-terminal")
+		stdin := runFlags.Bool("stdin", false, "Forward our stdin to the command")
+		image := runFlags.String("in-container", "", "Run the command in a container of this image (docker or podman), with the current directory mounted")
+		if err := runFlags.Parse(remainingArgs[1:]); err != nil {
+			os.Exit(2)
 		}
+		argv := runFlags.Args()
 		if len(argv) == 0 {
-			fmt.Println("usage: codex run -- <cmd...>")
+			fmt.Println("usage: codex run [--pty] [--stdin] [--in-container image] -- <cmd...>")
 			os.Exit(2)
 		}
 
@@ -181,13 +739,24 @@ func main() {
 			defer timeoutCancel()
 		}
 
-		runner := iexec.NewLocalRunner()
+		var runner iexec.Runner = iexec.NewLocalRunner()
+		if *image != "" {
+			runner = iexec.NewContainerRunner(*image)
+		}
 		
 		// Prepare options with environment variables
 		opts := iexec.Options{}
 		if len(globalFlags.env) > 0 {
 			opts.Env = append(os.Environ(), globalFlags.env...)
 		}
+		if *pty {
+			// Sized like our terminal, if there is one.
+			opts.Pty = true
+			opts.Rows, opts.Cols, _ = iexec.TermSize(os.Stdout)
+		}
+		if *stdin {
+			opts.Stdin = os.Stdin
+		}
 		
 		events, cancel, err := runner.Start(ctx, argv, opts)
 		if err != nil {
@@ -199,14 +768,28 @@ func main() {
 		// Stream events to the terminal.
 		for ev := range events {
 			switch ev.Type {
-			case iexec.EventStdout:
-				// Write stdout chunks as-is to stdout.
-				fmt.Print(ev.Data)
+			case iexec.EventStdout, iexec.EventPty:
+				// Write stdout (or terminal) chunks as-is to stdout.
+				os.Stdout.Write(ev.Data)
 			case iexec.EventStderr:
 				// Write stderr chunks as-is to stderr.
-				fmt.Fprint(os.Stderr, ev.Data)
+				os.Stderr.Write(ev.Data)
 			case iexec.EventExit:
-				fmt.Fprintf(os.Stderr, "\n[exit %d]\n", ev.Code)
+				how := ""
+				if ev.LimitExceeded != "" {
+					how = fmt.Sprintf(", %s limit exceeded", ev.LimitExceeded)
+				} else if ev.TimedOut {
+					how = ", timed out"
+				} else if ev.Killed {
+					how = ", killed"
+				} else if ev.Stopped {
+					how = ", stopped"
+				}
+				status := fmt.Sprintf("exit %d", ev.Code)
+				if ev.Signal != "" {
+					status = ev.Signal
+				}
+				fmt.Fprintf(os.Stderr, "\n[%s%s after %s]\n", status, how, ev.Duration.Round(time.Millisecond))
 			}
 		}
 		os.Exit(0)
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"codex-go/internal/agent"
+	"codex-go/internal/config"
+)
+
+// mcpAdd implements `codex mcp add [flags] <name> [-- <command...>]`. The
+// server is launched and handshaken once before the config file is touched,
+// so a typo does not leave a broken entry behind.
+func mcpAdd(args []string, timeout time.Duration) int {
+	fs := flag.NewFlagSet("mcp add", flag.ContinueOnError)
+	var envFlags arrayFlags
+	fs.Var(&envFlags, "env", "Environment variable for the server process (KEY=VALUE, repeatable)")
+	url := fs.String("url", "", "Streamable HTTP endpoint instead of a command")
+	bearerEnv := fs.String("bearer-token-env-var", "", "Environment variable holding the bearer token for --url")
+	startup := fs.Int("startup-timeout-sec", 0, "Seconds allowed for launch plus handshake (default 10)")
+	noValidate := fs.Bool("no-validate", false, "Write the entry without launching the server first")
+
+	// Everything after "--" is the server command line.
+	var command []string
+	for i, a := range args {
+		if a == "--" {
+			command = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+	// Accept flags before and after the name.
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: codex mcp add [--env KEY=VALUE]... [--url <url> [--bearer-token-env-var VAR]] [--no-validate] <name> [-- <command...>]")
+		return 2
+	}
+	name := positional[0]
+
+	server := config.MCPServerConfig{
+		URL:               *url,
+		BearerTokenEnvVar: *bearerEnv,
+		StartupTimeoutSec: *startup,
+	}
+	if len(command) > 0 {
+		server.Command = command[0]
+		server.Args = command[1:]
+	}
+	for _, kv := range envFlags {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			fmt.Fprintf(os.Stderr, "mcp add error: invalid --env %q, expected KEY=VALUE\n", kv)
+			return 2
+		}
+		if server.Env == nil {
+			server.Env = map[string]string{}
+		}
+		server.Env[k] = v
+	}
+	if err := server.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "mcp add error: %v\n", err)
+		return 2
+	}
+
+	if !*noValidate {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		info, tools, err := agent.ProbeMCPServer(ctx, server)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mcp add error: server %q failed validation: %v\n", name, err)
+			fmt.Fprintln(os.Stderr, "(use --no-validate to add it anyway)")
+			return 1
+		}
+		fmt.Printf("Connected to %s %s (%d tools)\n", info.ServerInfo.Name, info.ServerInfo.Version, len(tools))
+	}
+
+	path, err := config.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mcp add error: %v\n", err)
+		return 1
+	}
+	if err := config.SetMCPServer(path, name, server); err != nil {
+		fmt.Fprintf(os.Stderr, "mcp add error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Added MCP server %q to %s\n", name, path)
+	return 0
+}
+
+// mcpList implements `codex mcp list`.
+func mcpList(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: codex mcp list")
+		return 2
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mcp list error: %v\n", err)
+		return 1
+	}
+	if len(cfg.MCPServers) == 0 {
+		fmt.Println("No MCP servers configured. Add one with `codex mcp add <name> -- <command...>`.")
+		return 0
+	}
+	names := make([]string, 0, len(cfg.MCPServers))
+	for name := range cfg.MCPServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTRANSPORT\tTARGET")
+	for _, name := range names {
+		s := cfg.MCPServers[name]
+		if s.URL != "" {
+			fmt.Fprintf(tw, "%s\thttp\t%s\n", name, s.URL)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\tstdio\t%s\n", name, strings.Join(append([]string{s.Command}, s.Args...), " "))
+	}
+	tw.Flush()
+	return 0
+}
+
+// mcpRemove implements `codex mcp remove <name>`.
+func mcpRemove(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: codex mcp remove <name>")
+		return 2
+	}
+	path, err := config.DefaultPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mcp remove error: %v\n", err)
+		return 1
+	}
+	removed, err := config.RemoveMCPServer(path, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mcp remove error: %v\n", err)
+		return 1
+	}
+	if !removed {
+		fmt.Fprintf(os.Stderr, "mcp remove error: no MCP server named %q\n", args[0])
+		return 1
+	}
+	fmt.Printf("Removed MCP server %q from %s\n", args[0], path)
+	return 0
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"codex-go/internal/config"
+	"codex-go/internal/model"
+)
+
+// ossProvider is the provider --oss switches to.
+const ossProvider = "ollama"
+
+// setupOSS points cfg at the local Ollama server for --oss: it checks that
+// the server answers and that the model is installed, pulling it first
+// when pull is set. Without a configured model the provider's default is
+// used if installed, else the first installed model. Download progress
+// goes to stderr.
+func setupOSS(ctx context.Context, cfg *config.Config, pull bool, logger *slog.Logger) error {
+	cfg.ModelProvider = ossProvider
+	p, err := modelProvider(cfg)
+	if err != nil {
+		return err
+	}
+	o := model.Ollama{BaseURL: strings.TrimSuffix(strings.TrimRight(p.BaseURL, "/"), "/v1")}
+	detectCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	installed, err := o.Models(detectCtx)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("no Ollama server at %s (start one with `ollama serve`): %v", o.BaseURL, err)
+	}
+	logger.Info("ollama server found", "url", o.BaseURL, "models", installed)
+
+	name := cfg.Model
+	switch {
+	case name != "":
+	case model.HasOllamaModel(installed, p.Model("")) || pull || len(installed) == 0:
+		name = p.Model("")
+	default:
+		name = installed[0]
+		logger.Info("default model not installed; using an installed one", "default", p.Model(""), "model", name)
+	}
+	if !model.HasOllamaModel(installed, name) {
+		if !pull {
+			have := "none"
+			if len(installed) > 0 {
+				have = strings.Join(installed, ", ")
+			}
+			return fmt.Errorf("model %s is not installed in Ollama (installed: %s); pull it with --oss-pull or `ollama pull %s`", name, have, name)
+		}
+		fmt.Fprintf(os.Stderr, "pulling %s from the Ollama library...\n", name)
+		counting := false // a percentage is on the current line
+		err := o.Pull(ctx, name, func(pr model.OllamaProgress) {
+			if pr.Total > 0 {
+				fmt.Fprintf(os.Stderr, "\r%s %d%%", pr.Status, pr.Completed*100/pr.Total)
+				counting = true
+				return
+			}
+			if counting {
+				fmt.Fprintln(os.Stderr)
+				counting = false
+			}
+			fmt.Fprintln(os.Stderr, pr.Status)
+		})
+		if counting {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	cfg.Model = name
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"codex-go/internal/agent"
+	"codex-go/internal/config"
+	"codex-go/internal/server/mcp"
+)
+
+// configPollInterval is how often a server checks its config files for
+// changes.
+const configPollInterval = 2 * time.Second
+
+// configReloader applies edits of the config files to a running
+// `codex mcp serve` without a restart. Only settings that are safe to swap
+// mid-session change: log_level, notify and mcp_servers. Clients are told
+// what changed, and that anything else needs a restart, with a
+// background_event.
+type configReloader struct {
+	flags  GlobalFlags
+	logger *slog.Logger
+	srv    *mcp.Server
+	// cfg is the config last applied; conns are the connections to its
+	// mcp_servers.
+	cfg   *config.EffectiveConfig
+	conns *agent.MCPConnections
+}
+
+// watch reloads the config each time its files change, until ctx ends.
+func (r *configReloader) watch(ctx context.Context) {
+	opts := loadOptions(r.flags)
+	// Compare later loads with a fresh one: loadConfig adjusts what it
+	// returns (e.g. for --oss), which must not read as edits.
+	if cfg, err := config.LoadEffective(opts); err == nil {
+		r.cfg = cfg
+	}
+	config.Watch(ctx, opts, configPollInterval, func(cfg *config.EffectiveConfig, err error) {
+		if err != nil {
+			r.logger.Warn("config not reloaded", "error", err)
+			return
+		}
+		r.apply(ctx, cfg)
+	})
+}
+
+// apply switches to next, reporting what changed.
+func (r *configReloader) apply(ctx context.Context, next *config.EffectiveConfig) {
+	prev := r.cfg
+	r.cfg = next
+	var changes []string
+	var updates []func(*agent.Config)
+
+	if next.LogLevel != prev.LogLevel {
+		if r.flags.logLevel != "" {
+			changes = append(changes, "log_level changed but --log-level overrides it")
+		} else {
+			applyLogLevel(&next.Config, r.flags)
+			changes = append(changes, "log_level is now "+strings.ToLower(logLevel.Level().String()))
+		}
+	}
+
+	if !reflect.DeepEqual(next.Notify, prev.Notify) {
+		notify := next.Notify
+		updates = append(updates, func(c *agent.Config) { c.Notify = notify })
+		if len(notify) == 0 {
+			changes = append(changes, "notify is off")
+		} else {
+			changes = append(changes, "notify runs "+strings.Join(notify, " "))
+		}
+	}
+
+	if change := r.reconnect(ctx, prev.MCPServers, next.MCPServers); change != "" {
+		tools := toolRegistry(r.conns, r.logger)
+		updates = append(updates, func(c *agent.Config) { c.Tools = tools })
+		changes = append(changes, change)
+	}
+
+	a, b := prev.Config, next.Config
+	for _, c := range []*config.Config{&a, &b} {
+		c.LogLevel, c.Notify, c.MCPServers, c.Unknown = "", nil, nil, nil
+	}
+	if !reflect.DeepEqual(a, b) {
+		changes = append(changes, "other changes take effect after a restart")
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	message := "config reloaded: " + strings.Join(changes, "; ")
+	r.logger.Info(message)
+	r.srv.Reconfigure(ctx, func(c *agent.Config) {
+		for _, update := range updates {
+			update(c)
+		}
+	}, message)
+}
+
+// reconnect brings r.conns in line with next: servers that were removed or
+// whose settings changed are disconnected, new and changed ones connected.
+// It describes what it did, or returns "" when the lists are the same.
+func (r *configReloader) reconnect(ctx context.Context, prev, next map[string]config.MCPServerConfig) string {
+	var added, removed, restarted []string
+	for name, s := range next {
+		if old, ok := prev[name]; !ok {
+			added = append(added, name)
+		} else if !reflect.DeepEqual(old, s) {
+			restarted = append(restarted, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := next[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	if len(added)+len(removed)+len(restarted) == 0 {
+		return ""
+	}
+
+	servers := map[string]config.MCPServerConfig{}
+	for _, name := range append(removed, restarted...) {
+		r.conns.Disconnect(name)
+	}
+	for _, name := range append(added, restarted...) {
+		servers[name] = next[name]
+	}
+	r.conns.Merge(connectMCPServers(ctx, servers, r.logger))
+
+	connected := map[string]bool{}
+	for _, name := range r.conns.Servers() {
+		connected[name] = true
+	}
+	var parts, failed []string
+	for _, l := range []struct {
+		verb  string
+		names []string
+	}{{"added", added}, {"removed", removed}, {"restarted", restarted}} {
+		var names []string
+		for _, name := range l.names {
+			if l.verb != "removed" && !connected[name] {
+				failed = append(failed, name)
+				continue
+			}
+			names = append(names, name)
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			parts = append(parts, l.verb+" "+strings.Join(names, ", "))
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		parts = append(parts, "could not connect "+strings.Join(failed, ", "))
+	}
+	return "mcp_servers: " + strings.Join(parts, " and ")
+}
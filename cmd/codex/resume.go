@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"codex-go/internal/rollout"
+)
+
+// resumeTarget parses `codex resume [--fork-at <turn-id>] [--last |
+// <session-id>]` and returns the rollout file of the session to continue
+// and the turn to fork it at, if any. ok is false after an error has been
+// printed; code is then the exit code.
+func resumeTarget(args []string) (path, forkAt string, code int, ok bool) {
+	fs := flag.NewFlagSet("resume", flag.ContinueOnError)
+	last := fs.Bool("last", false, "Continue the most recently recorded session")
+	fs.StringVar(&forkAt, "fork-at", "", "Continue a new session forked from the recorded one at this turn (e.g. turn-2)")
+	if err := fs.Parse(args); err != nil {
+		return "", "", 2, false
+	}
+	if (fs.NArg() == 1) == *last || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: codex resume [--fork-at <turn-id>] [--last | <session-id>]")
+		return "", "", 2, false
+	}
+	dir, err := rollout.DefaultDir()
+	if err == nil {
+		if *last {
+			path, err = rollout.Latest(dir)
+		} else {
+			path, err = rollout.Find(dir, fs.Arg(0))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resume error: %v\n", err)
+		return "", "", 1, false
+	}
+	return path, forkAt, 0, true
+}
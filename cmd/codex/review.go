@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"codex-go/internal/agent"
+	"codex-go/internal/protocol"
+)
+
+// review implements `codex review [--base <rev> | --range <a..b>] [paths...]`:
+// it runs one review_request turn in-process and prints the findings as
+// path:line lines. The exit code is 1 when the review could not run.
+func review(args []string, timeout time.Duration, cfg agent.Config) int {
+	fs := flag.NewFlagSet("review", flag.ContinueOnError)
+	base := fs.String("base", "", "Review uncommitted changes against this revision (default HEAD)")
+	rng := fs.String("range", "", "Review a commit range instead, e.g. main..HEAD")
+	instructions := fs.String("instructions", "", "Extra focus for the reviewer")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	op := protocol.ReviewRequestOp{Instructions: *instructions}
+	switch {
+	case *rng != "" && (*base != "" || fs.NArg() > 0):
+		fmt.Fprintln(os.Stderr, "review: --range cannot be combined with --base or paths")
+		return 2
+	case *rng != "":
+		op.Target = protocol.ReviewTarget{Type: protocol.ReviewTargetCommits, Range: *rng}
+	case fs.NArg() > 0:
+		if *base != "" {
+			fmt.Fprintln(os.Stderr, "review: --base cannot be combined with paths")
+			return 2
+		}
+		op.Target = protocol.ReviewTarget{Type: protocol.ReviewTargetPaths, Paths: fs.Args()}
+	default:
+		op.Target = protocol.ReviewTarget{Type: protocol.ReviewTargetDiff, Base: *base}
+	}
+	if err := op.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "review error: %v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	failed := false
+	a := agent.New(cfg)
+	// Nothing here can answer an approval request; abort them at once.
+	a.CloseInput()
+	err := a.Submit(ctx, protocol.Submission{ID: "review", Op: op}, func(ev protocol.Event) error {
+		switch msg := ev.Msg.(type) {
+		case protocol.ReviewOutputEvent:
+			printReview(msg)
+		case protocol.ErrorEvent:
+			fmt.Fprintf(os.Stderr, "review error: %s\n", msg.Message)
+			failed = true
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "review error: %v\n", err)
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func printReview(out protocol.ReviewOutputEvent) {
+	for _, f := range out.Findings {
+		loc := f.Path
+		if f.LineStart > 0 {
+			loc = fmt.Sprintf("%s:%d", f.Path, f.LineStart)
+			if f.LineEnd > f.LineStart {
+				loc = fmt.Sprintf("%s-%d", loc, f.LineEnd)
+			}
+		}
+		fmt.Printf("%s: [%s] %s\n", loc, f.Severity, f.Title)
+		if f.Body != "" {
+			fmt.Printf("    %s\n", f.Body)
+		}
+	}
+	fmt.Println(out.Summary)
+}
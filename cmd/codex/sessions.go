@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"codex-go/internal/protocol"
+	"codex-go/internal/rollout"
+	"codex-go/internal/tokens"
+)
+
+// sessionsCmd implements `codex sessions show [--usage] [<session-id>]`:
+// it prints what a recorded session was (the most recent one without a
+// session id) and, with --usage, the tokens it used and their cost per
+// model, priced with the price table of the config file.
+func sessionsCmd(args []string, table map[string]tokens.Price) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "usage: codex sessions show [--usage] [<session-id>]")
+		return 2
+	}
+	fs := flag.NewFlagSet("sessions show", flag.ContinueOnError)
+	usage := fs.Bool("usage", false, "Print the tokens used and their cost per model")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: codex sessions show [--usage] [<session-id>]")
+		return 2
+	}
+	dir, err := rollout.DefaultDir()
+	var path string
+	if err == nil {
+		if fs.NArg() == 1 {
+			path, err = rollout.Find(dir, fs.Arg(0))
+		} else {
+			path, err = rollout.Latest(dir)
+		}
+	}
+	var r *rollout.Rollout
+	if err == nil {
+		r, err = rollout.Load(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sessions error: %v\n", err)
+		return 1
+	}
+
+	turns := map[string]bool{}
+	for _, ev := range r.Events {
+		if _, ok := ev.Msg.(protocol.TaskStartedEvent); ok {
+			turns[ev.TurnID] = true
+		}
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "session:\t%s\n", r.Meta.ID)
+	if r.Meta.ForkedFrom != "" {
+		fmt.Fprintf(w, "forked from:\t%s\n", r.Meta.ForkedFrom)
+	}
+	fmt.Fprintf(w, "started:\t%s\n", r.Meta.Timestamp)
+	fmt.Fprintf(w, "cwd:\t%s\n", r.Meta.Cwd)
+	if r.Meta.Model != "" {
+		fmt.Fprintf(w, "model:\t%s\n", r.Meta.Model)
+	}
+	fmt.Fprintf(w, "turns:\t%d\n", len(turns))
+	fmt.Fprintf(w, "rollout:\t%s\n", r.Path)
+	w.Flush()
+	if !*usage {
+		return 0
+	}
+
+	summary := tokens.Summarize(r.Usage(), table)
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "model\tinput\tcached\toutput\treasoning\ttotal\tcost (USD)")
+	row := func(name string, u protocol.TokenUsage, cost *float64) {
+		c := "?"
+		if cost != nil {
+			c = fmt.Sprintf("%.6f", *cost)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", name, u.InputTokens, u.CachedInputTokens, u.OutputTokens, u.ReasoningOutputTokens, u.TotalTokens, c)
+	}
+	for _, m := range summary.Models {
+		name := m.Model
+		if name == "" {
+			name = "(default)"
+		}
+		row(name, m.Usage, m.CostUSD)
+	}
+	row("total", summary.Total, summary.CostUSD)
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"codex-go/internal/agent"
+	"codex-go/internal/config"
+)
+
+// elevatedSettings lists the settings of cfg that let the agent change the
+// project without asking (see agent.ElevatedSettings).
+func elevatedSettings(cfg *config.Config) []string {
+	return agent.ElevatedSettings(cfg.SandboxMode, cfg.ApprovalPolicy)
+}
+
+// enforceTrust keeps the settings elevatedSettings lists only in a trusted
+// project. --trust trusts the project; otherwise, when the user has not
+// decided on it yet, they are asked on the terminal. The decision is
+// recorded in the user config file under [projects."<root>"]. An untrusted
+// project, or one that could not be asked about, falls back to the
+// defaults.
+//
+// It returns the trust decision for agent.Config.Trusted, so that clients
+// asking for elevated settings later are held to it too: the current
+// project as decided here, others as the config file says.
+func enforceTrust(cfg *config.Config, flags GlobalFlags, logger *slog.Logger) func(dir string) bool {
+	var root, level string
+	if wd, err := os.Getwd(); err == nil {
+		root = config.ProjectRoot(wd)
+		level = cfg.ProjectTrust(root)
+	}
+	recorded := *cfg
+	trusted := func(dir string) bool {
+		if r := config.ProjectRoot(dir); r != root {
+			return recorded.ProjectTrust(r) == config.TrustTrusted
+		}
+		return flags.trust || level == config.TrustTrusted
+	}
+	elevated := elevatedSettings(cfg)
+	if len(elevated) == 0 || root == "" {
+		return trusted
+	}
+	if level != config.TrustTrusted {
+		decided := level
+		if flags.trust {
+			decided = config.TrustTrusted
+		} else if level == "" {
+			decided = askTrust(root, elevated)
+		}
+		if decided != level {
+			level = decided
+			if path, err := config.DefaultPath(); err != nil {
+				logger.Warn("project trust not saved", "error", err)
+			} else if err := config.SetProjectTrust(path, root, level); err != nil {
+				logger.Warn("project trust not saved", "path", path, "error", err)
+			}
+		}
+	}
+	if level == config.TrustTrusted {
+		return trusted
+	}
+	logger.Warn("project is not trusted; using the read-only sandbox and on-request approvals (pass --trust to trust it)", "project", root, "ignored", elevated)
+	cfg.SandboxMode, cfg.ApprovalPolicy = "", ""
+	return trusted
+}
+
+// askTrust asks the user on the terminal whether to trust the project. It
+// returns "" when there is no terminal to ask on.
+func askTrust(root string, elevated []string) string {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return ""
+	}
+	defer tty.Close()
+	fmt.Fprintf(tty, "%s is not a trusted project. The config asks for %s:\n", root, strings.Join(elevated, " and "))
+	fmt.Fprintf(tty, "codex could change files or run commands without asking.\n")
+	fmt.Fprintf(tty, "Trust this project? [y/N] ")
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return config.TrustTrusted
+	}
+	return config.TrustUntrusted
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"codex-go/internal/agent"
+)
+
+// undoCmd implements `codex undo [<session-id>]`: it reverts the files the
+// latest agent turn changed in the git repository containing the cwd (of
+// the given session, else of any session) and prints what it did.
+func undoCmd(args []string) int {
+	if len(args) > 1 || len(args) == 1 && len(args[0]) > 0 && args[0][0] == '-' {
+		fmt.Fprintln(os.Stderr, "usage: codex undo [<session-id>]")
+		return 2
+	}
+	var session string
+	if len(args) == 1 {
+		session = args[0]
+	}
+	cwd, err := os.Getwd()
+	var res agent.UndoResult
+	if err == nil {
+		res, err = agent.UndoLastTurn(context.Background(), cwd, session)
+	}
+	if errors.Is(err, agent.ErrNothingToUndo) {
+		fmt.Fprintln(os.Stderr, "nothing to undo")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "undo error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("undid %s of session %s\n", res.TurnID, res.SessionID)
+	for _, p := range res.Restored {
+		fmt.Printf("restored %s\n", p)
+	}
+	for _, p := range res.Removed {
+		fmt.Printf("removed  %s\n", p)
+	}
+	return 0
+}
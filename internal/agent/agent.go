@@ -1,14 +1,25 @@
 package agent
 
 import (
-    "bufio"
+    "bytes"
     "context"
+    "crypto/rand"
+    "encoding/hex"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
-    "strings"
+    "os"
+    "path/filepath"
+    "sync"
 
+    iexec "codex-go/internal/exec"
+    "codex-go/internal/jsonl"
+    "codex-go/internal/jsonschema"
+    "codex-go/internal/model"
     "codex-go/internal/protocol"
+    "codex-go/internal/rollout"
+    "codex-go/internal/tokens"
 )
 
 // writeJSONLine marshals v to JSON and writes a newline-terminated frame.
@@ -23,65 +34,810 @@ func writeJSONLine(w io.Writer, v any) error {
     return nil
 }
 
-// textFromUserInput extracts concatenated text items from a user_input op.
-func textFromUserInput(op protocol.Op) string {
-    var parts []string
-    for _, it := range op.Items {
-        if strings.ToLower(it.Type) == "text" && it.Text != "" {
-            parts = append(parts, it.Text)
+// Config carries per-conversation settings supplied by the caller (CLI
+// flags, MCP tool arguments). Zero values mean "inherit from the process".
+type Config struct {
+    // Model names the model serving turns. Empty means the default.
+    Model string
+    // Cwd is the working directory the agent operates in.
+    Cwd string
+    // Sandbox confines the commands the model runs. Its Mode names the
+    // sandbox policy ("read-only", "workspace-write", "danger-full-access");
+    // empty means the default. The session cwd is always writable under
+    // workspace-write.
+    Sandbox protocol.SandboxPolicy
+    // Runner runs the commands of the shell tool, confining them to Sandbox
+    // its own way (e.g. a ContainerRunner). Nil means on the host, with its
+    // sandbox.
+    Runner iexec.Runner
+    // ApprovalPolicy says when commands need user approval ("untrusted",
+    // "on-failure", "on-request", "never"). Empty means the default.
+    ApprovalPolicy string
+    // Trusted reports whether the project containing dir is trusted with
+    // elevated settings (see ElevatedSettings). Elsewhere clients cannot
+    // ask for them, and turns run with the defaults instead. Nil trusts
+    // every project.
+    Trusted func(dir string) bool
+    // Instructions are extra user instructions given to the model.
+    Instructions string
+    // ShellEnvironmentPolicy filters the environment of the commands the
+    // model runs. The zero value inherits all but likely secrets.
+    ShellEnvironmentPolicy iexec.EnvPolicy
+    // ReasoningEffort is passed to reasoning models ("minimal", "low",
+    // "medium", "high"). Empty means the model's default.
+    ReasoningEffort string
+    // Verbosity is passed to models taking it ("low", "medium", "high").
+    // Empty means the model's default.
+    Verbosity string
+    // MaxOutputTokens bounds each reply. 0 means the API's default (the
+    // model family's maximum where a bound is required).
+    MaxOutputTokens int64
+    // Client serves turns. nil selects an offline canned backend that
+    // echoes the input.
+    Client model.Client
+    // MaxRetries bounds automatic retries of a failed model request. 0
+    // means none.
+    MaxRetries int
+    // Tools are offered to the model during turns. nil means none.
+    Tools *ToolRegistry
+    // WebSearch lets the model search the web: with the provider's own
+    // search when the client has one, otherwise through WebSearchAPI.
+    // Without either the model cannot search.
+    WebSearch    bool
+    WebSearchAPI *WebSearchAPI
+    // HistoryPath is the cross-session prompt history file used by
+    // add_to_history/get_history. Empty means <codex home>/history.jsonl.
+    HistoryPath string
+    // RolloutDir is where the session is recorded (see package rollout).
+    // Empty means <codex home>/sessions.
+    RolloutDir string
+    // ContextWindow is the model's context size in tokens, reported in
+    // token_count events. 0 means the size package tokens knows for the
+    // turn's model, if any.
+    ContextWindow int64
+    // AutoCompactTokenLimit is the conversation size in tokens at which it
+    // is compacted after a turn. 0 means 90% of the context window; when
+    // neither is known the conversation is only compacted on request.
+    AutoCompactTokenLimit int64
+    // ProjectDocMaxBytes bounds the AGENTS.md content added to the
+    // instructions. 0 means DefaultProjectDocMaxBytes; negative means
+    // AGENTS.md files are not read.
+    ProjectDocMaxBytes int
+    // Notify is a program and its arguments run with a JSON Notification
+    // appended when a turn completes or an approval is requested. Empty
+    // means no notifications.
+    Notify []string
+    // OutputSchema is the JSON Schema final answers must conform to, for
+    // turns that do not bring their own. Empty means free text.
+    OutputSchema json.RawMessage
+    // Prices, by model name prefix, take precedence over the list prices
+    // package tokens knows when usage is priced.
+    Prices map[string]tokens.Price
+}
+
+// EventSink receives events produced while handling a submission. Returning
+// an error aborts the submission.
+type EventSink func(protocol.Event) error
+
+// Agent handles submissions for a single conversation.
+type Agent struct {
+    approvals approvals
+    session   Session
+
+    emitMu sync.Mutex // serializes send
+    seq    uint64
+
+    mu sync.Mutex // guards the fields below
+    // id identifies the session; resume_session and fork_session replace
+    // it before the first turn.
+    id  string
+    cfg Config
+    // history is the size of the conversation so far, in tokens; every
+    // model call re-sends it as input.
+    history int64
+    usage   protocol.TokenUsage
+    // byModel splits usage by the model that was called.
+    byModel map[string]protocol.TokenUsage
+    turns   int
+    // patchesApproved is set once the user answered a patch approval with
+    // approved_for_session; later patches apply without asking.
+    patchesApproved bool
+    // approvedCommands holds the commands (argv joined by NUL) approved
+    // for the session.
+    approvedCommands map[string]bool
+    // escalatedCommands holds the commands approved for the session to
+    // run outside the sandbox after it made them fail.
+    escalatedCommands map[string]bool
+    // execSessions are the programs exec_session keeps running.
+    execSessions execSessions
+    // sandboxWarned is set once the session was told that commands run
+    // unsandboxed.
+    sandboxWarned bool
+    // shutdownHooks persist session state on shutdown; shutDown is set once
+    // they ran.
+    shutdownHooks []func() error
+    shutDown      bool
+    // task is the turn being executed, if any.
+    task *task
+    // projectDocs caches the AGENTS.md content per cwd.
+    projectDocs map[string]projectDoc
+    // rollout records the session once its first turn started;
+    // rolloutStarted is set on the first attempt, successful or not.
+    rollout        *rollout.Recorder
+    rolloutStarted bool
+}
+
+// Defaults reported in session_configured for unset Config fields.
+const (
+    DefaultApprovalPolicy = protocol.ApprovalOnRequest
+    DefaultSandboxMode    = protocol.SandboxReadOnly
+)
+
+// New constructs an Agent with the given configuration.
+func New(cfg Config) *Agent { return &Agent{id: newSessionID(), cfg: cfg} }
+
+// OnShutdown registers f to run when the session is shut down, e.g. to
+// flush and close its persisted transcript.
+func (a *Agent) OnShutdown(f func() error) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.shutdownHooks = append(a.shutdownHooks, f)
+}
+
+// shutdown aborts pending approvals, stops exec sessions, runs the shutdown hooks once and
+// closes the rollout, returning their joined errors.
+func (a *Agent) shutdown() error {
+    a.CloseInput()
+    a.execSessions.closeAll()
+    a.mu.Lock()
+    if a.shutDown {
+        a.mu.Unlock()
+        return nil
+    }
+    a.shutDown = true
+    hooks := a.shutdownHooks
+    a.mu.Unlock()
+    var errs []error
+    for _, f := range hooks {
+        if err := f(); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if err := a.closeRollout(); err != nil {
+        errs = append(errs, err)
+    }
+    return errors.Join(errs...)
+}
+
+// Reconfigure applies update to the session's settings, e.g. those of a
+// config file that changed while the agent runs. Turns already started
+// keep the settings they started with.
+func (a *Agent) Reconfigure(update func(*Config)) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    update(&a.cfg)
+}
+
+// SessionID identifies the conversation. It only changes when
+// resume_session continues a recorded session or fork_session forks one.
+func (a *Agent) SessionID() string {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.id
+}
+
+// Session returns the conversation state of the agent.
+func (a *Agent) Session() *Session { return &a.session }
+
+// resetSession starts a new conversation within the same session: the
+// model no longer sees earlier turns. Settings, approvals granted for the
+// session and cumulative token usage are kept.
+func (a *Agent) resetSession() protocol.SessionResetEvent {
+    n := a.session.Reset()
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.history = 0
+    return protocol.SessionResetEvent{ClearedItems: n}
+}
+
+func newSessionID() string {
+    var b [16]byte
+    _, _ = rand.Read(b[:])
+    return hex.EncodeToString(b[:])
+}
+
+// configure applies the non-empty fields of op and returns the effective
+// settings.
+func (a *Agent) configure(op protocol.ConfigureSessionOp) (protocol.SessionConfiguredEvent, error) {
+    cwd := op.Cwd
+    if cwd != "" {
+        var err error
+        if cwd, err = absDir(cwd); err != nil {
+            return protocol.SessionConfiguredEvent{}, err
+        }
+    }
+
+    a.mu.Lock()
+    next := a.cfg
+    if op.Model != "" {
+        next.Model = op.Model
+    }
+    if cwd != "" {
+        next.Cwd = cwd
+    }
+    if op.ApprovalPolicy != "" {
+        next.ApprovalPolicy = op.ApprovalPolicy
+    }
+    if op.SandboxPolicy != "" {
+        next.Sandbox.Mode = op.SandboxPolicy
+    }
+    if op.Instructions != "" {
+        next.Instructions = op.Instructions
+    }
+    if err := next.Allows(op.SandboxPolicy, op.ApprovalPolicy); err != nil {
+        a.mu.Unlock()
+        return protocol.SessionConfiguredEvent{}, err
+    }
+    a.cfg = next
+
+    cfg, id := a.cfg.withDefaults(), a.id
+    cfg.dropUntrusted()
+    a.mu.Unlock()
+    return protocol.SessionConfiguredEvent{
+        SessionID:      id,
+        Model:          cfg.Model,
+        Cwd:            cfg.Cwd,
+        ApprovalPolicy: cfg.ApprovalPolicy,
+        SandboxPolicy:  cfg.Sandbox.Mode,
+        Instructions:   cfg.Instructions,
+        ProjectDocs:    a.projectDocFor(cfg.Cwd).paths,
+    }, nil
+}
+
+// turnConfig returns the settings for one turn: the session's, with the
+// overrides carried by op applied and defaults filled in. The session
+// itself is left unchanged. A relative cwd override is resolved against
+// the session's cwd.
+func (a *Agent) turnConfig(op protocol.UserInputOp) (Config, error) {
+    cfg := a.sessionConfig()
+    if op.Cwd != "" {
+        dir := op.Cwd
+        if !filepath.IsAbs(dir) {
+            dir = filepath.Join(cfg.Cwd, dir)
+        }
+        dir, err := absDir(dir)
+        if err != nil {
+            return Config{}, err
+        }
+        cfg.Cwd = dir
+    }
+    if op.Model != "" {
+        cfg.Model = op.Model
+    }
+    if op.ReasoningEffort != "" {
+        cfg.ReasoningEffort = op.ReasoningEffort
+    }
+    if op.ApprovalPolicy != "" {
+        cfg.ApprovalPolicy = op.ApprovalPolicy
+    }
+    if op.SandboxPolicy != "" {
+        cfg.Sandbox.Mode = op.SandboxPolicy
+    }
+    if len(op.OutputSchema) > 0 {
+        cfg.OutputSchema = op.OutputSchema
+    }
+    if err := cfg.Allows(op.SandboxPolicy, op.ApprovalPolicy); err != nil {
+        return Config{}, err
+    }
+    // The cwd override can leave the trusted project.
+    cfg.dropUntrusted()
+    return cfg, nil
+}
+
+// sessionConfig returns the session's settings with defaults filled in,
+// and without elevated settings its project is not trusted with.
+func (a *Agent) sessionConfig() Config {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    cfg := a.cfg.withDefaults()
+    cfg.dropUntrusted()
+    return cfg
+}
+
+// taskStarted reports the settings a turn runs with.
+func taskStarted(cfg Config) protocol.TaskStartedEvent {
+    return protocol.TaskStartedEvent{
+        Model:           cfg.Model,
+        ReasoningEffort: cfg.ReasoningEffort,
+        Cwd:             cfg.Cwd,
+        ApprovalPolicy:  cfg.ApprovalPolicy,
+        SandboxPolicy:   cfg.Sandbox.Mode,
+    }
+}
+
+// withDefaults fills unset cwd and policies with the values in effect.
+func (c Config) withDefaults() Config {
+    if c.Cwd == "" {
+        c.Cwd, _ = os.Getwd()
+    }
+    if c.ApprovalPolicy == "" {
+        c.ApprovalPolicy = DefaultApprovalPolicy
+    }
+    if c.Sandbox.Mode == "" {
+        c.Sandbox.Mode = DefaultSandboxMode
+    }
+    return c
+}
+
+// absDir makes dir absolute and checks that it is a directory.
+func absDir(dir string) (string, error) {
+    abs, err := filepath.Abs(dir)
+    if err != nil {
+        return "", err
+    }
+    if fi, err := os.Stat(abs); err != nil || !fi.IsDir() {
+        return "", fmt.Errorf("cwd %s is not a directory", dir)
+    }
+    return abs, nil
+}
+
+// Submit processes one submission and reports resulting events through emit:
+//   - user_input => task_started, then per model request
+//     agent_message_delta..., agent_message, token_count and the events of
+//     the tools it called, then [turn_diff], task_complete
+//   - review_request => task_started, review_output, token_count,
+//     task_complete
+//   - configure_session => session_configured
+//   - reset_session => session_reset (after earlier turns finished)
+//   - compact => task_started, background_event, token_count,
+//     background_event, task_complete
+//   - resume_session => the recorded events, session_resumed
+//   - fork_session => the recorded events up to the fork, session_forked
+//   - patch_approval => (resolves a pending apply_patch_approval_request)
+//   - exec_approval => (resolves a pending exec_approval_request)
+//   - undo_turn => turn_undone (files of the last turn reverted)
+//   - get_usage => get_usage_response
+//   - shutdown => shutdown_complete (after running shutdown hooks)
+//   - interrupt => turn_aborted for the running turn, which ends it in
+//     place of task_complete; error(invalid_request) when none is running
+//
+// Events are stamped with the session's next seq and, for turns
+// (user_input, review_request, compact), with a fresh turn_id.
+func (a *Agent) Submit(ctx context.Context, sub protocol.Submission, emit EventSink) error {
+    switch sub.Op.(type) {
+    case protocol.ResumeSessionOp, protocol.ForkSessionOp:
+        // Replayed events keep their recorded turn ids.
+        return a.resume(sub.ID, sub.Op, func(ev protocol.Event) error { return a.send(emit, ev) })
+    }
+    switch sub.Op.(type) {
+    case protocol.UserInputOp, protocol.ReviewRequestOp, protocol.CompactOp:
+    default:
+        return a.submit(ctx, sub, func(ev protocol.Event) error { return a.send(emit, ev) })
+    }
+    a.mu.Lock()
+    a.turns++
+    turnID := fmt.Sprintf("turn-%d", a.turns)
+    a.mu.Unlock()
+    emitTurn := func(ev protocol.Event) error {
+        ev.TurnID = turnID
+        if done, ok := ev.Msg.(protocol.TaskCompleteEvent); ok {
+            // Every way a turn completes reports the usage so far.
+            summary := a.usageSummary()
+            done.Usage = &summary
+            ev.Msg = done
+        }
+        return a.send(emit, ev)
+    }
+    if err := a.startRollout(); err != nil {
+        msg := protocol.BackgroundEvent{Message: fmt.Sprintf("session is not recorded: %v", err)}
+        if err := emitTurn(protocol.Event{ID: sub.ID, Msg: msg}); err != nil {
+            return err
         }
     }
-    return strings.TrimSpace(strings.Join(parts, " "))
+    return a.runTask(ctx, sub, turnID, emitTurn)
+}
+
+// send stamps ev with the next seq, records it in the rollout and passes
+// it to emit. Holding emitMu across all three keeps seq order equal to
+// delivery and recording order when several goroutines emit for the same
+// session.
+func (a *Agent) send(emit EventSink, ev protocol.Event) error {
+    a.emitMu.Lock()
+    defer a.emitMu.Unlock()
+    a.seq++
+    ev.Seq = a.seq
+    a.recordEvent(ev)
+    return emit(ev)
+}
+
+func (a *Agent) submit(ctx context.Context, sub protocol.Submission, emit EventSink) error {
+    switch op := sub.Op.(type) {
+    case protocol.UserInputOp:
+        // Resolve overrides and attachments first: a bad cwd or a missing
+        // image is the client's mistake and does not start a task.
+        cfg, err := a.turnConfig(op)
+        if err != nil {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "%v", err)})
+        }
+        input, err := userContent(op.Items, cfg.Cwd)
+        if err != nil {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "%v", err)})
+        }
+        var schema *jsonschema.Schema
+        if len(cfg.OutputSchema) > 0 {
+            if schema, err = jsonschema.Compile(cfg.OutputSchema); err != nil {
+                return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "output_schema: %v", err)})
+            }
+        }
+
+        // 1. task_started, echoing the turn's effective settings
+        if err := emit(protocol.Event{ID: sub.ID, Msg: taskStarted(cfg)}); err != nil {
+            return err
+        }
+
+        // Tools called during the turn emit events and report file edits
+        // through ctx.
+        turn := &turnState{agent: a, subID: sub.ID, emit: emit, cfg: cfg, input: input, schema: schema}
+        turn.diff.begin(ctx, cfg.Cwd)
+        // A failed or aborted turn can be undone too.
+        defer a.keepGhost(context.WithoutCancel(ctx), turn)
+        ctx = withTurn(ctx, turn)
+
+        // 2. agent_message, streamed as deltas, and token_count for every
+        // model request; tool calls in between report their own events. A
+        // failed model request ends the turn with an error event.
+        if err := a.runTurn(ctx, turn); err != nil {
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            if err := emit(protocol.Event{ID: sub.ID, Msg: modelErrorEvent(err)}); err != nil {
+                return err
+            }
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.TaskCompleteEvent{}})
+        }
+
+        // 3. turn_diff (only when files changed), compaction of a
+        // conversation grown near the context window, task_complete
+        if d := turn.diff.result(ctx, cfg.Cwd); d != "" {
+            if err := emit(protocol.Event{ID: sub.ID, Msg: protocol.TurnDiffEvent{UnifiedDiff: d}}); err != nil {
+                return err
+            }
+        }
+        if err := a.keepGhost(ctx, turn); err != nil {
+            if err := notifyBackground(ctx, "turn cannot be undone: %v", err); err != nil {
+                return err
+            }
+        }
+        if size, limit := a.compactionDue(cfg.Model); limit > 0 && size >= limit {
+            if err := a.compact(ctx, turn, fmt.Sprintf("conversation is %d tokens, over the limit of %d", size, limit)); err != nil {
+                if ctx.Err() != nil {
+                    return ctx.Err()
+                }
+                if err := notifyBackground(ctx, "compaction failed: %v", err); err != nil {
+                    return err
+                }
+            }
+        }
+        a.notifyTurnComplete(turn)
+        return emit(protocol.Event{ID: sub.ID, Msg: protocol.TaskCompleteEvent{Output: turn.output}})
+
+    case protocol.CompactOp:
+        cfg := a.sessionConfig()
+        if err := emit(protocol.Event{ID: sub.ID, Msg: taskStarted(cfg)}); err != nil {
+            return err
+        }
+        turn := &turnState{agent: a, subID: sub.ID, emit: emit, cfg: cfg}
+        ctx = withTurn(ctx, turn)
+        if err := a.compact(ctx, turn, "requested"); err != nil {
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            if err := emit(protocol.Event{ID: sub.ID, Msg: modelErrorEvent(err)}); err != nil {
+                return err
+            }
+        }
+        return emit(protocol.Event{ID: sub.ID, Msg: protocol.TaskCompleteEvent{}})
+
+    case protocol.ConfigureSessionOp:
+        ev, err := a.configure(op)
+        if err != nil {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "%v", err)})
+        }
+        return emit(protocol.Event{ID: sub.ID, Msg: ev})
+
+    case protocol.PatchApprovalOp:
+        if !a.approvals.resolve(op.CallID, op.Decision) {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "no pending approval for call_id %q", op.CallID)})
+        }
+        return nil
+
+    case protocol.ResetSessionOp:
+        return emit(protocol.Event{ID: sub.ID, Msg: a.resetSession()})
+
+    case protocol.ExecApprovalOp:
+        if !a.approvals.resolve(op.CallID, op.Decision) {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "no pending approval for call_id %q", op.CallID)})
+        }
+        return nil
+
+    case protocol.ShutdownOp:
+        if err := a.shutdown(); err != nil {
+            // Report the failure but still complete: the client asked to stop.
+            if err := emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInternal, "shutdown: %v", err)}); err != nil {
+                return err
+            }
+        }
+        return emit(protocol.Event{ID: sub.ID, Msg: protocol.ShutdownCompleteEvent{}})
+
+    case protocol.GetUsageOp:
+        return emit(protocol.Event{ID: sub.ID, Msg: protocol.GetUsageResponseEvent{UsageSummary: a.usageSummary()}})
+
+    case protocol.ListMcpToolsOp:
+        specs := a.toolSpecs()
+        tools := make([]protocol.ToolInfo, 0, len(specs))
+        for _, spec := range specs {
+            tools = append(tools, protocol.ToolInfo{Name: spec.Name, Description: spec.Description, InputSchema: spec.Parameters})
+        }
+        return emit(protocol.Event{ID: sub.ID, Msg: protocol.McpListToolsResponseEvent{Tools: tools}})
+
+    case protocol.ReviewRequestOp:
+        return a.review(ctx, sub.ID, op, emit)
+
+    case protocol.AddToHistoryOp:
+        if err := a.addToHistory(op.Text); err != nil {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInternal, "add_to_history: %v", err)})
+        }
+        return nil
+
+    case protocol.GetHistoryOp:
+        ev, err := a.getHistory(op)
+        if err != nil {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInternal, "get_history: %v", err)})
+        }
+        return emit(protocol.Event{ID: sub.ID, Msg: ev})
+
+    case protocol.UndoTurnOp:
+        res, err := UndoLastTurn(ctx, a.sessionConfig().Cwd, a.SessionID())
+        if err != nil {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "undo: %v", err)})
+        }
+        return emit(protocol.Event{ID: sub.ID, Msg: protocol.TurnUndoneEvent{TurnID: res.TurnID, Restored: res.Restored, Removed: res.Removed}})
+
+    case protocol.InterruptOp:
+        // The aborted turn reports turn_aborted under its own id.
+        if !a.interrupt() {
+            return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "no running task to interrupt")})
+        }
+        return nil
+
+    default:
+        return emit(protocol.Event{ID: sub.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "unsupported op")})
+    }
+}
+
+// recordUsage accounts for the model request for p, answered by reply,
+// and returns the token_count event reporting it. When the server did not
+// report usage (or there is no server), counts are estimated; the
+// conversation as of the previous request then counts as cached input.
+func (a *Agent) recordUsage(reported *model.Usage, p model.Prompt, reply model.Message) protocol.TokenCountEvent {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    var last protocol.TokenUsage
+    if reported != nil {
+        last = protocol.TokenUsage(*reported)
+    } else {
+        last = protocol.TokenUsage{
+            InputTokens:  tokens.EstimatePrompt(p),
+            OutputTokens: tokens.EstimateMessages([]model.Message{reply}),
+        }
+        last.CachedInputTokens = min(a.history, last.InputTokens)
+        last.TotalTokens = last.InputTokens + last.OutputTokens
+    }
+    a.history = last.TotalTokens
+    a.usage = a.usage.Add(last)
+    if a.byModel == nil {
+        a.byModel = map[string]protocol.TokenUsage{}
+    }
+    a.byModel[p.Model] = a.byModel[p.Model].Add(last)
+    return protocol.TokenCountEvent{Total: a.usage, Last: last, ModelContextWindow: a.contextWindow(p.Model), Model: p.Model}
+}
+
+// usageSummary reports the session's usage so far, per model and priced.
+func (a *Agent) usageSummary() protocol.UsageSummary {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return tokens.Summarize(a.byModel, a.cfg.Prices)
+}
+
+// contextWindow returns the context size of the named model: the
+// configured one, else the one package tokens knows. a.mu must be held.
+func (a *Agent) contextWindow(name string) int64 {
+    if a.cfg.ContextWindow > 0 {
+        return a.cfg.ContextWindow
+    }
+    return tokens.ContextWindow(name)
+}
+
+// ServeOptions tunes the Serve loop. The zero value selects defaults.
+type ServeOptions struct {
+    // MaxFrameSize bounds a single submission line in bytes. <= 0 selects
+    // jsonl.DefaultMaxFrameSize.
+    MaxFrameSize int
+    // Agent is the configuration of the agent serving the connection.
+    Agent Config
+    // Resume is a rollout file whose session the connection continues, as
+    // if the client's first submission were resume_session for it. The
+    // answer carries the submission id "resume".
+    Resume string
+    // ForkAt, with Resume, forks the session at that turn into a new
+    // session instead: the first submission is fork_session.
+    ForkAt string
 }
 
 // Serve implements the Phase 1 minimal protocol loop over a line-delimited
-// JSON stream. For each Submission:
-// - user_input => task_started, agent_message, task_complete
-// - interrupt  => error("interrupted")
+// JSON stream, feeding each Submission to a single Agent.
 func Serve(ctx context.Context, r io.Reader, w io.Writer) error {
-    scanner := bufio.NewScanner(r)
-    for scanner.Scan() {
+    return ServeWithOptions(ctx, r, w, ServeOptions{})
+}
+
+// ServeWithOptions is Serve with explicit transport options.
+func ServeWithOptions(ctx context.Context, r io.Reader, w io.Writer, opts ServeOptions) error {
+    a := New(opts.Agent)
+    var wmu sync.Mutex
+    write := func(v any) error {
+        wmu.Lock()
+        defer wmu.Unlock()
+        return writeJSONLine(w, v)
+    }
+    emit := func(ev protocol.Event) error { return write(ev) }
+
+    // Turns run one at a time, in order, off the read loop so that control
+    // ops (approval decisions, interrupt) are read while a turn is blocked
+    // on them. Each turn waits for the previous one's done channel; user
+    // input that has to wait is announced with user_input_queued.
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    var (
+        errMu   sync.Mutex
+        turnErr error
+        pending int // turns running or waiting to
+    )
+    prev := make(chan struct{})
+    close(prev)
+    runTurn := func(sub protocol.Submission) error {
+        errMu.Lock()
+        ahead := pending
+        pending++
+        errMu.Unlock()
+        if _, ok := sub.Op.(protocol.UserInputOp); ok && ahead > 0 {
+            if err := a.send(emit, protocol.Event{ID: sub.ID, Msg: protocol.UserInputQueuedEvent{Position: ahead}}); err != nil {
+                return err
+            }
+        }
+        wait, done := prev, make(chan struct{})
+        prev = done
+        go func() {
+            defer close(done)
+            defer func() {
+                errMu.Lock()
+                pending--
+                errMu.Unlock()
+            }()
+            select {
+            case <-wait:
+            case <-ctx.Done():
+                return
+            }
+            if ctx.Err() != nil {
+                return
+            }
+            if err := a.Submit(ctx, sub, emit); err != nil {
+                errMu.Lock()
+                if turnErr == nil {
+                    turnErr = err
+                }
+                errMu.Unlock()
+                cancel()
+            }
+        }()
+        return nil
+    }
+    firstErr := func(fallback error) error {
+        errMu.Lock()
+        defer errMu.Unlock()
+        if turnErr != nil {
+            return turnErr
+        }
+        return fallback
+    }
+
+    switch {
+    case opts.Resume != "" && opts.ForkAt != "":
+        _ = runTurn(protocol.Submission{ID: "resume", Op: protocol.ForkSessionOp{Path: opts.Resume, TurnID: opts.ForkAt}})
+    case opts.Resume != "":
+        _ = runTurn(protocol.Submission{ID: "resume", Op: protocol.ResumeSessionOp{Path: opts.Resume}})
+    }
+
+    fr := jsonl.NewReader(r, opts.MaxFrameSize)
+    frames := jsonl.Pump(ctx, fr)
+    for {
+        // Selecting on ctx (rather than checking it between reads) lets
+        // cancellation end the loop while it is waiting for input.
+        var f jsonl.Frame
         select {
         case <-ctx.Done():
-            return ctx.Err()
-        default:
+            return firstErr(ctx.Err())
+        case f = <-frames:
+        }
+        line, err := f.Data, f.Err
+        if errors.Is(err, jsonl.ErrFrameTooLarge) {
+            // The oversized frame was never parsed, so the error cannot be
+            // bound to a submission id. Keep the loop alive.
+            _ = write(map[string]any{"error": "frame too large", "max_bytes": fr.Max()})
+            continue
+        }
+        if err == io.EOF {
+            // Nothing can answer approvals any more; let queued turns finish
+            // and persist the session as an implicit shutdown would.
+            a.CloseInput()
+            <-prev
+            return firstErr(a.shutdown())
+        }
+        if err != nil {
+            return err
+        }
+        if len(bytes.TrimSpace(line)) == 0 {
+            continue
         }
-
-        line := scanner.Bytes()
 
         var sub protocol.Submission
         if err := json.Unmarshal(line, &sub); err != nil {
-            // For invalid JSON, emit a protocol-level error without id binding.
-            // Keep the loop alive for subsequent frames.
-            _ = writeJSONLine(w, map[string]string{"error": "invalid json"})
+            if !json.Valid(line) {
+                // For invalid JSON, emit a protocol-level error without id
+                // binding. Keep the loop alive for subsequent frames.
+                _ = write(map[string]string{"error": "invalid json"})
+                continue
+            }
+            // Well-formed JSON that is not a valid submission (missing op,
+            // failed variant validation) is reported against its id.
+            var head struct {
+                ID string `json:"id"`
+            }
+            _ = json.Unmarshal(line, &head)
+            if err := a.send(emit, protocol.Event{ID: head.ID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "%v", err)}); err != nil {
+                return err
+            }
             continue
         }
 
-        switch sub.Op.Type {
-        case protocol.OpUserInput:
-            // 1. task_started
-            _ = writeJSONLine(w, protocol.Event{ID: sub.ID, Msg: protocol.EventMsg{Type: protocol.EventTaskStarted}})
-
-            // 2. agent_message (minimal – echo or static reply)
-            text := textFromUserInput(sub.Op)
-            reply := "Hi there"
-            if text != "" {
-                reply = fmt.Sprintf("You said: %s", text)
+        if _, ok := sub.Op.(protocol.ShutdownOp); ok {
+            // Earlier turns finish first; nothing after shutdown is read.
+            // Approvals those turns wait on can no longer be answered.
+            a.CloseInput()
+            if err := runTurn(sub); err != nil {
+                return err
             }
-            _ = writeJSONLine(w, protocol.Event{ID: sub.ID, Msg: protocol.EventMsg{Type: protocol.EventAgentMessage, Text: reply}})
-
-            // 3. task_complete
-            _ = writeJSONLine(w, protocol.Event{ID: sub.ID, Msg: protocol.EventMsg{Type: protocol.EventTaskComplete}})
-
-        case protocol.OpInterrupt:
-            // Emit an error for this submission. In later phases, this would
-            // target the currently running task's id.
-            _ = writeJSONLine(w, protocol.Event{ID: sub.ID, Msg: protocol.EventMsg{Type: protocol.EventError, Message: "interrupted"}})
-
-        default:
-            _ = writeJSONLine(w, protocol.Event{ID: sub.ID, Msg: protocol.EventMsg{Type: protocol.EventError, Message: "unsupported op"}})
+            <-prev
+            return firstErr(nil)
+        }
+        if isControlOp(sub.Op) {
+            if err := a.Submit(ctx, sub, emit); err != nil {
+                return err
+            }
+            continue
+        }
+        if err := runTurn(sub); err != nil {
+            return err
         }
     }
-    return scanner.Err()
 }
 
+// isControlOp reports ops that answer or steer a running turn, or only
+// read session state, and must therefore not queue behind it.
+func isControlOp(op protocol.Op) bool {
+    switch op.(type) {
+    case protocol.InterruptOp, protocol.PatchApprovalOp, protocol.ExecApprovalOp, protocol.ListMcpToolsOp, protocol.AddToHistoryOp, protocol.GetHistoryOp, protocol.GetUsageOp:
+        return true
+    }
+    return false
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "codex-go/internal/applypatch"
+    "codex-go/internal/diff"
+    "codex-go/internal/protocol"
+)
+
+// applyPatchSchema is the JSON Schema of the apply_patch arguments.
+const applyPatchSchema = `{
+  "type": "object",
+  "properties": {
+    "input": {"type": "string", "description": "The entire patch, from *** Begin Patch to *** End Patch."}
+  },
+  "required": ["input"],
+  "additionalProperties": false
+}`
+
+const applyPatchDescription = `Edits files with a patch. The patch format is:
+
+*** Begin Patch
+*** Add File: <path>
++<each line of the new file>
+*** Delete File: <path>
+*** Update File: <path>
+*** Move to: <new path>        (optional)
+@@ <a line before the change>  (optional, to locate it)
+ <context line>
+-<removed line>
++<added line>
+*** End Patch
+
+Paths are relative to the working directory. Give about three lines of
+context around each change; several @@ sections may follow one Update File.`
+
+// applyPatchInstructions join the instructions of models whose family is
+// not trained on the patch format (model.Family.ApplyPatchInstructions).
+const applyPatchInstructions = `To edit files, call the apply_patch tool rather than writing files from the shell (no cat <<EOF, sed -i or echo >). Its input is a patch in this format, not a unified diff:
+
+*** Begin Patch
+*** Update File: src/app.py
+@@ def greet():
+-    print("Hi")
++    print("Hello, world!")
+*** Add File: docs/NOTES.md
++First line of the new file
+*** Delete File: old.txt
+*** End Patch
+
+Every file section starts with "*** Add File: ", "*** Update File: " or "*** Delete File: " and a relative path. In an Update File section, lines starting with a space are unchanged context, "-" lines are removed and "+" lines added; an optional "@@ " line names a line above the change (a class or function) to locate it. Lines of an added file all start with "+". Re-read a file before patching it if it may have changed.`
+
+// applyPatchTool edits files with the codex patch format. Patches are
+// shown to the user for approval unless the session's policies allow them
+// (see patchNeedsApproval), and reported as patch_apply_begin/end events.
+type applyPatchTool struct{}
+
+func (applyPatchTool) Spec() ToolSpec {
+    return ToolSpec{Name: "apply_patch", Description: applyPatchDescription, Parameters: json.RawMessage(applyPatchSchema)}
+}
+
+func (applyPatchTool) Call(ctx context.Context, raw json.RawMessage) (ToolResult, error) {
+    var args struct {
+        Input string `json:"input"`
+    }
+    if err := json.Unmarshal(raw, &args); err != nil {
+        return ToolResult{Output: fmt.Sprintf("invalid arguments: %v", err)}, nil
+    }
+    patch, err := applypatch.Parse(args.Input)
+    if err != nil {
+        return ToolResult{Output: err.Error()}, nil
+    }
+
+    turn := turnFrom(ctx)
+    root, _ := os.Getwd()
+    if turn != nil {
+        root = turn.cfg.Cwd
+    }
+    changes, err := applypatch.Plan(root, patch)
+    if err != nil {
+        return ToolResult{Output: fmt.Sprintf("patch does not apply: %v", err)}, nil
+    }
+
+    callID := callIDFrom(ctx)
+    autoApproved := true
+    if turn != nil && turn.agent.patchNeedsApproval(turn.cfg, changes) {
+        autoApproved = false
+        req := protocol.ApplyPatchApprovalRequestEvent{CallID: callID, UnifiedDiff: unifiedPatch(root, changes)}
+        for _, c := range changes {
+            req.Paths = append(req.Paths, relPath(root, c.Path))
+        }
+        decision, err := turn.agent.requestPatchApproval(ctx, turn.subID, req, turn.emit)
+        if err != nil {
+            return ToolResult{}, err
+        }
+        switch decision {
+        case protocol.ReviewApprovedForSession:
+            turn.agent.mu.Lock()
+            turn.agent.patchesApproved = true
+            turn.agent.mu.Unlock()
+        case protocol.ReviewDenied:
+            return ToolResult{Output: "The user rejected this patch. Do not retry it unchanged."}, nil
+        case protocol.ReviewAbort:
+            return ToolResult{Output: "The user aborted. Stop and wait for further instructions."}, nil
+        }
+    }
+
+    begin := protocol.ApplyPatchBeginEvent{CallID: callID, AutoApproved: autoApproved, Changes: fileChanges(root, changes)}
+    if err := emitFromTool(ctx, begin); err != nil {
+        return ToolResult{}, err
+    }
+    for _, c := range changes {
+        TrackFileChange(ctx, c.Path)
+        if c.MovePath != "" {
+            TrackFileChange(ctx, c.MovePath)
+        }
+    }
+    end := protocol.ApplyPatchEndEvent{CallID: callID, Success: true}
+    if err := applypatch.Write(changes); err != nil {
+        end.Stderr, end.Success = err.Error(), false
+    } else {
+        end.Stdout = applypatch.Summary(root, changes)
+    }
+    if err := emitFromTool(ctx, end); err != nil {
+        return ToolResult{}, err
+    }
+    if !end.Success {
+        return ToolResult{Output: "failed to write the patch: " + end.Stderr}, nil
+    }
+    return ToolResult{Output: end.Stdout, Success: true}, nil
+}
+
+// patchNeedsApproval decides whether changes must be confirmed by the
+// user: always under "untrusted", never under "never" or after
+// approved_for_session, and otherwise when the sandbox would not let a
+// command write a file: under read-only, outside the writable roots, or in
+// a protected dotfile such as .git.
+func (a *Agent) patchNeedsApproval(cfg Config, changes []applypatch.Change) bool {
+    a.mu.Lock()
+    approved := a.patchesApproved
+    a.mu.Unlock()
+    switch {
+    case cfg.ApprovalPolicy == protocol.ApprovalNever || approved:
+        return false
+    case cfg.ApprovalPolicy == protocol.ApprovalUntrusted:
+        return true
+    }
+    for _, c := range changes {
+        for _, p := range []string{c.Path, c.MovePath} {
+            if p != "" && !cfg.Sandbox.IsWritable(cfg.Cwd, p) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// fileChanges describes changes for patch_apply_begin, keyed by path
+// relative to root.
+func fileChanges(root string, changes []applypatch.Change) map[string]protocol.FileChange {
+    out := make(map[string]protocol.FileChange, len(changes))
+    for _, c := range changes {
+        name := relPath(root, c.Path)
+        switch c.Kind {
+        case applypatch.KindAdd:
+            out[name] = protocol.FileChange{Type: protocol.FileChangeAdd, Content: c.NewContent}
+        case applypatch.KindDelete:
+            out[name] = protocol.FileChange{Type: protocol.FileChangeDelete}
+        default:
+            fc := protocol.FileChange{Type: protocol.FileChangeUpdate}
+            fc.UnifiedDiff = diff.Unified("a/"+name, "b/"+name, c.OldContent, c.NewContent, diff.DefaultContext)
+            if c.MovePath != "" {
+                fc.MovePath = relPath(root, c.MovePath)
+            }
+            out[name] = fc
+        }
+    }
+    return out
+}
+
+// unifiedPatch renders all changes as one unified diff.
+func unifiedPatch(root string, changes []applypatch.Change) string {
+    var sb strings.Builder
+    for _, c := range changes {
+        from, to := "a/"+relPath(root, c.Path), "b/"+relPath(root, c.Path)
+        switch {
+        case c.Kind == applypatch.KindAdd:
+            from = "/dev/null"
+        case c.Kind == applypatch.KindDelete:
+            to = "/dev/null"
+        case c.MovePath != "":
+            to = "b/" + relPath(root, c.MovePath)
+        }
+        sb.WriteString(diff.Unified(from, to, c.OldContent, c.NewContent, diff.DefaultContext))
+    }
+    return sb.String()
+}
+
+// relPath shows path relative to root when it is inside root, and
+// absolute otherwise.
+func relPath(root, path string) string {
+    if within(root, path) {
+        rel, _ := filepath.Rel(root, path)
+        return filepath.ToSlash(rel)
+    }
+    return path
+}
+
+// within reports whether path lies inside the directory root.
+func within(root, path string) bool {
+    rel, err := filepath.Rel(root, path)
+    return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
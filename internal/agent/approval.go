@@ -0,0 +1,109 @@
+package agent
+
+import (
+    "context"
+    "fmt"
+    "sync"
+
+    "codex-go/internal/protocol"
+)
+
+// approvals tracks approval requests that are waiting for the client's
+// decision, keyed by call_id. Decisions arrive as separate submissions while
+// the requesting turn is blocked, so Serve must keep reading input during a
+// turn (see ServeWithOptions).
+type approvals struct {
+    mu      sync.Mutex
+    pending map[string]chan protocol.ReviewDecision
+    // closed is set once no further input can arrive; requests are then
+    // aborted instead of waiting forever.
+    closed bool
+}
+
+// wait registers callID, runs send (which emits the request event) and blocks
+// until the client decides, ctx ends, or input is closed.
+func (p *approvals) wait(ctx context.Context, callID string, send func() error) (protocol.ReviewDecision, error) {
+    ch := make(chan protocol.ReviewDecision, 1)
+    p.mu.Lock()
+    if p.closed {
+        p.mu.Unlock()
+        return protocol.ReviewAbort, nil
+    }
+    if p.pending == nil {
+        p.pending = map[string]chan protocol.ReviewDecision{}
+    }
+    if _, dup := p.pending[callID]; dup {
+        p.mu.Unlock()
+        return "", fmt.Errorf("approval for call_id %q already pending", callID)
+    }
+    p.pending[callID] = ch
+    p.mu.Unlock()
+    defer func() {
+        p.mu.Lock()
+        delete(p.pending, callID)
+        p.mu.Unlock()
+    }()
+
+    if err := send(); err != nil {
+        return "", err
+    }
+    select {
+    case d := <-ch:
+        return d, nil
+    case <-ctx.Done():
+        return "", ctx.Err()
+    }
+}
+
+// resolve delivers a decision. It reports false when nothing is waiting for
+// callID.
+func (p *approvals) resolve(callID string, d protocol.ReviewDecision) bool {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    ch, ok := p.pending[callID]
+    if !ok {
+        return false
+    }
+    delete(p.pending, callID)
+    ch <- d
+    return true
+}
+
+// close aborts every pending request and makes future ones abort at once.
+func (p *approvals) close() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.closed = true
+    for id, ch := range p.pending {
+        ch <- protocol.ReviewAbort
+        delete(p.pending, id)
+    }
+}
+
+// requestPatchApproval asks the client whether the patch described by req
+// may be applied, emitting apply_patch_approval_request bound to subID.
+func (a *Agent) requestPatchApproval(ctx context.Context, subID string, req protocol.ApplyPatchApprovalRequestEvent, emit EventSink) (protocol.ReviewDecision, error) {
+    return a.approvals.wait(ctx, req.CallID, func() error {
+        if err := emit(protocol.Event{ID: subID, Msg: req}); err != nil {
+            return err
+        }
+        a.notifyApproval(req)
+        return nil
+    })
+}
+
+// requestExecApproval asks the client whether the command described by req
+// may run, emitting exec_approval_request bound to subID.
+func (a *Agent) requestExecApproval(ctx context.Context, subID string, req protocol.ExecApprovalRequestEvent, emit EventSink) (protocol.ReviewDecision, error) {
+    return a.approvals.wait(ctx, req.CallID, func() error {
+        if err := emit(protocol.Event{ID: subID, Msg: req}); err != nil {
+            return err
+        }
+        a.notifyApproval(req)
+        return nil
+    })
+}
+
+// CloseInput tells the agent that no more submissions will arrive, so
+// pending and future approval requests are answered with "abort".
+func (a *Agent) CloseInput() { a.approvals.close() }
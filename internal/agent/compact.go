@@ -0,0 +1,115 @@
+package agent
+
+import (
+    "context"
+    "strings"
+
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+    "codex-go/internal/tokens"
+)
+
+// compactPrompt asks the model for the summary that replaces earlier turns.
+const compactPrompt = "Summarize the conversation so far for your own later use: the user's goals, decisions made, files and commands involved, what is done and what remains. Be concise; the summary replaces the conversation."
+
+// summaryPrefix introduces the summary item in the compacted conversation.
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// compactionDue returns the conversation size in tokens, as of the last
+// model request, and the size at which it is compacted when served by the
+// named model (0 for never).
+func (a *Agent) compactionDue(name string) (size, limit int64) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.history, tokens.CompactLimit(a.contextWindow(name), a.cfg.AutoCompactTokenLimit)
+}
+
+// compact replaces the turns before the latest one with a summary written
+// by the model, reporting progress as background_event and the request as
+// token_count. A conversation of a single turn (after any earlier summary)
+// is summarized whole. The compaction is recorded in the rollout so a
+// resumed session continues from the summary.
+func (a *Agent) compact(ctx context.Context, turn *turnState, reason string) error {
+    items := a.session.Items()
+    if len(items) == 0 || len(items) == 1 && isSummary(items[0]) {
+        return notifyBackground(ctx, "nothing to compact")
+    }
+    older, kept := items, []model.Message(nil)
+    for i := len(items) - 1; i > 0; i-- {
+        // Images attached by tools come as text-less user items within a
+        // turn; a turn starts with the user's prompt.
+        if items[i].Role == "user" && items[i].Text() != "" {
+            older, kept = items[:i], items[i:]
+            break
+        }
+    }
+    if len(older) == 1 && isSummary(older[0]) {
+        // Only the latest turn is new since the last compaction.
+        older, kept = items, nil
+    }
+    if err := notifyBackground(ctx, "compacting conversation (%s)", reason); err != nil {
+        return err
+    }
+
+    a.mu.Lock()
+    client := a.cfg.Client
+    a.mu.Unlock()
+    prompt := model.Prompt{
+        Model:           turn.cfg.Model,
+        Instructions:    a.instructions(turn.cfg),
+        Messages:        append(older[:len(older):len(older)], model.TextMessage("user", compactPrompt)),
+        ReasoningEffort: turn.cfg.ReasoningEffort,
+        MaxOutputTokens: turn.cfg.MaxOutputTokens,
+        CacheKey:        a.SessionID(),
+    }
+    var summary string
+    var usage *model.Usage
+    if client == nil {
+        summary = cannedSummary(older)
+    } else {
+        // The summary is not an answer to the user: keep it off the
+        // agent_message stream.
+        resp, err := a.sample(ctx, turn.quiet(), client, prompt)
+        if err != nil {
+            return err
+        }
+        summary, usage = resp.Text, resp.Usage
+    }
+    if err := turn.emit(protocol.Event{ID: turn.subID, Msg: a.recordUsage(usage, prompt, model.TextMessage("assistant", summary))}); err != nil {
+        return err
+    }
+
+    compacted := append([]model.Message{model.TextMessage("user", summaryPrefix+summary)}, kept...)
+    a.session.Replace(compacted)
+    if r := a.recorder(); r != nil {
+        _ = r.RecordCompacted(compacted)
+    }
+    a.mu.Lock()
+    a.history = tokens.EstimateMessages(compacted)
+    a.mu.Unlock()
+    return notifyBackground(ctx, "conversation compacted: %d items summarized, %d kept", len(older), len(kept))
+}
+
+// isSummary reports the summary item of an earlier compaction.
+func isSummary(m model.Message) bool {
+    return m.Role == "user" && strings.HasPrefix(m.Text(), summaryPrefix)
+}
+
+// cannedAsked opens the summaries of the offline backend.
+const cannedAsked = "The user asked: "
+
+// cannedSummary stands in for the model's summary on the offline backend:
+// the user's prompts, including those of earlier summaries.
+func cannedSummary(items []model.Message) string {
+    var asked []string
+    for _, m := range items {
+        switch {
+        case isEnvironment(m):
+        case isSummary(m):
+            asked = append(asked, strings.TrimPrefix(strings.TrimPrefix(m.Text(), summaryPrefix), cannedAsked))
+        case m.Role == "user":
+            asked = append(asked, m.Text())
+        }
+    }
+    return cannedAsked + strings.Join(asked, "; ")
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+    "fmt"
+    "runtime"
+    "strings"
+
+    "codex-go/internal/model"
+)
+
+// environmentContext describes where the turn's commands run, so the model
+// writes commands that fit: the platform, the cwd and its repository, and
+// the policies that decide what runs unasked and what the sandbox allows.
+// It joins the conversation ahead of the first turn's input, and again
+// ahead of any turn whose settings change it, instead of opening every
+// request: earlier requests then stay a prefix of later ones, which keeps
+// the provider's prompt cache useful.
+func environmentContext(cfg Config) model.Message {
+    var b strings.Builder
+    b.WriteString(environmentTag + "\n")
+    field := func(name, value string) { fmt.Fprintf(&b, "  <%s>%s</%s>\n", name, value, name) }
+    field("os", runtime.GOOS)
+    field("arch", runtime.GOARCH)
+    field("cwd", cfg.Cwd)
+    if root := gitRoot(cfg.Cwd); root != "" {
+        field("git_repository", root)
+    } else {
+        field("git_repository", "none")
+    }
+    field("approval_policy", cfg.ApprovalPolicy)
+    field("sandbox_mode", cfg.Sandbox.Mode)
+    b.WriteString("</environment_context>")
+    return model.TextMessage("user", b.String())
+}
+
+// environmentTag opens environment context items.
+const environmentTag = "<environment_context>"
+
+// isEnvironment reports an environment context item.
+func isEnvironment(m model.Message) bool {
+    return m.Role == "user" && strings.HasPrefix(m.Text(), environmentTag)
+}
+
+// latestEnvironment returns the text of the last environment context item
+// in items, the one in effect, or "" when there is none (a new, reset or
+// compacted conversation).
+func latestEnvironment(items []model.Message) string {
+    for i := len(items) - 1; i >= 0; i-- {
+        if isEnvironment(items[i]) {
+            return items[i].Text()
+        }
+    }
+    return ""
+}
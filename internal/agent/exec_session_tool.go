@@ -0,0 +1,392 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "sync"
+    "time"
+
+    iexec "codex-go/internal/exec"
+    "codex-go/internal/protocol"
+)
+
+// Limits of the exec_session tool.
+const (
+    // defaultSessionYield is how long a call waits for output when the
+    // model does not say.
+    defaultSessionYield = time.Second
+    // maxSessionYield bounds the wait the model can ask for.
+    maxSessionYield = 30 * time.Second
+    // maxExecSessions bounds the sessions open at once.
+    maxExecSessions = 16
+    // maxSessionBuffer caps the output kept between reads; older output
+    // is dropped.
+    maxSessionBuffer = 1 << 20
+)
+
+// execSessionSchema is the JSON Schema of the exec_session arguments.
+const execSessionSchema = `{
+  "type": "object",
+  "properties": {
+    "action": {
+      "type": "string",
+      "enum": ["open", "write", "read", "close"],
+      "description": "open starts a program (by default a shell) that keeps running across calls; write sends it input; read returns its new output; close ends it."
+    },
+    "session_id": {"type": "integer", "description": "The session to write to, read from or close, as returned by open."},
+    "command": {
+      "type": "array",
+      "items": {"type": "string"},
+      "minItems": 1,
+      "description": "For open: the program to run as an argv list. Defaults to a shell reading commands from its input."
+    },
+    "workdir": {"type": "string", "description": "For open: working directory, relative to the session's cwd. Defaults to the session's cwd."},
+    "tty": {"type": "boolean", "description": "For open: run on a pseudo-terminal, for programs that need one (prompts, REPLs, pagers)."},
+    "input": {"type": "string", "description": "For write: text for the program's input; end a line with \"\\n\" to submit it."},
+    "yield_ms": {"type": "integer", "minimum": 0, "maximum": 30000, "description": "How long to wait for output before returning. Defaults to 1000."}
+  },
+  "required": ["action"],
+  "additionalProperties": false
+}`
+
+// execSessionArgs are the decoded arguments of an exec_session call.
+type execSessionArgs struct {
+    Action    string   `json:"action"`
+    SessionID int      `json:"session_id,omitempty"`
+    Command   []string `json:"command,omitempty"`
+    Workdir   string   `json:"workdir,omitempty"`
+    Tty       bool     `json:"tty,omitempty"`
+    Input     string   `json:"input,omitempty"`
+    YieldMs   *int     `json:"yield_ms,omitempty"`
+}
+
+// execSessionTool runs programs that outlive a call, such as a shell in
+// which the model activates a virtualenv and then runs tests. A session is
+// reported as one exec_command_begin/end pair: begin when it opens, end
+// when it exits or is closed; its output goes to the model only.
+type execSessionTool struct {
+    runner iexec.InputRunner
+}
+
+func (execSessionTool) Spec() ToolSpec {
+    return ToolSpec{
+        Name: "exec_session",
+        Description: "Runs a long-lived program, such as a shell, across several calls: open it, write input to it, " +
+            "read its output as it comes, and close it when done. State like the current directory or " +
+            "activated environments persists between writes.",
+        Parameters: json.RawMessage(execSessionSchema),
+    }
+}
+
+func (t execSessionTool) Call(ctx context.Context, raw json.RawMessage) (ToolResult, error) {
+    var args execSessionArgs
+    if err := json.Unmarshal(raw, &args); err != nil {
+        return ToolResult{Output: fmt.Sprintf("invalid arguments: %v", err)}, nil
+    }
+    yield := defaultSessionYield
+    if args.YieldMs != nil {
+        yield = min(max(time.Duration(*args.YieldMs)*time.Millisecond, 0), maxSessionYield)
+    }
+    turn := turnFrom(ctx)
+    if turn == nil {
+        return ToolResult{Output: "exec_session needs a session"}, nil
+    }
+    sessions := &turn.agent.execSessions
+
+    if args.Action == "open" {
+        return t.open(ctx, args, yield)
+    }
+    s := sessions.get(args.SessionID)
+    if s == nil {
+        return ToolResult{Output: fmt.Sprintf("no session %d; open one first", args.SessionID)}, nil
+    }
+    switch args.Action {
+    case "write":
+        if res, ok, err := approveInput(ctx, s, args.Input); !ok {
+            return res, err
+        }
+        if _, err := io.WriteString(s.stdin, args.Input); err != nil {
+            // Most likely the program exited, which the report tells.
+            res, err2 := s.report(ctx, sessions, 0)
+            res.Output = fmt.Sprintf("cannot write to session %d: %v\n", s.id, err) + res.Output
+            return res, err2
+        }
+    case "read":
+    case "close":
+        _ = s.cancel()
+        // The program has KillGrace to exit.
+        yield = iexec.DefaultKillGrace + time.Second
+    default:
+        return ToolResult{Output: fmt.Sprintf("invalid arguments: unknown action %q", args.Action)}, nil
+    }
+    return s.report(ctx, sessions, yield)
+}
+
+// open starts a session and returns its first output.
+func (t execSessionTool) open(ctx context.Context, args execSessionArgs, yield time.Duration) (ToolResult, error) {
+    turn := turnFrom(ctx)
+    sessions := &turn.agent.execSessions
+    argv := args.Command
+    if len(argv) == 0 {
+        argv = defaultSessionShell()
+    }
+    if argv[0] == "" {
+        return ToolResult{Output: "invalid arguments: missing command"}, nil
+    }
+    cwd := args.Workdir
+    if !filepath.IsAbs(cwd) {
+        cwd = filepath.Join(turn.cfg.Cwd, cwd)
+    }
+    if sessions.count() >= maxExecSessions {
+        return ToolResult{Output: fmt.Sprintf("too many sessions open (%d); close some first", maxExecSessions)}, nil
+    }
+    runner := t.runner
+    if turn.cfg.Runner != nil {
+        r, ok := turn.cfg.Runner.(iexec.InputRunner)
+        if !ok {
+            return ToolResult{Output: "sessions are not supported where commands run"}, nil
+        }
+        runner = r
+    }
+    sandbox, unconfined, err := turn.agent.sandboxPolicy(ctx, turn.cfg)
+    if err != nil {
+        return ToolResult{}, err
+    }
+    if sandbox != nil && turn.agent.escalated(argv) {
+        sandbox = nil
+    }
+    approve := approveExec
+    if unconfined && !turn.agent.escalated(argv) {
+        approve = approveUnconfined
+    }
+
+    callID := callIDFrom(ctx)
+    if res, ok, err := approve(ctx, callID, argv, cwd); !ok {
+        return res, err
+    }
+    env := turn.cfg.ShellEnvironmentPolicy
+    opt := iexec.Options{Cwd: cwd, EnvPolicy: &env, Pty: args.Tty, Sandbox: sandbox}
+    // The session outlives the turn: it ends when closed, or with the agent.
+    events, stdin, cancel, err := runner.StartInput(context.Background(), argv, opt)
+    if err != nil {
+        return ToolResult{Output: fmt.Sprintf("failed to start command: %v", err)}, nil
+    }
+    if err := emitFromTool(ctx, protocol.ExecCommandBeginEvent{CallID: callID, Command: argv, Cwd: cwd}); err != nil {
+        _ = cancel()
+        return ToolResult{}, err
+    }
+    s := &execSession{callID: callID, argv: argv, cwd: cwd, started: time.Now(), stdin: stdin, cancel: cancel, changed: make(chan struct{})}
+    sessions.add(s)
+    go s.collect(events)
+    return s.report(ctx, sessions, yield)
+}
+
+// inputReason starts the reason of the exec_approval_request asking to
+// write input to a session; the input follows.
+const inputReason = "input to session: "
+
+// approveInput asks the user whether input may be written to s, under the
+// untrusted policy: the program, a shell by default, runs whatever it is
+// sent, so approving it when it opened approves none of its input. The
+// request shows the session's command and the input; input approved for
+// the session is not asked about again for the same command.
+func approveInput(ctx context.Context, s *execSession, input string) (ToolResult, bool, error) {
+    turn := turnFrom(ctx)
+    if input == "" || turn.cfg.ApprovalPolicy != protocol.ApprovalUntrusted {
+        return ToolResult{}, true, nil
+    }
+    key := commandKey(append(append([]string{}, s.argv...), input))
+    turn.agent.mu.Lock()
+    approved := turn.agent.approvedCommands[key]
+    turn.agent.mu.Unlock()
+    if approved {
+        return ToolResult{}, true, nil
+    }
+    req := protocol.ExecApprovalRequestEvent{CallID: callIDFrom(ctx), Command: s.argv, Cwd: s.cwd, Reason: inputReason + input}
+    decision, err := turn.agent.requestExecApproval(ctx, turn.subID, req, turn.emit)
+    if err != nil {
+        return ToolResult{}, false, err
+    }
+    switch decision {
+    case protocol.ReviewApprovedForSession:
+        turn.agent.mu.Lock()
+        if turn.agent.approvedCommands == nil {
+            turn.agent.approvedCommands = map[string]bool{}
+        }
+        turn.agent.approvedCommands[key] = true
+        turn.agent.mu.Unlock()
+    case protocol.ReviewDenied:
+        return ToolResult{Output: "The user rejected this input. It was not written; do not retry it unchanged."}, false, nil
+    case protocol.ReviewAbort:
+        return ToolResult{Output: "The user aborted. Stop and wait for further instructions."}, false, nil
+    }
+    return ToolResult{}, true, nil
+}
+
+// defaultSessionShell is the program open runs without a command.
+func defaultSessionShell() []string {
+    if runtime.GOOS == "windows" {
+        return []string{"cmd.exe"}
+    }
+    if sh := os.Getenv("SHELL"); sh != "" {
+        return []string{sh}
+    }
+    return []string{"/bin/sh"}
+}
+
+// execSessions are the sessions of an agent, by id.
+type execSessions struct {
+    mu       sync.Mutex
+    next     int
+    sessions map[int]*execSession
+}
+
+// add registers s under a new id.
+func (ss *execSessions) add(s *execSession) {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+    ss.next++
+    s.id = ss.next
+    if ss.sessions == nil {
+        ss.sessions = map[int]*execSession{}
+    }
+    ss.sessions[s.id] = s
+}
+
+func (ss *execSessions) get(id int) *execSession {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+    return ss.sessions[id]
+}
+
+func (ss *execSessions) remove(id int) {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+    delete(ss.sessions, id)
+}
+
+func (ss *execSessions) count() int {
+    ss.mu.Lock()
+    defer ss.mu.Unlock()
+    return len(ss.sessions)
+}
+
+// closeAll stops every session, when the agent shuts down.
+func (ss *execSessions) closeAll() {
+    ss.mu.Lock()
+    sessions := ss.sessions
+    ss.sessions = nil
+    ss.mu.Unlock()
+    for _, s := range sessions {
+        _ = s.cancel()
+    }
+}
+
+// execSession is a running program and the output it wrote since the
+// model last read it.
+type execSession struct {
+    id      int
+    callID  string // of the call that opened it
+    argv    []string
+    cwd     string
+    started time.Time
+    stdin   io.WriteCloser
+    cancel  func() error
+
+    mu      sync.Mutex
+    out     []byte
+    dropped int // bytes dropped from out, past maxSessionBuffer
+    exit    *iexec.Event
+    // changed is closed, and replaced, whenever out or exit changes.
+    changed chan struct{}
+}
+
+// collect buffers the program's events until it exits.
+func (s *execSession) collect(events <-chan iexec.Event) {
+    for ev := range events {
+        s.mu.Lock()
+        switch ev.Type {
+        case iexec.EventStdout, iexec.EventStderr, iexec.EventPty:
+            s.out = append(s.out, ev.Data...)
+            if over := len(s.out) - maxSessionBuffer; over > 0 {
+                s.dropped += over
+                s.out = append(s.out[:0], s.out[over:]...)
+            }
+        case iexec.EventExit:
+            s.exit = &ev
+        default:
+            s.mu.Unlock()
+            continue
+        }
+        close(s.changed)
+        s.changed = make(chan struct{})
+        s.mu.Unlock()
+    }
+}
+
+// report waits up to yield, or until the program exits, and returns the
+// output it wrote meanwhile. Once it exited, the session is removed and
+// its exec_command_end sent.
+func (s *execSession) report(ctx context.Context, sessions *execSessions, yield time.Duration) (ToolResult, error) {
+    timer := time.NewTimer(yield)
+    defer timer.Stop()
+wait:
+    for {
+        s.mu.Lock()
+        exited, changed := s.exit != nil, s.changed
+        s.mu.Unlock()
+        if exited {
+            break
+        }
+        select {
+        case <-changed:
+        case <-timer.C:
+            break wait
+        case <-ctx.Done():
+            return ToolResult{}, ctx.Err()
+        }
+    }
+
+    s.mu.Lock()
+    out, dropped, exit := iexec.Text(s.out), s.dropped, s.exit
+    s.out, s.dropped = nil, 0
+    s.mu.Unlock()
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "session_id: %d\n", s.id)
+    if exit != nil {
+        sessions.remove(s.id)
+        end := protocol.ExecCommandEndEvent{
+            CallID:     s.callID,
+            Command:    s.argv,
+            Cwd:        s.cwd,
+            ExitCode:   exit.Code,
+            DurationMs: time.Since(s.started).Milliseconds(),
+            Signal:     exit.Signal,
+        }
+        if err := emitFromTool(ctx, end); err != nil {
+            return ToolResult{}, err
+        }
+        if exit.Signal != "" {
+            fmt.Fprintf(&b, "exited: terminated by %s\n", exit.Signal)
+        } else {
+            fmt.Fprintf(&b, "exited: exit_code %d\n", exit.Code)
+        }
+    } else {
+        b.WriteString("running\n")
+    }
+    if dropped > 0 {
+        fmt.Fprintf(&b, "[... %d earlier bytes dropped]\n", dropped)
+    }
+    if out != "" {
+        fmt.Fprintf(&b, "output:\n%s\n", strings.TrimRight(out, "\n"))
+    }
+    res := TruncateOutput(strings.TrimRight(b.String(), "\n"), maxShellOutputBytes)
+    return ToolResult{Output: res, Success: exit == nil || exit.Code == 0}, nil
+}
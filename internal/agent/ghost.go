@@ -0,0 +1,219 @@
+package agent
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// ghostRefPrefix holds the ghost commits of agent turns:
+// refs/codex/ghost/<session id>/<turn number> points at a commit of the
+// worktree as the turn left it, whose parent is the worktree as the turn
+// found it. Refs outside refs/heads and refs/tags do not show up in
+// branches, logs or pushes, but keep the commits from being collected.
+const ghostRefPrefix = "refs/codex/ghost/"
+
+// ghostIdentity signs ghost commits, so they work without a configured
+// git identity.
+var ghostIdentity = []string{
+    "GIT_AUTHOR_NAME=codex", "GIT_AUTHOR_EMAIL=codex@localhost",
+    "GIT_COMMITTER_NAME=codex", "GIT_COMMITTER_EMAIL=codex@localhost",
+}
+
+// ErrNothingToUndo is returned by UndoLastTurn when no recorded turn is
+// left to undo.
+var ErrNothingToUndo = errors.New("no agent turn to undo")
+
+// recordGhost stores the worktree before and after a turn that changed
+// files as ghost commits under ghostRefPrefix.
+func recordGhost(ctx context.Context, sessionID, turnID string, before, after worktreeSnapshot) error {
+    if before.tree == after.tree {
+        return nil
+    }
+    n := strings.TrimPrefix(turnID, "turn-")
+    msg := fmt.Sprintf("codex: session %s %s", sessionID, turnID)
+    base, err := gitEnv(ctx, before.root, ghostIdentity, "commit-tree", before.tree, "-m", msg+" (before)")
+    if err != nil {
+        return err
+    }
+    head, err := gitEnv(ctx, before.root, ghostIdentity, "commit-tree", after.tree, "-p", strings.TrimSpace(base), "-m", msg)
+    if err != nil {
+        return err
+    }
+    _, err = git(ctx, before.root, "update-ref", ghostRefPrefix+sessionID+"/"+n, strings.TrimSpace(head))
+    return err
+}
+
+// keepGhost records the turn's snapshots as ghost commits, once, so
+// undo_turn can revert it. It does nothing outside a git worktree.
+func (a *Agent) keepGhost(ctx context.Context, turn *turnState) error {
+    if turn.diff.ghosted {
+        return nil
+    }
+    turn.diff.ghosted = true
+    before, after, ok := turn.diff.finish(ctx)
+    if !ok {
+        return nil
+    }
+    return recordGhost(ctx, a.SessionID(), a.runningTurnID(), before, after)
+}
+
+// UndoResult describes an undone turn. Paths are relative to the root of
+// the repository.
+type UndoResult struct {
+    SessionID string
+    TurnID    string
+    Restored  []string
+    Removed   []string
+}
+
+// UndoLastTurn reverts the files changed by the latest recorded agent
+// turn in the git repository containing dir: of session sessionID, or of
+// any session when it is empty. Files are restored to their content when
+// the turn started; files the turn created are removed. If any of those
+// files changed since the turn, nothing is touched. The turn's ghost ref
+// is deleted, so the next call undoes the turn before it.
+func UndoLastTurn(ctx context.Context, dir, sessionID string) (UndoResult, error) {
+    root, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+    if err != nil {
+        return UndoResult{}, err
+    }
+    root = strings.TrimSpace(root)
+    ref, res, err := latestGhost(ctx, root, sessionID)
+    if err != nil {
+        return UndoResult{}, err
+    }
+
+    out, err := git(ctx, root, "diff-tree", "-r", "-z", "--no-renames", "--name-status", ref+"^", ref)
+    if err != nil {
+        return UndoResult{}, err
+    }
+    type change struct{ status, path string }
+    var changes []change
+    fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+    for i := 0; i+1 < len(fields); i += 2 {
+        changes = append(changes, change{fields[i], fields[i+1]})
+    }
+
+    // Check everything first so a conflict leaves the worktree as it is.
+    var conflicts []string
+    for _, c := range changes {
+        if !unchangedSince(ctx, root, ref, c.path, c.status == "D") {
+            conflicts = append(conflicts, c.path)
+        }
+    }
+    if len(conflicts) > 0 {
+        return UndoResult{}, fmt.Errorf("%s: files changed since the turn: %s", res.TurnID, strings.Join(conflicts, ", "))
+    }
+    for _, c := range changes {
+        path := filepath.Join(root, filepath.FromSlash(c.path))
+        if c.status == "A" {
+            if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+                return UndoResult{}, err
+            }
+            res.Removed = append(res.Removed, c.path)
+            continue
+        }
+        if err := restoreFile(ctx, root, ref+"^", c.path, path); err != nil {
+            return UndoResult{}, err
+        }
+        res.Restored = append(res.Restored, c.path)
+    }
+    if _, err := git(ctx, root, "update-ref", "-d", ref); err != nil {
+        return UndoResult{}, err
+    }
+    return res, nil
+}
+
+// latestGhost finds the ghost ref of the most recent turn, newest commit
+// first and the higher turn number among commits of the same second.
+func latestGhost(ctx context.Context, root, sessionID string) (string, UndoResult, error) {
+    pattern := ghostRefPrefix
+    if sessionID != "" {
+        pattern += sessionID + "/"
+    }
+    out, err := git(ctx, root, "for-each-ref", "--format=%(committerdate:unix) %(refname)", pattern)
+    if err != nil {
+        return "", UndoResult{}, err
+    }
+    type ghost struct {
+        time, turn int64
+        ref        string
+        session    string
+    }
+    var ghosts []ghost
+    for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+        t, ref, ok := strings.Cut(line, " ")
+        if !ok {
+            continue
+        }
+        session, n, ok := strings.Cut(strings.TrimPrefix(ref, ghostRefPrefix), "/")
+        if !ok {
+            continue
+        }
+        g := ghost{ref: ref, session: session}
+        g.time, _ = strconv.ParseInt(t, 10, 64)
+        g.turn, _ = strconv.ParseInt(n, 10, 64)
+        ghosts = append(ghosts, g)
+    }
+    if len(ghosts) == 0 {
+        return "", UndoResult{}, ErrNothingToUndo
+    }
+    sort.Slice(ghosts, func(i, j int) bool {
+        if ghosts[i].time != ghosts[j].time {
+            return ghosts[i].time > ghosts[j].time
+        }
+        return ghosts[i].turn > ghosts[j].turn
+    })
+    g := ghosts[0]
+    return g.ref, UndoResult{SessionID: g.session, TurnID: fmt.Sprintf("turn-%d", g.turn)}, nil
+}
+
+// unchangedSince reports whether path (relative to root) is still as
+// commit left it: absent when deleted, otherwise holding the same blob.
+func unchangedSince(ctx context.Context, root, commit, path string, deleted bool) bool {
+    abs := filepath.Join(root, filepath.FromSlash(path))
+    if _, err := os.Lstat(abs); err != nil {
+        return deleted && os.IsNotExist(err)
+    }
+    if deleted {
+        return false
+    }
+    want, err := git(ctx, root, "rev-parse", commit+":"+path)
+    if err != nil {
+        return false
+    }
+    got, err := git(ctx, root, "hash-object", "--", path)
+    return err == nil && strings.TrimSpace(got) == strings.TrimSpace(want)
+}
+
+// restoreFile writes path as commit holds it at rel, mode included.
+func restoreFile(ctx context.Context, root, commit, rel, path string) error {
+    entry, err := git(ctx, root, "ls-tree", "-z", commit, "--", rel)
+    if err != nil {
+        return err
+    }
+    mode, _, _ := strings.Cut(entry, " ")
+    content, err := git(ctx, root, "cat-file", "blob", commit+":"+rel)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return err
+    }
+    if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+        return err
+    }
+    switch mode {
+    case "120000":
+        return os.Symlink(content, path)
+    case "100755":
+        return os.WriteFile(path, []byte(content), 0o755)
+    }
+    return os.WriteFile(path, []byte(content), 0o644)
+}
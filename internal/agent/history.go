@@ -0,0 +1,53 @@
+package agent
+
+import (
+    "time"
+
+    "codex-go/internal/history"
+    "codex-go/internal/protocol"
+)
+
+// DefaultHistoryLimit is how many entries get_history returns when the
+// request does not set a limit.
+const DefaultHistoryLimit = 100
+
+// historyPath returns the history file for this session.
+func (a *Agent) historyPath() (string, error) {
+    a.mu.Lock()
+    p := a.cfg.HistoryPath
+    a.mu.Unlock()
+    if p != "" {
+        return p, nil
+    }
+    return history.DefaultPath()
+}
+
+// addToHistory records text, tagged with this session's id.
+func (a *Agent) addToHistory(text string) error {
+    path, err := a.historyPath()
+    if err != nil {
+        return err
+    }
+    return history.Append(path, history.Entry{SessionID: a.SessionID(), Ts: time.Now().Unix(), Text: text})
+}
+
+// getHistory answers a get_history op.
+func (a *Agent) getHistory(op protocol.GetHistoryOp) (protocol.GetHistoryResponseEvent, error) {
+    path, err := a.historyPath()
+    if err != nil {
+        return protocol.GetHistoryResponseEvent{}, err
+    }
+    limit := op.Limit
+    if limit == 0 {
+        limit = DefaultHistoryLimit
+    }
+    entries, total, err := history.Read(path, op.Offset, limit)
+    if err != nil {
+        return protocol.GetHistoryResponseEvent{}, err
+    }
+    ev := protocol.GetHistoryResponseEvent{Offset: op.Offset, Total: total, Entries: make([]protocol.HistoryEntry, 0, len(entries))}
+    for _, e := range entries {
+        ev.Entries = append(ev.Entries, protocol.HistoryEntry(e))
+    }
+    return ev, nil
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+    "bytes"
+    "fmt"
+    "image"
+    "image/color"
+    "image/gif"
+    "image/jpeg"
+    "image/png"
+)
+
+// fitImage downscales an image of MIME type mt whose width or height
+// exceeds MaxImageDimension, keeping the aspect ratio. JPEG stays JPEG;
+// PNG and GIF become PNG. Images in formats the standard library cannot
+// decode (WebP, ...) and those that already fit are returned unchanged.
+func fitImage(data []byte, mt string) ([]byte, string, error) {
+    var decode func([]byte) (image.Image, error)
+    switch mt {
+    case "image/png":
+        decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+    case "image/jpeg":
+        decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+    case "image/gif":
+        decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+    default:
+        return data, mt, nil
+    }
+    src, err := decode(data)
+    if err != nil {
+        return nil, "", fmt.Errorf("invalid %s: %w", mt, err)
+    }
+    b := src.Bounds()
+    w, h := b.Dx(), b.Dy()
+    if w <= MaxImageDimension && h <= MaxImageDimension {
+        return data, mt, nil
+    }
+    if w >= h {
+        w, h = MaxImageDimension, max(1, h*MaxImageDimension/w)
+    } else {
+        w, h = max(1, w*MaxImageDimension/h), MaxImageDimension
+    }
+
+    dst := downscale(src, w, h)
+    var buf bytes.Buffer
+    if mt == "image/jpeg" {
+        err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+    } else {
+        mt = "image/png"
+        err = png.Encode(&buf, dst)
+    }
+    if err != nil {
+        return nil, "", fmt.Errorf("re-encoding image: %w", err)
+    }
+    return buf.Bytes(), mt, nil
+}
+
+// downscale resizes src to w x h by averaging the source pixels that fall
+// into each destination pixel (a box filter).
+func downscale(src image.Image, w, h int) *image.NRGBA {
+    b := src.Bounds()
+    sw, sh := b.Dx(), b.Dy()
+    dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+    for y := 0; y < h; y++ {
+        y0, y1 := b.Min.Y+y*sh/h, b.Min.Y+max((y+1)*sh/h, y*sh/h+1)
+        for x := 0; x < w; x++ {
+            x0, x1 := b.Min.X+x*sw/w, b.Min.X+max((x+1)*sw/w, x*sw/w+1)
+            var r, g, bl, a, n uint64
+            for sy := y0; sy < y1; sy++ {
+                for sx := x0; sx < x1; sx++ {
+                    c := color.NRGBAModel.Convert(src.At(sx, sy)).(color.NRGBA)
+                    r += uint64(c.R)
+                    g += uint64(c.G)
+                    bl += uint64(c.B)
+                    a += uint64(c.A)
+                    n++
+                }
+            }
+            dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n)})
+        }
+    }
+    return dst
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+    "encoding/base64"
+    "fmt"
+    "mime"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// MaxLocalImageBytes caps the size of a local image file. Larger files
+// are rejected rather than decoded.
+const MaxLocalImageBytes = 20 << 20
+
+// MaxImageDimension bounds the width and height of local images sent to
+// the model; larger PNG, JPEG and GIF images are downscaled to fit. Models
+// scale images down to about this size anyway, so sending more only costs
+// bandwidth.
+const MaxImageDimension = 2048
+
+// userContent converts user_input items into model content. Unknown item
+// types are ignored; a local_image that cannot be read fails the whole
+// input so the client can fix it instead of the model silently missing it.
+// Relative image paths are resolved against cwd.
+func userContent(items []protocol.InputItem, cwd string) ([]model.ContentItem, error) {
+    var out []model.ContentItem
+    for _, it := range items {
+        switch strings.ToLower(it.Type) {
+        case protocol.InputText:
+            if it.Text != "" {
+                out = append(out, model.ContentItem{Type: model.InputText, Text: it.Text})
+            }
+        case protocol.InputImage:
+            out = append(out, model.ContentItem{Type: model.InputImage, ImageURL: it.ImageURL})
+        case protocol.InputLocalImage:
+            path := it.Path
+            if !filepath.IsAbs(path) {
+                path = filepath.Join(cwd, path)
+            }
+            uri, err := imageDataURI(path)
+            if err != nil {
+                return nil, fmt.Errorf("local_image %s: %w", it.Path, err)
+            }
+            out = append(out, model.ContentItem{Type: model.InputImage, ImageURL: uri})
+        }
+    }
+    return out, nil
+}
+
+// imageDataURI reads an image file and encodes it as a base64 data: URI,
+// downscaled to MaxImageDimension when needed. The MIME type is sniffed
+// from the content, falling back to the extension.
+func imageDataURI(path string) (string, error) {
+    fi, err := os.Stat(path)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return "", fmt.Errorf("no such file")
+        }
+        return "", err
+    }
+    if !fi.Mode().IsRegular() {
+        return "", fmt.Errorf("not a regular file")
+    }
+    if fi.Size() > MaxLocalImageBytes {
+        return "", fmt.Errorf("%d bytes exceeds the %d byte limit", fi.Size(), MaxLocalImageBytes)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return "", err
+    }
+    mt := http.DetectContentType(data)
+    if !strings.HasPrefix(mt, "image/") {
+        mt = mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+    }
+    if mt, _, _ = strings.Cut(mt, ";"); !strings.HasPrefix(mt, "image/") {
+        return "", fmt.Errorf("not a recognized image type")
+    }
+    if data, mt, err = fitImage(data, mt); err != nil {
+        return "", err
+    }
+    return "data:" + mt + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// cannedReply is the answer of the offline backend used when no model
+// client is configured: it echoes the text and counts the images.
+func cannedReply(content []model.ContentItem) string {
+    var parts []string
+    images := 0
+    for _, c := range content {
+        switch c.Type {
+        case model.InputText:
+            parts = append(parts, c.Text)
+        case model.InputImage:
+            images++
+        }
+    }
+    reply := "Hi there"
+    if text := strings.TrimSpace(strings.Join(parts, " ")); text != "" {
+        reply = fmt.Sprintf("You said: %s", text)
+    }
+    if images > 0 {
+        reply += fmt.Sprintf(" (%d image(s) attached)", images)
+    }
+    return reply
+}
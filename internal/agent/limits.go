@@ -0,0 +1,63 @@
+package agent
+
+import (
+    "encoding/json"
+    "fmt"
+    "time"
+    "unicode/utf8"
+
+    "codex-go/internal/config"
+)
+
+// Defaults applied to calls of external MCP tools when the config does not
+// say otherwise.
+const (
+    DefaultToolTimeout        = 60 * time.Second
+    DefaultMaxToolResultBytes = 1 << 20
+)
+
+// ToolLimits bounds one tool call: how long it may run and how much output
+// is kept. Zero fields mean "use the default".
+type ToolLimits struct {
+    Timeout        time.Duration
+    MaxResultBytes int
+}
+
+// LimitsFromConfig converts config limits, filling zero fields from def.
+func LimitsFromConfig(l config.ToolLimits, def ToolLimits) ToolLimits {
+    out := def
+    if l.TimeoutSec > 0 {
+        out.Timeout = time.Duration(l.TimeoutSec) * time.Second
+    }
+    if l.MaxResultBytes > 0 {
+        out.MaxResultBytes = l.MaxResultBytes
+    }
+    return out
+}
+
+// TruncateOutput shortens s to at most max bytes (on a UTF-8 boundary) and
+// appends a marker saying how much was dropped. max <= 0 disables the limit.
+func TruncateOutput(s string, max int) string {
+    if max <= 0 || len(s) <= max {
+        return s
+    }
+    cut := max
+    for cut > 0 && !utf8.RuneStart(s[cut]) {
+        cut--
+    }
+    return s[:cut] + fmt.Sprintf("\n[... truncated %d of %d bytes]", len(s)-cut, len(s))
+}
+
+// TimeoutOutput is the structured error reported when a tool call exceeds
+// its time limit, so callers can tell it apart from ordinary tool failures.
+func TimeoutOutput(tool string, d time.Duration) string {
+    b, _ := json.Marshal(map[string]any{
+        "error": map[string]any{
+            "type":        "timeout",
+            "tool":        tool,
+            "timeout_sec": d.Seconds(),
+            "message":     fmt.Sprintf("tool %s did not finish within %s", tool, d),
+        },
+    })
+    return string(b)
+}
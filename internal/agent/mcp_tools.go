@@ -0,0 +1,265 @@
+package agent
+
+import (
+    "context"
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "codex-go/internal/config"
+    "codex-go/internal/mcpclient"
+)
+
+// mcpToolDelimiter separates server and tool in qualified tool names, e.g.
+// "github__search_issues".
+const mcpToolDelimiter = "__"
+
+// maxToolNameLen is the longest function name model APIs accept.
+const maxToolNameLen = 64
+
+// defaultMCPStartupTimeout bounds spawning and handshaking one server.
+const defaultMCPStartupTimeout = 10 * time.Second
+
+// MCPConnections holds live clients for the configured external servers.
+type MCPConnections struct {
+    clients map[string]*mcpclient.Client
+    tools   []*mcpTool
+}
+
+// ConnectMCPServers starts every configured server, performs the handshake
+// and lists its tools. Servers that fail are skipped; their errors are
+// returned alongside the connections that did succeed.
+func ConnectMCPServers(ctx context.Context, servers map[string]config.MCPServerConfig) (*MCPConnections, []error) {
+    conns := &MCPConnections{clients: map[string]*mcpclient.Client{}}
+    names := make([]string, 0, len(servers))
+    for name := range servers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var (
+        mu   sync.Mutex
+        wg   sync.WaitGroup
+        errs []error
+    )
+    for _, name := range names {
+        name, cfg := name, servers[name]
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            client, tools, err := connectMCPServer(ctx, name, cfg)
+            mu.Lock()
+            defer mu.Unlock()
+            if err != nil {
+                errs = append(errs, fmt.Errorf("mcp server %q: %w", name, err))
+                return
+            }
+            conns.clients[name] = client
+            for _, t := range tools {
+                limits := LimitsFromConfig(cfg.LimitsFor(t.Name), ToolLimits{
+                    Timeout:        DefaultToolTimeout,
+                    MaxResultBytes: DefaultMaxToolResultBytes,
+                })
+                conns.tools = append(conns.tools, &mcpTool{server: name, tool: t, client: client, limits: limits})
+            }
+        }()
+    }
+    wg.Wait()
+    sort.Slice(conns.tools, func(i, j int) bool { return conns.tools[i].Spec().Name < conns.tools[j].Spec().Name })
+    return conns, errs
+}
+
+// Servers returns the names of the connected servers, sorted.
+func (m *MCPConnections) Servers() []string {
+    names := make([]string, 0, len(m.clients))
+    for name := range m.clients {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// Merge moves the connections of other, whose server names must not be
+// connected in m, into m.
+func (m *MCPConnections) Merge(other *MCPConnections) {
+    for name, c := range other.clients {
+        m.clients[name] = c
+    }
+    m.tools = append(m.tools, other.tools...)
+    sort.Slice(m.tools, func(i, j int) bool { return m.tools[i].Spec().Name < m.tools[j].Spec().Name })
+    other.clients, other.tools = map[string]*mcpclient.Client{}, nil
+}
+
+// Disconnect shuts down the named server and drops its tools.
+func (m *MCPConnections) Disconnect(name string) {
+    c, ok := m.clients[name]
+    if !ok {
+        return
+    }
+    _ = c.Close()
+    delete(m.clients, name)
+    kept := m.tools[:0]
+    for _, t := range m.tools {
+        if t.server != name {
+            kept = append(kept, t)
+        }
+    }
+    m.tools = kept
+}
+
+// ProbeMCPServer starts a server once, performs the handshake and lists its
+// tools, then shuts it down. It is used to validate config entries.
+func ProbeMCPServer(ctx context.Context, cfg config.MCPServerConfig) (*mcpclient.InitializeResult, []mcpclient.Tool, error) {
+    client, tools, err := connectMCPServer(ctx, "", cfg)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer client.Close()
+    return client.ServerInfo(), tools, nil
+}
+
+// connectMCPServer starts one server and lists its tools.
+func connectMCPServer(ctx context.Context, name string, cfg config.MCPServerConfig) (*mcpclient.Client, []mcpclient.Tool, error) {
+    if err := cfg.Validate(); err != nil {
+        return nil, nil, err
+    }
+    timeout := defaultMCPStartupTimeout
+    if cfg.StartupTimeoutSec > 0 {
+        timeout = time.Duration(cfg.StartupTimeoutSec) * time.Second
+    }
+    ctx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+
+    var client *mcpclient.Client
+    if cfg.URL != "" {
+        opts := mcpclient.HTTPOptions{}
+        if cfg.BearerTokenEnvVar != "" {
+            opts.BearerToken = os.Getenv(cfg.BearerTokenEnvVar)
+        }
+        client = mcpclient.DialHTTP(cfg.URL, opts)
+    } else {
+        env := make([]string, 0, len(cfg.Env))
+        for k, v := range cfg.Env {
+            env = append(env, k+"="+v)
+        }
+        var err error
+        client, err = mcpclient.StartStdio(cfg.Command, cfg.Args, mcpclient.StdioOptions{Env: env, Cwd: cfg.Cwd})
+        if err != nil {
+            return nil, nil, err
+        }
+    }
+    if _, err := client.Initialize(ctx); err != nil {
+        _ = client.Close()
+        return nil, nil, fmt.Errorf("initialize: %w", err)
+    }
+    tools, err := client.ListTools(ctx)
+    if err != nil {
+        _ = client.Close()
+        return nil, nil, fmt.Errorf("tools/list: %w", err)
+    }
+    return client, tools, nil
+}
+
+// Tools returns the namespaced tools of all connected servers.
+func (m *MCPConnections) Tools() []Tool {
+    out := make([]Tool, 0, len(m.tools))
+    for _, t := range m.tools {
+        out = append(out, t)
+    }
+    return out
+}
+
+// Close shuts down every client.
+func (m *MCPConnections) Close() {
+    for _, c := range m.clients {
+        _ = c.Close()
+    }
+}
+
+// qualifiedToolName builds "<server>__<tool>", restricted to the characters
+// model APIs accept and shortened with a hash suffix when too long.
+func qualifiedToolName(server, tool string) string {
+    sanitize := func(s string) string {
+        return strings.Map(func(r rune) rune {
+            if r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+                return r
+            }
+            return '_'
+        }, s)
+    }
+    name := sanitize(server) + mcpToolDelimiter + sanitize(tool)
+    if len(name) <= maxToolNameLen {
+        return name
+    }
+    sum := sha1.Sum([]byte(server + mcpToolDelimiter + tool))
+    suffix := hex.EncodeToString(sum[:])[:8]
+    return name[:maxToolNameLen-len(suffix)-1] + "_" + suffix
+}
+
+// mcpTool adapts a tool of an external MCP server to the Tool interface.
+type mcpTool struct {
+    server string
+    tool   mcpclient.Tool
+    client *mcpclient.Client
+    limits ToolLimits
+}
+
+func (t *mcpTool) Spec() ToolSpec {
+    params := t.tool.InputSchema
+    if len(params) == 0 {
+        params = json.RawMessage(`{"type":"object","properties":{}}`)
+    }
+    return ToolSpec{
+        Name:        qualifiedToolName(t.server, t.tool.Name),
+        Description: t.tool.Description,
+        Parameters:  params,
+    }
+}
+
+func (t *mcpTool) Call(ctx context.Context, args json.RawMessage) (ToolResult, error) {
+    callCtx, cancel := context.WithTimeout(ctx, t.limits.Timeout)
+    defer cancel()
+    res, err := t.client.CallTool(callCtx, t.tool.Name, args)
+    if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+        // The client already sent notifications/cancelled to the server.
+        return ToolResult{Output: TimeoutOutput(t.Spec().Name, t.limits.Timeout), Success: false}, nil
+    }
+    if err != nil {
+        // Report transport/protocol failures to the model rather than
+        // aborting the turn; it may choose another approach.
+        return ToolResult{Output: fmt.Sprintf("tool call failed: %v", err), Success: false}, nil
+    }
+    out := convertMCPResult(res)
+    out.Output = TruncateOutput(out.Output, t.limits.MaxResultBytes)
+    return out, nil
+}
+
+// convertMCPResult turns an MCP tool result into the output the model sees:
+// plain text when every block is text, otherwise the JSON-encoded result so
+// no content (images, resources) is silently dropped.
+func convertMCPResult(res *mcpclient.CallToolResult) ToolResult {
+    allText := true
+    var parts []string
+    for _, c := range res.Content {
+        if c.Type != "text" {
+            allText = false
+            break
+        }
+        parts = append(parts, c.Text)
+    }
+    out := strings.Join(parts, "\n")
+    if !allText || (len(res.Content) == 0 && len(res.StructuredContent) > 0) {
+        b, err := json.Marshal(res)
+        if err == nil {
+            out = string(b)
+        }
+    }
+    return ToolResult{Output: out, Success: !res.IsError}
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+    "encoding/json"
+    "os/exec"
+
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// Notification types passed to the notify program.
+const (
+    NotifyTurnComplete      = "agent-turn-complete"
+    NotifyApprovalRequested = "approval-requested"
+)
+
+// Notification is the JSON payload given to the notify program as its last
+// argument. Fields that do not apply to the type are omitted.
+type Notification struct {
+    Type      string `json:"type"`
+    SessionID string `json:"session-id"`
+    TurnID    string `json:"turn-id"`
+    Cwd       string `json:"cwd,omitempty"`
+    // InputMessages and LastAssistantMessage describe a completed turn.
+    InputMessages        []string `json:"input-messages,omitempty"`
+    LastAssistantMessage string   `json:"last-assistant-message,omitempty"`
+    // The rest describe an approval request: the command to run or the
+    // files a patch changes.
+    CallID  string   `json:"call-id,omitempty"`
+    Command []string `json:"command,omitempty"`
+    Paths   []string `json:"paths,omitempty"`
+    Reason  string   `json:"reason,omitempty"`
+}
+
+// notify runs the configured notify program with n appended as JSON to its
+// arguments. The program is not waited for and its failures are ignored:
+// notifications are best effort and must not hold up the turn.
+func (a *Agent) notify(n Notification) {
+    a.mu.Lock()
+    argv := a.cfg.Notify
+    n.SessionID = a.id
+    if n.TurnID == "" && a.task != nil {
+        n.TurnID = a.task.turnID
+    }
+    a.mu.Unlock()
+    if len(argv) == 0 {
+        return
+    }
+    payload, err := json.Marshal(n)
+    if err != nil {
+        return
+    }
+    cmd := exec.Command(argv[0], append(argv[1:len(argv):len(argv)], string(payload))...)
+    if err := cmd.Start(); err != nil {
+        return
+    }
+    go cmd.Wait()
+}
+
+// notifyTurnComplete reports a turn that ended with an answer.
+func (a *Agent) notifyTurnComplete(turn *turnState) {
+    var inputs []string
+    for _, c := range turn.input {
+        if c.Type == model.InputText && c.Text != "" {
+            inputs = append(inputs, c.Text)
+        }
+    }
+    a.notify(Notification{
+        Type:                 NotifyTurnComplete,
+        Cwd:                  turn.cfg.Cwd,
+        InputMessages:        inputs,
+        LastAssistantMessage: turn.lastMessage,
+    })
+}
+
+// notifyApproval reports an approval request waiting for the user.
+func (a *Agent) notifyApproval(req protocol.EventMsg) {
+    n := Notification{Type: NotifyApprovalRequested}
+    switch req := req.(type) {
+    case protocol.ExecApprovalRequestEvent:
+        n.CallID, n.Command, n.Cwd, n.Reason = req.CallID, req.Command, req.Cwd, req.Reason
+    case protocol.ApplyPatchApprovalRequestEvent:
+        n.CallID, n.Paths, n.Reason = req.CallID, req.Paths, req.Reason
+    }
+    a.notify(n)
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "strings"
+
+    "codex-go/internal/jsonschema"
+)
+
+// maxOutputRepairs bounds how often the model is asked to fix a final
+// answer that does not conform to the turn's output schema.
+const maxOutputRepairs = 2
+
+// outputInstructions tell the model about the output schema; providers
+// without a structured output mode only learn about it this way.
+const outputInstructions = "Your final answer (the reply in which you call no tools) must be a single JSON value conforming to the JSON Schema below, with no other text or code fences.\n"
+
+// outputRepairPrompt asks the model to fix a final answer.
+const outputRepairPrompt = "Your final answer does not conform to the output schema: %v. Reply with only the corrected JSON value."
+
+// outputError is returned by a turn whose final answer still did not
+// conform to the output schema once the repairs were spent.
+type outputError struct {
+    Err error
+}
+
+func (e *outputError) Error() string {
+    return fmt.Sprintf("final answer does not match output_schema: %v", e.Err)
+}
+
+func (e *outputError) Unwrap() error { return e.Err }
+
+// parseOutput checks a final answer against schema and returns it as
+// compact JSON. Code fences around the value are tolerated.
+func parseOutput(schema *jsonschema.Schema, text string) (json.RawMessage, error) {
+    text = strings.TrimSpace(text)
+    if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") && len(text) >= 6 {
+        text = strings.TrimSuffix(text, "```")
+        // Drop the info string of the opening fence, e.g. ```json.
+        if i := strings.IndexByte(text, '\n'); i >= 0 {
+            text = text[i+1:]
+        } else {
+            text = text[3:]
+        }
+        text = strings.TrimSpace(text)
+    }
+    if err := schema.Validate([]byte(text)); err != nil {
+        return nil, err
+    }
+    var buf bytes.Buffer
+    if err := json.Compact(&buf, []byte(text)); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
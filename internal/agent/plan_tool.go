@@ -0,0 +1,63 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    "codex-go/internal/protocol"
+)
+
+// updatePlanSchema is the JSON Schema of the update_plan arguments.
+const updatePlanSchema = `{
+  "type": "object",
+  "properties": {
+    "explanation": {"type": "string"},
+    "plan": {
+      "type": "array",
+      "description": "The full list of steps.",
+      "items": {
+        "type": "object",
+        "properties": {
+          "step": {"type": "string"},
+          "status": {"type": "string", "enum": ["pending", "in_progress", "completed"]}
+        },
+        "required": ["step", "status"],
+        "additionalProperties": false
+      }
+    }
+  },
+  "required": ["plan"],
+  "additionalProperties": false
+}`
+
+// updatePlanTool lets the model publish its task plan. Each call replaces
+// the session's plan and is forwarded to the client as plan_update; the
+// agent only checks that the plan is well formed.
+type updatePlanTool struct{}
+
+func (updatePlanTool) Spec() ToolSpec {
+    return ToolSpec{
+        Name: "update_plan",
+        Description: "Updates the task plan. Provide an optional explanation and the full list of steps, " +
+            "each with a status. While steps remain, exactly one is in_progress; an empty plan clears it.",
+        Parameters: json.RawMessage(updatePlanSchema),
+    }
+}
+
+func (updatePlanTool) Call(ctx context.Context, args json.RawMessage) (ToolResult, error) {
+    var p protocol.UpdatePlanArgs
+    if err := json.Unmarshal(args, &p); err != nil {
+        return ToolResult{Output: fmt.Sprintf("invalid arguments: %v", err)}, nil
+    }
+    if err := p.Validate(); err != nil {
+        return ToolResult{Output: fmt.Sprintf("invalid plan: %v", err)}, nil
+    }
+    if turn := turnFrom(ctx); turn != nil {
+        turn.agent.session.SetPlan(p)
+    }
+    if err := emitFromTool(ctx, protocol.PlanUpdateEvent{UpdatePlanArgs: p}); err != nil {
+        return ToolResult{}, err
+    }
+    return ToolResult{Output: "Plan updated", Success: true}, nil
+}
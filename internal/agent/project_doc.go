@@ -0,0 +1,101 @@
+package agent
+
+import (
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// ProjectDocName is the file in which a project gives the agent
+// instructions, like a README for agents.
+const ProjectDocName = "AGENTS.md"
+
+// DefaultProjectDocMaxBytes bounds the AGENTS.md content added to the
+// instructions.
+const DefaultProjectDocMaxBytes = 32 * 1024
+
+// projectDocSeparator sets the project docs apart from the instructions
+// before them.
+const projectDocSeparator = "--- project-doc ---"
+
+// projectDoc is the AGENTS.md content found for one cwd.
+type projectDoc struct {
+    text  string
+    paths []string
+}
+
+// projectDocFor returns the project docs for cwd, reading them the first
+// time the cwd is used so the instructions stay the same for the rest of
+// the session.
+func (a *Agent) projectDocFor(cwd string) projectDoc {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if d, ok := a.projectDocs[cwd]; ok {
+        return d
+    }
+    limit := a.cfg.ProjectDocMaxBytes
+    if limit == 0 {
+        limit = DefaultProjectDocMaxBytes
+    }
+    var d projectDoc
+    if limit > 0 {
+        d = loadProjectDoc(cwd, limit)
+    }
+    if a.projectDocs == nil {
+        a.projectDocs = make(map[string]projectDoc)
+    }
+    a.projectDocs[cwd] = d
+    return d
+}
+
+// loadProjectDoc concatenates the AGENTS.md files from the root of the git
+// repository containing cwd down to cwd, outermost first, so instructions
+// closer to cwd come later and take precedence. Outside a repository only
+// cwd is searched. Content beyond limit bytes is dropped; unreadable files
+// are skipped.
+func loadProjectDoc(cwd string, limit int) projectDoc {
+    dirs := []string{cwd}
+    if root := gitRoot(cwd); root != "" {
+        for dir := cwd; dir != root; {
+            dir = filepath.Dir(dir)
+            dirs = append(dirs, dir)
+        }
+    }
+
+    var d projectDoc
+    var parts []string
+    for i := len(dirs) - 1; i >= 0 && limit > 0; i-- {
+        path := filepath.Join(dirs[i], ProjectDocName)
+        f, err := os.Open(path)
+        if err != nil {
+            continue
+        }
+        data, err := io.ReadAll(io.LimitReader(f, int64(limit)))
+        f.Close()
+        text := strings.TrimSpace(string(data))
+        if err != nil || text == "" {
+            continue
+        }
+        limit -= len(data)
+        parts = append(parts, text)
+        d.paths = append(d.paths, path)
+    }
+    d.text = strings.Join(parts, "\n\n")
+    return d
+}
+
+// gitRoot returns the root of the git repository containing dir (the
+// nearest directory with a .git entry), or "" outside a repository.
+func gitRoot(dir string) string {
+    for {
+        if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+            return dir
+        }
+        parent := filepath.Dir(dir)
+        if parent == dir {
+            return ""
+        }
+        dir = parent
+    }
+}
@@ -0,0 +1,242 @@
+package agent
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+
+    "codex-go/internal/jsonschema"
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// maxReviewBytes caps the material gathered for one review.
+const maxReviewBytes = 1 << 20
+
+// reviewMaterial resolves a review target into the text under review: a
+// git diff for diff and commits targets, file contents for paths. It also
+// returns the paths involved.
+func reviewMaterial(ctx context.Context, cwd string, t protocol.ReviewTarget) (string, []string, error) {
+    switch t.Type {
+    case protocol.ReviewTargetDiff:
+        base := t.Base
+        if base == "" {
+            base = "HEAD"
+        }
+        return gitDiff(ctx, cwd, base)
+    case protocol.ReviewTargetCommits:
+        return gitDiff(ctx, cwd, t.Range)
+    case protocol.ReviewTargetPaths:
+        var sb strings.Builder
+        for _, p := range t.Paths {
+            abs := p
+            if !filepath.IsAbs(abs) {
+                abs = filepath.Join(cwd, abs)
+            }
+            b, err := os.ReadFile(abs)
+            if err != nil {
+                return "", nil, err
+            }
+            fmt.Fprintf(&sb, "=== %s\n%s\n", p, b)
+        }
+        return TruncateOutput(sb.String(), maxReviewBytes), t.Paths, nil
+    }
+    return "", nil, fmt.Errorf("unknown target type %q", t.Type)
+}
+
+// gitDiff runs `git diff <rev>` in cwd and lists the files it touches.
+func gitDiff(ctx context.Context, cwd, rev string) (string, []string, error) {
+    if strings.HasPrefix(rev, "-") {
+        return "", nil, fmt.Errorf("invalid revision %q", rev)
+    }
+    out, err := git(ctx, cwd, "diff", rev, "--")
+    if err != nil {
+        return "", nil, err
+    }
+    names, err := git(ctx, cwd, "diff", "--name-only", rev, "--")
+    if err != nil {
+        return "", nil, err
+    }
+    return TruncateOutput(out, maxReviewBytes), strings.Fields(names), nil
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+    return gitEnv(ctx, dir, nil, args...)
+}
+
+// gitEnv runs git in dir with env added to the environment and returns its
+// stdout.
+func gitEnv(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+    cmd := exec.CommandContext(ctx, "git", args...)
+    cmd.Dir = dir
+    if env != nil {
+        cmd.Env = append(os.Environ(), env...)
+    }
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout, cmd.Stderr = &stdout, &stderr
+    if err := cmd.Run(); err != nil {
+        if msg := strings.TrimSpace(stderr.String()); msg != "" {
+            return "", fmt.Errorf("git %s: %s", args[0], msg)
+        }
+        return "", fmt.Errorf("git %s: %w", args[0], err)
+    }
+    return stdout.String(), nil
+}
+
+// reviewInstructions replace the base instructions for review turns.
+const reviewInstructions = `You are codex-go acting as a code reviewer. You are given changes (a git diff) or file contents to review.
+
+Report the problems the author would want to fix before merging: bugs, wrong results, crashes, data loss, security issues, races, resource leaks, broken error handling, and code that does not do what its names and comments say. Skip matters of taste and style unless the user asks for them, and do not report what the changes merely remove. Every finding must be concrete and provable from the material: if you are not sure, leave it out. No findings is a fine result.
+
+For each finding give:
+- path: the file as named in the diff (or in the "=== path" header);
+- line_start and line_end: the affected lines in the new version of the file, as narrow as possible (omit both for a whole-file remark);
+- severity: critical (must fix: wrong results, data loss, security), high (should fix before merging), medium (worth fixing), low (minor);
+- title: one line stating the problem;
+- body: why it is wrong and how to fix it, briefly.
+
+End with a summary of one or two sentences giving your overall verdict.`
+
+// reviewSchema is the JSON Schema of the answer of a review turn, the
+// fields of review_output.
+const reviewSchema = `{
+  "type": "object",
+  "properties": {
+    "summary": {"type": "string"},
+    "findings": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "title": {"type": "string", "minLength": 1},
+          "body": {"type": "string"},
+          "severity": {"type": "string", "enum": ["critical", "high", "medium", "low"]},
+          "path": {"type": "string", "minLength": 1},
+          "line_start": {"type": "integer", "minimum": 1},
+          "line_end": {"type": "integer", "minimum": 1}
+        },
+        "required": ["title", "body", "severity", "path"],
+        "additionalProperties": false
+      }
+    }
+  },
+  "required": ["summary", "findings"],
+  "additionalProperties": false
+}`
+
+var reviewOutputSchema = jsonschema.MustCompile(reviewSchema)
+
+// reviewPrompt is the user message a model-backed review is run with.
+func reviewPrompt(op protocol.ReviewRequestOp, material string) string {
+    var sb strings.Builder
+    sb.WriteString("Review the following changes.\n")
+    if op.Instructions != "" {
+        sb.WriteString(op.Instructions + "\n")
+    }
+    sb.WriteString("\n" + material)
+    return sb.String()
+}
+
+// review runs a review_request turn: task_started, token_count for each
+// model request, review_output, task_complete. The model reviews with
+// reviewInstructions and answers with JSON matching reviewSchema, which is
+// checked like an output_schema answer; the review does not join the
+// conversation. With nothing to review, or on the canned backend, the
+// output reports what was looked at without findings.
+func (a *Agent) review(ctx context.Context, subID string, op protocol.ReviewRequestOp, emit EventSink) error {
+    cfg := a.sessionConfig()
+    material, paths, err := reviewMaterial(ctx, cfg.Cwd, op.Target)
+    if err != nil {
+        return emit(protocol.Event{ID: subID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, "review: %v", err)})
+    }
+    if err := emit(protocol.Event{ID: subID, Msg: taskStarted(cfg)}); err != nil {
+        return err
+    }
+    turn := &turnState{agent: a, subID: subID, emit: emit, cfg: cfg}
+    ctx = withTurn(ctx, turn)
+    prompt := reviewPrompt(op, material)
+    a.mu.Lock()
+    client := a.cfg.Client
+    a.mu.Unlock()
+
+    out := protocol.ReviewOutputEvent{Findings: []protocol.ReviewFinding{}}
+    switch {
+    case len(paths) == 0:
+        out.Summary = "Nothing to review."
+    case client == nil:
+        out.Summary = fmt.Sprintf("Reviewed %d file(s); no findings.", len(paths))
+        if err := emit(protocol.Event{ID: subID, Msg: a.recordUsage(nil, model.Prompt{Model: cfg.Model, Instructions: reviewInstructions, Messages: []model.Message{model.TextMessage("user", prompt)}}, model.TextMessage("assistant", out.Summary))}); err != nil {
+            return err
+        }
+    default:
+        out, err = a.modelReview(ctx, turn, client, prompt)
+        if err != nil {
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            if err := emit(protocol.Event{ID: subID, Msg: modelErrorEvent(err)}); err != nil {
+                return err
+            }
+            return emit(protocol.Event{ID: subID, Msg: protocol.TaskCompleteEvent{}})
+        }
+    }
+    if err := emit(protocol.Event{ID: subID, Msg: out}); err != nil {
+        return err
+    }
+    return emit(protocol.Event{ID: subID, Msg: protocol.TaskCompleteEvent{}})
+}
+
+// modelReview asks the model to review the material in prompt. Answers
+// that do not match reviewSchema are sent back for correction like
+// output_schema answers. The raw JSON is kept off the agent_message
+// stream.
+func (a *Agent) modelReview(ctx context.Context, turn *turnState, client model.Client, prompt string) (protocol.ReviewOutputEvent, error) {
+    instructions := reviewInstructions
+    if doc := a.projectDocFor(turn.cfg.Cwd); doc.text != "" {
+        // Projects may give review guidelines in AGENTS.md.
+        instructions += "\n\n" + projectDocSeparator + "\n\n" + doc.text
+    }
+    instructions += "\n\n" + outputInstructions + reviewSchema
+    msgs := []model.Message{model.TextMessage("user", prompt)}
+    for repairs := 0; ; repairs++ {
+        p := model.Prompt{
+            Model:           turn.cfg.Model,
+            Instructions:    instructions,
+            Messages:        msgs,
+            ReasoningEffort: turn.cfg.ReasoningEffort,
+            MaxOutputTokens: turn.cfg.MaxOutputTokens,
+            OutputSchema:    json.RawMessage(reviewSchema),
+            CacheKey:        a.SessionID(),
+        }
+        resp, err := a.sample(ctx, turn.quiet(), client, p)
+        if err != nil {
+            return protocol.ReviewOutputEvent{}, err
+        }
+        reply := resp.Message()
+        if err := turn.emit(protocol.Event{ID: turn.subID, Msg: a.recordUsage(resp.Usage, p, reply)}); err != nil {
+            return protocol.ReviewOutputEvent{}, err
+        }
+        var out protocol.ReviewOutputEvent
+        raw, err := parseOutput(reviewOutputSchema, resp.Text)
+        if err == nil {
+            if err = json.Unmarshal(raw, &out); err == nil {
+                err = out.Validate()
+            }
+        }
+        if err == nil {
+            return out, nil
+        }
+        if repairs == maxOutputRepairs {
+            return protocol.ReviewOutputEvent{}, &outputError{Err: err}
+        }
+        if err := notifyBackground(ctx, "review does not match the findings format (%v); asking again", err); err != nil {
+            return protocol.ReviewOutputEvent{}, err
+        }
+        msgs = append(msgs, reply, model.TextMessage("user", fmt.Sprintf(outputRepairPrompt, err)))
+    }
+}
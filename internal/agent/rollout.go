@@ -0,0 +1,214 @@
+package agent
+
+import (
+    "strconv"
+    "strings"
+
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+    "codex-go/internal/rollout"
+    "codex-go/internal/version"
+)
+
+// startRollout begins recording the session, once, when its first turn
+// starts; sessions that never run a turn leave no file behind. A failure
+// is returned once and the session then runs unrecorded.
+func (a *Agent) startRollout() error {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.rolloutStarted {
+        return nil
+    }
+    a.rolloutStarted = true
+    dir, err := a.rolloutDir()
+    if err != nil {
+        return err
+    }
+    cfg := a.cfg.withDefaults()
+    r, err := rollout.Create(dir, rollout.SessionMeta{
+        ID:             a.id,
+        Cwd:            cfg.Cwd,
+        CLIVersion:     version.Version,
+        Model:          cfg.Model,
+        ApprovalPolicy: cfg.ApprovalPolicy,
+        SandboxPolicy:  cfg.Sandbox.Mode,
+        Instructions:   cfg.Instructions,
+    })
+    if err != nil {
+        return err
+    }
+    a.rollout = r
+    return nil
+}
+
+// rolloutDir returns the directory sessions are recorded in. a.mu must be
+// held.
+func (a *Agent) rolloutDir() (string, error) {
+    if a.cfg.RolloutDir != "" {
+        return a.cfg.RolloutDir, nil
+    }
+    return rollout.DefaultDir()
+}
+
+// resume answers resume_session and fork_session: it loads the recorded
+// session, replays its events through emit, adopts its id, conversation
+// and token usage, and continues recording into the same file. A fork
+// first copies the session up to the requested turn into a new rollout
+// under a new id and continues that copy instead. Approval requests are
+// not replayed since nothing can answer them any more.
+func (a *Agent) resume(subID string, op protocol.Op, emit EventSink) error {
+    name, fork, turnID := protocol.OpResumeSession, false, ""
+    sel, _ := op.(protocol.ResumeSessionOp)
+    if f, ok := op.(protocol.ForkSessionOp); ok {
+        name, fork, turnID = protocol.OpForkSession, true, f.TurnID
+        sel = protocol.ResumeSessionOp{SessionID: f.SessionID, Path: f.Path, Last: f.Last}
+    }
+    fail := func(format string, args ...any) error {
+        return emit(protocol.Event{ID: subID, Msg: protocol.NewErrorEvent(protocol.ErrInvalidRequest, format, args...)})
+    }
+    a.mu.Lock()
+    started := a.rolloutStarted || a.turns > 0
+    if !started {
+        // Claimed now so no turn starts a new rollout meanwhile.
+        a.rolloutStarted = true
+    }
+    dir, dirErr := a.rolloutDir()
+    a.mu.Unlock()
+    if started {
+        return fail("%s must come before the first turn", name)
+    }
+    release := func() {
+        a.mu.Lock()
+        a.rolloutStarted = false
+        a.mu.Unlock()
+    }
+
+    path := sel.Path
+    var err error
+    switch {
+    case dirErr != nil && (path == "" || fork):
+        err = dirErr
+    case sel.Last:
+        path, err = rollout.Latest(dir)
+    case sel.SessionID != "":
+        path, err = rollout.Find(dir, sel.SessionID)
+    }
+    var r *rollout.Rollout
+    var rec *rollout.Recorder
+    switch {
+    case err != nil:
+    case fork:
+        if rec, err = rollout.Fork(dir, path, newSessionID(), turnID); err == nil {
+            path = rec.Path()
+            if r, err = rollout.Load(path); err != nil {
+                rec.Close()
+            }
+        }
+    default:
+        if r, err = rollout.Load(path); err == nil {
+            rec, err = rollout.Append(path)
+        }
+    }
+    if err != nil {
+        release()
+        return fail("%s: %v", name, err)
+    }
+
+    replayed := 0
+    var usage protocol.TokenUsage
+    var history int64
+    var plan protocol.UpdatePlanArgs
+    turns := 0
+    for _, ev := range r.Events {
+        switch msg := ev.Msg.(type) {
+        case protocol.ExecApprovalRequestEvent, protocol.ApplyPatchApprovalRequestEvent:
+            continue
+        case protocol.TokenCountEvent:
+            usage, history = msg.Total, msg.Last.TotalTokens
+        case protocol.PlanUpdateEvent:
+            plan = msg.UpdatePlanArgs
+        case protocol.SessionResetEvent:
+            history, plan = 0, protocol.UpdatePlanArgs{}
+        }
+        if n, err := strconv.Atoi(strings.TrimPrefix(ev.TurnID, "turn-")); err == nil && n > turns {
+            turns = n
+        }
+        if err := emit(ev); err != nil {
+            rec.Close()
+            return err
+        }
+        replayed++
+    }
+
+    a.session.Reset()
+    a.session.Append(r.Items...)
+    a.session.SetPlan(plan)
+    a.mu.Lock()
+    a.id = r.Meta.ID
+    a.rollout = rec
+    a.usage, a.history = usage, history
+    a.byModel = r.Usage()
+    a.turns = turns
+    a.mu.Unlock()
+    if fork {
+        return emit(protocol.Event{ID: subID, Msg: protocol.SessionForkedEvent{
+            SessionID:      r.Meta.ID,
+            ForkedFrom:     r.Meta.ForkedFrom,
+            TurnID:         turnID,
+            RolloutPath:    path,
+            Items:          len(r.Items),
+            ReplayedEvents: replayed,
+        }})
+    }
+    return emit(protocol.Event{ID: subID, Msg: protocol.SessionResumedEvent{
+        SessionID:      r.Meta.ID,
+        RolloutPath:    path,
+        Items:          len(r.Items),
+        ReplayedEvents: replayed,
+    }})
+}
+
+// RolloutPath returns the file the session is recorded in, or "" before
+// its first turn or when recording failed.
+func (a *Agent) RolloutPath() string {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.rollout == nil {
+        return ""
+    }
+    return a.rollout.Path()
+}
+
+func (a *Agent) recorder() *rollout.Recorder {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.rollout
+}
+
+// recordEvent adds ev to the rollout. Streaming deltas are left out: the
+// complete message and the conversation items carry the same text. Write
+// errors stop the recording and surface when the session shuts down.
+func (a *Agent) recordEvent(ev protocol.Event) {
+    switch ev.Msg.(type) {
+    case protocol.AgentMessageDeltaEvent, protocol.AgentReasoningDeltaEvent:
+        return
+    }
+    if r := a.recorder(); r != nil {
+        _ = r.RecordEvent(ev)
+    }
+}
+
+// recordItems adds conversation items to the rollout.
+func (a *Agent) recordItems(items ...model.Message) {
+    if r := a.recorder(); r != nil {
+        _ = r.RecordItems(items...)
+    }
+}
+
+// closeRollout ends the recording, reporting any write error it hit.
+func (a *Agent) closeRollout() error {
+    if r := a.recorder(); r != nil {
+        return r.Close()
+    }
+    return nil
+}
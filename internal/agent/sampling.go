@@ -0,0 +1,282 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "codex-go/internal/jsonrepair"
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// baseInstructions open the system message of every request; the session's
+// Instructions are appended.
+const baseInstructions = "You are codex-go, a coding agent working in the user's repository. Be concise and precise."
+
+// runTurn answers the turn's input. It samples the model, runs the tool
+// calls of each reply and sends their outputs back, until the model
+// answers without calling tools. Each reply with text is reported as
+// agent_message and each request as token_count. The exchange joins the
+// conversation once the turn completes; a failed turn leaves it unchanged.
+//
+// Requests are built so each one extends the previous one byte for byte
+// (same instructions and tools, the conversation only growing), which lets
+// providers serve the shared prefix from their prompt cache; the session
+// id is passed as the cache key.
+func (a *Agent) runTurn(ctx context.Context, turn *turnState) error {
+    a.mu.Lock()
+    client := a.cfg.Client
+    a.mu.Unlock()
+    history := a.session.Items()
+    pending := []model.Message{{Role: "user", Content: turn.input}}
+    if env := environmentContext(turn.cfg); env.Text() != latestEnvironment(history) {
+        pending = append([]model.Message{env}, pending...)
+    }
+
+    if client == nil {
+        return a.cannedTurn(turn, history, pending)
+    }
+
+    tools := a.modelTools()
+    nativeSearch, searchTool := a.webSearch(client)
+    if searchTool != nil {
+        spec := searchTool.Spec()
+        tools = append(tools, model.ToolSpec{Name: spec.Name, Description: spec.Description, Parameters: spec.Parameters})
+    }
+    instructions := a.instructions(turn.cfg)
+    var outputSchema json.RawMessage
+    if turn.schema != nil {
+        outputSchema = turn.cfg.OutputSchema
+        instructions += "\n\n" + outputInstructions + string(outputSchema)
+    }
+    repairs := 0
+    for round := 1; ; round++ {
+        prompt := model.Prompt{
+            Model:           turn.cfg.Model,
+            Instructions:    instructions,
+            Messages:        append(history[:len(history):len(history)], pending...),
+            Tools:           tools,
+            ReasoningEffort: turn.cfg.ReasoningEffort,
+            Verbosity:       turn.cfg.Verbosity,
+            MaxOutputTokens: turn.cfg.MaxOutputTokens,
+            WebSearch:       nativeSearch,
+            OutputSchema:    outputSchema,
+            CacheKey:        a.SessionID(),
+        }
+        resp, err := a.sample(ctx, turn, client, prompt)
+        if err != nil {
+            return err
+        }
+        // badArgs holds the calls whose arguments could not be repaired.
+        var badArgs map[string]error
+        for i := range resp.ToolCalls {
+            c := &resp.ToolCalls[i]
+            // Some compatible servers omit call ids; outputs still need
+            // one to refer to.
+            if c.ID == "" {
+                c.ID = fmt.Sprintf("call_%d_%d", round, i)
+            }
+            // Repaired before the reply joins the conversation, so later
+            // requests send the arguments back well-formed.
+            args, repaired, err := jsonrepair.Object(c.Arguments)
+            switch {
+            case err != nil:
+                if badArgs == nil {
+                    badArgs = map[string]error{}
+                }
+                badArgs[c.ID] = err
+            case repaired:
+                c.Arguments = args
+                if err := notifyBackground(ctx, "repaired malformed arguments of %s call %s", c.Name, c.ID); err != nil {
+                    return err
+                }
+            }
+        }
+        reply := resp.Message()
+        pending = append(pending, reply)
+
+        if resp.Text != "" || len(resp.ToolCalls) == 0 {
+            if err := turn.emit(protocol.Event{ID: turn.subID, Msg: protocol.AgentMessageEvent{Text: resp.Text}}); err != nil {
+                return err
+            }
+            turn.lastMessage = resp.Text
+        }
+        if err := turn.emit(protocol.Event{ID: turn.subID, Msg: a.recordUsage(resp.Usage, prompt, reply)}); err != nil {
+            return err
+        }
+        if len(resp.ToolCalls) == 0 {
+            if turn.schema != nil {
+                out, err := parseOutput(turn.schema, resp.Text)
+                if err != nil {
+                    if repairs == maxOutputRepairs {
+                        return &outputError{Err: err}
+                    }
+                    repairs++
+                    if err := notifyBackground(ctx, "final answer does not match output_schema (%v); asking again", err); err != nil {
+                        return err
+                    }
+                    pending = append(pending, model.TextMessage("user", fmt.Sprintf(outputRepairPrompt, err)))
+                    continue
+                }
+                turn.output = out
+            }
+            a.remember(pending...)
+            return nil
+        }
+
+        var images []model.ContentItem
+        for _, c := range resp.ToolCalls {
+            if err := badArgs[c.ID]; err != nil {
+                if err := turn.emit(protocol.Event{ID: turn.subID, Msg: protocol.ToolCallErrorEvent{CallID: c.ID, Name: c.Name, Message: err.Error()}}); err != nil {
+                    return err
+                }
+                pending = append(pending, model.ToolOutput(c.ID, fmt.Sprintf(badArgumentsOutput, c.Name, err)))
+                continue
+            }
+            res, err := a.callTool(ctx, c)
+            if err != nil {
+                return err
+            }
+            pending = append(pending, model.ToolOutput(c.ID, res.Output))
+            for _, uri := range res.Images {
+                images = append(images, model.ContentItem{Type: model.InputImage, ImageURL: uri})
+            }
+        }
+        if len(images) > 0 {
+            pending = append(pending, model.Message{Role: "user", Content: images})
+        }
+    }
+}
+
+// badArgumentsOutput tells the model a call was not run because its
+// arguments did not parse.
+const badArgumentsOutput = "%s was not called: its arguments are not a valid JSON object (%v). Call it again with the arguments as one JSON object."
+
+// cannedTurn answers pending, the turn's new items, with the offline echo
+// backend.
+func (a *Agent) cannedTurn(turn *turnState, history, pending []model.Message) error {
+    reply := cannedReply(turn.input)
+    for _, chunk := range strings.SplitAfter(reply, " ") {
+        if chunk == "" {
+            continue
+        }
+        if err := turn.emit(protocol.Event{ID: turn.subID, Msg: protocol.AgentMessageDeltaEvent{Delta: chunk}}); err != nil {
+            return err
+        }
+    }
+    if err := turn.emit(protocol.Event{ID: turn.subID, Msg: protocol.AgentMessageEvent{Text: reply}}); err != nil {
+        return err
+    }
+    turn.lastMessage = reply
+    answer := model.TextMessage("assistant", reply)
+    a.remember(append(pending, answer)...)
+    prompt := model.Prompt{Model: turn.cfg.Model, Instructions: a.instructions(turn.cfg), Messages: append(history, pending...)}
+    return turn.emit(protocol.Event{ID: turn.subID, Msg: a.recordUsage(nil, prompt, answer)})
+}
+
+// sample runs one model request, emitting deltas as they arrive. Requests
+// that fail retryably before producing output are retried with backoff,
+// each retry announced as background_event, up to the configured budget.
+// A retryable failure that ends the request (budget spent, or the stream
+// broke after output) is reported as stream_error.
+func (a *Agent) sample(ctx context.Context, turn *turnState, client model.Client, prompt model.Prompt) (model.Response, error) {
+    a.mu.Lock()
+    maxRetries := a.cfg.MaxRetries
+    a.mu.Unlock()
+    for attempt := 1; ; attempt++ {
+        streamed := false
+        var search nativeWebSearch
+        resp, err := client.Stream(ctx, prompt, func(ev model.StreamEvent) error {
+            streamed = true
+            var msg protocol.EventMsg
+            switch ev.Type {
+            case model.ReasoningDelta:
+                msg = protocol.AgentReasoningDeltaEvent{Delta: ev.Delta}
+            case model.WebSearchBegin, model.WebSearchEnd:
+                msg = search.event(ev)
+            default:
+                msg = protocol.AgentMessageDeltaEvent{Delta: ev.Delta}
+            }
+            return turn.emit(protocol.Event{ID: turn.subID, Msg: msg})
+        })
+        if err == nil {
+            return resp, nil
+        }
+        if ctx.Err() != nil || !model.Retryable(err) {
+            return model.Response{}, err
+        }
+        if streamed || attempt > maxRetries {
+            ev := modelErrorEvent(err)
+            stream := protocol.StreamErrorEvent{Code: ev.Code, Message: ev.Message, Attempts: attempt, RetryAfterMs: ev.RetryAfterMs}
+            if err := turn.emit(protocol.Event{ID: turn.subID, Msg: stream}); err != nil {
+                return model.Response{}, err
+            }
+            return model.Response{}, err
+        }
+        delay := model.Backoff(attempt, err)
+        if err := notifyBackground(ctx, "model request failed (%v); retrying in %s (%d/%d)", err, delay.Round(time.Millisecond), attempt, maxRetries); err != nil {
+            return model.Response{}, err
+        }
+        select {
+        case <-time.After(delay):
+        case <-ctx.Done():
+            return model.Response{}, ctx.Err()
+        }
+    }
+}
+
+// remember appends a completed exchange to the conversation and its
+// rollout. Assistant messages keep their reasoning items so reasoning
+// models can continue from them.
+func (a *Agent) remember(msgs ...model.Message) {
+    a.session.Append(msgs...)
+    a.recordItems(msgs...)
+}
+
+// instructions builds the system message for a turn: the base
+// instructions, the patch format for models that need it explained, the
+// user's instructions and those of the project's AGENTS.md files.
+func (a *Agent) instructions(cfg Config) string {
+    s := baseInstructions
+    if model.LookupFamily(cfg.Model).ApplyPatchInstructions {
+        s += "\n\n" + applyPatchInstructions
+    }
+    if cfg.Instructions != "" {
+        s += "\n\n" + cfg.Instructions
+    }
+    if doc := a.projectDocFor(cfg.Cwd); doc.text != "" {
+        s += "\n\n" + projectDocSeparator + "\n\n" + doc.text
+    }
+    return s
+}
+
+// modelErrorEvent classifies a failed model request, or a final answer
+// that did not match the output schema, for the client.
+func modelErrorEvent(err error) protocol.ErrorEvent {
+    var outErr *outputError
+    if errors.As(err, &outErr) {
+        return protocol.NewErrorEvent(protocol.ErrInvalidOutput, "%v", err)
+    }
+    var apiErr *model.APIError
+    if !errors.As(err, &apiErr) {
+        return protocol.NewErrorEvent(protocol.ErrModelUnavailable, "%v", err)
+    }
+    code := protocol.ErrInternal
+    switch {
+    case apiErr.RateLimited():
+        code = protocol.ErrModelRateLimited
+    case apiErr.ContextWindowExceeded():
+        code = protocol.ErrContextWindowExceeded
+    case apiErr.StatusCode >= 500:
+        code = protocol.ErrModelUnavailable
+    case apiErr.StatusCode == 400 || apiErr.StatusCode == 404:
+        code = protocol.ErrInvalidRequest
+    }
+    ev := protocol.NewErrorEvent(code, "%v", err)
+    ev.RetryAfterMs = apiErr.RetryAfter.Milliseconds()
+    return ev
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+    "sync"
+
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// Session is the conversation carried across the turns of one Agent: user
+// messages, assistant replies (with their reasoning), tool calls and tool
+// outputs, oldest first. Every model request re-sends all of it, which is
+// what gives follow-up prompts their context. The session also keeps the
+// model's latest plan (see update_plan).
+type Session struct {
+    mu    sync.Mutex
+    items []model.Message
+    plan  protocol.UpdatePlanArgs
+}
+
+// Items returns a copy of the conversation.
+func (s *Session) Items() []model.Message {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]model.Message(nil), s.items...)
+}
+
+// Len returns the number of items in the conversation.
+func (s *Session) Len() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return len(s.items)
+}
+
+// Append adds the items of a completed turn.
+func (s *Session) Append(items ...model.Message) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.items = append(s.items, items...)
+}
+
+// Replace swaps the conversation for items, e.g. a compacted summary.
+func (s *Session) Replace(items []model.Message) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.items = append([]model.Message(nil), items...)
+}
+
+// Reset forgets the conversation and the plan and returns how many items
+// were dropped.
+func (s *Session) Reset() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    n := len(s.items)
+    s.items = nil
+    s.plan = protocol.UpdatePlanArgs{}
+    return n
+}
+
+// Plan returns a copy of the current plan; its Plan is empty when the model
+// has not made one.
+func (s *Session) Plan() protocol.UpdatePlanArgs {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    p := s.plan
+    p.Plan = append([]protocol.PlanItem(nil), p.Plan...)
+    return p
+}
+
+// SetPlan replaces the plan.
+func (s *Session) SetPlan(p protocol.UpdatePlanArgs) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    p.Plan = append([]protocol.PlanItem(nil), p.Plan...)
+    s.plan = p
+}
@@ -0,0 +1,357 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "path/filepath"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    iexec "codex-go/internal/exec"
+    "codex-go/internal/protocol"
+    "codex-go/internal/safety"
+)
+
+// Limits of the shell tool.
+const (
+    // DefaultShellTimeout applies when the model does not ask for one.
+    DefaultShellTimeout = 60 * time.Second
+    // maxShellOutputBytes caps the output returned to the model.
+    maxShellOutputBytes = 64 << 10
+    // maxExecEventOutputBytes caps stdout and stderr in exec_command_end;
+    // the tail is kept.
+    maxExecEventOutputBytes = 10 << 10
+)
+
+// shellSchema is the JSON Schema of the shell arguments.
+const shellSchema = `{
+  "type": "object",
+  "properties": {
+    "command": {
+      "type": "array",
+      "items": {"type": "string"},
+      "minItems": 1,
+      "description": "The command to execute as an argv list, e.g. [\"bash\", \"-lc\", \"ls -la\"]."
+    },
+    "workdir": {"type": "string", "description": "Working directory, relative to the session's cwd. Defaults to the session's cwd."},
+    "timeout_sec": {"type": "integer", "minimum": 0, "description": "Kill the command after this many seconds. Defaults to 60."}
+  },
+  "required": ["command"],
+  "additionalProperties": false
+}`
+
+// shellArgs are the decoded arguments of a shell call.
+type shellArgs struct {
+    Command    []string `json:"command"`
+    Workdir    string   `json:"workdir,omitempty"`
+    TimeoutSec int      `json:"timeout_sec,omitempty"`
+}
+
+// shellTool runs commands through internal/exec and reports them as
+// exec_command_begin/end events.
+type shellTool struct {
+    runner iexec.Runner
+}
+
+func (shellTool) Spec() ToolSpec {
+    return ToolSpec{
+        Name: "shell",
+        Description: "Runs a command and returns its exit code, stdout and stderr. " +
+            "Use [\"bash\", \"-lc\", \"...\"] for pipes, redirection or globbing.",
+        Parameters: json.RawMessage(shellSchema),
+    }
+}
+
+func (t shellTool) Call(ctx context.Context, raw json.RawMessage) (ToolResult, error) {
+    var args shellArgs
+    if err := json.Unmarshal(raw, &args); err != nil {
+        return ToolResult{Output: fmt.Sprintf("invalid arguments: %v", err)}, nil
+    }
+    if len(args.Command) == 0 || args.Command[0] == "" {
+        return ToolResult{Output: "invalid arguments: missing command"}, nil
+    }
+    cwd := args.Workdir
+    if turn := turnFrom(ctx); turn != nil && !filepath.IsAbs(cwd) {
+        cwd = filepath.Join(turn.cfg.Cwd, cwd)
+    }
+    timeout := DefaultShellTimeout
+    if args.TimeoutSec > 0 {
+        timeout = time.Duration(args.TimeoutSec) * time.Second
+    }
+
+    var env iexec.EnvPolicy
+    var sandbox *iexec.SandboxPolicy
+    approve := approveExec
+    if turn := turnFrom(ctx); turn != nil {
+        env = turn.cfg.ShellEnvironmentPolicy
+        if turn.cfg.Runner != nil {
+            t.runner = turn.cfg.Runner
+        }
+        var unconfined bool
+        var err error
+        if sandbox, unconfined, err = turn.agent.sandboxPolicy(ctx, turn.cfg); err != nil {
+            return ToolResult{}, err
+        }
+        if unconfined && !turn.agent.escalated(args.Command) {
+            approve = approveUnconfined
+        }
+    }
+
+    callID := callIDFrom(ctx)
+    if res, ok, err := approve(ctx, callID, args.Command, cwd); !ok {
+        return res, err
+    }
+    opt := iexec.Options{Cwd: cwd, TimeoutSec: int(timeout / time.Second), EnvPolicy: &env, MaxOutputBytes: maxShellOutputBytes, Sandbox: sandbox}
+    if sandbox != nil && turnFrom(ctx).agent.escalated(args.Command) {
+        opt.Sandbox = nil
+    }
+    run, err := t.exec(ctx, callID, args.Command, opt, timeout)
+    if err != nil {
+        return ToolResult{}, err
+    }
+    if turn := turnFrom(ctx); turn != nil && opt.Sandbox != nil && run.sandboxDenied() && escalates(turn.cfg) {
+        req := protocol.ExecApprovalRequestEvent{CallID: callID, Command: args.Command, Cwd: cwd, Reason: sandboxDeniedReason}
+        decision, err := turn.agent.requestExecApproval(ctx, turn.subID, req, turn.emit)
+        if err != nil {
+            return ToolResult{}, err
+        }
+        switch decision {
+        case protocol.ReviewApprovedForSession:
+            turn.agent.mu.Lock()
+            if turn.agent.escalatedCommands == nil {
+                turn.agent.escalatedCommands = map[string]bool{}
+            }
+            turn.agent.escalatedCommands[commandKey(args.Command)] = true
+            turn.agent.mu.Unlock()
+            fallthrough
+        case protocol.ReviewApproved:
+            // A run of its own, which clients pairing begin and end
+            // events by call_id must not take for the first.
+            opt.Sandbox = nil
+            if run, err = t.exec(ctx, callID+escalatedSuffix, args.Command, opt, timeout); err != nil {
+                return ToolResult{}, err
+            }
+        case protocol.ReviewAbort:
+            return ToolResult{Output: "The user aborted. Stop and wait for further instructions."}, nil
+        }
+    }
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "exit_code: %d\n", run.code)
+    if run.stdout != "" {
+        fmt.Fprintf(&b, "stdout:\n%s\n", strings.TrimRight(run.stdout, "\n"))
+    }
+    if run.stderr != "" {
+        fmt.Fprintf(&b, "stderr:\n%s\n", strings.TrimRight(run.stderr, "\n"))
+    }
+    out := TruncateOutput(strings.TrimRight(b.String(), "\n"), maxShellOutputBytes)
+    return ToolResult{Output: out, Success: run.code == 0}, nil
+}
+
+// sandboxDeniedReason is the reason of the exec_approval_request asking to
+// run a command again outside the sandbox.
+const sandboxDeniedReason = "sandbox denied"
+
+// escalatedSuffix ends the call_id of the exec_command_begin/end pair of a
+// command run again outside the sandbox; the rest is the tool call's.
+const escalatedSuffix = "-escalated"
+
+// shellRun is the outcome of one run of a shell command, as reported to
+// the model.
+type shellRun struct {
+    res            iexec.ExecResult
+    stdout, stderr string
+    code           int
+}
+
+// sandboxDenied reports whether the run failed for what the sandbox denied
+// the command: writes, or the network.
+func (r shellRun) sandboxDenied() bool {
+    return r.code != 0 && (r.res.SandboxDenied || r.res.NetworkBlocked)
+}
+
+// exec runs argv once with opt, reported as an exec_command_begin/end
+// pair. The error ends the turn: the turn's context ended, or events
+// could not be sent.
+func (t shellTool) exec(ctx context.Context, callID string, argv []string, opt iexec.Options, timeout time.Duration) (shellRun, error) {
+    cwd := opt.Cwd
+    if err := emitFromTool(ctx, protocol.ExecCommandBeginEvent{CallID: callID, Command: argv, Cwd: cwd}); err != nil {
+        return shellRun{}, err
+    }
+    start := time.Now()
+    // Past maxShellOutputBytes, the head and tail of each stream are kept.
+    res, err := t.runner.Run(ctx, argv, opt)
+    stdout, stderr, code := iexec.Text(res.Stdout), iexec.Text(res.Stderr), res.ExitCode
+    elapsed := time.Since(start)
+    if res.Duration > 0 {
+        elapsed = res.Duration
+    }
+    if ctx.Err() != nil {
+        // The process was killed with the turn; still pair the begin event.
+        end := protocol.ExecCommandEndEvent{CallID: callID, Command: argv, Cwd: cwd, Stdout: tailOutput(stdout, maxExecEventOutputBytes), Stderr: "command aborted", ExitCode: -1, DurationMs: elapsed.Milliseconds(), Signal: res.Signal}
+        if err := emitFromTool(ctx, end); err != nil {
+            return shellRun{}, err
+        }
+        return shellRun{}, ctx.Err()
+    }
+    if err != nil {
+        code = -1
+        stderr = fmt.Sprintf("failed to start command: %v", err)
+    } else if res.TimedOut {
+        stderr += fmt.Sprintf("\ncommand timed out after %s", timeout)
+    } else if res.Signal != "" {
+        stderr += fmt.Sprintf("\ncommand terminated by %s", res.Signal)
+    }
+    if res.NetworkBlocked {
+        stderr += "\nthe command has no network access in this sandbox"
+    }
+    end := protocol.ExecCommandEndEvent{
+        CallID:     callID,
+        Command:    argv,
+        Cwd:        cwd,
+        Stdout:     tailOutput(stdout, maxExecEventOutputBytes),
+        Stderr:     tailOutput(stderr, maxExecEventOutputBytes),
+        ExitCode:   code,
+        DurationMs: elapsed.Milliseconds(),
+        Signal:     res.Signal,
+        TimedOut:   res.TimedOut,
+    }
+    if err := emitFromTool(ctx, end); err != nil {
+        return shellRun{}, err
+    }
+    return shellRun{res: res, stdout: stdout, stderr: stderr, code: code}, nil
+}
+
+// escalates reports whether, under cfg, a command the sandbox made fail
+// is offered to the user to run again outside it: under untrusted and
+// on-failure, as codex-rs does. Under on-request and never, the model is
+// told of the failure instead.
+func escalates(cfg Config) bool {
+    return cfg.ApprovalPolicy == protocol.ApprovalUntrusted || cfg.ApprovalPolicy == protocol.ApprovalOnFailure
+}
+
+// escalated reports whether argv was approved for the session to run
+// outside the sandbox.
+func (a *Agent) escalated(argv []string) bool {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.escalatedCommands[commandKey(argv)]
+}
+
+// approveExec asks the user whether argv may run in cwd, if the session's
+// policies say so (see execNeedsApproval). Unless it may, the result is
+// what to tell the model instead, or the error ends the turn.
+func approveExec(ctx context.Context, callID string, argv []string, cwd string) (ToolResult, bool, error) {
+    turn := turnFrom(ctx)
+    if turn == nil || !turn.agent.execNeedsApproval(turn.cfg, argv) {
+        return ToolResult{}, true, nil
+    }
+    req := protocol.ExecApprovalRequestEvent{CallID: callID, Command: argv, Cwd: cwd}
+    decision, err := turn.agent.requestExecApproval(ctx, turn.subID, req, turn.emit)
+    if err != nil {
+        return ToolResult{}, false, err
+    }
+    switch decision {
+    case protocol.ReviewApprovedForSession:
+        turn.agent.mu.Lock()
+        if turn.agent.approvedCommands == nil {
+            turn.agent.approvedCommands = map[string]bool{}
+        }
+        turn.agent.approvedCommands[commandKey(argv)] = true
+        turn.agent.mu.Unlock()
+    case protocol.ReviewDenied:
+        return ToolResult{Output: "The user rejected this command. Do not retry it unchanged."}, false, nil
+    case protocol.ReviewAbort:
+        return ToolResult{Output: "The user aborted. Stop and wait for further instructions."}, false, nil
+    }
+    return ToolResult{}, true, nil
+}
+
+// noSandboxReason is the reason of the exec_approval_request asking to run
+// a command that should be sandboxed where no sandbox is available.
+const noSandboxReason = "no sandbox available"
+
+// approveUnconfined asks the user whether argv may run in cwd without the
+// sandbox the session asked for, which the host cannot provide: commands
+// do not silently run unconfined. Under the never policy nobody is asked
+// and the command is refused. Approval for the session lets argv run
+// unconfined from then on, as escalation does.
+func approveUnconfined(ctx context.Context, callID string, argv []string, cwd string) (ToolResult, bool, error) {
+    turn := turnFrom(ctx)
+    if turn.cfg.ApprovalPolicy == protocol.ApprovalNever {
+        return ToolResult{Output: fmt.Sprintf("Commands cannot be sandboxed here (sandbox_mode %q), and the approval policy never asks the user to run them unconfined. The command was not run.", turn.cfg.Sandbox.Mode)}, false, nil
+    }
+    req := protocol.ExecApprovalRequestEvent{CallID: callID, Command: argv, Cwd: cwd, Reason: noSandboxReason}
+    decision, err := turn.agent.requestExecApproval(ctx, turn.subID, req, turn.emit)
+    if err != nil {
+        return ToolResult{}, false, err
+    }
+    switch decision {
+    case protocol.ReviewApprovedForSession:
+        turn.agent.mu.Lock()
+        if turn.agent.escalatedCommands == nil {
+            turn.agent.escalatedCommands = map[string]bool{}
+        }
+        turn.agent.escalatedCommands[commandKey(argv)] = true
+        turn.agent.mu.Unlock()
+    case protocol.ReviewDenied:
+        return ToolResult{Output: "The user rejected running this command without a sandbox. Do not retry it unchanged."}, false, nil
+    case protocol.ReviewAbort:
+        return ToolResult{Output: "The user aborted. Stop and wait for further instructions."}, false, nil
+    }
+    return ToolResult{}, true, nil
+}
+
+// execNeedsApproval decides whether argv must be confirmed by the user.
+// Only the untrusted policy asks, and not for known-safe (read-only)
+// commands or commands approved for the session.
+func (a *Agent) execNeedsApproval(cfg Config, argv []string) bool {
+    if cfg.ApprovalPolicy != protocol.ApprovalUntrusted || safety.IsKnownSafe(argv) {
+        return false
+    }
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return !a.approvedCommands[commandKey(argv)]
+}
+
+// sandboxPolicy returns the sandbox commands run in under cfg.Sandbox, in
+// the session cwd. Where commands cannot be sandboxed on the host (and no
+// cfg.Runner confines them) the policy is nil and unconfined is set: each
+// command then needs the user's approval (see approveUnconfined), as the
+// session is told once.
+func (a *Agent) sandboxPolicy(ctx context.Context, cfg Config) (p *iexec.SandboxPolicy, unconfined bool, err error) {
+    if !cfg.Sandbox.Confines() {
+        return nil, false, nil
+    }
+    if err := iexec.SandboxAvailable(); err != nil && cfg.Runner == nil {
+        a.mu.Lock()
+        warned := a.sandboxWarned
+        a.sandboxWarned = true
+        a.mu.Unlock()
+        if !warned {
+            return nil, true, notifyBackground(ctx, "commands cannot be sandboxed, so each needs approval: %v", err)
+        }
+        return nil, true, nil
+    }
+    sandbox := cfg.Sandbox
+    if sandbox.Mode == protocol.SandboxWorkspaceWrite && cfg.Cwd != "" {
+        sandbox.WritableRoots = append([]string{cfg.Cwd}, sandbox.WritableRoots...)
+    }
+    return &sandbox, false, nil
+}
+
+func commandKey(argv []string) string { return strings.Join(argv, "\x00") }
+
+// tailOutput keeps the last max bytes of s (on a UTF-8 boundary).
+func tailOutput(s string, max int) string {
+    if len(s) <= max {
+        return s
+    }
+    cut := len(s) - max
+    for cut < len(s) && !utf8.RuneStart(s[cut]) {
+        cut++
+    }
+    return fmt.Sprintf("[... %d bytes omitted]\n", cut) + s[cut:]
+}
@@ -0,0 +1,69 @@
+package agent
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// worktreeSnapshot is the state of a git worktree at one moment, stored as
+// a tree object in the repository.
+type worktreeSnapshot struct {
+    root string // top-level directory of the worktree
+    tree string // id of the tree object
+}
+
+// snapshotWorktree records the worktree containing dir, untracked files
+// included and ignored files left out, without touching the user's index,
+// HEAD or branches: the files are staged into a temporary copy of the
+// index and written as a tree. It fails outside a git worktree.
+func snapshotWorktree(ctx context.Context, dir string) (worktreeSnapshot, error) {
+    out, err := git(ctx, dir, "rev-parse", "--show-toplevel", "--absolute-git-dir")
+    if err != nil {
+        return worktreeSnapshot{}, err
+    }
+    lines := strings.Fields(out)
+    if len(lines) != 2 {
+        return worktreeSnapshot{}, fmt.Errorf("not a git worktree: %s", dir)
+    }
+    root, gitDir := lines[0], lines[1]
+
+    index, err := os.CreateTemp("", "codex-index-")
+    if err != nil {
+        return worktreeSnapshot{}, err
+    }
+    defer os.Remove(index.Name())
+    // Starting from the real index lets git skip rehashing unchanged files.
+    if f, err := os.Open(filepath.Join(gitDir, "index")); err == nil {
+        _, err = io.Copy(index, f)
+        f.Close()
+        if err != nil {
+            index.Close()
+            return worktreeSnapshot{}, err
+        }
+    }
+    if err := index.Close(); err != nil {
+        return worktreeSnapshot{}, err
+    }
+    env := []string{"GIT_INDEX_FILE=" + index.Name()}
+    if _, err := gitEnv(ctx, root, env, "add", "--all", "--", "."); err != nil {
+        return worktreeSnapshot{}, err
+    }
+    tree, err := gitEnv(ctx, root, env, "write-tree")
+    if err != nil {
+        return worktreeSnapshot{}, err
+    }
+    return worktreeSnapshot{root: root, tree: strings.TrimSpace(tree)}, nil
+}
+
+// diff returns the changes from s to later as a git diff, with paths
+// relative to the worktree root.
+func (s worktreeSnapshot) diff(ctx context.Context, later worktreeSnapshot) (string, error) {
+    if later.tree == s.tree {
+        return "", nil
+    }
+    return git(ctx, s.root, "diff", "--no-color", "--no-ext-diff", s.tree, later.tree)
+}
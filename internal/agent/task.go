@@ -0,0 +1,69 @@
+package agent
+
+import (
+    "context"
+    "errors"
+
+    "codex-go/internal/protocol"
+)
+
+// errInterrupted is the cancellation cause of a turn stopped by interrupt.
+var errInterrupted = errors.New("interrupted")
+
+// task is the turn currently executing. Its context is cancelled by
+// interrupt, which stops the model request, pending approvals and the
+// processes its tools started.
+type task struct {
+    subID  string
+    turnID string
+    cancel context.CancelCauseFunc
+}
+
+// runTask runs the turn for sub under its own context, registered as the
+// session's current task. A turn stopped by interrupt ends with
+// turn_aborted instead of task_complete; its exchange is not added to the
+// conversation, so the next turn continues from the state before it.
+func (a *Agent) runTask(ctx context.Context, sub protocol.Submission, turnID string, emit EventSink) error {
+    ctx, cancel := context.WithCancelCause(ctx)
+    defer cancel(nil)
+    t := &task{subID: sub.ID, turnID: turnID, cancel: cancel}
+    a.mu.Lock()
+    a.task = t
+    a.mu.Unlock()
+    defer func() {
+        a.mu.Lock()
+        if a.task == t {
+            a.task = nil
+        }
+        a.mu.Unlock()
+    }()
+
+    err := a.submit(ctx, sub, emit)
+    if err != nil && errors.Is(context.Cause(ctx), errInterrupted) {
+        return emit(protocol.Event{ID: sub.ID, Msg: protocol.TurnAbortedEvent{Reason: protocol.TurnAbortInterrupted}})
+    }
+    return err
+}
+
+// interrupt cancels the running task. It reports false when no task is
+// running.
+func (a *Agent) interrupt() bool {
+    a.mu.Lock()
+    t := a.task
+    a.mu.Unlock()
+    if t == nil {
+        return false
+    }
+    t.cancel(errInterrupted)
+    return true
+}
+
+// runningTurnID returns the id of the turn being executed, or "".
+func (a *Agent) runningTurnID() string {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.task == nil {
+        return ""
+    }
+    return a.task.turnID
+}
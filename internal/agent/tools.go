@@ -0,0 +1,152 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "sort"
+
+    iexec "codex-go/internal/exec"
+    "codex-go/internal/model"
+)
+
+// ToolSpec describes a tool offered to the model: a function name, a
+// description and a JSON Schema for its arguments.
+type ToolSpec struct {
+    Name        string          `json:"name"`
+    Description string          `json:"description,omitempty"`
+    Parameters  json.RawMessage `json:"parameters"`
+}
+
+// ToolResult is the outcome of a tool call. It is fed back to the model as
+// the function_call_output conversation item for the call.
+type ToolResult struct {
+    Output  string `json:"output"`
+    Success bool   `json:"success"`
+    // Images are data: URIs of images the call shows the model. Function
+    // outputs can only hold text, so they follow the outputs of the reply's
+    // calls as a user message.
+    Images []string `json:"-"`
+}
+
+// Tool is something the model can call during a turn. Returning an error
+// means the call could not be performed at all; failures the model should
+// see (non-zero exit, tool-reported errors) belong in ToolResult.
+type Tool interface {
+    Spec() ToolSpec
+    Call(ctx context.Context, args json.RawMessage) (ToolResult, error)
+}
+
+// ToolRegistry holds the tools available to an agent, keyed by name.
+type ToolRegistry struct {
+    tools map[string]Tool
+}
+
+// NewToolRegistry returns an empty registry.
+func NewToolRegistry() *ToolRegistry { return &ToolRegistry{tools: map[string]Tool{}} }
+
+// Register adds t, rejecting duplicate names.
+func (r *ToolRegistry) Register(t Tool) error {
+    name := t.Spec().Name
+    if _, dup := r.tools[name]; dup {
+        return fmt.Errorf("tool %q registered twice", name)
+    }
+    r.tools[name] = t
+    return nil
+}
+
+// Lookup returns the tool with the given name.
+func (r *ToolRegistry) Lookup(name string) (Tool, bool) {
+    if r == nil {
+        return nil, false
+    }
+    t, ok := r.tools[name]
+    return t, ok
+}
+
+// Specs returns the specs of all registered tools sorted by name, which
+// keeps the tool list stable across requests.
+func (r *ToolRegistry) Specs() []ToolSpec {
+    if r == nil {
+        return nil
+    }
+    out := make([]ToolSpec, 0, len(r.tools))
+    for _, t := range r.tools {
+        out = append(out, t.Spec())
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+    return out
+}
+
+// builtinTools are available to every agent in addition to Config.Tools.
+var builtinTools = func() *ToolRegistry {
+    r := NewToolRegistry()
+    _ = r.Register(updatePlanTool{})
+    _ = r.Register(shellTool{runner: iexec.NewLocalRunner()})
+    _ = r.Register(execSessionTool{runner: iexec.NewLocalRunner()})
+    _ = r.Register(applyPatchTool{})
+    _ = r.Register(viewImageTool{})
+    return r
+}()
+
+// lookupTool finds a tool by name, built-ins first.
+func (a *Agent) lookupTool(name string) (Tool, bool) {
+    if t, ok := builtinTools.Lookup(name); ok {
+        return t, true
+    }
+    if name == webSearchToolName {
+        a.mu.Lock()
+        client := a.cfg.Client
+        a.mu.Unlock()
+        if _, t := a.webSearch(client); t != nil {
+            return t, true
+        }
+    }
+    return a.tools().Lookup(name)
+}
+
+// tools returns the session's configured (non built-in) tools.
+func (a *Agent) tools() *ToolRegistry {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.cfg.Tools
+}
+
+// toolSpecs lists every tool offered to the model, sorted by name.
+func (a *Agent) toolSpecs() []ToolSpec {
+    specs := append(builtinTools.Specs(), a.tools().Specs()...)
+    sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+    return specs
+}
+
+// modelTools converts toolSpecs for a model request.
+func (a *Agent) modelTools() []model.ToolSpec {
+    specs := a.toolSpecs()
+    out := make([]model.ToolSpec, 0, len(specs))
+    for _, s := range specs {
+        out = append(out, model.ToolSpec{Name: s.Name, Description: s.Description, Parameters: s.Parameters})
+    }
+    return out
+}
+
+// callTool runs one tool call and returns the result sent back to the
+// model. Unknown tools and failed calls are reported to the model, which
+// can react to them; only cancellation ends the turn.
+func (a *Agent) callTool(ctx context.Context, call model.ToolCall) (ToolResult, error) {
+    t, ok := a.lookupTool(call.Name)
+    if !ok {
+        return ToolResult{Output: fmt.Sprintf("unknown tool %q", call.Name)}, nil
+    }
+    args := json.RawMessage(call.Arguments)
+    if len(args) == 0 {
+        args = json.RawMessage("{}")
+    }
+    res, err := t.Call(withCallID(ctx, call.ID), args)
+    if err != nil {
+        if ctx.Err() != nil {
+            return ToolResult{}, ctx.Err()
+        }
+        return ToolResult{Output: fmt.Sprintf("tool %s failed: %v", call.Name, err)}, nil
+    }
+    return res, nil
+}
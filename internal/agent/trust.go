@@ -0,0 +1,56 @@
+package agent
+
+import (
+    "fmt"
+    "os"
+    "strings"
+
+    "codex-go/internal/protocol"
+)
+
+// ElevatedSettings lists those of a sandbox mode and an approval policy
+// that let the agent change the project without asking: a writable
+// sandbox, or an approval policy that runs commands unasked. They are only
+// allowed in projects the user trusts (see Config.Trusted).
+func ElevatedSettings(sandboxMode, approvalPolicy string) []string {
+    var out []string
+    switch sandboxMode {
+    case protocol.SandboxWorkspaceWrite, protocol.SandboxDangerFullAccess:
+        out = append(out, fmt.Sprintf("sandbox_mode = %q", sandboxMode))
+    }
+    switch approvalPolicy {
+    case protocol.ApprovalNever, protocol.ApprovalOnFailure:
+        out = append(out, fmt.Sprintf("approval_policy = %q", approvalPolicy))
+    }
+    return out
+}
+
+// Allows returns an error when sandboxMode or approvalPolicy, asked for by
+// a client, are elevated (see ElevatedSettings) and the session cwd is in
+// a project Trusted does not trust.
+func (c Config) Allows(sandboxMode, approvalPolicy string) error {
+    elevated := ElevatedSettings(sandboxMode, approvalPolicy)
+    if c.Trusted == nil || len(elevated) == 0 {
+        return nil
+    }
+    cwd := c.Cwd
+    if cwd == "" {
+        cwd, _ = os.Getwd()
+    }
+    if c.Trusted(cwd) {
+        return nil
+    }
+    return fmt.Errorf("%s is not in a trusted project; %s is not allowed there", cwd, strings.Join(elevated, " and "))
+}
+
+// dropUntrusted falls back to the default sandbox and approval policy
+// where c's own are not allowed: a session whose cwd moved into an
+// untrusted project does not take its elevated settings along.
+func (c *Config) dropUntrusted() {
+    if c.Allows(c.Sandbox.Mode, "") != nil {
+        c.Sandbox.Mode = DefaultSandboxMode
+    }
+    if c.Allows("", c.ApprovalPolicy) != nil {
+        c.ApprovalPolicy = DefaultApprovalPolicy
+    }
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+
+    "codex-go/internal/jsonschema"
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// turnState is what tools running inside a turn can reach through their
+// context: the agent, the submission being answered, the event sink, the
+// turn's effective settings, the user's input as model content, and the
+// turn's file-change tracker.
+type turnState struct {
+    agent *Agent
+    subID string
+    emit  EventSink
+    cfg   Config
+    input []model.ContentItem
+    diff  turnDiff
+    // lastMessage is the latest agent_message of the turn.
+    lastMessage string
+    // schema is the compiled output schema, if the turn has one; output
+    // is the final answer once it conformed.
+    schema *jsonschema.Schema
+    output json.RawMessage
+}
+
+// quiet returns a turn emitting like t except for message and reasoning
+// deltas, for model requests whose reply is not an answer to the user.
+func (t *turnState) quiet() *turnState {
+    return &turnState{agent: t.agent, subID: t.subID, cfg: t.cfg, emit: func(ev protocol.Event) error {
+        switch ev.Msg.(type) {
+        case protocol.AgentMessageDeltaEvent, protocol.AgentReasoningDeltaEvent:
+            return nil
+        }
+        return t.emit(ev)
+    }}
+}
+
+type turnKey struct{}
+
+func withTurn(ctx context.Context, t *turnState) context.Context {
+    return context.WithValue(ctx, turnKey{}, t)
+}
+
+// turnFrom returns the turn ctx belongs to, or nil outside a turn.
+func turnFrom(ctx context.Context) *turnState {
+    t, _ := ctx.Value(turnKey{}).(*turnState)
+    return t
+}
+
+type callIDKey struct{}
+
+func withCallID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, callIDKey{}, id)
+}
+
+// callIDFrom returns the id of the tool call ctx was made for, which tools
+// use to pair their begin/end events. It is empty outside a call.
+func callIDFrom(ctx context.Context) string {
+    id, _ := ctx.Value(callIDKey{}).(string)
+    return id
+}
+
+// emitFromTool sends msg as an event of the current turn. It is a no-op
+// outside a turn.
+func emitFromTool(ctx context.Context, msg protocol.EventMsg) error {
+    t := turnFrom(ctx)
+    if t == nil {
+        return nil
+    }
+    return t.emit(protocol.Event{ID: t.subID, Msg: msg})
+}
+
+// notifyBackground reports an operational detail of the current turn
+// (a retry, a fallback) as a background_event rather than an error.
+func notifyBackground(ctx context.Context, format string, args ...any) error {
+    return emitFromTool(ctx, protocol.BackgroundEvent{Message: fmt.Sprintf(format, args...)})
+}
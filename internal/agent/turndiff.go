@@ -0,0 +1,140 @@
+package agent
+
+import (
+    "context"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+
+    "codex-go/internal/diff"
+)
+
+// turnDiff works out what a turn changed, for the turn_diff event. In a
+// git worktree it snapshots the worktree when the turn starts and diffs
+// against it at the end, which also catches files changed by commands.
+// Elsewhere it remembers the content files had before the agent's tools
+// first touched them in the turn.
+type turnDiff struct {
+    // base is the worktree snapshot taken when the turn started and end
+    // the one taken when it finished; nil outside a git worktree (end also
+    // until taken).
+    base, end *worktreeSnapshot
+    // ghosted is set once the snapshots were kept for undo.
+    ghosted bool
+
+    mu sync.Mutex
+    // baseline maps absolute paths to their original content; nil means
+    // the file did not exist.
+    baseline map[string]*string
+}
+
+// begin takes the snapshot of the worktree containing cwd, if any.
+func (t *turnDiff) begin(ctx context.Context, cwd string) {
+    if s, err := snapshotWorktree(ctx, cwd); err == nil {
+        t.base = &s
+    }
+}
+
+// finish takes the snapshot of the worktree as the turn left it, once,
+// and returns both snapshots. ok is false outside a git worktree or when
+// git failed.
+func (t *turnDiff) finish(ctx context.Context) (base, end worktreeSnapshot, ok bool) {
+    if t.base == nil {
+        return worktreeSnapshot{}, worktreeSnapshot{}, false
+    }
+    if t.end == nil {
+        s, err := snapshotWorktree(ctx, t.base.root)
+        if err != nil {
+            return worktreeSnapshot{}, worktreeSnapshot{}, false
+        }
+        t.end = &s
+    }
+    return *t.base, *t.end, true
+}
+
+// result returns the unified diff of the turn. The snapshot diff is used
+// when there is one; the tracked files otherwise, or when git fails.
+func (t *turnDiff) result(ctx context.Context, root string) string {
+    if base, end, ok := t.finish(ctx); ok {
+        if d, err := base.diff(ctx, end); err == nil {
+            return d
+        }
+    }
+    return t.unified(root)
+}
+
+// TrackFileChange must be called by tools right before they create, modify
+// or delete path. Only the first call per path and turn takes a snapshot.
+// It is a no-op outside a turn.
+func TrackFileChange(ctx context.Context, path string) {
+    turn := turnFrom(ctx)
+    if turn == nil {
+        return
+    }
+    t := &turn.diff
+    abs, err := filepath.Abs(path)
+    if err != nil {
+        return
+    }
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.baseline == nil {
+        t.baseline = map[string]*string{}
+    }
+    if _, seen := t.baseline[abs]; seen {
+        return
+    }
+    if b, err := os.ReadFile(abs); err == nil {
+        s := string(b)
+        t.baseline[abs] = &s
+    } else {
+        t.baseline[abs] = nil
+    }
+}
+
+// unified compares every tracked file with its current content. Paths are
+// shown relative to root when they are inside it.
+func (t *turnDiff) unified(root string) string {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    paths := make([]string, 0, len(t.baseline))
+    for p := range t.baseline {
+        paths = append(paths, p)
+    }
+    sort.Strings(paths)
+
+    var sb strings.Builder
+    for _, p := range paths {
+        name := p
+        if rel, err := filepath.Rel(root, p); err == nil && !strings.HasPrefix(rel, "..") {
+            name = filepath.ToSlash(rel)
+        }
+        before := t.baseline[p]
+        var after *string
+        if b, err := os.ReadFile(p); err == nil {
+            s := string(b)
+            after = &s
+        }
+        from, to := "a/"+name, "b/"+name
+        var a, b string
+        switch {
+        case before == nil && after == nil:
+            continue
+        case before == nil:
+            from, b = "/dev/null", *after
+        case after == nil:
+            a, to = *before, "/dev/null"
+        default:
+            a, b = *before, *after
+        }
+        d := diff.Unified(from, to, a, b, diff.DefaultContext)
+        if d == "" {
+            continue
+        }
+        sb.WriteString("diff --git a/" + name + " b/" + name + "\n")
+        sb.WriteString(d)
+    }
+    return sb.String()
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "path/filepath"
+)
+
+// viewImageSchema is the JSON Schema of the view_image arguments.
+const viewImageSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "description": "Path of the image file, relative to the working directory."}
+  },
+  "required": ["path"],
+  "additionalProperties": false
+}`
+
+// viewImageTool lets the model look at a local image, such as a
+// screenshot a command produced. The image is read like a local_image
+// input (validated, downscaled when large) and attached to the
+// conversation after the call's output.
+type viewImageTool struct{}
+
+func (viewImageTool) Spec() ToolSpec {
+    return ToolSpec{
+        Name:        "view_image",
+        Description: "Attaches a local image file (PNG, JPEG, GIF or WebP) to the conversation so you can see it.",
+        Parameters:  json.RawMessage(viewImageSchema),
+    }
+}
+
+func (viewImageTool) Call(ctx context.Context, raw json.RawMessage) (ToolResult, error) {
+    var args struct {
+        Path string `json:"path"`
+    }
+    if err := json.Unmarshal(raw, &args); err != nil {
+        return ToolResult{Output: fmt.Sprintf("invalid arguments: %v", err)}, nil
+    }
+    if args.Path == "" {
+        return ToolResult{Output: "invalid arguments: missing path"}, nil
+    }
+    path := args.Path
+    if turn := turnFrom(ctx); turn != nil && !filepath.IsAbs(path) {
+        path = filepath.Join(turn.cfg.Cwd, path)
+    }
+    uri, err := imageDataURI(path)
+    if err != nil {
+        return ToolResult{Output: fmt.Sprintf("cannot attach %s: %v", args.Path, err)}, nil
+    }
+    return ToolResult{Output: "attached image " + args.Path, Success: true, Images: []string{uri}}, nil
+}
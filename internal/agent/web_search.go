@@ -0,0 +1,230 @@
+package agent
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// webSearchToolName is the function the model calls to search the web
+// when the provider has no search of its own.
+const webSearchToolName = "web_search"
+
+// DefaultWebSearchResults is the number of results asked of a search API.
+const DefaultWebSearchResults = 5
+
+// maxWebSearchResponseBytes caps the search API response read.
+const maxWebSearchResponseBytes = 1 << 20
+
+// webSearchSchema is the JSON Schema of the web_search arguments.
+const webSearchSchema = `{
+  "type": "object",
+  "properties": {
+    "query": {"type": "string", "description": "What to search the web for."}
+  },
+  "required": ["query"],
+  "additionalProperties": false
+}`
+
+// WebSearchAPI is a search service answering GET <URL>?q=<query>&count=<n>
+// with JSON results, for providers that cannot search the web themselves.
+// Query parameters already in URL are kept (SearXNG needs format=json).
+// SearXNG-style ({"results":[{"title","url","content"}]}) and Brave-style
+// ({"web":{"results":[{"title","url","description"}]}}) bodies are
+// understood.
+type WebSearchAPI struct {
+    URL string
+    // Header is sent with every request, e.g. the API key.
+    Header http.Header
+    // MaxResults is the number of results asked for. 0 means
+    // DefaultWebSearchResults.
+    MaxResults int
+    // Client sends the requests. nil means http.DefaultClient.
+    Client *http.Client
+}
+
+// WebSearchResult is one hit of a search.
+type WebSearchResult struct {
+    Title   string
+    URL     string
+    Snippet string
+}
+
+// Search queries the API.
+func (s *WebSearchAPI) Search(ctx context.Context, query string) ([]WebSearchResult, error) {
+    n := s.MaxResults
+    if n <= 0 {
+        n = DefaultWebSearchResults
+    }
+    u, err := url.Parse(s.URL)
+    if err != nil {
+        return nil, fmt.Errorf("web search: %w", err)
+    }
+    q := u.Query()
+    q.Set("q", query)
+    q.Set("count", strconv.Itoa(n))
+    u.RawQuery = q.Encode()
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+    if err != nil {
+        return nil, fmt.Errorf("web search: %w", err)
+    }
+    for k, v := range s.Header {
+        req.Header[k] = v
+    }
+    req.Header.Set("Accept", "application/json")
+    client := s.Client
+    if client == nil {
+        client = http.DefaultClient
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("web search: %w", err)
+    }
+    defer resp.Body.Close()
+    data, err := io.ReadAll(io.LimitReader(resp.Body, maxWebSearchResponseBytes))
+    if err != nil {
+        return nil, fmt.Errorf("web search: %w", err)
+    }
+    if resp.StatusCode/100 != 2 {
+        return nil, fmt.Errorf("web search: http %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+    }
+
+    type hit struct {
+        Title       string `json:"title"`
+        URL         string `json:"url"`
+        Content     string `json:"content"`
+        Description string `json:"description"`
+        Snippet     string `json:"snippet"`
+    }
+    var body struct {
+        Results []hit `json:"results"`
+        Web     struct {
+            Results []hit `json:"results"`
+        } `json:"web"`
+    }
+    if err := json.Unmarshal(data, &body); err != nil {
+        return nil, fmt.Errorf("web search: bad response: %w", err)
+    }
+    hits := append(body.Results, body.Web.Results...)
+    var out []WebSearchResult
+    for _, h := range hits {
+        if len(out) == n {
+            break
+        }
+        snippet := h.Content
+        if snippet == "" {
+            snippet = h.Description
+        }
+        if snippet == "" {
+            snippet = h.Snippet
+        }
+        out = append(out, WebSearchResult{Title: h.Title, URL: h.URL, Snippet: snippet})
+    }
+    return out, nil
+}
+
+// webSearchTool offers a WebSearchAPI to the model and reports each
+// search as web_search_begin/end. The results reach the model as the
+// call's output.
+type webSearchTool struct {
+    api *WebSearchAPI
+}
+
+func (webSearchTool) Spec() ToolSpec {
+    return ToolSpec{
+        Name:        webSearchToolName,
+        Description: "Searches the web and returns the top results (title, URL and snippet). Use it for information that is recent or not in the repository.",
+        Parameters:  json.RawMessage(webSearchSchema),
+    }
+}
+
+func (t webSearchTool) Call(ctx context.Context, raw json.RawMessage) (ToolResult, error) {
+    var args struct {
+        Query string `json:"query"`
+    }
+    if err := json.Unmarshal(raw, &args); err != nil {
+        return ToolResult{Output: fmt.Sprintf("invalid arguments: %v", err)}, nil
+    }
+    if strings.TrimSpace(args.Query) == "" {
+        return ToolResult{Output: "invalid arguments: missing query"}, nil
+    }
+    id := callIDFrom(ctx)
+    if err := emitFromTool(ctx, protocol.WebSearchBeginEvent{CallID: id, Query: args.Query}); err != nil {
+        return ToolResult{}, err
+    }
+    start := time.Now()
+    results, err := t.api.Search(ctx, args.Query)
+    end := protocol.WebSearchEndEvent{CallID: id, Query: args.Query, ResultCount: len(results), DurationMs: time.Since(start).Milliseconds()}
+    if err != nil {
+        end.Error = err.Error()
+    }
+    if err := emitFromTool(ctx, end); err != nil {
+        return ToolResult{}, err
+    }
+    if err != nil {
+        if ctx.Err() != nil {
+            return ToolResult{}, ctx.Err()
+        }
+        return ToolResult{Output: err.Error()}, nil
+    }
+    if len(results) == 0 {
+        return ToolResult{Output: "No results.", Success: true}, nil
+    }
+    var sb strings.Builder
+    for i, r := range results {
+        fmt.Fprintf(&sb, "%d. %s\n   %s\n", i+1, r.Title, r.URL)
+        if r.Snippet != "" {
+            fmt.Fprintf(&sb, "   %s\n", r.Snippet)
+        }
+    }
+    return ToolResult{Output: sb.String(), Success: true}, nil
+}
+
+// webSearch decides how the turn's model searches the web: natively
+// through client, through the configured WebSearchAPI (the returned tool),
+// or not at all.
+func (a *Agent) webSearch(client model.Client) (native bool, tool Tool) {
+    a.mu.Lock()
+    enabled, api := a.cfg.WebSearch, a.cfg.WebSearchAPI
+    a.mu.Unlock()
+    switch {
+    case !enabled:
+        return false, nil
+    case model.SearchesWeb(client):
+        return true, nil
+    case api != nil && api.URL != "":
+        return false, webSearchTool{api: api}
+    }
+    return false, nil
+}
+
+// nativeWebSearch converts the provider's web search stream events into
+// web_search_begin/end, timing each search.
+type nativeWebSearch struct {
+    started map[string]time.Time
+}
+
+func (w *nativeWebSearch) event(ev model.StreamEvent) protocol.EventMsg {
+    if ev.Type == model.WebSearchBegin {
+        if w.started == nil {
+            w.started = make(map[string]time.Time)
+        }
+        w.started[ev.CallID] = time.Now()
+        return protocol.WebSearchBeginEvent{CallID: ev.CallID, Query: ev.Query}
+    }
+    end := protocol.WebSearchEndEvent{CallID: ev.CallID, Query: ev.Query}
+    if t, ok := w.started[ev.CallID]; ok {
+        end.DurationMs = time.Since(t).Milliseconds()
+        delete(w.started, ev.CallID)
+    }
+    return end
+}
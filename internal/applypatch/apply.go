@@ -0,0 +1,226 @@
+package applypatch
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// Change is the effect of a patch on one file, computed before anything
+// is written.
+type Change struct {
+    Kind HunkKind
+    // Path is absolute; MovePath too when the update renames the file.
+    Path     string
+    MovePath string
+    // OldContent is empty for added files, NewContent for deleted ones.
+    OldContent string
+    NewContent string
+}
+
+// Plan computes the changes p makes to the files under root without
+// touching them. Relative paths are resolved against root. Hunks apply in
+// order, so a later hunk sees the result of an earlier one on the same
+// file.
+func Plan(root string, p *Patch) ([]Change, error) {
+    // state holds file contents as the patch has left them so far; nil
+    // means deleted.
+    state := map[string]*string{}
+    read := func(path string) (string, error) {
+        if s, ok := state[path]; ok {
+            if s == nil {
+                return "", fmt.Errorf("%s: no such file", path)
+            }
+            return *s, nil
+        }
+        b, err := os.ReadFile(path)
+        if err != nil {
+            if errors.Is(err, os.ErrNotExist) {
+                return "", fmt.Errorf("%s: no such file", path)
+            }
+            return "", err
+        }
+        return string(b), nil
+    }
+
+    var changes []Change
+    for _, h := range p.Hunks {
+        path := resolve(root, h.Path)
+        switch h.Kind {
+        case KindAdd:
+            old, _ := read(path)
+            changes = append(changes, Change{Kind: KindAdd, Path: path, OldContent: old, NewContent: h.Contents})
+            s := h.Contents
+            state[path] = &s
+        case KindDelete:
+            old, err := read(path)
+            if err != nil {
+                return nil, fmt.Errorf("delete %s: %w", h.Path, err)
+            }
+            changes = append(changes, Change{Kind: KindDelete, Path: path, OldContent: old})
+            state[path] = nil
+        case KindUpdate:
+            old, err := read(path)
+            if err != nil {
+                return nil, fmt.Errorf("update %s: %w", h.Path, err)
+            }
+            updated, err := applyChunks(old, h.Chunks)
+            if err != nil {
+                return nil, fmt.Errorf("update %s: %w", h.Path, err)
+            }
+            c := Change{Kind: KindUpdate, Path: path, OldContent: old, NewContent: updated}
+            if h.MovePath != "" {
+                c.MovePath = resolve(root, h.MovePath)
+                state[path] = nil
+                state[c.MovePath] = &updated
+            } else {
+                state[path] = &updated
+            }
+            changes = append(changes, c)
+        }
+    }
+    return changes, nil
+}
+
+func resolve(root, path string) string {
+    if filepath.IsAbs(path) {
+        return filepath.Clean(path)
+    }
+    return filepath.Join(root, path)
+}
+
+// Write performs changes. It is all or nothing: when a write fails, the
+// files already written are restored to their previous content.
+func Write(changes []Change) error {
+    type saved struct {
+        path    string
+        content []byte
+        existed bool
+        mode    os.FileMode
+    }
+    var undo []saved
+    seen := map[string]bool{}
+    save := func(path string) {
+        if seen[path] {
+            return
+        }
+        seen[path] = true
+        s := saved{path: path, mode: 0o644}
+        if fi, err := os.Stat(path); err == nil {
+            s.mode = fi.Mode().Perm()
+            if b, err := os.ReadFile(path); err == nil {
+                s.content, s.existed = b, true
+            }
+        }
+        undo = append(undo, s)
+    }
+    rollback := func() {
+        for i := len(undo) - 1; i >= 0; i-- {
+            s := undo[i]
+            if s.existed {
+                _ = writeFile(s.path, string(s.content), s.mode)
+            } else {
+                _ = os.Remove(s.path)
+            }
+        }
+    }
+
+    for _, c := range changes {
+        var err error
+        switch c.Kind {
+        case KindDelete:
+            save(c.Path)
+            err = os.Remove(c.Path)
+        default:
+            dst := c.Path
+            if c.MovePath != "" {
+                dst = c.MovePath
+            }
+            save(c.Path)
+            save(dst)
+            mode := os.FileMode(0o644)
+            if fi, statErr := os.Stat(c.Path); statErr == nil {
+                mode = fi.Mode().Perm()
+            }
+            if err = writeFile(dst, c.NewContent, mode); err == nil && dst != c.Path {
+                err = os.Remove(c.Path)
+            }
+        }
+        if err != nil {
+            rollback()
+            return err
+        }
+    }
+    return nil
+}
+
+// writeFile replaces path atomically through a temporary file in the same
+// directory, creating parent directories as needed.
+func writeFile(path, content string, mode os.FileMode) error {
+    dir := filepath.Dir(path)
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return err
+    }
+    f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+    if err != nil {
+        return err
+    }
+    tmp := f.Name()
+    _, err = f.WriteString(content)
+    if cerr := f.Close(); err == nil {
+        err = cerr
+    }
+    if err == nil {
+        err = os.Chmod(tmp, mode)
+    }
+    if err == nil {
+        err = os.Rename(tmp, path)
+    }
+    if err != nil {
+        _ = os.Remove(tmp)
+    }
+    return err
+}
+
+// Apply plans p against root and writes the result, returning the
+// changes made.
+func Apply(root string, p *Patch) ([]Change, error) {
+    changes, err := Plan(root, p)
+    if err != nil {
+        return nil, err
+    }
+    if err := Write(changes); err != nil {
+        return nil, err
+    }
+    return changes, nil
+}
+
+// Summary lists changed files the way `git status --short` does, relative
+// to root: "A path", "M path", "D path".
+func Summary(root string, changes []Change) string {
+    var sb strings.Builder
+    sb.WriteString("Success. Updated the following files:\n")
+    for _, c := range changes {
+        letter, path := "M", c.Path
+        switch {
+        case c.Kind == KindAdd:
+            letter = "A"
+        case c.Kind == KindDelete:
+            letter = "D"
+        case c.MovePath != "":
+            path = c.MovePath
+        }
+        sb.WriteString(letter + " " + relPath(root, path) + "\n")
+    }
+    return sb.String()
+}
+
+// relPath shows path relative to root when it is inside root.
+func relPath(root, path string) string {
+    if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+        return filepath.ToSlash(rel)
+    }
+    return path
+}
@@ -0,0 +1,112 @@
+package applypatch
+
+import (
+    "fmt"
+    "strings"
+)
+
+// applyChunks applies the chunks of an update hunk to content. The result
+// always ends with a newline.
+func applyChunks(content string, chunks []Chunk) (string, error) {
+    lines := strings.Split(content, "\n")
+    if lines[len(lines)-1] == "" {
+        lines = lines[:len(lines)-1]
+    }
+
+    cursor := 0
+    for _, c := range chunks {
+        if c.Context != "" {
+            i := seek(lines, []string{c.Context}, cursor, false)
+            if i < 0 {
+                return "", fmt.Errorf("context line %q not found", c.Context)
+            }
+            cursor = i + 1
+        }
+
+        if len(c.Old) == 0 {
+            // Pure insertion: after the context line, or at the end.
+            at := len(lines)
+            if c.Context != "" && !c.EOF {
+                at = cursor
+            }
+            lines = splice(lines, at, 0, c.New)
+            cursor = at + len(c.New)
+            continue
+        }
+
+        old, repl := c.Old, c.New
+        i := seek(lines, old, cursor, c.EOF)
+        if i < 0 && old[len(old)-1] == "" {
+            // A trailing blank line in the chunk often stands for the end
+            // of the file rather than an actual empty line.
+            old = old[:len(old)-1]
+            if len(repl) > 0 && repl[len(repl)-1] == "" {
+                repl = repl[:len(repl)-1]
+            }
+            i = seek(lines, old, cursor, c.EOF)
+        }
+        if i < 0 {
+            return "", fmt.Errorf("lines not found:\n%s", strings.Join(c.Old, "\n"))
+        }
+        lines = splice(lines, i, len(old), repl)
+        cursor = i + len(repl)
+    }
+    return strings.Join(lines, "\n") + "\n", nil
+}
+
+// splice replaces n lines at i with repl.
+func splice(lines []string, i, n int, repl []string) []string {
+    out := make([]string, 0, len(lines)-n+len(repl))
+    out = append(out, lines[:i]...)
+    out = append(out, repl...)
+    return append(out, lines[i+n:]...)
+}
+
+// seek finds pattern in lines at or after start and returns its index, or
+// -1. Matching is tried with decreasing strictness: exact, ignoring
+// trailing whitespace, ignoring surrounding whitespace, and finally with
+// typographic punctuation normalized to ASCII. With eof the pattern is
+// first tried at the very end of the file.
+func seek(lines, pattern []string, start int, eof bool) int {
+    if len(pattern) > len(lines) {
+        return -1
+    }
+    for _, eq := range []func(a, b string) bool{
+        func(a, b string) bool { return a == b },
+        func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+        func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+        func(a, b string) bool { return normalize(a) == normalize(b) },
+    } {
+        if eof {
+            if i := len(lines) - len(pattern); i >= start && matchAt(lines, pattern, i, eq) {
+                return i
+            }
+        }
+        for i := start; i+len(pattern) <= len(lines); i++ {
+            if matchAt(lines, pattern, i, eq) {
+                return i
+            }
+        }
+    }
+    return -1
+}
+
+func matchAt(lines, pattern []string, i int, eq func(a, b string) bool) bool {
+    for j, p := range pattern {
+        if !eq(lines[i+j], p) {
+            return false
+        }
+    }
+    return true
+}
+
+// punctuation maps look-alike Unicode characters models tend to emit to
+// the ASCII characters source code uses.
+var punctuation = strings.NewReplacer(
+    "‐", "-", "‑", "-", "‒", "-", "–", "-", "—", "-", "―", "-", "−", "-",
+    "‘", "'", "’", "'", "‚", "'", "‛", "'",
+    "“", "\"", "”", "\"", "„", "\"", "‟", "\"",
+    "\u00a0", " ", "\u2002", " ", "\u2003", " ", "\u2009", " ", "\u202f", " ",
+)
+
+func normalize(s string) string { return strings.TrimSpace(punctuation.Replace(s)) }
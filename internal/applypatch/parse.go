@@ -0,0 +1,210 @@
+// Package applypatch parses and applies patches in the codex patch format:
+//
+//	*** Begin Patch
+//	*** Add File: docs/new.md
+//	+first line
+//	*** Delete File: old.txt
+//	*** Update File: main.go
+//	*** Move to: cmd/main.go
+//	@@ func main() {
+//	 context
+//	-removed
+//	+added
+//	*** End Patch
+//
+// Update hunks locate their lines by content rather than by line number;
+// the optional "@@ <line>" header names a line to search from, which
+// disambiguates repeated code.
+package applypatch
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Markers of the patch format.
+const (
+    beginPatch = "*** Begin Patch"
+    endPatch   = "*** End Patch"
+    addFile    = "*** Add File: "
+    deleteFile = "*** Delete File: "
+    updateFile = "*** Update File: "
+    moveTo     = "*** Move to: "
+    endOfFile  = "*** End of File"
+)
+
+// HunkKind says what a hunk does to its file.
+type HunkKind int
+
+const (
+    KindAdd HunkKind = iota
+    KindDelete
+    KindUpdate
+)
+
+func (k HunkKind) String() string {
+    switch k {
+    case KindAdd:
+        return "add"
+    case KindDelete:
+        return "delete"
+    }
+    return "update"
+}
+
+// Patch is a parsed patch: an ordered list of file operations.
+type Patch struct {
+    Hunks []Hunk
+}
+
+// Hunk is one file operation.
+type Hunk struct {
+    Kind HunkKind
+    Path string
+    // Contents is the full text of an added file.
+    Contents string
+    // MovePath renames an updated file.
+    MovePath string
+    // Chunks are the edits of an updated file, in file order.
+    Chunks []Chunk
+}
+
+// Chunk replaces Old with New inside an updated file.
+type Chunk struct {
+    // Context is the text after "@@ ", a line to find before Old.
+    Context string
+    Old     []string
+    New     []string
+    // EOF anchors the chunk at the end of the file.
+    EOF bool
+}
+
+// ParseError reports malformed patch text.
+type ParseError struct {
+    Line int // 1-based
+    Msg  string
+}
+
+func (e *ParseError) Error() string { return fmt.Sprintf("invalid patch: line %d: %s", e.Line, e.Msg) }
+
+// Parse parses patch text. Surrounding whitespace is ignored, as is a
+// shell heredoc wrapper (`apply_patch <<'EOF'` ... `EOF`) that models
+// sometimes produce.
+func Parse(text string) (*Patch, error) {
+    lines := strings.Split(strings.TrimSpace(text), "\n")
+    for i := range lines {
+        lines[i] = strings.TrimSuffix(lines[i], "\r")
+    }
+    if len(lines) >= 3 && strings.Contains(lines[0], "<<") && strings.TrimSpace(lines[1]) == beginPatch {
+        lines = lines[1 : len(lines)-1]
+    }
+    if strings.TrimSpace(lines[0]) != beginPatch {
+        return nil, &ParseError{Line: 1, Msg: fmt.Sprintf("first line must be %q", beginPatch)}
+    }
+    last := len(lines) - 1
+    if last == 0 || strings.TrimSpace(lines[last]) != endPatch {
+        return nil, &ParseError{Line: len(lines), Msg: fmt.Sprintf("last line must be %q", endPatch)}
+    }
+
+    p := &Patch{}
+    i := 1
+    for i < last {
+        line := strings.TrimSpace(lines[i])
+        switch {
+        case strings.HasPrefix(line, addFile):
+            h := Hunk{Kind: KindAdd, Path: strings.TrimPrefix(line, addFile)}
+            i++
+            var sb strings.Builder
+            for i < last && strings.HasPrefix(lines[i], "+") {
+                sb.WriteString(lines[i][1:] + "\n")
+                i++
+            }
+            h.Contents = sb.String()
+            p.Hunks = append(p.Hunks, h)
+        case strings.HasPrefix(line, deleteFile):
+            p.Hunks = append(p.Hunks, Hunk{Kind: KindDelete, Path: strings.TrimPrefix(line, deleteFile)})
+            i++
+        case strings.HasPrefix(line, updateFile):
+            h := Hunk{Kind: KindUpdate, Path: strings.TrimPrefix(line, updateFile)}
+            i++
+            if i < last && strings.HasPrefix(strings.TrimSpace(lines[i]), moveTo) {
+                h.MovePath = strings.TrimPrefix(strings.TrimSpace(lines[i]), moveTo)
+                i++
+            }
+            var err error
+            if h.Chunks, i, err = parseChunks(lines, i, last); err != nil {
+                return nil, err
+            }
+            if len(h.Chunks) == 0 {
+                return nil, &ParseError{Line: i + 1, Msg: fmt.Sprintf("update of %s has no changes", h.Path)}
+            }
+            for _, c := range h.Chunks {
+                if len(c.Old) == 0 && len(c.New) == 0 {
+                    return nil, &ParseError{Line: i + 1, Msg: fmt.Sprintf("update of %s has an empty chunk", h.Path)}
+                }
+            }
+            p.Hunks = append(p.Hunks, h)
+        case line == "":
+            i++
+        default:
+            return nil, &ParseError{Line: i + 1, Msg: fmt.Sprintf("expected a file operation, got %q", lines[i])}
+        }
+    }
+    for _, h := range p.Hunks {
+        if strings.TrimSpace(h.Path) == "" {
+            return nil, &ParseError{Line: 1, Msg: "file operation without a path"}
+        }
+    }
+    return p, nil
+}
+
+// parseChunks reads the chunks of an update hunk starting at lines[i] and
+// returns them with the index of the first line after them.
+func parseChunks(lines []string, i, last int) ([]Chunk, int, error) {
+    var chunks []Chunk
+    var cur *Chunk
+    start := func(context string) {
+        chunks = append(chunks, Chunk{Context: context})
+        cur = &chunks[len(chunks)-1]
+    }
+    for ; i < last; i++ {
+        line := lines[i]
+        switch {
+        case strings.HasPrefix(line, "*** ") && strings.TrimSpace(line) == endOfFile:
+            if cur == nil {
+                return nil, i, &ParseError{Line: i + 1, Msg: "end of file marker outside a chunk"}
+            }
+            cur.EOF = true
+            cur = nil
+            continue
+        case strings.HasPrefix(line, "*** "):
+            return chunks, i, nil
+        case line == "@@" || strings.HasPrefix(line, "@@ "):
+            start(strings.TrimSpace(strings.TrimPrefix(line, "@@")))
+            continue
+        }
+        if cur == nil {
+            if len(chunks) > 0 {
+                return nil, i, &ParseError{Line: i + 1, Msg: "expected @@ before more changes"}
+            }
+            // The first chunk may omit its @@ header.
+            start("")
+        }
+        switch {
+        case line == "":
+            // Editors strip the leading space of blank context lines.
+            cur.Old = append(cur.Old, "")
+            cur.New = append(cur.New, "")
+        case line[0] == ' ':
+            cur.Old = append(cur.Old, line[1:])
+            cur.New = append(cur.New, line[1:])
+        case line[0] == '-':
+            cur.Old = append(cur.Old, line[1:])
+        case line[0] == '+':
+            cur.New = append(cur.New, line[1:])
+        default:
+            return nil, i, &ParseError{Line: i + 1, Msg: fmt.Sprintf("change lines must start with ' ', '-' or '+', got %q", line)}
+        }
+    }
+    return chunks, i, nil
+}
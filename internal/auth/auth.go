@@ -0,0 +1,128 @@
+// Package auth stores the credentials codex uses to reach model providers
+// in auth.json, inside the codex home directory.
+package auth
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+
+    "codex-go/internal/codexhome"
+)
+
+// FileName is the name of the credentials file inside the codex home
+// directory. It is written readable by its owner only.
+const FileName = "auth.json"
+
+// OpenAIAPIKeyEnv is the variable the stored OpenAI API key takes
+// precedence over.
+const OpenAIAPIKeyEnv = "OPENAI_API_KEY"
+
+// Auth is the contents of auth.json. The default credential, an OpenAI API
+// key or the tokens of a ChatGPT sign-in, is used instead of
+// $OPENAI_API_KEY by providers whose env_key is OPENAI_API_KEY, the key
+// first. Named credentials are only used where the config selects them.
+type Auth struct {
+    OpenAIAPIKey string  `json:"OPENAI_API_KEY,omitempty"`
+    Tokens       *Tokens `json:"tokens,omitempty"`
+    // Credentials are the named credentials, by name.
+    Credentials map[string]*Credential `json:"credentials,omitempty"`
+}
+
+// Credential is a named way to authenticate; exactly one field is set.
+type Credential struct {
+    APIKey string          `json:"api_key,omitempty"`
+    Tokens *Tokens         `json:"tokens,omitempty"`
+    Azure  *AzurePrincipal `json:"azure,omitempty"`
+}
+
+// Kind describes the credential for listings.
+func (c *Credential) Kind() string {
+    switch {
+    case c.APIKey != "":
+        return "API key " + Mask(c.APIKey)
+    case c.Tokens != nil:
+        if c.Tokens.AccountID != "" {
+            return "ChatGPT account " + c.Tokens.AccountID
+        }
+        return "ChatGPT account"
+    case c.Azure != nil:
+        return "Azure service principal " + c.Azure.ClientID
+    }
+    return "empty"
+}
+
+// DefaultPath returns the location of auth.json.
+func DefaultPath() (string, error) { return codexhome.Path(FileName) }
+
+// LoadFile reads the credentials file at path. A missing file yields an
+// empty Auth.
+func LoadFile(path string) (*Auth, error) {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return &Auth{}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var a Auth
+    if err := json.Unmarshal(data, &a); err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return &a, nil
+}
+
+// SaveFile atomically replaces the credentials file at path with a,
+// creating its directory if needed. The file is private to its owner
+// (0600) from the moment it is created.
+func SaveFile(path string, a *Auth) error {
+    data, err := json.MarshalIndent(a, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+        return err
+    }
+    // CreateTemp makes the file 0600.
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".auth-*.json")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(append(data, '\n')); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// RemoveFile deletes the credentials file at path, reporting whether it
+// existed.
+func RemoveFile(path string) (bool, error) {
+    err := os.Remove(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// APIKey returns the key stored for the environment variable env, if any.
+func (a *Auth) APIKey(env string) string {
+    if env == OpenAIAPIKeyEnv {
+        return a.OpenAIAPIKey
+    }
+    return ""
+}
+
+// Mask shortens a secret for display, keeping only enough to recognize it.
+func Mask(key string) string {
+    if len(key) <= 12 {
+        return "****"
+    }
+    return key[:3] + "..." + key[len(key)-4:]
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+// AzureAuthority is the Microsoft identity platform issuing tokens to
+// service principals.
+const AzureAuthority = "https://login.microsoftonline.com"
+
+// AzureScope asks for tokens accepted by Azure OpenAI.
+const AzureScope = "https://cognitiveservices.azure.com/.default"
+
+// AzurePrincipal is a Microsoft Entra service principal authenticating
+// with a client secret (the OAuth client credentials grant).
+type AzurePrincipal struct {
+    TenantID     string `json:"tenant_id"`
+    ClientID     string `json:"client_id"`
+    ClientSecret string `json:"client_secret"`
+}
+
+// TokenSource returns a function handing out access tokens for the
+// principal, requesting a new one shortly before the last expires.
+func (p *AzurePrincipal) TokenSource(hc *http.Client) func(ctx context.Context) (string, error) {
+    if hc == nil {
+        hc = http.DefaultClient
+    }
+    var (
+        mu      sync.Mutex
+        token   string
+        expires time.Time
+    )
+    return func(ctx context.Context) (string, error) {
+        mu.Lock()
+        defer mu.Unlock()
+        if token != "" && time.Now().Add(refreshMargin).Before(expires) {
+            return token, nil
+        }
+        form := url.Values{
+            "grant_type":    {"client_credentials"},
+            "client_id":     {p.ClientID},
+            "client_secret": {p.ClientSecret},
+            "scope":         {AzureScope},
+        }
+        endpoint := AzureAuthority + "/" + url.PathEscape(p.TenantID) + "/oauth2/v2.0/token"
+        req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+        if err != nil {
+            return "", err
+        }
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+        resp, err := hc.Do(req)
+        if err != nil {
+            return "", fmt.Errorf("azure token request: %w", err)
+        }
+        defer resp.Body.Close()
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+        if resp.StatusCode/100 != 2 {
+            return "", fmt.Errorf("azure token request: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+        }
+        var r struct {
+            AccessToken string `json:"access_token"`
+            ExpiresIn   int64  `json:"expires_in"`
+        }
+        if err := json.Unmarshal(body, &r); err != nil || r.AccessToken == "" {
+            return "", fmt.Errorf("azure token request: malformed response")
+        }
+        token, expires = r.AccessToken, time.Now().Add(time.Duration(r.ExpiresIn)*time.Second)
+        return token, nil
+    }
+}
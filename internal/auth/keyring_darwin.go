@@ -0,0 +1,64 @@
+package auth
+
+import (
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "os/exec"
+    "strings"
+)
+
+// The macOS Keychain is driven through security(1). Secrets are passed on
+// stdin in its interactive mode so they never show up in argv, and stored
+// base64 encoded, which needs no quoting there.
+
+// errSecItemNotFound is the exit status of security for a missing item.
+const errSecItemNotFound = 44
+
+func keyringAvailable() bool {
+    _, err := exec.LookPath("security")
+    return err == nil
+}
+
+func keyringGet(service, account string) (string, bool, error) {
+    out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+    var exit *exec.ExitError
+    if errors.As(err, &exit) && exit.ExitCode() == errSecItemNotFound {
+        return "", false, nil
+    }
+    if err != nil {
+        return "", false, fmt.Errorf("keychain: %w", err)
+    }
+    data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(out)))
+    if err != nil {
+        return "", false, fmt.Errorf("keychain: malformed item: %w", err)
+    }
+    return string(data), true, nil
+}
+
+func keyringSet(service, account, secret string) error {
+    cmd := exec.Command("security", "-i")
+    cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+        quoteSecurityArg(service), quoteSecurityArg(account), base64.StdEncoding.EncodeToString([]byte(secret))))
+    if out, err := cmd.CombinedOutput(); err != nil {
+        return fmt.Errorf("keychain: %v: %s", err, strings.TrimSpace(string(out)))
+    }
+    return nil
+}
+
+func keyringDelete(service, account string) (bool, error) {
+    err := exec.Command("security", "delete-generic-password", "-s", service, "-a", account).Run()
+    var exit *exec.ExitError
+    if errors.As(err, &exit) && exit.ExitCode() == errSecItemNotFound {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("keychain: %w", err)
+    }
+    return true, nil
+}
+
+// quoteSecurityArg quotes s for the command parser of security -i.
+func quoteSecurityArg(s string) string {
+    return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,59 @@
+//go:build !darwin && !windows
+
+package auth
+
+import (
+    "errors"
+    "fmt"
+    "os/exec"
+    "strings"
+)
+
+// The Secret Service (GNOME Keyring, KWallet) is driven through
+// secret-tool(1), which reads secrets from stdin.
+
+func keyringAvailable() bool {
+    if _, err := exec.LookPath("secret-tool"); err != nil {
+        return false
+    }
+    // A lookup fails with output on stderr when no Secret Service is
+    // running (e.g. in a headless session), and quietly when the item is
+    // missing.
+    out, err := exec.Command("secret-tool", "lookup", "service", KeyringService, "account", "probe").CombinedOutput()
+    return err == nil || len(strings.TrimSpace(string(out))) == 0
+}
+
+func keyringGet(service, account string) (string, bool, error) {
+    var stderr strings.Builder
+    cmd := exec.Command("secret-tool", "lookup", "service", service, "account", account)
+    cmd.Stderr = &stderr
+    out, err := cmd.Output()
+    var exit *exec.ExitError
+    if errors.As(err, &exit) && stderr.Len() == 0 {
+        return "", false, nil
+    }
+    if err != nil {
+        return "", false, fmt.Errorf("keychain: %v: %s", err, strings.TrimSpace(stderr.String()))
+    }
+    return string(out), true, nil
+}
+
+func keyringSet(service, account, secret string) error {
+    cmd := exec.Command("secret-tool", "store", "--label=codex credentials", "service", service, "account", account)
+    cmd.Stdin = strings.NewReader(secret)
+    if out, err := cmd.CombinedOutput(); err != nil {
+        return fmt.Errorf("keychain: %v: %s", err, strings.TrimSpace(string(out)))
+    }
+    return nil
+}
+
+func keyringDelete(service, account string) (bool, error) {
+    _, ok, err := keyringGet(service, account)
+    if err != nil || !ok {
+        return false, err
+    }
+    if out, err := exec.Command("secret-tool", "clear", "service", service, "account", account).CombinedOutput(); err != nil {
+        return false, fmt.Errorf("keychain: %v: %s", err, strings.TrimSpace(string(out)))
+    }
+    return true, nil
+}
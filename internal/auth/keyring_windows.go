@@ -0,0 +1,105 @@
+package auth
+
+import (
+    "errors"
+    "fmt"
+    "syscall"
+    "unsafe"
+)
+
+// Windows Credential Manager, through the Cred* functions of advapi32.
+
+var (
+    advapi32       = syscall.NewLazyDLL("advapi32.dll")
+    procCredReadW  = advapi32.NewProc("CredReadW")
+    procCredWriteW = advapi32.NewProc("CredWriteW")
+    procCredDelete = advapi32.NewProc("CredDeleteW")
+    procCredFree   = advapi32.NewProc("CredFree")
+)
+
+const (
+    credTypeGeneric         = 1
+    credPersistLocalMachine = 2
+    errorNotFound           = syscall.Errno(1168)
+)
+
+// credential is CREDENTIALW.
+type credential struct {
+    Flags              uint32
+    Type               uint32
+    TargetName         *uint16
+    Comment            *uint16
+    LastWritten        syscall.Filetime
+    CredentialBlobSize uint32
+    CredentialBlob     *byte
+    Persist            uint32
+    AttributeCount     uint32
+    Attributes         uintptr
+    TargetAlias        *uint16
+    UserName           *uint16
+}
+
+func keyringAvailable() bool { return procCredReadW.Find() == nil }
+
+// credTarget names the credential of account.
+func credTarget(service, account string) (*uint16, error) {
+    return syscall.UTF16PtrFromString(service + ":" + account)
+}
+
+func keyringGet(service, account string) (string, bool, error) {
+    target, err := credTarget(service, account)
+    if err != nil {
+        return "", false, err
+    }
+    var cred *credential
+    r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+    if r == 0 {
+        if errors.Is(err, errorNotFound) {
+            return "", false, nil
+        }
+        return "", false, fmt.Errorf("credential manager: %w", err)
+    }
+    defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+    blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+    return string(blob), true, nil
+}
+
+func keyringSet(service, account, secret string) error {
+    target, err := credTarget(service, account)
+    if err != nil {
+        return err
+    }
+    user, err := syscall.UTF16PtrFromString(account)
+    if err != nil {
+        return err
+    }
+    blob := []byte(secret)
+    cred := credential{
+        Type:               credTypeGeneric,
+        TargetName:         target,
+        CredentialBlobSize: uint32(len(blob)),
+        Persist:            credPersistLocalMachine,
+        UserName:           user,
+    }
+    if len(blob) > 0 {
+        cred.CredentialBlob = &blob[0]
+    }
+    if r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0); r == 0 {
+        return fmt.Errorf("credential manager: %w", err)
+    }
+    return nil
+}
+
+func keyringDelete(service, account string) (bool, error) {
+    target, err := credTarget(service, account)
+    if err != nil {
+        return false, err
+    }
+    if r, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0); r == 0 {
+        if errors.Is(err, errorNotFound) {
+            return false, nil
+        }
+        return false, fmt.Errorf("credential manager: %w", err)
+    }
+    return true, nil
+}
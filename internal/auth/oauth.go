@@ -0,0 +1,319 @@
+package auth
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// ChatGPT sign-in: the OAuth 2.0 authorization code flow with PKCE against
+// the OpenAI auth server, redirecting to a listener on localhost.
+const (
+    DefaultIssuer   = "https://auth.openai.com"
+    DefaultClientID = "app_EMoamEEZ73f0CkXaXp7hrann"
+    // DefaultCallbackPort is the port registered for the redirect URI.
+    DefaultCallbackPort = 1455
+    // ChatGPTBaseURL serves the models of a ChatGPT plan over the
+    // Responses API.
+    ChatGPTBaseURL = "https://chatgpt.com/backend-api/codex"
+    // AccountHeader names the ChatGPT account requests are billed to.
+    AccountHeader = "chatgpt-account-id"
+)
+
+// refreshMargin is how long before expiry an access token is refreshed.
+const refreshMargin = 5 * time.Minute
+
+// Tokens are the OAuth tokens of a ChatGPT sign-in.
+type Tokens struct {
+    IDToken      string `json:"id_token,omitempty"`
+    AccessToken  string `json:"access_token"`
+    RefreshToken string `json:"refresh_token,omitempty"`
+    // AccountID is the ChatGPT account, read from the ID token.
+    AccountID string `json:"account_id,omitempty"`
+    // ExpiresAt is when AccessToken expires; zero when unknown.
+    ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// expiring reports whether the access token should be refreshed now.
+func (t *Tokens) expiring(now time.Time) bool {
+    return !t.ExpiresAt.IsZero() && now.Add(refreshMargin).After(t.ExpiresAt)
+}
+
+// OAuth configures the sign-in flow. The zero value uses the defaults.
+type OAuth struct {
+    Issuer   string
+    ClientID string
+    // Port is the callback listener's port on localhost; 0 means
+    // DefaultCallbackPort.
+    Port       int
+    HTTPClient *http.Client
+}
+
+func (o OAuth) issuer() string {
+    if o.Issuer != "" {
+        return strings.TrimRight(o.Issuer, "/")
+    }
+    return DefaultIssuer
+}
+
+func (o OAuth) clientID() string {
+    if o.ClientID != "" {
+        return o.ClientID
+    }
+    return DefaultClientID
+}
+
+func (o OAuth) httpClient() *http.Client {
+    if o.HTTPClient != nil {
+        return o.HTTPClient
+    }
+    return http.DefaultClient
+}
+
+// Login runs the sign-in flow: it listens for the redirect on localhost,
+// passes the authorization URL to open (which shows it to the user, e.g.
+// by launching a browser), and exchanges the code the redirect carries for
+// tokens. It returns when the flow completes, fails, or ctx ends.
+func (o OAuth) Login(ctx context.Context, open func(authURL string)) (*Tokens, error) {
+    port := o.Port
+    if port == 0 {
+        port = DefaultCallbackPort
+    }
+    ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+    if err != nil {
+        return nil, fmt.Errorf("callback listener: %w", err)
+    }
+    redirectURI := fmt.Sprintf("http://localhost:%d/auth/callback", ln.Addr().(*net.TCPAddr).Port)
+
+    verifier := randomString(64)
+    sum := sha256.Sum256([]byte(verifier))
+    state := randomString(32)
+    q := url.Values{
+        "response_type":         {"code"},
+        "client_id":             {o.clientID()},
+        "redirect_uri":          {redirectURI},
+        "scope":                 {"openid profile email offline_access"},
+        "code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+        "code_challenge_method": {"S256"},
+        "state":                 {state},
+    }
+
+    type result struct {
+        tokens *Tokens
+        err    error
+    }
+    done := make(chan result, 1)
+    finish := func(r result) {
+        select {
+        case done <- r:
+        default:
+        }
+    }
+    mux := http.NewServeMux()
+    mux.HandleFunc("/auth/callback", func(w http.ResponseWriter, r *http.Request) {
+        p := r.URL.Query()
+        var res result
+        switch {
+        case p.Get("state") != state:
+            // Not our flow (e.g. a stale tab); keep waiting.
+            http.Error(w, "unexpected state", http.StatusBadRequest)
+            return
+        case p.Get("error") != "":
+            res.err = fmt.Errorf("sign-in failed: %s %s", p.Get("error"), p.Get("error_description"))
+        case p.Get("code") == "":
+            res.err = errors.New("sign-in failed: no authorization code")
+        default:
+            res.tokens, res.err = o.token(r.Context(), url.Values{
+                "grant_type":    {"authorization_code"},
+                "code":          {p.Get("code")},
+                "redirect_uri":  {redirectURI},
+                "code_verifier": {verifier},
+            })
+        }
+        if res.err != nil {
+            http.Error(w, res.err.Error(), http.StatusBadRequest)
+        } else {
+            fmt.Fprintln(w, "Signed in to codex. You can close this tab.")
+        }
+        finish(res)
+    })
+    srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+    go srv.Serve(ln)
+    defer srv.Close()
+
+    open(o.issuer() + "/oauth/authorize?" + q.Encode())
+    select {
+    case r := <-done:
+        return r.tokens, r.err
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+}
+
+// Refresh trades the refresh token of t for new tokens. Fields the server
+// does not return again are kept.
+func (o OAuth) Refresh(ctx context.Context, t *Tokens) (*Tokens, error) {
+    if t.RefreshToken == "" {
+        return nil, errors.New("no refresh token; run codex login")
+    }
+    fresh, err := o.token(ctx, url.Values{
+        "grant_type":    {"refresh_token"},
+        "refresh_token": {t.RefreshToken},
+        "scope":         {"openid profile email"},
+    })
+    if err != nil {
+        return nil, err
+    }
+    if fresh.RefreshToken == "" {
+        fresh.RefreshToken = t.RefreshToken
+    }
+    if fresh.IDToken == "" {
+        fresh.IDToken, fresh.AccountID = t.IDToken, t.AccountID
+    }
+    return fresh, nil
+}
+
+// token posts a token request to the issuer.
+func (o OAuth) token(ctx context.Context, form url.Values) (*Tokens, error) {
+    form.Set("client_id", o.clientID())
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.issuer()+"/oauth/token", strings.NewReader(form.Encode()))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    resp, err := o.httpClient().Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("token request: %w", err)
+    }
+    defer resp.Body.Close()
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+    if resp.StatusCode/100 != 2 {
+        return nil, fmt.Errorf("token request: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+    }
+    var r struct {
+        IDToken      string `json:"id_token"`
+        AccessToken  string `json:"access_token"`
+        RefreshToken string `json:"refresh_token"`
+        ExpiresIn    int64  `json:"expires_in"`
+    }
+    if err := json.Unmarshal(body, &r); err != nil || r.AccessToken == "" {
+        return nil, fmt.Errorf("token request: malformed response")
+    }
+    t := &Tokens{IDToken: r.IDToken, AccessToken: r.AccessToken, RefreshToken: r.RefreshToken}
+    if r.ExpiresIn > 0 {
+        t.ExpiresAt = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+    } else if claims := jwtClaims(r.AccessToken); claims.Exp > 0 {
+        t.ExpiresAt = time.Unix(claims.Exp, 0)
+    }
+    t.AccountID = jwtClaims(r.IDToken).Auth.AccountID
+    return t, nil
+}
+
+// claims are the JWT claims codex reads.
+type claims struct {
+    Exp  int64 `json:"exp"`
+    Auth struct {
+        AccountID string `json:"chatgpt_account_id"`
+    } `json:"https://api.openai.com/auth"`
+}
+
+// jwtClaims decodes the payload of a JWT without verifying it: the token
+// came straight from the issuer over TLS. Malformed tokens have no claims.
+func jwtClaims(token string) claims {
+    var c claims
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return c
+    }
+    payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+    if err == nil {
+        _ = json.Unmarshal(payload, &c)
+    }
+    return c
+}
+
+// randomString returns n random bytes, base64url encoded.
+func randomString(n int) string {
+    b := make([]byte, n)
+    _, _ = rand.Read(b)
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// TokenSource hands out the access token kept in a Store, refreshing it
+// (and saving the new tokens) shortly before it expires. It is safe for
+// concurrent use.
+type TokenSource struct {
+    store Store
+    name  string // of the credential holding the tokens; "" is the default
+    oauth OAuth
+
+    mu     sync.Mutex
+    tokens *Tokens
+}
+
+// NewTokenSource returns a TokenSource for tokens, which were read from
+// the credential name (empty for the default one) of store.
+func NewTokenSource(store Store, name string, oauth OAuth, tokens *Tokens) *TokenSource {
+    return &TokenSource{store: store, name: name, oauth: oauth, tokens: tokens}
+}
+
+// stored returns the tokens of the source's credential in a.
+func (s *TokenSource) stored(a *Auth) *Tokens {
+    if s.name == "" {
+        return a.Tokens
+    }
+    if c := a.Credentials[s.name]; c != nil {
+        return c.Tokens
+    }
+    return nil
+}
+
+// Token returns a valid access token.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if !s.tokens.expiring(time.Now()) {
+        return s.tokens.AccessToken, nil
+    }
+    // Another process may have refreshed the tokens already.
+    if a, err := s.store.Load(); err == nil {
+        if t := s.stored(a); t != nil && !t.expiring(time.Now()) {
+            s.tokens = t
+            return s.tokens.AccessToken, nil
+        }
+    }
+    fresh, err := s.oauth.Refresh(ctx, s.tokens)
+    if err != nil {
+        if time.Now().Before(s.tokens.ExpiresAt) {
+            // Still valid for a while; the next request retries.
+            return s.tokens.AccessToken, nil
+        }
+        return "", fmt.Errorf("refreshing ChatGPT tokens: %w", err)
+    }
+    s.tokens = fresh
+    a, err := s.store.Load()
+    if err == nil {
+        if c := a.Credentials[s.name]; s.name != "" && c != nil {
+            c.Tokens = fresh
+        } else if s.name == "" {
+            a.Tokens = fresh
+        }
+        err = s.store.Save(a)
+    }
+    if err != nil {
+        return "", fmt.Errorf("saving refreshed tokens: %w", err)
+    }
+    return fresh.AccessToken, nil
+}
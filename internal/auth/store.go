@@ -0,0 +1,118 @@
+package auth
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+
+    "codex-go/internal/codexhome"
+)
+
+// Backends for stored credentials, chosen with cli_auth_credentials_store.
+const (
+    StoreFile    = "file"    // auth.json in the codex home directory
+    StoreKeyring = "keyring" // the platform keychain
+    StoreAuto    = "auto"    // the keychain when there is one, else the file
+)
+
+// KeyringService is the service name of the keychain entries.
+const KeyringService = "codex-go"
+
+// Store loads and saves credentials.
+type Store interface {
+    // Load returns the stored credentials; none stored is an empty Auth.
+    Load() (*Auth, error)
+    Save(a *Auth) error
+    // Remove deletes the credentials, reporting whether there were any.
+    Remove() (bool, error)
+    // Location describes where the credentials are kept, for messages.
+    Location() string
+}
+
+// ErrNoKeyring is returned when the platform keychain is not available.
+var ErrNoKeyring = errors.New("no keychain available")
+
+// OpenStore returns the store of the backend kind; empty means StoreFile.
+// StoreKeyring fails with ErrNoKeyring when the keychain cannot be used.
+func OpenStore(kind string) (Store, error) {
+    path, err := DefaultPath()
+    if err != nil {
+        return nil, err
+    }
+    file := &fileStore{path: path}
+    switch kind {
+    case "", StoreFile:
+        return file, nil
+    case StoreKeyring, StoreAuto:
+        if !keyringAvailable() {
+            if kind == StoreAuto {
+                return file, nil
+            }
+            return nil, fmt.Errorf("cli_auth_credentials_store = %q: %w", kind, ErrNoKeyring)
+        }
+        // One entry per codex home, so separate homes keep separate
+        // credentials.
+        home, err := codexhome.Dir()
+        if err != nil {
+            return nil, err
+        }
+        return &keyringStore{account: home, file: file}, nil
+    }
+    return nil, fmt.Errorf("cli_auth_credentials_store: unknown value %q", kind)
+}
+
+// fileStore keeps credentials in auth.json.
+type fileStore struct{ path string }
+
+func (s *fileStore) Load() (*Auth, error) { return LoadFile(s.path) }
+func (s *fileStore) Save(a *Auth) error { return SaveFile(s.path, a) }
+func (s *fileStore) Remove() (bool, error) { return RemoveFile(s.path) }
+func (s *fileStore) Location() string { return s.path }
+
+// keyringStore keeps credentials, as the JSON of auth.json, in the
+// platform keychain. Credentials left in auth.json from before are still
+// read, and deleted once the keychain holds new ones.
+type keyringStore struct {
+    account string
+    file    *fileStore
+}
+
+func (s *keyringStore) Load() (*Auth, error) {
+    secret, ok, err := keyringGet(KeyringService, s.account)
+    if err != nil {
+        return nil, err
+    }
+    if !ok {
+        return s.file.Load()
+    }
+    var a Auth
+    if err := json.Unmarshal([]byte(secret), &a); err != nil {
+        return nil, fmt.Errorf("keychain entry %s/%s: %w", KeyringService, s.account, err)
+    }
+    return &a, nil
+}
+
+func (s *keyringStore) Save(a *Auth) error {
+    data, err := json.Marshal(a)
+    if err != nil {
+        return err
+    }
+    if err := keyringSet(KeyringService, s.account, string(data)); err != nil {
+        return err
+    }
+    _, err = s.file.Remove()
+    return err
+}
+
+func (s *keyringStore) Remove() (bool, error) {
+    removed, err := keyringDelete(KeyringService, s.account)
+    if err != nil {
+        return false, err
+    }
+    fileRemoved, err := s.file.Remove()
+    return removed || fileRemoved, err
+}
+
+func (s *keyringStore) Location() string {
+    return fmt.Sprintf("the keychain (service %s, account %s)", KeyringService, s.account)
+}
@@ -0,0 +1,35 @@
+package codexhome
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+)
+
+// EnvVar overrides the default location of the codex home directory.
+const EnvVar = "CODEX_HOME"
+
+// Dir returns the codex home directory: $CODEX_HOME when set, otherwise
+// ~/.codex. The directory is not created.
+func Dir() (string, error) {
+    if d := os.Getenv(EnvVar); d != "" {
+        return filepath.Abs(d)
+    }
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return "", err
+    }
+    if home == "" {
+        return "", errors.New("cannot determine home directory")
+    }
+    return filepath.Join(home, ".codex"), nil
+}
+
+// Path joins elem onto the codex home directory.
+func Path(elem ...string) (string, error) {
+    dir, err := Dir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(append([]string{dir}, elem...)...), nil
+}
@@ -0,0 +1,491 @@
+package config
+
+import (
+    "fmt"
+    "os"
+    "reflect"
+
+    "codex-go/internal/codexhome"
+    iexec "codex-go/internal/exec"
+    "codex-go/internal/protocol"
+)
+
+// FileName is the name of the config file inside the codex home directory.
+const FileName = "config.toml"
+
+// Config is the decoded contents of a config.toml file.
+type Config struct {
+    // Model is the default model for new sessions. Empty means the
+    // backend's default.
+    Model string `toml:"model"`
+    // ModelReasoningEffort is sent to reasoning models: "minimal", "low",
+    // "medium" or "high". Empty means the model's default.
+    ModelReasoningEffort string `toml:"model_reasoning_effort"`
+    // ModelVerbosity is sent to models taking it (GPT-5): "low",
+    // "medium" or "high". Empty means the model's default.
+    ModelVerbosity string `toml:"model_verbosity"`
+    // ModelMaxOutputTokens bounds each reply. 0 means the API's default,
+    // or the model's maximum where the API requires a bound.
+    ModelMaxOutputTokens int64 `toml:"model_max_output_tokens"`
+    // ModelContextWindow is the model's context size in tokens. 0 means
+    // the size known for the model; for unknown models automatic
+    // compaction is then off.
+    ModelContextWindow int64 `toml:"model_context_window"`
+    // ModelAutoCompactTokenLimit is the conversation size in tokens at
+    // which it is compacted into a summary. 0 means 90% of
+    // ModelContextWindow.
+    ModelAutoCompactTokenLimit int64 `toml:"model_auto_compact_token_limit"`
+    // ApprovalPolicy says when commands need the user's approval:
+    // "untrusted", "on-failure", "on-request" or "never". Empty means
+    // "on-request".
+    ApprovalPolicy string `toml:"approval_policy"`
+    // SandboxMode confines commands: "read-only", "workspace-write" or
+    // "danger-full-access". Empty means "read-only".
+    SandboxMode string `toml:"sandbox_mode"`
+    // SandboxWorkspaceWrite tunes the workspace-write sandbox mode.
+    SandboxWorkspaceWrite SandboxWorkspaceWrite `toml:"sandbox_workspace_write"`
+    // SandboxContainer, when its image is set, runs the agent's commands
+    // in containers instead of on the host.
+    SandboxContainer SandboxContainer `toml:"sandbox_container"`
+    // ShellEnvironmentPolicy filters the environment of the commands the
+    // agent runs.
+    ShellEnvironmentPolicy ShellEnvironmentPolicy `toml:"shell_environment_policy"`
+    // ProjectDocMaxBytes bounds the AGENTS.md content added to the
+    // instructions. nil means 32 KiB; 0 turns AGENTS.md files off.
+    ProjectDocMaxBytes *int `toml:"project_doc_max_bytes"`
+    // Notify is a program and its arguments, run with a JSON payload as
+    // the last argument when a turn completes or an approval is requested.
+    Notify []string `toml:"notify"`
+    // LogLevel is the minimum level of diagnostics on stderr: "debug",
+    // "info", "warn" or "error". Empty means "warn"; --log-level wins.
+    LogLevel string `toml:"log_level"`
+    // CLIAuthCredentialsStore is where `codex login` keeps credentials:
+    // "file" (auth.json, the default), "keyring" (the platform keychain)
+    // or "auto" (the keychain when there is one).
+    CLIAuthCredentialsStore string `toml:"cli_auth_credentials_store"`
+    // ModelPrices prices token usage by model name prefix, taking
+    // precedence over the built-in list prices.
+    ModelPrices map[string]ModelPrice `toml:"model_prices"`
+
+    // ModelProvider selects the entry of ModelProviders (or a built-in
+    // provider) that serves the model. Empty means "openai".
+    ModelProvider string `toml:"model_provider"`
+    // ModelProviders adds providers or overrides fields of built-in ones.
+    ModelProviders map[string]ModelProviderConfig `toml:"model_providers"`
+    // Credential names the stored credential (`codex login --name`) the
+    // model provider authenticates with, overriding the provider's own
+    // credential key. Profiles can set it to switch accounts.
+    Credential string `toml:"credential"`
+
+    // WebSearch lets the model search the web.
+    WebSearch WebSearchConfig `toml:"web_search"`
+
+    // MCPServers maps a server name to how to reach it. Each server's tools
+    // are offered to the agent as "<name>__<tool>".
+    MCPServers map[string]MCPServerConfig `toml:"mcp_servers"`
+
+    // MCPServe limits the tools `codex mcp serve` exposes to its clients.
+    MCPServe MCPServeConfig `toml:"mcp_serve"`
+
+    // Profiles are named sets of settings. The selected one (--profile,
+    // else DefaultProfile) overrides the top-level keys of the same name.
+    Profiles       map[string]ProfileConfig `toml:"profiles"`
+    DefaultProfile string                   `toml:"default_profile"`
+
+    // Projects records, by project root, whether the user trusts a
+    // project with the settings that let the agent change it unasked.
+    Projects map[string]ProjectConfig `toml:"projects"`
+
+    // Unknown lists dotted keys present in the file but not understood.
+    Unknown []string `toml:"-"`
+}
+
+// ProfileConfig is a [profiles.<name>] table. Empty fields keep the
+// top-level setting.
+type ProfileConfig struct {
+    Model                string `toml:"model"`
+    ModelProvider        string `toml:"model_provider"`
+    ModelReasoningEffort string `toml:"model_reasoning_effort"`
+    ModelVerbosity       string `toml:"model_verbosity"`
+    ApprovalPolicy       string `toml:"approval_policy"`
+    SandboxMode          string `toml:"sandbox_mode"`
+    Credential           string `toml:"credential"`
+}
+
+// ShellEnvironmentPolicy is the [shell_environment_policy] table. Unset, it
+// passes every variable but those named like credentials (*KEY*, *SECRET*,
+// *TOKEN*).
+type ShellEnvironmentPolicy struct {
+    // Inherit is the starting set: "all" (default), "core" (HOME, PATH,
+    // USER and the like) or "none".
+    Inherit string `toml:"inherit"`
+    // IgnoreDefaultExcludes keeps the credential-like variables.
+    IgnoreDefaultExcludes bool `toml:"ignore_default_excludes"`
+    // Exclude and IncludeOnly are case-insensitive globs over variable
+    // names: matches of Exclude are dropped, and when IncludeOnly is set
+    // everything not matching it is. Set adds variables.
+    Exclude     []string          `toml:"exclude"`
+    Set         map[string]string `toml:"set"`
+    IncludeOnly []string          `toml:"include_only"`
+}
+
+// Policy returns the policy internal/exec applies.
+func (p ShellEnvironmentPolicy) Policy() iexec.EnvPolicy {
+    return iexec.EnvPolicy{
+        Inherit:               p.Inherit,
+        IgnoreDefaultExcludes: p.IgnoreDefaultExcludes,
+        Exclude:               p.Exclude,
+        Set:                   p.Set,
+        IncludeOnly:           p.IncludeOnly,
+    }
+}
+
+// SandboxWorkspaceWrite is the [sandbox_workspace_write] table. Unset, the
+// workspace-write mode lets commands write in the working directory and
+// the temporary directories, but not in .git or the other top-level
+// dotfiles of the working directory, and keeps them off the network.
+type SandboxWorkspaceWrite struct {
+    // WritableRoots are more directories commands can write in, as
+    // absolute paths; their top-level dotfiles are protected too.
+    WritableRoots []string `toml:"writable_roots"`
+    // NetworkAccess lets commands use the network.
+    NetworkAccess bool `toml:"network_access"`
+    // ExcludeTmpdir keeps commands from writing in $TMPDIR and /tmp.
+    ExcludeTmpdir bool `toml:"exclude_tmpdir"`
+    // WriteDotfiles lets commands write in .git and the other top-level
+    // dotfiles of the writable directories.
+    WriteDotfiles bool `toml:"write_dotfiles"`
+}
+
+// Policy returns the sandbox policy of mode (a sandbox_mode value); the
+// table only applies to workspace-write.
+func (s SandboxWorkspaceWrite) Policy(mode string) protocol.SandboxPolicy {
+    if mode != protocol.SandboxWorkspaceWrite {
+        return protocol.SandboxPolicy{Mode: mode}
+    }
+    return protocol.SandboxPolicy{
+        Mode:          mode,
+        WritableRoots: s.WritableRoots,
+        NetworkAccess: s.NetworkAccess,
+        ExcludeTmpdir: s.ExcludeTmpdir,
+        WriteDotfiles: s.WriteDotfiles,
+    }
+}
+
+// SandboxContainer is the [sandbox_container] table: the container the
+// agent's commands run in, with the session cwd mounted at the same path.
+// The sandbox mode still applies, to the mounts and the network.
+type SandboxContainer struct {
+    // Image is the image to run, such as "golang:1.22". Empty means
+    // commands run on the host.
+    Image string `toml:"image"`
+    // Engine is "docker" or "podman". Empty means the first one installed.
+    Engine string `toml:"engine"`
+    // Args are more options to the engine's run command.
+    Args []string `toml:"args"`
+}
+
+// Runner returns the runner commands run through, or nil (on the host) if
+// no image is set.
+func (c SandboxContainer) Runner() iexec.Runner {
+    if c.Image == "" {
+        return nil
+    }
+    return &iexec.ContainerRunner{Image: c.Image, Engine: c.Engine, Args: c.Args}
+}
+
+// DefaultModelProvider is used when model_provider is not set.
+const DefaultModelProvider = "openai"
+
+// ModelProviderConfig describes a model API. Fields left empty keep the
+// value of the built-in provider with the same id, if any.
+type ModelProviderConfig struct {
+    // Name is shown to users.
+    Name    string `toml:"name"`
+    BaseURL string `toml:"base_url"`
+    // EnvKey names the environment variable holding the API key. Keys are
+    // never read from the config file itself.
+    EnvKey string `toml:"env_key"`
+    // Credential names a stored credential (`codex login --name`) used
+    // instead of EnvKey.
+    Credential string `toml:"credential"`
+    // WireAPI is the protocol the provider speaks: "chat" (Chat
+    // Completions, default), "responses" (OpenAI Responses API, needed for
+    // reasoning items) or "anthropic" (Anthropic Messages API).
+    WireAPI string `toml:"wire_api"`
+    // QueryParams are appended to every request URL.
+    QueryParams map[string]string `toml:"query_params"`
+    // APIVersion is sent as the api-version query parameter; Azure
+    // providers default to a current GA version.
+    APIVersion string `toml:"api_version"`
+    // Azure marks an Azure OpenAI resource: the key is sent in the
+    // api-key header and chat requests go to the model's deployment,
+    // <base_url>/deployments/<deployment>/chat/completions.
+    Azure bool `toml:"azure"`
+    // Deployments maps a model name to its Azure deployment name, or to
+    // the deployment's full URL. Unlisted models use their own name.
+    Deployments map[string]string `toml:"deployments"`
+    // HTTPHeaders are sent with every request; EnvHTTPHeaders map a header
+    // name to the environment variable holding its value.
+    HTTPHeaders    map[string]string `toml:"http_headers"`
+    EnvHTTPHeaders map[string]string `toml:"env_http_headers"`
+    // RequestMaxRetries bounds automatic retries of a failed request. nil
+    // means the default; 0 disables retries.
+    RequestMaxRetries *int `toml:"request_max_retries"`
+}
+
+// ModelPrice is what a model charges, in US dollars per million tokens.
+type ModelPrice struct {
+    Input float64 `toml:"input"`
+    // CachedInput is charged for input tokens served from the prompt
+    // cache. nil means Input.
+    CachedInput *float64 `toml:"cached_input"`
+    Output      float64  `toml:"output"`
+}
+
+// Wire APIs.
+const (
+    WireAPIChat      = "chat"
+    WireAPIResponses = "responses"
+    WireAPIAnthropic = "anthropic"
+)
+
+// WebSearchConfig configures web search. Providers with a search tool of
+// their own (wire_api "responses") use it; others need URL.
+type WebSearchConfig struct {
+    // Enabled offers web search to the model (also --search).
+    Enabled bool `toml:"enabled"`
+    // URL is a search API answering GET <url>?q=<query>&count=<n> with
+    // JSON results (SearXNG or Brave style).
+    URL string `toml:"url"`
+    // HTTPHeaders are sent with every search; EnvHTTPHeaders map a header
+    // name to the environment variable holding its value (e.g. an API key).
+    HTTPHeaders    map[string]string `toml:"http_headers"`
+    EnvHTTPHeaders map[string]string `toml:"env_http_headers"`
+    // MaxResults is the number of results asked for. 0 means 5.
+    MaxResults int `toml:"max_results"`
+}
+
+// MCPServerConfig describes one external MCP server. Exactly one of Command
+// (stdio transport) or URL (streamable HTTP) must be set.
+type MCPServerConfig struct {
+    Command string            `toml:"command"`
+    Args    []string          `toml:"args"`
+    Env     map[string]string `toml:"env"`
+    Cwd     string            `toml:"cwd"`
+
+    URL string `toml:"url"`
+    // BearerTokenEnvVar names an environment variable holding the token
+    // sent to URL servers.
+    BearerTokenEnvVar string `toml:"bearer_token_env_var"`
+
+    // StartupTimeoutSec bounds spawning plus the initialize handshake.
+    StartupTimeoutSec int `toml:"startup_timeout_sec"`
+
+    // ToolTimeoutSec and MaxResultBytes cap every call to this server's
+    // tools; Tools overrides them per tool name (as the server names it).
+    ToolTimeoutSec int                   `toml:"tool_timeout_sec"`
+    MaxResultBytes int                   `toml:"max_result_bytes"`
+    Tools          map[string]ToolLimits `toml:"tools"`
+}
+
+// MCPServeConfig holds limits for the tools served by `codex mcp serve`.
+type MCPServeConfig struct {
+    ToolTimeoutSec int                   `toml:"tool_timeout_sec"`
+    MaxResultBytes int                   `toml:"max_result_bytes"`
+    Tools          map[string]ToolLimits `toml:"tools"`
+}
+
+// ToolLimits caps a single tool call. Zero fields inherit the enclosing
+// setting, and ultimately the built-in default.
+type ToolLimits struct {
+    TimeoutSec     int `toml:"tool_timeout_sec"`
+    MaxResultBytes int `toml:"max_result_bytes"`
+}
+
+// merge returns l with zero fields taken from base.
+func (l ToolLimits) merge(base ToolLimits) ToolLimits {
+    if l.TimeoutSec == 0 {
+        l.TimeoutSec = base.TimeoutSec
+    }
+    if l.MaxResultBytes == 0 {
+        l.MaxResultBytes = base.MaxResultBytes
+    }
+    return l
+}
+
+// LimitsFor returns the effective limits for one of the server's tools.
+func (c MCPServerConfig) LimitsFor(tool string) ToolLimits {
+    return c.Tools[tool].merge(ToolLimits{TimeoutSec: c.ToolTimeoutSec, MaxResultBytes: c.MaxResultBytes})
+}
+
+// Default returns the limits applying to served tools without an override.
+func (c MCPServeConfig) Default() ToolLimits {
+    return ToolLimits{TimeoutSec: c.ToolTimeoutSec, MaxResultBytes: c.MaxResultBytes}
+}
+
+// LimitsFor returns the effective limits for the named served tool.
+func (c MCPServeConfig) LimitsFor(tool string) ToolLimits {
+    return c.Tools[tool].merge(c.Default())
+}
+
+// Validate checks that the entry names exactly one transport.
+func (c MCPServerConfig) Validate() error {
+    if c.ToolTimeoutSec < 0 || c.MaxResultBytes < 0 {
+        return fmt.Errorf("tool_timeout_sec and max_result_bytes must not be negative")
+    }
+    switch {
+    case c.Command == "" && c.URL == "":
+        return fmt.Errorf("either command or url is required")
+    case c.Command != "" && c.URL != "":
+        return fmt.Errorf("command and url are mutually exclusive")
+    }
+    return nil
+}
+
+// DefaultPath returns the location of the user config file.
+func DefaultPath() (string, error) { return codexhome.Path(FileName) }
+
+// Load reads the user config file. A missing file yields an empty Config.
+func Load() (*Config, error) {
+    path, err := DefaultPath()
+    if err != nil {
+        return nil, err
+    }
+    return LoadFile(path)
+}
+
+// LoadFile reads and decodes the config file at path. A missing file yields
+// an empty Config.
+func LoadFile(path string) (*Config, error) {
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return &Config{}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    cfg, err := Parse(data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return cfg, nil
+}
+
+// Parse decodes config TOML.
+func Parse(data []byte) (*Config, error) {
+    doc, err := ParseTOML(data)
+    if err != nil {
+        return nil, err
+    }
+    return fromValues(doc.Values)
+}
+
+// fromValues decodes and validates the root table of a config.
+func fromValues(values map[string]any) (*Config, error) {
+    var cfg Config
+    if err := decode(values, reflect.ValueOf(&cfg), "", &cfg.Unknown); err != nil {
+        return nil, err
+    }
+    top := ProfileConfig{
+        ModelReasoningEffort: cfg.ModelReasoningEffort,
+        ModelVerbosity:       cfg.ModelVerbosity,
+        ApprovalPolicy:       cfg.ApprovalPolicy,
+        SandboxMode:          cfg.SandboxMode,
+    }
+    if err := top.validate(""); err != nil {
+        return nil, err
+    }
+    for name, p := range cfg.Profiles {
+        if err := p.validate("profiles." + name + "."); err != nil {
+            return nil, err
+        }
+    }
+    if cfg.ModelContextWindow < 0 || cfg.ModelAutoCompactTokenLimit < 0 || cfg.ModelMaxOutputTokens < 0 {
+        return nil, fmt.Errorf("model_context_window, model_auto_compact_token_limit and model_max_output_tokens must not be negative")
+    }
+    if err := cfg.SandboxWorkspaceWrite.Policy(protocol.SandboxWorkspaceWrite).Validate(); err != nil {
+        return nil, fmt.Errorf("sandbox_workspace_write: %w", err)
+    }
+    switch cfg.SandboxContainer.Engine {
+    case "", "docker", "podman":
+    default:
+        return nil, fmt.Errorf("sandbox_container.engine: unknown value %q", cfg.SandboxContainer.Engine)
+    }
+    if err := cfg.ShellEnvironmentPolicy.Policy().Validate(); err != nil {
+        return nil, fmt.Errorf("shell_environment_policy.%w", err)
+    }
+    if cfg.WebSearch.MaxResults < 0 {
+        return nil, fmt.Errorf("web_search.max_results: must not be negative")
+    }
+    if n := cfg.ProjectDocMaxBytes; n != nil && *n < 0 {
+        return nil, fmt.Errorf("project_doc_max_bytes: must not be negative")
+    }
+    switch cfg.LogLevel {
+    case "", "debug", "info", "warn", "error":
+    default:
+        return nil, fmt.Errorf("log_level: unknown value %q", cfg.LogLevel)
+    }
+    switch cfg.CLIAuthCredentialsStore {
+    case "", "file", "keyring", "auto":
+    default:
+        return nil, fmt.Errorf("cli_auth_credentials_store: unknown value %q", cfg.CLIAuthCredentialsStore)
+    }
+    if len(cfg.Notify) > 0 && cfg.Notify[0] == "" {
+        return nil, fmt.Errorf("notify: the program must not be empty")
+    }
+    for name, p := range cfg.ModelPrices {
+        if p.Input < 0 || p.Output < 0 || (p.CachedInput != nil && *p.CachedInput < 0) {
+            return nil, fmt.Errorf("model_prices.%s: prices must not be negative", name)
+        }
+    }
+    for id, p := range cfg.ModelProviders {
+        switch p.WireAPI {
+        case "", WireAPIChat, WireAPIResponses, WireAPIAnthropic:
+        default:
+            return nil, fmt.Errorf("model_providers.%s.wire_api: unknown value %q", id, p.WireAPI)
+        }
+        if n := p.RequestMaxRetries; n != nil && *n < 0 {
+            return nil, fmt.Errorf("model_providers.%s.request_max_retries: must not be negative", id)
+        }
+    }
+    for root, p := range cfg.Projects {
+        switch p.TrustLevel {
+        case "", TrustTrusted, TrustUntrusted:
+        default:
+            return nil, fmt.Errorf("projects.%s.trust_level: unknown value %q", quoteKey(root), p.TrustLevel)
+        }
+    }
+    for name, s := range cfg.MCPServers {
+        if err := s.Validate(); err != nil {
+            return nil, fmt.Errorf("mcp_servers.%s: %w", name, err)
+        }
+    }
+    return &cfg, nil
+}
+
+// validate checks the enumerated settings; prefix qualifies the keys named
+// in errors.
+func (p ProfileConfig) validate(prefix string) error {
+    switch p.ModelReasoningEffort {
+    case "", "minimal", "low", "medium", "high":
+    default:
+        return fmt.Errorf("%smodel_reasoning_effort: unknown value %q", prefix, p.ModelReasoningEffort)
+    }
+    switch p.ModelVerbosity {
+    case "", "low", "medium", "high":
+    default:
+        return fmt.Errorf("%smodel_verbosity: unknown value %q", prefix, p.ModelVerbosity)
+    }
+    switch p.ApprovalPolicy {
+    case "", protocol.ApprovalUntrusted, protocol.ApprovalOnFailure, protocol.ApprovalOnRequest, protocol.ApprovalNever:
+    default:
+        return fmt.Errorf("%sapproval_policy: unknown value %q", prefix, p.ApprovalPolicy)
+    }
+    switch p.SandboxMode {
+    case "", protocol.SandboxReadOnly, protocol.SandboxWorkspaceWrite, protocol.SandboxDangerFullAccess:
+    default:
+        return fmt.Errorf("%ssandbox_mode: unknown value %q", prefix, p.SandboxMode)
+    }
+    return nil
+}
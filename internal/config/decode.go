@@ -0,0 +1,181 @@
+package config
+
+import (
+    "fmt"
+    "math"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+// decode copies TOML data into the struct, map, slice or scalar pointed to
+// by v. Struct fields are matched by their `toml:"name"` tag; fields without
+// a tag are skipped. Keys with no matching field are appended to unknown as
+// dotted paths so callers can warn about them.
+func decode(data any, v reflect.Value, path string, unknown *[]string) error {
+    if v.Kind() == reflect.Pointer {
+        if v.IsNil() {
+            v.Set(reflect.New(v.Type().Elem()))
+        }
+        return decode(data, v.Elem(), path, unknown)
+    }
+
+    switch v.Kind() {
+    case reflect.Struct:
+        m, ok := data.(map[string]any)
+        if !ok {
+            return typeError(path, "table", data)
+        }
+        fields := structFields(v.Type())
+        keys := make([]string, 0, len(m))
+        for k := range m {
+            keys = append(keys, k)
+        }
+        sort.Strings(keys)
+        for _, k := range keys {
+            idx, ok := fields[k]
+            if !ok {
+                if unknown != nil {
+                    *unknown = append(*unknown, joinPath(path, k))
+                }
+                continue
+            }
+            if err := decode(m[k], v.Field(idx), joinPath(path, k), unknown); err != nil {
+                return err
+            }
+        }
+        return nil
+
+    case reflect.Map:
+        m, ok := data.(map[string]any)
+        if !ok {
+            return typeError(path, "table", data)
+        }
+        if v.IsNil() {
+            v.Set(reflect.MakeMap(v.Type()))
+        }
+        for k, raw := range m {
+            elem := reflect.New(v.Type().Elem()).Elem()
+            if err := decode(raw, elem, joinPath(path, k), unknown); err != nil {
+                return err
+            }
+            v.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), elem)
+        }
+        return nil
+
+    case reflect.Slice:
+        arr, ok := data.([]any)
+        if !ok {
+            return typeError(path, "array", data)
+        }
+        out := reflect.MakeSlice(v.Type(), len(arr), len(arr))
+        for i, raw := range arr {
+            if err := decode(raw, out.Index(i), fmt.Sprintf("%s[%d]", path, i), unknown); err != nil {
+                return err
+            }
+        }
+        v.Set(out)
+        return nil
+
+    case reflect.String:
+        s, ok := data.(string)
+        if !ok {
+            return typeError(path, "string", data)
+        }
+        v.SetString(s)
+        return nil
+
+    case reflect.Bool:
+        b, ok := data.(bool)
+        if !ok {
+            return typeError(path, "boolean", data)
+        }
+        v.SetBool(b)
+        return nil
+
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        n, ok := data.(int64)
+        if !ok {
+            return typeError(path, "integer", data)
+        }
+        if v.OverflowInt(n) {
+            return fmt.Errorf("%s: integer %d out of range", path, n)
+        }
+        v.SetInt(n)
+        return nil
+
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        n, ok := data.(int64)
+        if !ok {
+            return typeError(path, "integer", data)
+        }
+        if n < 0 || v.OverflowUint(uint64(n)) {
+            return fmt.Errorf("%s: integer %d out of range", path, n)
+        }
+        v.SetUint(uint64(n))
+        return nil
+
+    case reflect.Float32, reflect.Float64:
+        switch f := data.(type) {
+        case float64:
+            v.SetFloat(f)
+        case int64:
+            v.SetFloat(float64(f))
+        default:
+            return typeError(path, "float", data)
+        }
+        if v.Kind() == reflect.Float32 && math.Abs(v.Float()) > math.MaxFloat32 && !math.IsInf(v.Float(), 0) {
+            return fmt.Errorf("%s: float out of range", path)
+        }
+        return nil
+
+    case reflect.Interface:
+        v.Set(reflect.ValueOf(data))
+        return nil
+    }
+    return fmt.Errorf("%s: unsupported field kind %s", path, v.Kind())
+}
+
+// structFields maps toml tag names to field indexes.
+func structFields(t reflect.Type) map[string]int {
+    out := map[string]int{}
+    for i := 0; i < t.NumField(); i++ {
+        tag := t.Field(i).Tag.Get("toml")
+        name, _, _ := strings.Cut(tag, ",")
+        if name == "" || name == "-" {
+            continue
+        }
+        out[name] = i
+    }
+    return out
+}
+
+func joinPath(base, k string) string {
+    if base == "" {
+        return k
+    }
+    return base + "." + k
+}
+
+// typeName describes a decoded TOML value for error messages.
+func typeName(v any) string {
+    switch v.(type) {
+    case string:
+        return "string"
+    case int64:
+        return "integer"
+    case float64:
+        return "float"
+    case bool:
+        return "boolean"
+    case []any:
+        return "array"
+    case map[string]any:
+        return "table"
+    }
+    return fmt.Sprintf("%T", v)
+}
+
+func typeError(path, want string, got any) error {
+    return fmt.Errorf("%s: expected %s, found %s", path, want, typeName(got))
+}
@@ -0,0 +1,404 @@
+package config
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// The editing helpers below rewrite config.toml textually so that comments,
+// ordering and unrelated settings survive `codex mcp add/remove` and
+// `codex config set/unset`. Only the lines defining the edited key, or
+// whole [mcp_servers.<name>] tables (and their sub-tables), are touched.
+
+// SetMCPServer adds or replaces the named server in the config file at path,
+// creating the file if needed.
+func SetMCPServer(path, name string, server MCPServerConfig) error {
+    if err := server.Validate(); err != nil {
+        return fmt.Errorf("mcp_servers.%s: %w", name, err)
+    }
+    lines, err := readLines(path)
+    if err != nil {
+        return err
+    }
+    lines = removeTables(lines, []string{"mcp_servers", name})
+    for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+        lines = lines[:len(lines)-1]
+    }
+    if len(lines) > 0 {
+        lines = append(lines, "")
+    }
+    lines = append(lines, renderMCPServer(name, server)...)
+    return writeChecked(path, lines, func(cfg *Config) error {
+        if _, ok := cfg.MCPServers[name]; !ok {
+            return fmt.Errorf("mcp_servers.%s: not present after edit", name)
+        }
+        return nil
+    })
+}
+
+// RemoveMCPServer deletes the named server from the config file at path.
+// It reports whether the server was present.
+func RemoveMCPServer(path, name string) (bool, error) {
+    cfg, err := LoadFile(path)
+    if err != nil {
+        return false, err
+    }
+    if _, ok := cfg.MCPServers[name]; !ok {
+        return false, nil
+    }
+    lines, err := readLines(path)
+    if err != nil {
+        return false, err
+    }
+    lines = removeTables(lines, []string{"mcp_servers", name})
+    err = writeChecked(path, lines, func(cfg *Config) error {
+        if _, ok := cfg.MCPServers[name]; ok {
+            // e.g. an inline table under [mcp_servers]; leave it to the user.
+            return fmt.Errorf("mcp_servers.%s is not defined as its own table; edit %s by hand", name, path)
+        }
+        return nil
+    })
+    return err == nil, err
+}
+
+// SetValue sets key to value, as returned by ParseValue, in the config file
+// at path, creating the file if needed. An existing definition is replaced
+// in place; a new key goes to the end of the table it belongs to.
+func SetValue(path, key string, value any) error {
+    segs, err := SplitKey(key)
+    if err != nil {
+        return err
+    }
+    lines, doc, err := readDocument(path)
+    if err != nil {
+        return err
+    }
+    text := FormatValue(value)
+    for i := len(segs) - 1; i >= 1; i-- {
+        if l, ok := doc.Lines[strings.Join(segs[:i], ".")]; ok && !isHeader(lines[l-1]) {
+            return fmt.Errorf("%s is defined inline on line %d; edit %s by hand", JoinKey(segs[:i]), l, path)
+        }
+    }
+    if l, ok := doc.Lines[strings.Join(segs, ".")]; ok {
+        if isHeader(lines[l-1]) {
+            return fmt.Errorf("%s is a table; set its keys one by one", key)
+        }
+        i := l - 1
+        line := lines[i][:assignmentEnd(lines[i])] + " " + text
+        lines = append(lines[:i], append([]string{line}, lines[valueEnd(lines, i):]...)...)
+    } else {
+        at, rel := -1, segs
+        for i := len(segs) - 1; i >= 1; i-- {
+            if l, ok := doc.Lines[strings.Join(segs[:i], ".")]; ok {
+                at, rel = sectionEnd(lines, l), segs[i:]
+                break
+            }
+        }
+        if _, exists := lookup(doc.Values, segs[:len(segs)-1]); at < 0 && exists {
+            at = sectionEnd(lines, 0)
+        }
+        if at >= 0 {
+            line := JoinKey(rel) + " = " + text
+            lines = append(lines[:at], append([]string{line}, lines[at:]...)...)
+        } else {
+            for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+                lines = lines[:len(lines)-1]
+            }
+            if len(lines) > 0 {
+                lines = append(lines, "")
+            }
+            lines = append(lines, "["+JoinKey(segs[:len(segs)-1])+"]", quoteKey(segs[len(segs)-1])+" = "+text)
+        }
+    }
+    return writeChecked(path, lines, func(*Config) error {
+        return checkValue(lines, segs, path, func(v any, ok bool) bool { return ok && FormatValue(v) == text })
+    })
+}
+
+// UnsetValue deletes key, a value or a whole table, from the config file at
+// path. It reports whether the key was present.
+func UnsetValue(path, key string) (bool, error) {
+    segs, err := SplitKey(key)
+    if err != nil {
+        return false, err
+    }
+    lines, doc, err := readDocument(path)
+    if err != nil {
+        return false, err
+    }
+    if _, ok := lookup(doc.Values, segs); !ok {
+        return false, nil
+    }
+    if l, ok := doc.Lines[strings.Join(segs, ".")]; ok && !isHeader(lines[l-1]) {
+        lines = append(lines[:l-1], lines[valueEnd(lines, l-1):]...)
+    } else {
+        lines = removeTables(lines, segs)
+    }
+    err = writeChecked(path, lines, func(*Config) error {
+        return checkValue(lines, segs, path, func(_ any, ok bool) bool { return !ok })
+    })
+    return err == nil, err
+}
+
+// readDocument reads the config file at path as lines and as parsed TOML.
+func readDocument(path string) ([]string, *Document, error) {
+    lines, err := readLines(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    doc, err := ParseTOML([]byte(strings.Join(lines, "\n")))
+    if err != nil {
+        return nil, nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return lines, doc, nil
+}
+
+// checkValue verifies an edit by the value now at segs.
+func checkValue(lines, segs []string, path string, ok func(v any, ok bool) bool) error {
+    doc, err := ParseTOML([]byte(strings.Join(lines, "\n")))
+    if err != nil {
+        return err
+    }
+    if !ok(lookup(doc.Values, segs)) {
+        return fmt.Errorf("%s is not defined on a line of its own; edit %s by hand", JoinKey(segs), path)
+    }
+    return nil
+}
+
+// assignmentEnd returns the offset just past the '=' of a key/value line,
+// skipping any '=' inside a quoted key.
+func assignmentEnd(line string) int {
+    var quote byte
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case quote == '"' && c == '\\':
+            i++
+        case quote != 0:
+            if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == '=':
+            return i + 1
+        }
+    }
+    return len(line)
+}
+
+// valueEnd returns the index of the first line after the key/value pair
+// starting on line i, which spans several lines for multi-line strings and
+// arrays: the shortest run of lines that parses on its own.
+func valueEnd(lines []string, i int) int {
+    for end := i + 1; end <= len(lines); end++ {
+        if _, err := ParseTOML([]byte(strings.Join(lines[i:end], "\n"))); err == nil {
+            return end
+        }
+    }
+    return i + 1
+}
+
+// sectionEnd returns where a key appended to the table whose content starts
+// on line from (0 for the root table) goes: after its last setting, ahead of
+// the blank lines and comments leading into the next header.
+func sectionEnd(lines []string, from int) int {
+    end := from
+    for end < len(lines) && !isHeader(lines[end]) {
+        end++
+    }
+    for end > from {
+        t := strings.TrimSpace(lines[end-1])
+        if t != "" && !strings.HasPrefix(t, "#") {
+            break
+        }
+        end--
+    }
+    return end
+}
+
+func readLines(path string) ([]string, error) {
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    s := strings.TrimSuffix(string(data), "\n")
+    if s == "" {
+        return nil, nil
+    }
+    return strings.Split(s, "\n"), nil
+}
+
+// writeChecked re-parses the edited text, runs check on the result and only
+// then atomically replaces the file.
+func writeChecked(path string, lines []string, check func(*Config) error) error {
+    data := []byte(strings.Join(lines, "\n") + "\n")
+    cfg, err := Parse(data)
+    if err != nil {
+        return fmt.Errorf("%s: edit produced invalid config: %w", path, err)
+    }
+    if err := check(cfg); err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return err
+    }
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.toml")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    if fi, err := os.Stat(path); err == nil {
+        _ = os.Chmod(tmp.Name(), fi.Mode().Perm())
+    }
+    return os.Rename(tmp.Name(), path)
+}
+
+// removeTables drops every table whose header is segs or one of its
+// sub-tables, up to the next header.
+func removeTables(lines []string, segs []string) []string {
+    out := make([]string, 0, len(lines))
+    skipping := false
+    for _, line := range lines {
+        if isHeader(line) {
+            skipping = headerBelongsTo(line, segs)
+        }
+        if !skipping {
+            out = append(out, line)
+        }
+    }
+    return out
+}
+
+func isHeader(line string) bool {
+    return strings.HasPrefix(strings.TrimSpace(line), "[")
+}
+
+// headerBelongsTo parses a single header line and checks whether it opens
+// the table at segs or something nested in it. Parsing (rather than string
+// matching) copes with quoted keys and whitespace.
+func headerBelongsTo(line string, segs []string) bool {
+    doc, err := ParseTOML([]byte(strings.TrimSpace(line)))
+    if err != nil {
+        return false
+    }
+    _, ok := lookup(doc.Values, segs)
+    return ok
+}
+
+// renderMCPServer formats one server as a TOML table.
+func renderMCPServer(name string, s MCPServerConfig) []string {
+    out := []string{"[mcp_servers." + quoteKey(name) + "]"}
+    if s.Command != "" {
+        out = append(out, "command = "+quoteString(s.Command))
+    }
+    if len(s.Args) > 0 {
+        args := make([]string, len(s.Args))
+        for i, a := range s.Args {
+            args[i] = quoteString(a)
+        }
+        out = append(out, "args = ["+strings.Join(args, ", ")+"]")
+    }
+    if len(s.Env) > 0 {
+        keys := make([]string, 0, len(s.Env))
+        for k := range s.Env {
+            keys = append(keys, k)
+        }
+        sort.Strings(keys)
+        pairs := make([]string, len(keys))
+        for i, k := range keys {
+            pairs[i] = quoteKey(k) + " = " + quoteString(s.Env[k])
+        }
+        out = append(out, "env = { "+strings.Join(pairs, ", ")+" }")
+    }
+    if s.Cwd != "" {
+        out = append(out, "cwd = "+quoteString(s.Cwd))
+    }
+    if s.URL != "" {
+        out = append(out, "url = "+quoteString(s.URL))
+    }
+    if s.BearerTokenEnvVar != "" {
+        out = append(out, "bearer_token_env_var = "+quoteString(s.BearerTokenEnvVar))
+    }
+    if s.StartupTimeoutSec > 0 {
+        out = append(out, "startup_timeout_sec = "+strconv.Itoa(s.StartupTimeoutSec))
+    }
+    if s.ToolTimeoutSec > 0 {
+        out = append(out, "tool_timeout_sec = "+strconv.Itoa(s.ToolTimeoutSec))
+    }
+    if s.MaxResultBytes > 0 {
+        out = append(out, "max_result_bytes = "+strconv.Itoa(s.MaxResultBytes))
+    }
+    tools := make([]string, 0, len(s.Tools))
+    for t := range s.Tools {
+        tools = append(tools, t)
+    }
+    sort.Strings(tools)
+    for _, t := range tools {
+        l := s.Tools[t]
+        out = append(out, "", "[mcp_servers."+quoteKey(name)+".tools."+quoteKey(t)+"]")
+        if l.TimeoutSec > 0 {
+            out = append(out, "tool_timeout_sec = "+strconv.Itoa(l.TimeoutSec))
+        }
+        if l.MaxResultBytes > 0 {
+            out = append(out, "max_result_bytes = "+strconv.Itoa(l.MaxResultBytes))
+        }
+    }
+    return out
+}
+
+// quoteKey returns k bare when TOML allows it, quoted otherwise.
+func quoteKey(k string) string {
+    if k == "" {
+        return `""`
+    }
+    for _, r := range k {
+        if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+            return quoteString(k)
+        }
+    }
+    return k
+}
+
+// quoteString renders s as a TOML basic string. strconv.Quote is not used
+// because TOML has no \x escapes.
+func quoteString(s string) string {
+    var b strings.Builder
+    b.WriteByte('"')
+    for _, r := range s {
+        switch r {
+        case '"':
+            b.WriteString(`\"`)
+        case '\\':
+            b.WriteString(`\\`)
+        case '\n':
+            b.WriteString(`\n`)
+        case '\t':
+            b.WriteString(`\t`)
+        case '\r':
+            b.WriteString(`\r`)
+        default:
+            if r < 0x20 || r == 0x7f {
+                fmt.Fprintf(&b, `\u%04X`, r)
+            } else {
+                b.WriteRune(r)
+            }
+        }
+    }
+    b.WriteByte('"')
+    return b.String()
+}
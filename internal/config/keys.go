@@ -0,0 +1,216 @@
+package config
+
+import (
+    "fmt"
+    "math"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Keys are dotted paths into the config, written as in a TOML file:
+// "model", "model_providers.azure.api_version", `mcp_servers."my.server".url`.
+
+// SplitKey splits a dotted key into its segments.
+func SplitKey(key string) ([]string, error) {
+    doc, err := ParseTOML([]byte(key + " = 0"))
+    if err != nil {
+        return nil, fmt.Errorf("invalid key %q", key)
+    }
+    var segs []string
+    for t := doc.Values; ; {
+        if len(t) != 1 {
+            return nil, fmt.Errorf("invalid key %q", key)
+        }
+        for k, v := range t {
+            segs = append(segs, k)
+            sub, ok := v.(map[string]any)
+            if !ok {
+                return segs, nil
+            }
+            t = sub
+        }
+    }
+}
+
+// JoinKey is the inverse of SplitKey.
+func JoinKey(segs []string) string {
+    quoted := make([]string, len(segs))
+    for i, s := range segs {
+        quoted[i] = quoteKey(s)
+    }
+    return strings.Join(quoted, ".")
+}
+
+// keyType returns the Go type a key decodes into, or an error naming the
+// first segment that is not a known key.
+func keyType(segs []string) (reflect.Type, error) {
+    t := reflect.TypeOf(Config{})
+    for i, s := range segs {
+        for t.Kind() == reflect.Pointer {
+            t = t.Elem()
+        }
+        switch t.Kind() {
+        case reflect.Struct:
+            idx, ok := structFields(t)[s]
+            if !ok {
+                return nil, fmt.Errorf("unknown key %s", JoinKey(segs[:i+1]))
+            }
+            t = t.Field(idx).Type
+        case reflect.Map:
+            t = t.Elem()
+        default:
+            return nil, fmt.Errorf("%s is not a table", JoinKey(segs[:i]))
+        }
+    }
+    return t, nil
+}
+
+// ParseValue converts raw, as typed on a command line, to the value of key:
+// TOML syntax ("true", "30", `["a", "b"]`, `{ X = "y" }`), except that
+// string keys also take the text as is. The value must have the key's type.
+func ParseValue(key, raw string) (any, error) {
+    segs, err := SplitKey(key)
+    if err != nil {
+        return nil, err
+    }
+    t, err := keyType(segs)
+    if err != nil {
+        return nil, err
+    }
+    var v any
+    doc, err := ParseTOML([]byte("v = " + raw))
+    if err == nil {
+        v = doc.Values["v"]
+    }
+    base := t
+    for base.Kind() == reflect.Pointer {
+        base = base.Elem()
+    }
+    if _, isString := v.(string); base.Kind() == reflect.String && !isString {
+        v, err = raw, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("%s: %q is not a TOML value", key, raw)
+    }
+    if err := decode(v, reflect.New(t), JoinKey(segs), nil); err != nil {
+        return nil, err
+    }
+    return v, nil
+}
+
+// FormatValue renders a decoded value in TOML syntax.
+func FormatValue(v any) string {
+    switch v := v.(type) {
+    case string:
+        return quoteString(v)
+    case bool:
+        return strconv.FormatBool(v)
+    case int64:
+        return strconv.FormatInt(v, 10)
+    case float64:
+        switch {
+        case math.IsNaN(v):
+            return "nan"
+        case math.IsInf(v, 1):
+            return "inf"
+        case math.IsInf(v, -1):
+            return "-inf"
+        }
+        s := strconv.FormatFloat(v, 'g', -1, 64)
+        if !strings.ContainsAny(s, ".e") {
+            s += ".0"
+        }
+        return s
+    case []any:
+        items := make([]string, len(v))
+        for i, e := range v {
+            items[i] = FormatValue(e)
+        }
+        return "[" + strings.Join(items, ", ") + "]"
+    case map[string]any:
+        if len(v) == 0 {
+            return "{}"
+        }
+        keys := sortedKeys(v)
+        pairs := make([]string, len(keys))
+        for i, k := range keys {
+            pairs[i] = quoteKey(k) + " = " + FormatValue(v[k])
+        }
+        return "{ " + strings.Join(pairs, ", ") + " }"
+    }
+    return fmt.Sprint(v)
+}
+
+// KeyValue is one setting of a config file.
+type KeyValue struct {
+    Key   string
+    Value any
+}
+
+// Flatten lists the settings of a root table by dotted key, sorted. Tables
+// are descended into; arrays, including arrays of tables, are values.
+func Flatten(values map[string]any) []KeyValue {
+    var out []KeyValue
+    var walk func(prefix []string, t map[string]any)
+    walk = func(prefix []string, t map[string]any) {
+        for _, k := range sortedKeys(t) {
+            path := append(append([]string{}, prefix...), k)
+            if sub, ok := t[k].(map[string]any); ok && len(sub) > 0 {
+                walk(path, sub)
+                continue
+            }
+            out = append(out, KeyValue{Key: JoinKey(path), Value: t[k]})
+        }
+    }
+    walk(nil, values)
+    return out
+}
+
+// GetValue returns the value of key in the config file at path.
+func GetValue(path, key string) (any, bool, error) {
+    segs, err := SplitKey(key)
+    if err != nil {
+        return nil, false, err
+    }
+    values, err := readValues(path)
+    if err != nil {
+        return nil, false, err
+    }
+    v, ok := lookup(values, segs)
+    return v, ok, nil
+}
+
+// ListValues returns the settings of the config file at path (see Flatten).
+func ListValues(path string) ([]KeyValue, error) {
+    values, err := readValues(path)
+    if err != nil {
+        return nil, err
+    }
+    return Flatten(values), nil
+}
+
+// lookup returns the value at segs in the root table values.
+func lookup(values map[string]any, segs []string) (any, bool) {
+    var v any = values
+    for _, s := range segs {
+        t, ok := v.(map[string]any)
+        if !ok {
+            return nil, false
+        }
+        if v, ok = t[s]; !ok {
+            return nil, false
+        }
+    }
+    return v, true
+}
+
+func sortedKeys(m map[string]any) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
@@ -0,0 +1,411 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "net/url"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Settings come from layers, lowest precedence first: the user config file,
+// the project's config file, the selected profile, CODEX_* environment
+// variables, and the command line. A later layer overrides an earlier one
+// key by key; tables merge, while arrays and scalars are replaced whole.
+const (
+    LayerUser    = "user"    // <codex home>/config.toml
+    LayerProject = "project" // .codex/config.toml of the project
+    LayerProfile = "profile" // [profiles.<name>] of the merged files
+    LayerEnv     = "env"     // CODEX_* environment variables
+    LayerFlags   = "flags"   // -c key=value and other command-line flags
+)
+
+// ProjectDir is the directory holding a project's config file.
+const ProjectDir = ".codex"
+
+// projectDenied lists the keys a project config cannot set: they run
+// programs, decide where API keys are sent or kept, which secrets commands
+// see, where sandboxed commands can write or in what they run, or which
+// projects are trusted, which a repository someone else wrote must not
+// control.
+var projectDenied = []string{"notify", "mcp_servers", "model_providers", "shell_environment_policy", "sandbox_workspace_write", "sandbox_container", "projects", "cli_auth_credentials_store", "credential"}
+
+// EnvPrefix starts the environment variables that set config keys. The
+// rest of the name is the key in upper case, with "__" between its
+// segments: CODEX_SANDBOX_MODE sets sandbox_mode and
+// CODEX_MODEL_PROVIDERS__OPENAI__BASE_URL model_providers.openai.base_url.
+// Variables naming no config key, like CODEX_HOME, are not settings.
+const EnvPrefix = "CODEX_"
+
+// Layer is one source of settings that took part in an EffectiveConfig.
+type Layer struct {
+    Name string
+    // Path is the file the layer was read from; empty for env and flags.
+    Path string
+    // Ignored lists keys the layer set but was not allowed to.
+    Ignored []string
+}
+
+// EffectiveConfig is the configuration in effect: every layer merged.
+type EffectiveConfig struct {
+    Config
+    // Profile is the name of the selected profile, if any.
+    Profile string
+    // Layers are the layers that set anything, lowest precedence first.
+    Layers []Layer
+    // Values are the merged settings Config was decoded from.
+    Values map[string]any
+    // Sources maps the dotted key of each of Values (see Flatten) to the
+    // name of the layer that set it.
+    Sources map[string]string
+}
+
+// LoadOptions selects the layers of an EffectiveConfig.
+type LoadOptions struct {
+    // Cwd locates the project config: the nearest .codex/config.toml in
+    // Cwd or a parent directory, up to the root of the git repository
+    // containing Cwd. Empty means no project layer.
+    Cwd string
+    // Environ lists the environment as KEY=VALUE entries; nil means
+    // os.Environ.
+    Environ func() []string
+    // Profile selects a [profiles.<name>] table, overriding the
+    // default_profile key. It is an error if the table does not exist.
+    Profile string
+    // Overrides are key=value settings from the command line, applied
+    // last in order. Values are TOML ("true", "[\"a\"]", "'x'"); a value
+    // that does not parse as TOML is taken as a string.
+    Overrides []string
+}
+
+// LoadEffective reads and merges every layer. A layer that does not parse
+// is an error naming its source.
+func LoadEffective(opts LoadOptions) (*EffectiveConfig, error) {
+    var eff EffectiveConfig
+    var layers []map[string]any
+    add := func(l Layer, values map[string]any) {
+        if len(values) == 0 {
+            return
+        }
+        layers = append(layers, values)
+        eff.Layers = append(eff.Layers, l)
+    }
+
+    userPath, err := DefaultPath()
+    if err != nil {
+        return nil, err
+    }
+    values, err := readValues(userPath)
+    if err != nil {
+        return nil, err
+    }
+    add(Layer{Name: LayerUser, Path: userPath}, values)
+
+    if opts.Cwd != "" {
+        if path := FindProjectConfig(opts.Cwd); path != "" && !samePath(path, userPath) {
+            values, err := readValues(path)
+            if err != nil {
+                return nil, err
+            }
+            l := Layer{Name: LayerProject, Path: path}
+            l.Ignored = dropKeys(values, "", projectDenied)
+            // Profiles are filtered too: a project could otherwise select
+            // one of its own that sets a denied key.
+            if profiles, ok := values["profiles"].(map[string]any); ok {
+                for _, name := range sortedKeys(profiles) {
+                    if p, ok := profiles[name].(map[string]any); ok {
+                        l.Ignored = append(l.Ignored, dropKeys(p, "profiles."+quoteKey(name)+".", projectDenied)...)
+                    }
+                }
+            }
+            add(l, values)
+        }
+    }
+
+    environ := opts.Environ
+    if environ == nil {
+        environ = os.Environ
+    }
+    env := map[string]any{}
+    vars := environ()
+    sort.Strings(vars)
+    for _, kv := range vars {
+        name, raw, _ := strings.Cut(kv, "=")
+        segs, ok := EnvKey(name)
+        if !ok || raw == "" {
+            continue
+        }
+        v, err := ParseValue(JoinKey(segs), raw)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", name, err)
+        }
+        for i := len(segs) - 1; i > 0; i-- {
+            v = map[string]any{segs[i]: v}
+        }
+        mergeValues(env, map[string]any{segs[0]: v})
+    }
+    add(Layer{Name: LayerEnv}, env)
+
+    flags := map[string]any{}
+    for _, o := range opts.Overrides {
+        values, err := ParseOverride(o)
+        if err != nil {
+            return nil, err
+        }
+        mergeValues(flags, values)
+    }
+    add(Layer{Name: LayerFlags}, flags)
+
+    merged := map[string]any{}
+    for _, values := range layers {
+        mergeValues(merged, values)
+    }
+    // The profile is chosen and read from every layer, so -c can select
+    // or amend one, but it ranks below env and flags.
+    eff.Profile = opts.Profile
+    if eff.Profile == "" {
+        eff.Profile, _ = merged["default_profile"].(string)
+    }
+    if eff.Profile != "" {
+        profiles, _ := merged["profiles"].(map[string]any)
+        profile, ok := profiles[eff.Profile].(map[string]any)
+        if !ok {
+            return nil, fmt.Errorf("profile %q is not defined (want a [profiles.%s] table)", eff.Profile, eff.Profile)
+        }
+        // Only the keys of ProfileConfig can be set by a profile.
+        profile = copyValues(profile)
+        var denied []string
+        for k := range profile {
+            if !profileKeys[k] {
+                denied = append(denied, k)
+            }
+        }
+        sort.Strings(denied)
+        ignored := dropKeys(profile, "profiles."+quoteKey(eff.Profile)+".", denied)
+        at := 0
+        for at < len(eff.Layers) && (eff.Layers[at].Name == LayerUser || eff.Layers[at].Name == LayerProject) {
+            at++
+        }
+        layers = append(layers[:at], append([]map[string]any{profile}, layers[at:]...)...)
+        eff.Layers = append(eff.Layers[:at], append([]Layer{{Name: LayerProfile, Ignored: ignored}}, eff.Layers[at:]...)...)
+        merged = map[string]any{}
+        for _, values := range layers {
+            mergeValues(merged, values)
+        }
+    }
+
+    eff.Values = merged
+    eff.Sources = map[string]string{}
+    for _, kv := range Flatten(merged) {
+        // The last layer setting a key wins; a key a later layer replaced
+        // with a table or a scalar is not in merged.
+        for i := len(layers) - 1; i >= 0; i-- {
+            if segs, err := SplitKey(kv.Key); err == nil {
+                if _, ok := lookup(layers[i], segs); ok {
+                    eff.Sources[kv.Key] = eff.Layers[i].Name
+                    break
+                }
+            }
+        }
+    }
+    if opts.Profile != "" {
+        eff.Sources["default_profile"] = LayerFlags
+    }
+
+    cfg, err := fromValues(merged)
+    if err != nil {
+        return nil, err
+    }
+    eff.Config = *cfg
+    return &eff, nil
+}
+
+// EnvKey returns the segments of the config key the environment variable
+// name sets (see EnvPrefix), if any.
+func EnvKey(name string) ([]string, bool) {
+    rest, ok := strings.CutPrefix(name, EnvPrefix)
+    if !ok || rest == "" {
+        return nil, false
+    }
+    segs := strings.Split(strings.ToLower(rest), "__")
+    for _, s := range segs {
+        if s == "" {
+            return nil, false
+        }
+    }
+    if _, err := keyType(segs); err != nil {
+        return nil, false
+    }
+    return segs, true
+}
+
+// FindProjectConfig returns the project config file for dir, or "" when
+// there is none (see LoadOptions.Cwd).
+func FindProjectConfig(dir string) string {
+    dir, err := filepath.Abs(dir)
+    if err != nil {
+        return ""
+    }
+    var found string
+    for d := dir; ; {
+        if found == "" {
+            p := filepath.Join(d, ProjectDir, FileName)
+            if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+                found = p
+            }
+        }
+        if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+            return found
+        }
+        parent := filepath.Dir(d)
+        if parent == d {
+            break
+        }
+        d = parent
+    }
+    // Outside a repository only dir itself is the project.
+    if found != "" && filepath.Dir(filepath.Dir(found)) == dir {
+        return found
+    }
+    return ""
+}
+
+// ParseOverride parses a key=value setting into the table it stands for.
+func ParseOverride(s string) (map[string]any, error) {
+    key, value, ok := strings.Cut(s, "=")
+    key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+    if !ok || key == "" {
+        return nil, fmt.Errorf("override %q: want key=value", s)
+    }
+    doc, err := ParseTOML([]byte(key + " = " + value))
+    if err != nil {
+        doc, err = ParseTOML([]byte(key + " = " + strconv.Quote(value)))
+    }
+    if err != nil {
+        return nil, fmt.Errorf("override %q: %w", s, err)
+    }
+    return doc.Values, nil
+}
+
+// readValues parses the config file at path into its root table. A missing
+// file has none.
+func readValues(path string) (map[string]any, error) {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    doc, err := ParseTOML(data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return doc.Values, nil
+}
+
+// profileKeys are the keys a [profiles.<name>] table can set: those of
+// ProfileConfig.
+var profileKeys = func() map[string]bool {
+    keys := map[string]bool{}
+    t := reflect.TypeOf(ProfileConfig{})
+    for i := 0; i < t.NumField(); i++ {
+        if k := t.Field(i).Tag.Get("toml"); k != "" && k != "-" {
+            keys[k] = true
+        }
+    }
+    return keys
+}()
+
+// dropKeys deletes keys from values and returns those it found, qualified
+// by prefix.
+func dropKeys(values map[string]any, prefix string, keys []string) []string {
+    var dropped []string
+    for _, k := range keys {
+        if _, ok := values[k]; ok {
+            delete(values, k)
+            dropped = append(dropped, prefix+k)
+        }
+    }
+    return dropped
+}
+
+// copyValues returns a deep copy of the table values.
+func copyValues(values map[string]any) map[string]any {
+    cp := map[string]any{}
+    mergeValues(cp, values)
+    return cp
+}
+
+// Redacted replaces secret values in RedactSecrets' output.
+const Redacted = "<redacted>"
+
+// secretTables are tables whose values can hold secrets: headers and query
+// parameters sent to model providers and MCP servers, and environment
+// variables given to MCP servers and commands.
+var secretTables = map[string]bool{"http_headers": true, "query_params": true, "env": true, "set": true}
+
+// RedactSecrets returns a copy of values, such as EffectiveConfig.Values,
+// fit to show: the values of secretTables are replaced with Redacted and
+// passwords in URLs are masked.
+func RedactSecrets(values map[string]any) map[string]any {
+    out := make(map[string]any, len(values))
+    for k, v := range values {
+        out[k] = redactValue(k, v)
+    }
+    return out
+}
+
+func redactValue(key string, v any) any {
+    switch v := v.(type) {
+    case map[string]any:
+        if secretTables[key] {
+            out := make(map[string]any, len(v))
+            for k := range v {
+                out[k] = Redacted
+            }
+            return out
+        }
+        return RedactSecrets(v)
+    case []any:
+        out := make([]any, len(v))
+        for i, e := range v {
+            out[i] = redactValue(key, e)
+        }
+        return out
+    case string:
+        if u, err := url.Parse(v); err == nil && u.Scheme != "" && u.User != nil {
+            return u.Redacted()
+        }
+    }
+    return v
+}
+
+// mergeValues merges src into dst: tables present in both merge, any other
+// value of src replaces dst's.
+func mergeValues(dst, src map[string]any) {
+    for k, v := range src {
+        sub, isTable := v.(map[string]any)
+        if cur, ok := dst[k].(map[string]any); ok && isTable {
+            mergeValues(cur, sub)
+            continue
+        }
+        if isTable {
+            // Copied so later merges do not write into a layer's table.
+            cp := map[string]any{}
+            mergeValues(cp, sub)
+            v = cp
+        }
+        dst[k] = v
+    }
+}
+
+func samePath(a, b string) bool {
+    fa, errA := os.Stat(a)
+    fb, errB := os.Stat(b)
+    return errA == nil && errB == nil && os.SameFile(fa, fb)
+}
@@ -0,0 +1,248 @@
+package config
+
+//go:generate go run ../../cmd/codex config schema -o ../../schema/config.schema.json
+
+import (
+    "encoding/json"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+
+    iexec "codex-go/internal/exec"
+    "codex-go/internal/protocol"
+)
+
+// SchemaDraft is the JSON Schema version of Schema.
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// keyEnums lists the values of enumerated keys, by key name. Reflection
+// cannot see them; keep in sync with the checks in fromValues.
+var keyEnums = map[string][]string{
+    "model_reasoning_effort":     {"minimal", "low", "medium", "high"},
+    "model_verbosity":            {"low", "medium", "high"},
+    "approval_policy":            {protocol.ApprovalUntrusted, protocol.ApprovalOnFailure, protocol.ApprovalOnRequest, protocol.ApprovalNever},
+    "sandbox_mode":               {protocol.SandboxReadOnly, protocol.SandboxWorkspaceWrite, protocol.SandboxDangerFullAccess},
+    "wire_api":                   {WireAPIChat, WireAPIResponses, WireAPIAnthropic},
+    "inherit":                    {iexec.InheritAll, iexec.InheritCore, iexec.InheritNone},
+    "log_level":                  {"debug", "info", "warn", "error"},
+    "trust_level":                {TrustTrusted, TrustUntrusted},
+    "cli_auth_credentials_store": {"file", "keyring", "auto"},
+    "engine":                     {"docker", "podman"},
+}
+
+// deprecatedKeys are root keys older versions read, with what replaced
+// them. They are accepted but ignored.
+var deprecatedKeys = map[string]string{
+    "openai": "use [model_providers.openai] instead; API keys are read from the variable named by env_key",
+}
+
+// Schema returns a JSON Schema of config.toml, derived from the toml tags
+// of Config. Every number must be non-negative.
+func Schema() map[string]any {
+    s := typeSchema(reflect.TypeOf(Config{}))
+    props := s["properties"].(map[string]any)
+    for k, why := range deprecatedKeys {
+        props[k] = map[string]any{"deprecated": true, "description": "Deprecated: " + why}
+    }
+    s["$schema"] = SchemaDraft
+    s["title"] = "codex-go config.toml"
+    return s
+}
+
+// SchemaJSON returns Schema indented, with keys sorted.
+func SchemaJSON() ([]byte, error) {
+    b, err := json.MarshalIndent(Schema(), "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    return append(b, '\n'), nil
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+    switch t.Kind() {
+    case reflect.Pointer:
+        return typeSchema(t.Elem())
+    case reflect.String:
+        return map[string]any{"type": "string"}
+    case reflect.Bool:
+        return map[string]any{"type": "boolean"}
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return map[string]any{"type": "integer", "minimum": 0}
+    case reflect.Float32, reflect.Float64:
+        return map[string]any{"type": "number", "minimum": 0}
+    case reflect.Slice:
+        return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+    case reflect.Map:
+        return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+    case reflect.Struct:
+        props := map[string]any{}
+        for name, idx := range structFields(t) {
+            s := typeSchema(t.Field(idx).Type)
+            if vals, ok := keyEnums[name]; ok {
+                s["enum"] = vals
+            }
+            props[name] = s
+        }
+        return map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+    }
+    return map[string]any{}
+}
+
+// Problem is something wrong with a config file.
+type Problem struct {
+    // Line is where Key is defined; 0 when unknown.
+    Line int
+    Key  string
+    // Warning marks problems that need no fix yet, such as deprecated keys.
+    Warning bool
+    Message string
+}
+
+func (p Problem) String() string {
+    kind := "error"
+    if p.Warning {
+        kind = "warning"
+    }
+    if p.Key == "" {
+        return fmt.Sprintf("%d: %s: %s", p.Line, kind, p.Message)
+    }
+    return fmt.Sprintf("%d: %s: %s: %s", p.Line, kind, p.Key, p.Message)
+}
+
+// Validate checks config TOML against Schema and the rules Parse enforces,
+// reporting every unknown key, type mismatch and deprecated key, ordered by
+// line. A file that is not valid TOML yields an error instead.
+func Validate(data []byte) ([]Problem, error) {
+    doc, err := ParseTOML(data)
+    if err != nil {
+        return nil, err
+    }
+    v := &validator{doc: doc}
+    v.check(doc.Values, Schema(), nil)
+    if !v.failed() {
+        // Rules the schema cannot express, such as mcp_servers entries
+        // needing exactly one of command and url.
+        if _, err := fromValues(doc.Values); err != nil {
+            if key, msg, ok := strings.Cut(err.Error(), ": "); ok {
+                v.add(strings.Split(key, "."), false, "%s", msg)
+            } else {
+                v.add(nil, false, "%s", err)
+            }
+        }
+    }
+    sort.SliceStable(v.problems, func(i, j int) bool { return v.problems[i].Line < v.problems[j].Line })
+    return v.problems, nil
+}
+
+type validator struct {
+    doc      *Document
+    problems []Problem
+}
+
+func (v *validator) failed() bool {
+    for _, p := range v.problems {
+        if !p.Warning {
+            return true
+        }
+    }
+    return false
+}
+
+// add records a problem at segs, located at the line of segs or of its
+// nearest ancestor with a known line (keys inside inline tables have none).
+func (v *validator) add(segs []string, warning bool, format string, args ...any) {
+    p := Problem{Key: JoinKey(segs), Warning: warning, Message: fmt.Sprintf(format, args...)}
+    for n := len(segs); n > 0 && p.Line == 0; n-- {
+        p.Line = v.doc.Lines[strings.Join(segs[:n], ".")]
+    }
+    v.problems = append(v.problems, p)
+}
+
+// check validates value against the schema node s, the subset of JSON
+// Schema Schema produces.
+func (v *validator) check(value any, s map[string]any, segs []string) {
+    if s["deprecated"] == true {
+        desc, _ := s["description"].(string)
+        v.add(segs, true, "deprecated: %s", strings.TrimPrefix(desc, "Deprecated: "))
+        return
+    }
+    want, _ := s["type"].(string)
+    if want != "" && !tomlHasType(value, want) {
+        v.add(segs, false, "expected %s, found %s", schemaTypeName(want), typeName(value))
+        return
+    }
+    if vals, ok := s["enum"].([]string); ok {
+        str, _ := value.(string)
+        found := false
+        for _, e := range vals {
+            found = found || e == str
+        }
+        if !found {
+            v.add(segs, false, "unknown value %q (want one of %s)", str, strings.Join(vals, ", "))
+        }
+    }
+    if _, ok := s["minimum"]; ok {
+        if n, ok := value.(int64); ok && n < 0 {
+            v.add(segs, false, "must not be negative")
+        }
+        if f, ok := value.(float64); ok && f < 0 {
+            v.add(segs, false, "must not be negative")
+        }
+    }
+    switch value := value.(type) {
+    case []any:
+        items, _ := s["items"].(map[string]any)
+        for i, e := range value {
+            v.check(e, items, append(append([]string{}, segs...), fmt.Sprint(i)))
+        }
+    case map[string]any:
+        props, _ := s["properties"].(map[string]any)
+        for _, k := range sortedKeys(value) {
+            path := append(append([]string{}, segs...), k)
+            if sub, ok := props[k].(map[string]any); ok {
+                v.check(value[k], sub, path)
+                continue
+            }
+            switch extra := s["additionalProperties"].(type) {
+            case map[string]any:
+                v.check(value[k], extra, path)
+            case bool:
+                if !extra {
+                    v.add(path, false, "unknown key")
+                }
+            }
+        }
+    }
+}
+
+// tomlHasType reports whether a decoded TOML value is of the JSON Schema
+// type want.
+func tomlHasType(v any, want string) bool {
+    switch v.(type) {
+    case string:
+        return want == "string"
+    case bool:
+        return want == "boolean"
+    case int64:
+        return want == "integer" || want == "number"
+    case float64:
+        return want == "number"
+    case []any:
+        return want == "array"
+    case map[string]any:
+        return want == "object"
+    }
+    return false
+}
+
+// schemaTypeName names a JSON Schema type the way TOML does.
+func schemaTypeName(t string) string {
+    switch t {
+    case "object":
+        return "table"
+    case "number":
+        return "float"
+    }
+    return t
+}
@@ -0,0 +1,615 @@
+package config
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// This file implements the subset of TOML v1.0 used by codex config files,
+// without pulling in a third-party dependency:
+//   - comments, bare/quoted/dotted keys
+//   - basic, literal and multi-line strings
+//   - integers (decimal, hex, octal, binary, with underscores), floats, booleans
+//   - arrays (multi-line, trailing commas) and inline tables
+//   - [tables] and [[arrays of tables]]
+// Offset date-times and similar values are kept as their literal string.
+//
+// Values decode to: string, int64, float64, bool, []any, map[string]any.
+
+// Document is a parsed TOML file.
+type Document struct {
+    // Values is the root table.
+    Values map[string]any
+    // Lines maps dotted key paths (e.g. "mcp_servers.github.command") to the
+    // 1-based line on which they were defined. Table headers are recorded too.
+    Lines map[string]int
+}
+
+// ParseTOML parses data into a Document.
+func ParseTOML(data []byte) (*Document, error) {
+    p := &tomlParser{
+        src:     []rune(string(data)),
+        line:    1,
+        doc:     &Document{Values: map[string]any{}, Lines: map[string]int{}},
+        defined: map[string]bool{},
+    }
+    if !utf8.Valid(data) {
+        return nil, fmt.Errorf("toml: file is not valid UTF-8")
+    }
+    if err := p.parse(); err != nil {
+        return nil, err
+    }
+    return p.doc, nil
+}
+
+type tomlParser struct {
+    src  []rune
+    pos  int
+    line int
+    doc  *Document
+
+    cur     map[string]any // table receiving key/value pairs
+    curPath []string
+    defined map[string]bool // explicitly defined [table] headers
+}
+
+func (p *tomlParser) errf(format string, args ...any) error {
+    return fmt.Errorf("toml: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *tomlParser) peek() rune {
+    if p.eof() {
+        return 0
+    }
+    return p.src[p.pos]
+}
+
+func (p *tomlParser) next() rune {
+    r := p.src[p.pos]
+    p.pos++
+    if r == '\n' {
+        p.line++
+    }
+    return r
+}
+
+// skipSpace skips spaces and tabs (not newlines).
+func (p *tomlParser) skipSpace() {
+    for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+        p.pos++
+    }
+}
+
+// skipComment skips a comment up to (not including) the newline.
+func (p *tomlParser) skipComment() {
+    if p.peek() == '#' {
+        for !p.eof() && p.peek() != '\n' {
+            p.pos++
+        }
+    }
+}
+
+// skipBlank skips whitespace, newlines and comments.
+func (p *tomlParser) skipBlank() {
+    for !p.eof() {
+        switch p.peek() {
+        case ' ', '\t', '\r', '\n':
+            p.next()
+        case '#':
+            p.skipComment()
+        default:
+            return
+        }
+    }
+}
+
+// endOfLine requires only whitespace/comment until the newline.
+func (p *tomlParser) endOfLine() error {
+    p.skipSpace()
+    p.skipComment()
+    if p.eof() {
+        return nil
+    }
+    if p.peek() == '\r' {
+        p.pos++
+    }
+    if p.eof() || p.peek() == '\n' {
+        if !p.eof() {
+            p.next()
+        }
+        return nil
+    }
+    return p.errf("unexpected %q after value", p.peek())
+}
+
+func (p *tomlParser) parse() error {
+    p.cur = p.doc.Values
+    for {
+        p.skipBlank()
+        if p.eof() {
+            return nil
+        }
+        switch p.peek() {
+        case '[':
+            if err := p.parseHeader(); err != nil {
+                return err
+            }
+        default:
+            if err := p.parseKeyValue(p.cur, p.curPath); err != nil {
+                return err
+            }
+            if err := p.endOfLine(); err != nil {
+                return err
+            }
+        }
+    }
+}
+
+// parseHeader handles [table] and [[array.of.tables]].
+func (p *tomlParser) parseHeader() error {
+    line := p.line
+    p.next() // '['
+    array := false
+    if p.peek() == '[' {
+        p.next()
+        array = true
+    }
+    p.skipSpace()
+    key, err := p.parseKey()
+    if err != nil {
+        return err
+    }
+    p.skipSpace()
+    if p.eof() || p.next() != ']' {
+        return p.errf("expected ']' to close table header")
+    }
+    if array && (p.eof() || p.next() != ']') {
+        return p.errf("expected ']]' to close array-of-tables header")
+    }
+    if err := p.endOfLine(); err != nil {
+        return err
+    }
+
+    parent := p.doc.Values
+    for i, k := range key[:len(key)-1] {
+        t, err := p.descend(parent, k, key[:i+1])
+        if err != nil {
+            return err
+        }
+        parent = t
+    }
+    last := key[len(key)-1]
+    path := strings.Join(key, ".")
+    if array {
+        var arr []any
+        switch v := parent[last].(type) {
+        case nil:
+        case []any:
+            if len(v) == 0 {
+                return p.errf("cannot append to static array %q", path)
+            }
+            if _, ok := v[0].(map[string]any); !ok {
+                return p.errf("cannot append to static array %q", path)
+            }
+            arr = v
+        default:
+            return p.errf("key %q already defined as a non-array", path)
+        }
+        t := map[string]any{}
+        parent[last] = append(arr, t)
+        p.cur = t
+    } else {
+        if p.defined[path] {
+            return p.errf("table %q defined more than once", path)
+        }
+        p.defined[path] = true
+        t, err := p.descend(parent, last, key)
+        if err != nil {
+            return err
+        }
+        p.cur = t
+    }
+    p.curPath = key
+    p.doc.Lines[path] = line
+    return nil
+}
+
+// descend returns the table parent[k], creating it when missing. For an
+// array of tables it returns the last element, as TOML requires.
+func (p *tomlParser) descend(parent map[string]any, k string, path []string) (map[string]any, error) {
+    switch v := parent[k].(type) {
+    case nil:
+        t := map[string]any{}
+        parent[k] = t
+        return t, nil
+    case map[string]any:
+        return v, nil
+    case []any:
+        if n := len(v); n > 0 {
+            if t, ok := v[n-1].(map[string]any); ok {
+                return t, nil
+            }
+        }
+    }
+    return nil, p.errf("key %q is not a table", strings.Join(path, "."))
+}
+
+// parseKeyValue parses "key = value" into table t (whose path is base).
+func (p *tomlParser) parseKeyValue(t map[string]any, base []string) error {
+    line := p.line
+    key, err := p.parseKey()
+    if err != nil {
+        return err
+    }
+    p.skipSpace()
+    if p.eof() || p.next() != '=' {
+        return p.errf("expected '=' after key %q", strings.Join(key, "."))
+    }
+    p.skipSpace()
+    val, err := p.parseValue()
+    if err != nil {
+        return err
+    }
+    full := append(append([]string{}, base...), key...)
+    for i, k := range key[:len(key)-1] {
+        t, err = p.descend(t, k, append(append([]string{}, base...), key[:i+1]...))
+        if err != nil {
+            return err
+        }
+    }
+    last := key[len(key)-1]
+    if _, exists := t[last]; exists {
+        return p.errf("key %q defined more than once", strings.Join(full, "."))
+    }
+    t[last] = val
+    p.doc.Lines[strings.Join(full, ".")] = line
+    return nil
+}
+
+// parseKey parses a (possibly dotted) key.
+func (p *tomlParser) parseKey() ([]string, error) {
+    var parts []string
+    for {
+        p.skipSpace()
+        var part string
+        switch p.peek() {
+        case '"':
+            s, err := p.parseBasicString()
+            if err != nil {
+                return nil, err
+            }
+            part = s
+        case '\'':
+            s, err := p.parseLiteralString()
+            if err != nil {
+                return nil, err
+            }
+            part = s
+        default:
+            start := p.pos
+            for !p.eof() && isBareKeyRune(p.peek()) {
+                p.pos++
+            }
+            if start == p.pos {
+                return nil, p.errf("expected a key, found %q", p.peek())
+            }
+            part = string(p.src[start:p.pos])
+        }
+        parts = append(parts, part)
+        p.skipSpace()
+        if p.peek() != '.' {
+            return parts, nil
+        }
+        p.pos++
+    }
+}
+
+func isBareKeyRune(r rune) bool {
+    return r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+func (p *tomlParser) parseValue() (any, error) {
+    if p.eof() {
+        return nil, p.errf("missing value")
+    }
+    switch r := p.peek(); {
+    case r == '"':
+        if p.hasPrefix(`"""`) {
+            return p.parseMultilineBasic()
+        }
+        return p.parseBasicString()
+    case r == '\'':
+        if p.hasPrefix(`'''`) {
+            return p.parseMultilineLiteral()
+        }
+        return p.parseLiteralString()
+    case r == '[':
+        return p.parseArray()
+    case r == '{':
+        return p.parseInlineTable()
+    case p.hasPrefix("true"):
+        p.pos += 4
+        return true, nil
+    case p.hasPrefix("false"):
+        p.pos += 5
+        return false, nil
+    default:
+        return p.parseScalar()
+    }
+}
+
+func (p *tomlParser) hasPrefix(s string) bool {
+    rs := []rune(s)
+    if p.pos+len(rs) > len(p.src) {
+        return false
+    }
+    for i, r := range rs {
+        if p.src[p.pos+i] != r {
+            return false
+        }
+    }
+    return true
+}
+
+// parseScalar parses numbers and date-times.
+func (p *tomlParser) parseScalar() (any, error) {
+    start := p.pos
+    for !p.eof() {
+        r := p.peek()
+        if r == ',' || r == ']' || r == '}' || r == '#' || r == '\n' || r == '\r' {
+            break
+        }
+        // A single space may separate date and time in date-times.
+        if (r == ' ' || r == '\t') && !(p.pos-start == 10 && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9') {
+            break
+        }
+        p.pos++
+    }
+    tok := string(p.src[start:p.pos])
+    if tok == "" {
+        return nil, p.errf("missing value")
+    }
+    switch tok {
+    case "inf", "+inf":
+        return math.Inf(1), nil
+    case "-inf":
+        return math.Inf(-1), nil
+    case "nan", "+nan", "-nan":
+        return math.NaN(), nil
+    }
+    clean := strings.ReplaceAll(tok, "_", "")
+    if strings.HasPrefix(clean, "0x") || strings.HasPrefix(clean, "0o") || strings.HasPrefix(clean, "0b") {
+        base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[clean[1]]
+        n, err := strconv.ParseInt(clean[2:], base, 64)
+        if err != nil {
+            return nil, p.errf("invalid integer %q", tok)
+        }
+        return n, nil
+    }
+    if n, err := strconv.ParseInt(clean, 10, 64); err == nil {
+        return n, nil
+    }
+    if strings.ContainsAny(clean, ".eE") {
+        if f, err := strconv.ParseFloat(clean, 64); err == nil {
+            return f, nil
+        }
+    }
+    // Date, time and date-time values are kept verbatim.
+    if len(tok) >= 8 && (tok[4] == '-' || tok[2] == ':') {
+        return tok, nil
+    }
+    return nil, p.errf("invalid value %q", tok)
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+    p.pos++ // opening quote
+    var b strings.Builder
+    for {
+        if p.eof() || p.peek() == '\n' {
+            return "", p.errf("unterminated string")
+        }
+        r := p.next()
+        switch r {
+        case '"':
+            return b.String(), nil
+        case '\\':
+            if err := p.parseEscape(&b); err != nil {
+                return "", err
+            }
+        default:
+            b.WriteRune(r)
+        }
+    }
+}
+
+func (p *tomlParser) parseEscape(b *strings.Builder) error {
+    if p.eof() {
+        return p.errf("unterminated escape")
+    }
+    r := p.next()
+    switch r {
+    case 'b':
+        b.WriteRune('\b')
+    case 't':
+        b.WriteRune('\t')
+    case 'n':
+        b.WriteRune('\n')
+    case 'f':
+        b.WriteRune('\f')
+    case 'r':
+        b.WriteRune('\r')
+    case 'e':
+        b.WriteRune(0x1b)
+    case '"':
+        b.WriteRune('"')
+    case '\\':
+        b.WriteRune('\\')
+    case 'u', 'U':
+        n := 4
+        if r == 'U' {
+            n = 8
+        }
+        if p.pos+n > len(p.src) {
+            return p.errf("short unicode escape")
+        }
+        code, err := strconv.ParseUint(string(p.src[p.pos:p.pos+n]), 16, 32)
+        if err != nil || !utf8.ValidRune(rune(code)) {
+            return p.errf("invalid unicode escape")
+        }
+        p.pos += n
+        b.WriteRune(rune(code))
+    default:
+        return p.errf("invalid escape \\%c", r)
+    }
+    return nil
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+    p.pos++
+    start := p.pos
+    for {
+        if p.eof() || p.peek() == '\n' {
+            return "", p.errf("unterminated string")
+        }
+        if p.peek() == '\'' {
+            s := string(p.src[start:p.pos])
+            p.pos++
+            return s, nil
+        }
+        p.pos++
+    }
+}
+
+// trimLeadingNewline drops a newline immediately after an opening delimiter.
+func (p *tomlParser) trimLeadingNewline() {
+    if p.hasPrefix("\r\n") {
+        p.pos++
+    }
+    if p.peek() == '\n' {
+        p.next()
+    }
+}
+
+func (p *tomlParser) parseMultilineBasic() (string, error) {
+    p.pos += 3
+    p.trimLeadingNewline()
+    var b strings.Builder
+    for {
+        if p.eof() {
+            return "", p.errf("unterminated multi-line string")
+        }
+        if p.hasPrefix(`"""`) {
+            p.pos += 3
+            // Up to two extra quotes belong to the content.
+            for i := 0; i < 2 && p.peek() == '"'; i++ {
+                b.WriteRune('"')
+                p.pos++
+            }
+            return b.String(), nil
+        }
+        r := p.next()
+        if r != '\\' {
+            b.WriteRune(r)
+            continue
+        }
+        // Line-ending backslash trims following whitespace and newlines.
+        save, saveLine := p.pos, p.line
+        p.skipSpace()
+        if p.peek() == '\r' || p.peek() == '\n' {
+            for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r' || p.peek() == '\n') {
+                p.next()
+            }
+            continue
+        }
+        p.pos, p.line = save, saveLine
+        if err := p.parseEscape(&b); err != nil {
+            return "", err
+        }
+    }
+}
+
+func (p *tomlParser) parseMultilineLiteral() (string, error) {
+    p.pos += 3
+    p.trimLeadingNewline()
+    var b strings.Builder
+    for {
+        if p.eof() {
+            return "", p.errf("unterminated multi-line string")
+        }
+        if p.hasPrefix(`'''`) {
+            p.pos += 3
+            for i := 0; i < 2 && p.peek() == '\''; i++ {
+                b.WriteRune('\'')
+                p.pos++
+            }
+            return b.String(), nil
+        }
+        b.WriteRune(p.next())
+    }
+}
+
+func (p *tomlParser) parseArray() ([]any, error) {
+    p.pos++ // '['
+    out := []any{}
+    for {
+        p.skipBlank()
+        if p.eof() {
+            return nil, p.errf("unterminated array")
+        }
+        if p.peek() == ']' {
+            p.pos++
+            return out, nil
+        }
+        v, err := p.parseValue()
+        if err != nil {
+            return nil, err
+        }
+        out = append(out, v)
+        p.skipBlank()
+        switch {
+        case p.peek() == ',':
+            p.pos++
+        case p.peek() == ']':
+        default:
+            return nil, p.errf("expected ',' or ']' in array")
+        }
+    }
+}
+
+func (p *tomlParser) parseInlineTable() (map[string]any, error) {
+    p.pos++ // '{'
+    t := map[string]any{}
+    p.skipSpace()
+    if p.peek() == '}' {
+        p.pos++
+        return t, nil
+    }
+    // Inline tables record no positions of their own: their keys are
+    // reported at the line of the enclosing key.
+    saved := p.doc.Lines
+    p.doc.Lines = map[string]int{}
+    defer func() { p.doc.Lines = saved }()
+    for {
+        p.skipSpace()
+        if err := p.parseKeyValue(t, nil); err != nil {
+            return nil, err
+        }
+        p.skipSpace()
+        if p.eof() {
+            return nil, p.errf("unterminated inline table")
+        }
+        switch p.next() {
+        case ',':
+            continue
+        case '}':
+            return t, nil
+        default:
+            return nil, p.errf("expected ',' or '}' in inline table")
+        }
+    }
+}
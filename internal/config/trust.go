@@ -0,0 +1,66 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+)
+
+// Trust levels of a [projects."<path>"] table.
+const (
+    TrustTrusted   = "trusted"
+    TrustUntrusted = "untrusted"
+)
+
+// ProjectConfig is a [projects."<path>"] table, keyed by the absolute path
+// of a project root (see ProjectRoot).
+type ProjectConfig struct {
+    // TrustLevel is TrustTrusted or TrustUntrusted; empty means the user
+    // has not decided.
+    TrustLevel string `toml:"trust_level"`
+}
+
+// ProjectRoot returns the project dir belongs to: the root of the git
+// repository containing it, or dir itself outside a repository. The path
+// is absolute and clean.
+func ProjectRoot(dir string) string {
+    dir, err := filepath.Abs(dir)
+    if err != nil {
+        return filepath.Clean(dir)
+    }
+    for d := dir; ; {
+        if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+            return d
+        }
+        parent := filepath.Dir(d)
+        if parent == d {
+            return dir
+        }
+        d = parent
+    }
+}
+
+// ProjectTrust returns the trust level recorded for dir: that of the
+// nearest [projects] entry for dir or one of its parents, so trusting a
+// directory trusts everything below it. It is "" when there is none.
+func (c *Config) ProjectTrust(dir string) string {
+    dir, err := filepath.Abs(dir)
+    if err != nil {
+        return ""
+    }
+    for d := dir; ; {
+        if p, ok := c.Projects[d]; ok && p.TrustLevel != "" {
+            return p.TrustLevel
+        }
+        parent := filepath.Dir(d)
+        if parent == d {
+            return ""
+        }
+        d = parent
+    }
+}
+
+// SetProjectTrust records the trust level of the project root in the
+// config file at path.
+func SetProjectTrust(path, root, level string) error {
+    return SetValue(path, JoinKey([]string{"projects", root, "trust_level"}), level)
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+    "context"
+    "os"
+    "time"
+)
+
+// Watch polls the files of the effective config selected by opts (the user
+// config and the project config, including one created later) every
+// interval until ctx ends. Each time one of them changes it reloads the
+// config and calls onChange with the result; err is set when the edited
+// files do not load, and the caller should keep its previous settings.
+func Watch(ctx context.Context, opts LoadOptions, interval time.Duration, onChange func(cfg *EffectiveConfig, err error)) {
+    last := watchedFiles(opts)
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        cur := watchedFiles(opts)
+        if sameStamps(last, cur) {
+            continue
+        }
+        last = cur
+        onChange(LoadEffective(opts))
+    }
+}
+
+// fileStamp identifies a version of a file; a missing file has the zero
+// stamp.
+type fileStamp struct {
+    modTime time.Time
+    size    int64
+}
+
+// watchedFiles stamps the config files opts reads, by path.
+func watchedFiles(opts LoadOptions) map[string]fileStamp {
+    var paths []string
+    if p, err := DefaultPath(); err == nil {
+        paths = append(paths, p)
+    }
+    if opts.Cwd != "" {
+        if p := FindProjectConfig(opts.Cwd); p != "" {
+            paths = append(paths, p)
+        }
+    }
+    stamps := map[string]fileStamp{}
+    for _, p := range paths {
+        var st fileStamp
+        if fi, err := os.Stat(p); err == nil {
+            st = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+        }
+        stamps[p] = st
+    }
+    return stamps
+}
+
+func sameStamps(a, b map[string]fileStamp) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for p, st := range a {
+        if b[p] != st {
+            return false
+        }
+    }
+    return true
+}
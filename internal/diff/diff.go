@@ -0,0 +1,196 @@
+// Package diff computes line-based unified diffs (Myers' algorithm).
+package diff
+
+import (
+    "fmt"
+    "strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change.
+const DefaultContext = 3
+
+// op is one step of an edit script.
+type op struct {
+    kind byte // ' ', '-', '+'
+    line string
+}
+
+// Unified returns a unified diff turning a into b, with the given header
+// names ("a/path", "/dev/null", ...). It returns "" when a == b.
+func Unified(fromName, toName, a, b string, context int) string {
+    if a == b {
+        return ""
+    }
+    ops := lineOps(splitLines(a), splitLines(b))
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+    for _, h := range hunks(ops, context) {
+        sb.WriteString(h)
+    }
+    return sb.String()
+}
+
+// splitLines splits s into lines keeping their terminators, so a missing
+// final newline survives the round trip.
+func splitLines(s string) []string {
+    if s == "" {
+        return nil
+    }
+    lines := strings.SplitAfter(s, "\n")
+    if lines[len(lines)-1] == "" {
+        lines = lines[:len(lines)-1]
+    }
+    return lines
+}
+
+// lineOps computes a shortest edit script with Myers' O(ND) algorithm.
+func lineOps(a, b []string) []op {
+    n, m := len(a), len(b)
+    max := n + m
+    offset := max + 1
+    v := make([]int, 2*max+2)
+    var trace [][]int
+    for d := 0; d <= max; d++ {
+        snapshot := make([]int, len(v))
+        copy(snapshot, v)
+        trace = append(trace, snapshot)
+        for k := -d; k <= d; k += 2 {
+            var x int
+            if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+                x = v[offset+k+1]
+            } else {
+                x = v[offset+k-1] + 1
+            }
+            y := x - k
+            for x < n && y < m && a[x] == b[y] {
+                x++
+                y++
+            }
+            v[offset+k] = x
+            if x >= n && y >= m {
+                return backtrack(trace, a, b, offset, d)
+            }
+        }
+    }
+    return nil
+}
+
+// backtrack walks the saved V arrays from (n, m) back to the origin.
+func backtrack(trace [][]int, a, b []string, offset, d int) []op {
+    x, y := len(a), len(b)
+    var rev []op
+    for ; d > 0; d-- {
+        v := trace[d]
+        k := x - y
+        var prevK int
+        if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+            prevK = k + 1
+        } else {
+            prevK = k - 1
+        }
+        prevX := v[offset+prevK]
+        prevY := prevX - prevK
+        for x > prevX && y > prevY {
+            x--
+            y--
+            rev = append(rev, op{' ', a[x]})
+        }
+        if x == prevX {
+            y--
+            rev = append(rev, op{'+', b[y]})
+        } else {
+            x--
+            rev = append(rev, op{'-', a[x]})
+        }
+    }
+    for x > 0 && y > 0 {
+        x--
+        y--
+        rev = append(rev, op{' ', a[x]})
+    }
+    out := make([]op, len(rev))
+    for i := range rev {
+        out[i] = rev[len(rev)-1-i]
+    }
+    return out
+}
+
+// hunks groups ops into "@@" hunks with context lines around changes.
+func hunks(ops []op, context int) []string {
+    var out []string
+    i := 0
+    aLine, bLine := 1, 1
+    for i < len(ops) {
+        // Skip to the next change.
+        for i < len(ops) && ops[i].kind == ' ' {
+            i++
+            aLine++
+            bLine++
+        }
+        if i == len(ops) {
+            break
+        }
+        start := i - context
+        if start < 0 {
+            start = 0
+        }
+        // Extend the hunk while changes are within 2*context of each other.
+        end := i
+        for end < len(ops) {
+            if ops[end].kind != ' ' {
+                end++
+                continue
+            }
+            run := end
+            for run < len(ops) && ops[run].kind == ' ' {
+                run++
+            }
+            if run == len(ops) || run-end > 2*context {
+                end += min(context, run-end)
+                break
+            }
+            end = run
+        }
+
+        aStart, bStart := aLine-(i-start), bLine-(i-start)
+        var body strings.Builder
+        aCount, bCount := 0, 0
+        for _, o := range ops[start:end] {
+            body.WriteByte(o.kind)
+            body.WriteString(o.line)
+            if !strings.HasSuffix(o.line, "\n") {
+                body.WriteString("\n\\ No newline at end of file\n")
+            }
+            if o.kind != '+' {
+                aCount++
+            }
+            if o.kind != '-' {
+                bCount++
+            }
+        }
+        out = append(out, fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))+body.String())
+
+        for _, o := range ops[i:end] {
+            if o.kind != '+' {
+                aLine++
+            }
+            if o.kind != '-' {
+                bLine++
+            }
+        }
+        i = end
+    }
+    return out
+}
+
+// hunkRange formats "start,count" the way diff(1) does: an empty range
+// refers to the line before it.
+func hunkRange(start, count int) string {
+    if count == 0 {
+        start--
+    }
+    if count == 1 {
+        return fmt.Sprintf("%d", start)
+    }
+    return fmt.Sprintf("%d,%d", start, count)
+}
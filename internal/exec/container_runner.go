@@ -0,0 +1,295 @@
+package exec
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"codex-go/internal/protocol"
+)
+
+// ContainerRunner is a Runner that runs each command in a fresh container
+// of Image, through the docker or podman command line: isolation that does
+// not depend on what the host can sandbox. The workspace is mounted at the
+// same path inside, so Cwd and paths in arguments mean the same there.
+//
+// Options apply to the container:
+//   - Cwd is the working directory inside it;
+//   - Env, filtered by EnvPolicy, is passed to it; the rest of its
+//     environment is the image's, not ours;
+//   - MaxCPUTime and MaxOpenFiles are ulimits, MaxMemoryBytes the cgroup
+//     memory limit and MaxProcesses the pids limit;
+//   - under a read-only Sandbox, the workspace and the container's own
+//     filesystem are read-only; under workspace-write, WritableRoots are
+//     mounted too, with their top-level dotfiles read-only unless
+//     WriteDotfiles; without NetworkAccess, or with NetworkDisabled, the
+//     container has no network.
+//
+// EventStart reports the engine's client process, which relays the
+// command's output and exit status; a command killed by a signal exits
+// with 128 plus its number.
+type ContainerRunner struct {
+	// Image is the image commands run in, such as "golang:1.22".
+	Image string
+	// Engine is the container command line, "docker" or "podman", or a
+	// path to one. Empty means the first of them found in PATH.
+	Engine string
+	// Workspace is the directory mounted into the container. Empty means
+	// Options.Cwd, or our working directory.
+	Workspace string
+	// Args are more options to the engine's run command, such as
+	// ["--user", "1000"].
+	Args []string
+
+	local LocalRunner
+}
+
+// NewContainerRunner constructs a ContainerRunner running commands in image.
+func NewContainerRunner(image string) *ContainerRunner { return &ContainerRunner{Image: image} }
+
+// ErrNoContainerEngine is returned by ContainerRunner.Start when neither
+// docker nor podman is installed.
+var ErrNoContainerEngine = errors.New("exec: no container engine (docker or podman) found")
+
+// Start runs argv in a new container and returns its event stream and a
+// cancel func, as LocalRunner.Start does.
+func (r *ContainerRunner) Start(ctx context.Context, argv []string, opt Options) (<-chan Event, func() error, error) {
+	events, _, cancel, err := r.start(ctx, argv, opt, false)
+	return events, cancel, err
+}
+
+// Run is Start, collecting the output and exit status of the command once
+// it finished (see Runner).
+func (r *ContainerRunner) Run(ctx context.Context, argv []string, opt Options) (ExecResult, error) {
+	return run(ctx, r, argv, opt)
+}
+
+// StartInput is Start, also returning the command's stdin (see
+// InputRunner).
+func (r *ContainerRunner) StartInput(ctx context.Context, argv []string, opt Options) (<-chan Event, io.WriteCloser, func() error, error) {
+	if opt.Stdin != nil {
+		return nil, nil, nil, errors.New("exec: Options.Stdin is set; StartInput returns the process's stdin instead")
+	}
+	return r.start(ctx, argv, opt, true)
+}
+
+// start implements Start, and StartInput when input is true.
+func (r *ContainerRunner) start(ctx context.Context, argv []string, opt Options, input bool) (<-chan Event, io.WriteCloser, func() error, error) {
+	if len(argv) == 0 {
+		return r.local.start(ctx, argv, opt, input)
+	}
+	engine, err := r.engine()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	name, err := containerName()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cargv, local, err := r.command(engine, name, argv, opt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	events, stdin, cancel, err := r.local.start(ctx, cargv, local, input)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !input {
+		stdin = nil
+	}
+
+	confined := confines(opt.Sandbox)
+	noNetwork := opt.NetworkDisabled || confined && !opt.Sandbox.NetworkAccess
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		// seen ends with the output last scanned for network and sandbox
+		// errors, as LocalRunner does.
+		var seen []byte
+		var networkFailed, sandboxFailed bool
+		for ev := range events {
+			switch ev.Type {
+			case EventStdout, EventStderr, EventPty:
+				if noNetwork || confined {
+					seen = append(seen, ev.Data...)
+					networkFailed = networkFailed || noNetwork && looksNetworkBlocked(seen)
+					sandboxFailed = sandboxFailed || confined && looksSandboxDenied(seen)
+					if len(seen) > errorWindow {
+						seen = append(seen[:0], seen[len(seen)-errorWindow:]...)
+					}
+				}
+			case EventExit:
+				if ev.Stopped {
+					// The client can exit before the container does,
+					// which would then run on.
+					removeContainer(engine, name)
+				}
+				ev.LimitExceeded = containerLimitExceeded(opt, ev.Code)
+				ev.NetworkBlocked = networkFailed && ev.Code != 0
+				ev.SandboxDenied = sandboxFailed && ev.Code != 0
+			}
+			out <- ev
+		}
+	}()
+	return out, stdin, cancel, nil
+}
+
+// engine returns the path of the container command line to use.
+func (r *ContainerRunner) engine() (string, error) {
+	if r.Engine != "" {
+		return osexec.LookPath(r.Engine)
+	}
+	for _, name := range []string{"docker", "podman"} {
+		if path, err := osexec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", ErrNoContainerEngine
+}
+
+// command returns the engine command line running argv in a container
+// named name under opt, and the options to run it with on the host.
+func (r *ContainerRunner) command(engine, name string, argv []string, opt Options) ([]string, Options, error) {
+	if r.Image == "" {
+		return nil, Options{}, errors.New("exec: ContainerRunner.Image is not set")
+	}
+	if opt.RestrictedToken {
+		return nil, Options{}, ErrRestrictedTokenUnsupported
+	}
+	workspace := r.Workspace
+	if workspace == "" {
+		workspace = opt.Cwd
+	}
+	workspace, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, Options{}, err
+	}
+	cwd := workspace
+	if opt.Cwd != "" {
+		if cwd, err = filepath.Abs(opt.Cwd); err != nil {
+			return nil, Options{}, err
+		}
+	}
+
+	args := []string{engine, "run", "--rm", "-i", "--init", "--name", name, "-w", cwd}
+	if opt.Pty {
+		args = append(args, "-t")
+	}
+	confined := confines(opt.Sandbox)
+	readOnly := confined && opt.Sandbox.Mode != protocol.SandboxWorkspaceWrite
+	volume := func(path string, ro bool) {
+		v := path + ":" + path
+		if ro {
+			v += ":ro"
+		}
+		args = append(args, "-v", v)
+	}
+	volume(workspace, readOnly)
+	if readOnly {
+		args = append(args, "--read-only")
+	} else if confined {
+		mounted := map[string]bool{workspace: true}
+		roots := []string{workspace}
+		for _, root := range opt.Sandbox.Roots(cwd) {
+			if !mounted[root] {
+				mounted[root] = true
+				roots = append(roots, root)
+				volume(root, false)
+			}
+		}
+		if !opt.Sandbox.WriteDotfiles {
+			for _, root := range roots {
+				for _, p := range dotfiles(root) {
+					volume(p, true)
+				}
+			}
+		}
+	}
+	if opt.NetworkDisabled || confined && !opt.Sandbox.NetworkAccess {
+		args = append(args, "--network", "none")
+	}
+	if opt.MaxCPUTime > 0 {
+		secs := int64((opt.MaxCPUTime + time.Second - 1) / time.Second)
+		args = append(args, "--ulimit", fmt.Sprintf("cpu=%d:%d", secs, secs+1))
+	}
+	if opt.MaxMemoryBytes > 0 {
+		args = append(args, "--memory", fmt.Sprint(opt.MaxMemoryBytes))
+	}
+	if opt.MaxOpenFiles > 0 {
+		args = append(args, "--ulimit", fmt.Sprintf("nofile=%d:%d", opt.MaxOpenFiles, opt.MaxOpenFiles))
+	}
+	if opt.MaxProcesses > 0 {
+		args = append(args, "--pids-limit", fmt.Sprint(opt.MaxProcesses))
+	}
+
+	// Variables are named on the command line and take their values from
+	// the client's environment, which keeps them out of ps.
+	var env []string
+	if len(opt.Env) > 0 || opt.EnvPolicy != nil {
+		env = opt.Env
+		if opt.EnvPolicy != nil {
+			env = opt.EnvPolicy.Environ(opt.Env)
+		}
+	}
+	for _, kv := range env {
+		if k, _, ok := strings.Cut(kv, "="); ok && k != "" {
+			args = append(args, "-e", k)
+		}
+	}
+	args = append(args, r.Args...)
+	args = append(args, r.Image)
+	args = append(args, argv...)
+
+	local := Options{
+		Env:            append(os.Environ(), env...),
+		TimeoutSec:     opt.TimeoutSec,
+		StopSignal:     opt.StopSignal,
+		KillGrace:      opt.KillGrace,
+		Pty:            opt.Pty,
+		Rows:           opt.Rows,
+		Cols:           opt.Cols,
+		Binary:         opt.Binary,
+		Stdin:          opt.Stdin,
+		MaxOutputBytes: opt.MaxOutputBytes,
+		MaxOutputLines: opt.MaxOutputLines,
+	}
+	return args, local, nil
+}
+
+// containerName returns a new name for a container, to remove it by.
+func containerName() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "codex-exec-" + hex.EncodeToString(b[:]), nil
+}
+
+// removeContainer removes the container name, if it still exists.
+func removeContainer(engine, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = osexec.CommandContext(ctx, engine, "rm", "-f", name).Run()
+}
+
+// containerLimitExceeded names the resource limit that ended a container
+// exiting with code, as far as the exit status tells: SIGXCPU for the CPU
+// time, SIGKILL (from the OOM killer) under a memory limit.
+func containerLimitExceeded(opt Options, code int) Limit {
+	const sigkill, sigxcpu = 9, 24
+	switch {
+	case opt.MaxCPUTime > 0 && code == 128+sigxcpu:
+		return LimitCPU
+	case opt.MaxMemoryBytes > 0 && code == 128+sigkill:
+		return LimitMemory
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package exec
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Inherit values of EnvPolicy: the variables a command starts from.
+const (
+	InheritAll  = "all"  // the whole base environment
+	InheritCore = "core" // only CoreEnvVars
+	InheritNone = "none" // nothing; only EnvPolicy.Set
+)
+
+// CoreEnvVars are the variables kept by InheritCore: enough for shells and
+// common tools to find programs, the home and temporary directories.
+var CoreEnvVars = []string{"HOME", "LOGNAME", "PATH", "SHELL", "USER", "USERNAME", "TMPDIR", "TEMP", "TMP"}
+
+// DefaultEnvExcludes drop variables likely to hold credentials (e.g.
+// AWS_SECRET_ACCESS_KEY, GITHUB_TOKEN) unless IgnoreDefaultExcludes is set.
+var DefaultEnvExcludes = []string{"*KEY*", "*SECRET*", "*TOKEN*"}
+
+// EnvPolicy decides which environment variables a command sees. It is
+// applied in order: Inherit, the default excludes, Exclude, Set, and
+// IncludeOnly. Patterns are path.Match globs over variable names, matched
+// case-insensitively. The zero value inherits everything but the default
+// excludes.
+type EnvPolicy struct {
+	// Inherit is InheritAll, InheritCore or InheritNone. Empty means
+	// InheritAll.
+	Inherit string
+	// IgnoreDefaultExcludes keeps the variables DefaultEnvExcludes drop.
+	IgnoreDefaultExcludes bool
+	// Exclude drops matching variables.
+	Exclude []string
+	// Set adds or replaces variables.
+	Set map[string]string
+	// IncludeOnly, when not empty, drops every variable matching none of
+	// its patterns.
+	IncludeOnly []string
+}
+
+// Validate checks Inherit and the patterns.
+func (p EnvPolicy) Validate() error {
+	switch p.Inherit {
+	case "", InheritAll, InheritCore, InheritNone:
+	default:
+		return fmt.Errorf("inherit: unknown value %q", p.Inherit)
+	}
+	for name, pats := range map[string][]string{"exclude": p.Exclude, "include_only": p.IncludeOnly} {
+		for _, pat := range pats {
+			if _, err := path.Match(pat, ""); err != nil {
+				return fmt.Errorf("%s: bad pattern %q", name, pat)
+			}
+		}
+	}
+	return nil
+}
+
+// Environ applies the policy to base, a list of KEY=VALUE entries such as
+// os.Environ(), and returns the resulting environment sorted by name.
+func (p EnvPolicy) Environ(base []string) []string {
+	vars := map[string]string{}
+	for _, kv := range base {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			continue
+		}
+		switch p.Inherit {
+		case InheritNone:
+			continue
+		case InheritCore:
+			if !matchAny(CoreEnvVars, k) {
+				continue
+			}
+		}
+		vars[k] = v
+	}
+	for k := range vars {
+		if !p.IgnoreDefaultExcludes && matchAny(DefaultEnvExcludes, k) || matchAny(p.Exclude, k) {
+			delete(vars, k)
+		}
+	}
+	for k, v := range p.Set {
+		vars[k] = v
+	}
+	if len(p.IncludeOnly) > 0 {
+		for k := range vars {
+			if !matchAny(p.IncludeOnly, k) {
+				delete(vars, k)
+			}
+		}
+	}
+	out := make([]string, 0, len(vars))
+	for k, v := range vars {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// matchAny reports whether name matches one of patterns, ignoring case.
+func matchAny(patterns []string, name string) bool {
+	name = strings.ToUpper(name)
+	for _, pat := range patterns {
+		if ok, _ := path.Match(strings.ToUpper(pat), name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package exec
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// outputLimit enforces Options.MaxOutputBytes and MaxOutputLines on one
+// output stream. The first half of the budget (the head) is passed
+// through as it arrives; past it, only the last half (the tail) is kept,
+// and sent after an elision marker once the stream ends. Memory stays
+// bounded however much the process writes.
+type outputLimit struct {
+	headBytes, headLines int // head budget left; < 0 means unlimited
+	tailBytes, tailLines int // tail size; 0 means unlimited
+	text                 bool
+	inTail               bool
+	tail                 []byte
+	omitted              int  // bytes dropped from the tail
+	midLine              bool // the head ends inside a line
+}
+
+// newOutputLimit returns the limit opt sets on a stream, or nil.
+func newOutputLimit(opt Options) *outputLimit {
+	if opt.MaxOutputBytes <= 0 && opt.MaxOutputLines <= 0 {
+		return nil
+	}
+	l := &outputLimit{headBytes: -1, headLines: -1, text: !opt.Binary}
+	if n := opt.MaxOutputBytes; n > 0 {
+		l.headBytes, l.tailBytes = n/2, n-n/2
+	}
+	if n := opt.MaxOutputLines; n > 0 {
+		l.headLines, l.tailLines = n/2, n-n/2
+	}
+	return l
+}
+
+// write takes the next chunk of output and returns what of it to send now.
+func (l *outputLimit) write(p []byte) []byte {
+	if l.inTail {
+		l.keep(p)
+		return nil
+	}
+	cut := len(p)
+	if l.headBytes >= 0 && cut > l.headBytes {
+		cut = l.headBytes
+		for l.text && cut > 0 && !utf8.RuneStart(p[cut]) {
+			cut--
+		}
+	}
+	if l.headLines >= 0 {
+		lines := 0
+		for i, c := range p[:cut] {
+			if c == '\n' {
+				lines++
+				if lines == l.headLines {
+					cut = i + 1
+					break
+				}
+			}
+		}
+		if l.headLines == 0 {
+			cut = 0
+		}
+	}
+	head := p[:cut]
+	if len(head) > 0 {
+		l.midLine = head[len(head)-1] != '\n'
+	}
+	if l.headBytes >= 0 {
+		l.headBytes -= len(head)
+	}
+	if l.headLines >= 0 {
+		l.headLines -= bytes.Count(head, []byte("\n"))
+	}
+	if cut < len(p) {
+		l.inTail = true
+		l.keep(p[cut:])
+	}
+	return head
+}
+
+// keep appends p to the tail and drops what falls out of it.
+func (l *outputLimit) keep(p []byte) {
+	l.tail = append(l.tail, p...)
+	start := 0
+	if l.tailBytes > 0 && len(l.tail) > l.tailBytes {
+		start = len(l.tail) - l.tailBytes
+		for l.text && start < len(l.tail) && !utf8.RuneStart(l.tail[start]) {
+			start++
+		}
+	}
+	if l.tailLines > 0 {
+		if s := lastLines(l.tail, l.tailLines); s > start {
+			start = s
+		}
+	}
+	if start > 0 {
+		l.omitted += start
+		l.tail = append(l.tail[:0], l.tail[start:]...)
+	}
+}
+
+// finish returns what is left to send once the stream ended: the tail,
+// after an elision marker if output was dropped.
+func (l *outputLimit) finish() []byte {
+	if l.omitted == 0 {
+		return l.tail
+	}
+	marker := fmt.Sprintf("[... %d bytes omitted]\n", l.omitted)
+	if l.midLine {
+		marker = "\n" + marker
+	}
+	return append([]byte(marker), l.tail...)
+}
+
+// truncated reports whether output was dropped.
+func (l *outputLimit) truncated() bool { return l.omitted > 0 }
+
+// lastLines returns where the last n lines of b start; a final newline
+// does not start another line.
+func lastLines(b []byte, n int) int {
+	end := len(b)
+	if end > 0 && b[end-1] == '\n' {
+		end--
+	}
+	for i := end - 1; i >= 0; i-- {
+		if b[i] == '\n' {
+			n--
+			if n == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
@@ -3,9 +3,17 @@ package exec
 import (
     "bufio"
     "context"
+    "errors"
     "io"
+    "os"
     osexec "os/exec"
+    "path/filepath"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "syscall"
     "time"
+    "unicode/utf8"
 )
 
 // LocalRunner is a minimal Runner implementation backed by the standard
@@ -19,22 +27,62 @@ func NewLocalRunner() *LocalRunner { return &LocalRunner{} }
 // Start launches the process and returns an event stream and a cancel func.
 //
 // Behavior:
-// - Spawns argv[0] with argv[1..] and the provided Cwd/Env.
-// - Emits EventStdout/EventStderr with textual chunks (not necessarily lines).
-// - Emits EventExit with the exit code when the process finishes.
-// - cancel() attempts to terminate the process early.
+// - Spawns argv[0] with argv[1..] and the provided Cwd/Env, filtered by
+//   EnvPolicy when set.
+// - Emits EventStart with the PID and executable path once the process
+//   is running.
+// - Emits EventStdout/EventStderr with chunks of output (not necessarily
+//   lines, but whole runes unless Options.Binary), or EventPty with
+//   Options.Pty, within Options.MaxOutputBytes/MaxOutputLines.
+// - Emits EventExit with the exit code (or signal), run time and how it
+//   was stopped, if it was, when the process finishes.
+// - cancel(), the context or the timeout stops the process early: it is
+//   sent Options.StopSignal, then killed if it is still running after
+//   Options.KillGrace.
 func (r *LocalRunner) Start(parent context.Context, argv []string, opt Options) (<-chan Event, func() error, error) {
+    events, _, cancel, err := r.start(parent, argv, opt, false)
+    return events, cancel, err
+}
+
+// Run is Start, collecting the output and exit status of the command once
+// it finished (see Runner).
+func (r *LocalRunner) Run(ctx context.Context, argv []string, opt Options) (ExecResult, error) {
+    return run(ctx, r, argv, opt)
+}
+
+// StartInput is Start, also returning the process's stdin, which stays
+// open for writing until closed (see InputRunner).
+func (r *LocalRunner) StartInput(parent context.Context, argv []string, opt Options) (<-chan Event, io.WriteCloser, func() error, error) {
+    if opt.Stdin != nil {
+        return nil, nil, nil, errors.New("exec: Options.Stdin is set; StartInput returns the process's stdin instead")
+    }
+    return r.start(parent, argv, opt, true)
+}
+
+// start implements Start, and StartInput when input is true.
+func (r *LocalRunner) start(parent context.Context, argv []string, opt Options, input bool) (<-chan Event, io.WriteCloser, func() error, error) {
     if len(argv) == 0 {
         ch := make(chan Event)
         close(ch)
-        return ch, func() error { return nil }, nil
+        return ch, nopWriteCloser{io.Discard}, func() error { return nil }, nil
     }
 
-    // Honor timeout if provided.
-    ctx := parent
-    var cancelTimeout context.CancelFunc
+    if opt.hasLimits() {
+        if err := checkLimits(opt); err != nil {
+            return nil, nil, nil, err
+        }
+    }
+
+    // Honor timeout if provided; cancel() cancels ctx too.
+    ctx, cancelCtx := context.WithCancel(parent)
     if opt.TimeoutSec > 0 {
-        ctx, cancelTimeout = context.WithTimeout(parent, time.Duration(opt.TimeoutSec)*time.Second)
+        var cancelTimeout context.CancelFunc
+        ctx, cancelTimeout = context.WithTimeout(ctx, time.Duration(opt.TimeoutSec)*time.Second)
+        cancelParent := cancelCtx
+        cancelCtx = func() {
+            cancelTimeout()
+            cancelParent()
+        }
     }
 
     cmd := osexec.CommandContext(ctx, argv[0], argv[1:]...)
@@ -44,87 +92,426 @@ func (r *LocalRunner) Start(parent context.Context, argv []string, opt Options)
     if len(opt.Env) > 0 {
         cmd.Env = opt.Env
     }
+    if opt.EnvPolicy != nil {
+        base := opt.Env
+        if len(base) == 0 {
+            base = os.Environ()
+        }
+        cmd.Env = opt.EnvPolicy.Environ(base)
+    }
 
-    stdout, err := cmd.StdoutPipe()
-    if err != nil {
-        if cancelTimeout != nil {
-            cancelTimeout()
+    // Resolved before wrapSandbox and gateLimits run the command through
+    // other programs.
+    path := absPath(cmd)
+    // Without network, a network namespace is all it takes where there is
+    // one; failing that, the sandbox takes the network away.
+    sandboxed := confines(opt.Sandbox)
+    noNetwork := opt.NetworkDisabled || sandboxed && !opt.Sandbox.NetworkAccess
+    netCut := noNetwork && cmd.Err == nil && isolateNetwork(cmd)
+    if sandboxed && cmd.Err == nil {
+        policy := *opt.Sandbox
+        policy.NetworkAccess = !noNetwork || netCut
+        if err := wrapSandbox(cmd, &policy); err != nil {
+            cancelCtx()
+            return nil, nil, nil, err
+        }
+    } else if noNetwork && !netCut && cmd.Err == nil {
+        if err := disableNetwork(cmd); err != nil {
+            cancelCtx()
+            return nil, nil, nil, err
         }
-        return nil, nil, err
     }
-    stderr, err := cmd.StderrPipe()
-    if err != nil {
-        if cancelTimeout != nil {
-            cancelTimeout()
+    var gateR, gateW *os.File
+    if opt.hasLimits() && cmd.Err == nil {
+        var err error
+        if gateR, gateW, err = gateLimits(cmd); err != nil {
+            cancelCtx()
+            return nil, nil, nil, err
         }
-        return nil, nil, err
     }
 
-    if err := cmd.Start(); err != nil {
-        if cancelTimeout != nil {
-            cancelTimeout()
+    // The command runs in a process group of its own (a Job Object on
+    // Windows), so that stopping it reaches the processes it started too,
+    // such as the rest of a shell pipeline.
+    var group *procGroup
+    var started time.Time
+    startCmd := func() error {
+        var err error
+        if group, err = newProcGroup(cmd, opt); err != nil {
+            return err
+        }
+        started = time.Now()
+        err = cmd.Start()
+        group.release()
+        if gateR != nil {
+            gateR.Close()
+            defer gateW.Close()
         }
-        return nil, nil, err
+        if err != nil {
+            return err
+        }
+        if err := group.started(cmd.Process); err != nil {
+            _ = cmd.Process.Kill()
+            _ = cmd.Wait()
+            return err
+        }
+        if gateW != nil {
+            if err := setLimits(cmd.Process.Pid, opt); err != nil {
+                _ = group.kill()
+                _ = cmd.Wait()
+                return err
+            }
+        }
+        return nil
+    }
+
+    // Stopping is two-stage: the stop signal, then SIGKILL once the
+    // grace period is over.
+    var stopped, killed atomic.Bool
+    exited := make(chan struct{})
+    cmd.Cancel = func() error {
+        stopped.Store(true)
+        sig := opt.StopSignal
+        if sig == nil {
+            sig = syscall.SIGTERM
+        }
+        if err := group.signal(sig); err != nil {
+            // E.g. on Windows, where only killing is supported.
+            killed.Store(true)
+            return group.kill()
+        }
+        grace := opt.KillGrace
+        if grace <= 0 {
+            grace = DefaultKillGrace
+        }
+        go func() {
+            t := time.NewTimer(grace)
+            defer t.Stop()
+            select {
+            case <-exited:
+            case <-t.C:
+                killed.Store(true)
+                _ = group.kill()
+            }
+        }()
+        return nil
+    }
+
+    // Each output source and the event type its chunks are sent as.
+    type source struct {
+        r  io.Reader
+        et EventType
+    }
+    var sources []source
+    var master *os.File
+    var stdin io.WriteCloser
+    if opt.Pty {
+        var err error
+        master, err = startPty(cmd, opt, startCmd)
+        if err != nil {
+            cancelCtx()
+            return nil, nil, nil, err
+        }
+        sources = []source{{master, EventPty}}
+        // Input goes through the terminal, which echoes it.
+        stdin = ptyInput{master}
+    } else {
+        // Our own pipes rather than cmd's, which cmd.Wait would close:
+        // the process can then be waited for while its output is read.
+        stdout, stdoutW, err := os.Pipe()
+        if err != nil {
+            cancelCtx()
+            return nil, nil, nil, err
+        }
+        stderr, stderrW, err := os.Pipe()
+        if err != nil {
+            stdout.Close()
+            stdoutW.Close()
+            cancelCtx()
+            return nil, nil, nil, err
+        }
+        cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+        if f, ok := opt.Stdin.(*os.File); ok {
+            // Handed to the child as is, e.g. os.Stdin.
+            cmd.Stdin = f
+        } else if opt.Stdin != nil || input {
+            stdin, err = cmd.StdinPipe()
+        }
+        if err == nil {
+            err = startCmd()
+        }
+        // The child has its own copies of the write ends.
+        stdoutW.Close()
+        stderrW.Close()
+        if err != nil {
+            stdout.Close()
+            stderr.Close()
+            cancelCtx()
+            return nil, nil, nil, err
+        }
+        sources = []source{{stdout, EventStdout}, {stderr, EventStderr}}
+    }
+    if opt.Stdin != nil && stdin != nil {
+        // Copied rather than given to cmd.Stdin, whose copying cmd.Wait
+        // would wait for even after the process exited. A reader that
+        // never ends leaves this goroutine blocked, not the process.
+        go func(w io.WriteCloser) {
+            _, _ = io.Copy(w, opt.Stdin)
+            w.Close()
+        }(stdin)
     }
 
     events := make(chan Event, 16)
+    events <- Event{Type: EventStart, PID: cmd.Process.Pid, Path: path, StartedAt: started}
 
     // Reader helper that streams chunks from r into events as type et.
+    var truncated, networkFailed, sandboxFailed atomic.Bool
     stream := func(r io.Reader, et EventType) {
+        limit := newOutputLimit(opt)
+        if limit != nil {
+            defer func() {
+                if rest := limit.finish(); len(rest) > 0 {
+                    events <- Event{Type: et, Data: rest}
+                }
+                if limit.truncated() {
+                    truncated.Store(true)
+                }
+            }()
+        }
         // Use a buffered reader to read fixed-size chunks; this avoids the
         // token-size limitation of bufio.Scanner and keeps implementation simple.
         br := bufio.NewReader(r)
         const chunk = 4096
+        // held is the start of a rune cut off at the end of the last
+        // chunk, sent with the next one (text mode only).
+        var held []byte
+        // seen ends with the output last scanned for network and sandbox
+        // errors.
+        var seen []byte
         for {
-            buf := make([]byte, chunk)
-            n, err := br.Read(buf)
-            if n > 0 {
-                events <- Event{Type: et, Data: string(buf[:n])}
+            buf := make([]byte, len(held), len(held)+chunk)
+            copy(buf, held)
+            n, err := br.Read(buf[len(held):cap(buf)])
+            buf = buf[:len(held)+n]
+            held = nil
+            if !opt.Binary && err == nil {
+                if cut := partialRune(buf); cut > 0 {
+                    held = append(held, buf[len(buf)-cut:]...)
+                    buf = buf[:len(buf)-cut]
+                }
+            }
+            if noNetwork && !networkFailed.Load() || sandboxed && !sandboxFailed.Load() {
+                // A message can span chunks.
+                seen = append(seen, buf...)
+                if noNetwork && looksNetworkBlocked(seen) {
+                    networkFailed.Store(true)
+                }
+                if sandboxed && looksSandboxDenied(seen) {
+                    sandboxFailed.Store(true)
+                }
+                if len(seen) > errorWindow {
+                    seen = append(seen[:0], seen[len(seen)-errorWindow:]...)
+                }
+            }
+            if limit != nil {
+                buf = limit.write(buf)
+            }
+            if len(buf) > 0 {
+                events <- Event{Type: et, Data: buf}
             }
             if err != nil {
                 if err == io.EOF {
                     return
                 }
-                // On read error other than EOF, stop this stream.
+                // On read error other than EOF, stop this stream. A pty
+                // master reports EIO once the child side is closed.
                 return
             }
         }
     }
 
-    go stream(stdout, EventStdout)
-    go stream(stderr, EventStderr)
+    // The WaitGroup guarantees no stream sends after events is closed.
+    var wg sync.WaitGroup
+    wg.Add(len(sources))
+    for _, s := range sources {
+        go func(s source) {
+            defer wg.Done()
+            stream(s.r, s.et)
+            if s.et != EventPty {
+                s.r.(io.Closer).Close()
+            }
+        }(s)
+    }
 
     // Wait for process completion and emit exit code.
     go func() {
         // Wait respects context cancellation/timeout via CommandContext.
         err := cmd.Wait()
+        exit := Event{Type: EventExit, Duration: time.Since(started), Stopped: stopped.Load(), Killed: killed.Load()}
+        close(exited)
+        // Processes the command left behind die with it: they would hold
+        // its output open, and nobody would stop them later.
+        _ = group.kill()
+        group.close()
+        // The output may still be buffered.
+        wg.Wait()
+        if master != nil {
+            // Only now: closing the terminal hangs up a process that
+            // closed its output but has not exited yet.
+            master.Close()
+        }
         code := 0
         if err != nil {
             // Best-effort extraction of exit status; if unavailable, leave 1.
             code = 1
             if exitErr, ok := err.(*osexec.ExitError); ok {
-                // Process finished and produced non-zero exit code.
-                if status, ok := exitErr.Sys().(interface{ ExitStatus() int }); ok {
-                    code = status.ExitStatus()
-                }
+                // Process finished and produced non-zero exit code (or
+                // -1, if a signal ended it).
+                code = exitErr.ExitCode()
+            } else if stopped.Load() && cmd.ProcessState != nil {
+                // A stopped process exited successfully; Wait reports the
+                // context's error instead.
+                code = cmd.ProcessState.ExitCode()
             }
         }
-        events <- Event{Type: EventExit, Code: code}
+        exit.Code = code
+        exit.Truncated = truncated.Load()
+        exit.Signal = exitSignal(cmd.ProcessState)
+        // The timeout, not the parent context, ended the process.
+        exit.TimedOut = exit.Stopped && errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil
+        exit.LimitExceeded = limitExceeded(opt, exit, cmd.ProcessState)
+        exit.NetworkBlocked = networkFailed.Load() && (exit.Code != 0 || exit.Signal != "")
+        exit.SandboxDenied = sandboxFailed.Load() && (exit.Code != 0 || exit.Signal != "")
+        events <- exit
         close(events)
-        if cancelTimeout != nil {
-            cancelTimeout()
-        }
+        cancelCtx()
     }()
 
-    // Cancel function attempts to terminate the process by canceling the context.
+    // Cancel function stops the process by canceling the context, which
+    // calls cmd.Cancel.
     cancel := func() error {
-        if cancelTimeout != nil {
-            cancelTimeout()
-        }
-        // CommandContext cancellation sends SIGKILL on Unix-ish systems.
+        cancelCtx()
         return nil
     }
 
-    return events, cancel, nil
+    if !input {
+        stdin = nil
+    }
+    return events, stdin, cancel, nil
+}
+
+// limitExceeded tells which resource limit of opt, if any, ended the
+// process that exit and ps describe.
+func limitExceeded(opt Options, exit Event, ps *os.ProcessState) Limit {
+    if exit.Stopped {
+        return ""
+    }
+    if exit.Signal == "" {
+        return limitExceededBy(opt, exit)
+    }
+    if opt.MaxCPUTime > 0 {
+        if exit.Signal == "SIGXCPU" {
+            return LimitCPU
+        }
+        if exit.Signal == "SIGKILL" && ps != nil && ps.UserTime()+ps.SystemTime() >= opt.MaxCPUTime {
+            return LimitCPU
+        }
+    }
+    if opt.MaxMemoryBytes > 0 {
+        // Failed allocations tend to end in a crash or an abort, and the
+        // OOM killer uses SIGKILL.
+        switch exit.Signal {
+        case "SIGSEGV", "SIGBUS", "SIGABRT", "SIGKILL":
+            return LimitMemory
+        }
+    }
+    return ""
+}
+
+// absPath returns the absolute path of the executable cmd runs. cmd.Path
+// is relative when argv[0] is, e.g. "./build.sh", which runs from cmd.Dir.
+func absPath(cmd *osexec.Cmd) string {
+    if filepath.IsAbs(cmd.Path) {
+        return cmd.Path
+    }
+    p := cmd.Path
+    if cmd.Dir != "" {
+        p = filepath.Join(cmd.Dir, p)
+    }
+    if abs, err := filepath.Abs(p); err == nil {
+        return abs
+    }
+    return cmd.Path
+}
+
+// startPty starts cmd with start on a new pseudo-terminal sized by opt,
+// returning its master end, from which the output is read.
+func startPty(cmd *osexec.Cmd, opt Options, start func() error) (*os.File, error) {
+    rows, cols := opt.Rows, opt.Cols
+    if rows == 0 {
+        rows = 24
+    }
+    if cols == 0 {
+        cols = 80
+    }
+    master, slave, err := openPty(rows, cols)
+    if err != nil {
+        return nil, err
+    }
+    env := cmd.Env
+    if env == nil {
+        env = os.Environ()
+    }
+    if !hasEnv(env, "TERM") {
+        cmd.Env = append(env[:len(env):len(env)], "TERM=xterm-256color")
+    }
+    cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+    cmd.SysProcAttr = ptyAttr()
+    err = start()
+    // The child has its own copy; keeping ours would hold the terminal
+    // open, so reading the master would never end.
+    slave.Close()
+    if err != nil {
+        master.Close()
+        return nil, err
+    }
+    return master, nil
+}
+
+// partialRune returns the length of the incomplete UTF-8 rune b ends
+// with, if any.
+func partialRune(b []byte) int {
+    for i := len(b) - 1; i >= 0 && i > len(b)-utf8.UTFMax; i-- {
+        if utf8.RuneStart(b[i]) {
+            if utf8.FullRune(b[i:]) {
+                return 0
+            }
+            return len(b) - i
+        }
+    }
+    return 0
 }
 
+// ptyInput writes to a pseudo-terminal; closing it sends end-of-file
+// (Ctrl-D) instead of closing the terminal, which carries the output too.
+type ptyInput struct{ f *os.File }
+
+func (p ptyInput) Write(b []byte) (int, error) { return p.f.Write(b) }
+
+func (p ptyInput) Close() error {
+    _, err := p.f.Write([]byte{4})
+    return err
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func hasEnv(env []string, name string) bool {
+    for _, kv := range env {
+        if k, _, _ := strings.Cut(kv, "="); k == name {
+            return true
+        }
+    }
+    return false
+}
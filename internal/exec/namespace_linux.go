@@ -0,0 +1,67 @@
+package exec
+
+import (
+	"os"
+	osexec "os/exec"
+	"sync"
+	"syscall"
+)
+
+var (
+	namespacesOnce sync.Once
+	namespacesErr  error
+)
+
+// capSysAdmin is CAP_SYS_ADMIN, which mounting takes.
+const capSysAdmin = 21
+
+// addNamespaces makes the process started with attr run in new namespaces
+// of the given kinds: a network namespace only has a loopback interface,
+// down; a mount namespace starts as a copy of ours. Without root, that
+// takes a user namespace too, in which our IDs map to themselves; the
+// process then keeps CAP_SYS_ADMIN in it, as an ambient capability, to
+// mount things in its mount namespace, and must drop it itself.
+func addNamespaces(attr *syscall.SysProcAttr, flags uintptr) {
+	attr.Cloneflags |= flags
+	if uid := os.Getuid(); uid != 0 {
+		if flags&syscall.CLONE_NEWNS != 0 {
+			attr.AmbientCaps = []uintptr{capSysAdmin}
+		}
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		gid := os.Getgid()
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+	}
+}
+
+// namespacesAvailable reports why processes cannot be started in network
+// and mount namespaces, or nil: unprivileged user namespaces may be
+// disabled, for one. It tries once.
+func namespacesAvailable() error {
+	namespacesOnce.Do(func() {
+		self, err := os.Executable()
+		if err != nil {
+			namespacesErr = err
+			return
+		}
+		probe := osexec.Command(self, namespaceProbeArg)
+		probe.SysProcAttr = &syscall.SysProcAttr{}
+		addNamespaces(probe.SysProcAttr, syscall.CLONE_NEWNET|syscall.CLONE_NEWNS)
+		namespacesErr = probe.Run()
+	})
+	return namespacesErr
+}
+
+// setNamespaces makes cmd, not yet started, run in new namespaces of the
+// given kinds if it can, reporting whether it does.
+func setNamespaces(cmd *osexec.Cmd, flags uintptr) bool {
+	if namespacesAvailable() != nil {
+		return false
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	addNamespaces(cmd.SysProcAttr, flags)
+	return true
+}
@@ -0,0 +1,44 @@
+package exec
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrNetworkUnsupported is returned by Start for Options.NetworkDisabled
+// on platforms that cannot cut a command's network.
+var ErrNetworkUnsupported = errors.New("exec: disabling the network not supported on this platform")
+
+// networkErrors are what commands typically print when they cannot reach
+// the network, lowercase.
+var networkErrors = [][]byte{
+	[]byte("network is unreachable"),
+	[]byte("network is down"),
+	[]byte("no route to host"),
+	[]byte("could not resolve host"),
+	[]byte("temporary failure in name resolution"),
+	[]byte("name or service not known"),
+	[]byte("nodename nor servname provided"),
+	[]byte("no such host"),
+	[]byte("failed to establish a new connection"),
+	[]byte("could not connect to server"),
+	[]byte("couldn't connect to server"),
+	[]byte("socket: operation not permitted"),
+	[]byte("connect: operation not permitted"),
+}
+
+// errorWindow is how much output before a chunk is scanned with it for
+// networkErrors and sandboxErrors, which are shorter.
+const errorWindow = 64
+
+// looksNetworkBlocked reports whether output b reads like a failure to use
+// the network.
+func looksNetworkBlocked(b []byte) bool {
+	lower := bytes.ToLower(b)
+	for _, e := range networkErrors {
+		if bytes.Contains(lower, e) {
+			return true
+		}
+	}
+	return false
+}
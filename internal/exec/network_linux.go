@@ -0,0 +1,22 @@
+package exec
+
+import (
+	osexec "os/exec"
+	"syscall"
+)
+
+// isolateNetwork makes cmd, not yet started, run in a network namespace
+// if it can, reporting whether it does.
+func isolateNetwork(cmd *osexec.Cmd) bool {
+	return setNamespaces(cmd, syscall.CLONE_NEWNET)
+}
+
+// disableNetwork makes cmd, not yet started, run under the seccomp filter
+// of the sandbox helper, which keeps it from creating sockets other than
+// Unix ones.
+func disableNetwork(cmd *osexec.Cmd) error {
+	if !seccompSupported {
+		return ErrNetworkUnsupported
+	}
+	return wrapHelper(cmd, sandboxSpec{AnyWritable: true})
+}
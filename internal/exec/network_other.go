@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package exec
+
+import osexec "os/exec"
+
+func isolateNetwork(cmd *osexec.Cmd) bool { return false }
+
+func disableNetwork(cmd *osexec.Cmd) error { return ErrNetworkUnsupported }
@@ -0,0 +1,90 @@
+//go:build !windows
+
+package exec
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"syscall"
+)
+
+// procGroup is the process group of a command: the process and every
+// process it starts that does not leave the group.
+type procGroup struct{ pid int }
+
+// newProcGroup makes cmd, not yet started, lead a process group of its
+// own. A command on a pty already leads a session, hence a group.
+func newProcGroup(cmd *osexec.Cmd, opt Options) (*procGroup, error) {
+	if opt.RestrictedToken {
+		return nil, ErrRestrictedTokenUnsupported
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if !cmd.SysProcAttr.Setsid {
+		cmd.SysProcAttr.Setpgid = true
+	}
+	return &procGroup{}, nil
+}
+
+// release frees what starting the command needed: nothing.
+func (g *procGroup) release() {}
+
+// started records the started process.
+func (g *procGroup) started(p *os.Process) error {
+	g.pid = p.Pid
+	return nil
+}
+
+// signal sends sig to every process of the group.
+func (g *procGroup) signal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return os.ErrInvalid
+	}
+	return syscall.Kill(-g.pid, s)
+}
+
+// kill kills every process of the group.
+func (g *procGroup) kill() error { return syscall.Kill(-g.pid, syscall.SIGKILL) }
+
+// close releases the group once its leader was waited for.
+func (g *procGroup) close() {}
+
+// signalNames names the signals commands commonly die of.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGSYS:  "SIGSYS",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGUSR1: "SIGUSR1",
+	syscall.SIGUSR2: "SIGUSR2",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+}
+
+// exitSignal names the signal that terminated a process, if any.
+func exitSignal(ps *os.ProcessState) string {
+	if ps == nil {
+		return ""
+	}
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return ""
+	}
+	if name, ok := signalNames[ws.Signal()]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %d", int(ws.Signal()))
+}
@@ -0,0 +1,197 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// Job Objects, through kernel32.
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+
+	procNtResumeProcess = syscall.NewLazyDLL("ntdll.dll").NewProc("NtResumeProcess")
+
+	procCreateRestrictedToken = syscall.NewLazyDLL("advapi32.dll").NewProc("CreateRestrictedToken")
+)
+
+const (
+	jobObjectExtendedLimitInformation = 9
+	jobObjectLimitJobTime             = 0x4
+	jobObjectLimitActiveProcess       = 0x8
+	jobObjectLimitJobMemory           = 0x200
+	jobObjectLimitKillOnJobClose      = 0x2000
+	processSetQuota                   = 0x0100
+	processTerminate                  = 0x0001
+	processSuspendResume              = 0x0800
+
+	createSuspended = 0x4
+
+	disableMaxPrivilege = 0x1
+	luaToken            = 0x4
+)
+
+// jobBasicLimit is JOBOBJECT_BASIC_LIMIT_INFORMATION.
+type jobBasicLimit struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+// jobExtendedLimit is JOBOBJECT_EXTENDED_LIMIT_INFORMATION.
+type jobExtendedLimit struct {
+	BasicLimitInformation jobBasicLimit
+	IoInfo                [6]uint64
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// procGroup is the Job Object of a command, which the processes it starts
+// join, and which enforces the resource limits of its Options. Closing the
+// job kills whatever is left in it.
+type procGroup struct {
+	opt   Options
+	job   syscall.Handle
+	p     *os.Process
+	token syscall.Token
+}
+
+// newProcGroup makes cmd, not yet started, start suspended, so that it
+// does nothing before it is in its job, and with a restricted token if
+// opt asks for one.
+func newProcGroup(cmd *osexec.Cmd, opt Options) (*procGroup, error) {
+	g := &procGroup{opt: opt}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if opt.RestrictedToken {
+		token, err := restrictedToken()
+		if err != nil {
+			return nil, err
+		}
+		g.token = token
+		cmd.SysProcAttr.Token = token
+	}
+	cmd.SysProcAttr.CreationFlags |= createSuspended
+	return g, nil
+}
+
+// restrictedToken returns a copy of our access token without privileges
+// and, for an administrator, with the rights of a standard user.
+func restrictedToken() (syscall.Token, error) {
+	p, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, err
+	}
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(p, syscall.TOKEN_DUPLICATE|syscall.TOKEN_ASSIGN_PRIMARY|syscall.TOKEN_QUERY, &token); err != nil {
+		return 0, err
+	}
+	defer token.Close()
+	var restricted syscall.Token
+	if ok, _, err := procCreateRestrictedToken.Call(uintptr(token), disableMaxPrivilege|luaToken, 0, 0, 0, 0, 0, 0, uintptr(unsafe.Pointer(&restricted))); ok == 0 {
+		return 0, fmt.Errorf("exec: restricted token: %w", err)
+	}
+	return restricted, nil
+}
+
+// release frees the restricted token once the command started with it.
+func (g *procGroup) release() {
+	if g.token != 0 {
+		g.token.Close()
+		g.token = 0
+	}
+}
+
+// started puts the started process, still suspended, in a new job with
+// the limits of the Options, then resumes it. Without a job, only the
+// process itself can be killed; that is an error only if limits were
+// asked for.
+func (g *procGroup) started(p *os.Process) error {
+	g.p = p
+	h, err := syscall.OpenProcess(processSetQuota|processTerminate|processSuspendResume, false, uint32(p.Pid))
+	if err != nil {
+		return fmt.Errorf("exec: open process: %w", err)
+	}
+	defer syscall.CloseHandle(h)
+	jobErr := g.join(h)
+	if jobErr != nil && g.opt.hasLimits() {
+		return fmt.Errorf("exec: limits: %w", jobErr)
+	}
+	if status, _, _ := procNtResumeProcess.Call(uintptr(h)); status != 0 {
+		return fmt.Errorf("exec: resume process: NTSTATUS %#x", status)
+	}
+	return nil
+}
+
+// join creates the job, limited as the Options say, and assigns the
+// process h to it.
+func (g *procGroup) join(h syscall.Handle) error {
+	job, _, err := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		return err
+	}
+	info := jobExtendedLimit{BasicLimitInformation: jobBasicLimit{LimitFlags: jobObjectLimitKillOnJobClose}}
+	if d := g.opt.MaxCPUTime; d > 0 {
+		info.BasicLimitInformation.LimitFlags |= jobObjectLimitJobTime
+		info.BasicLimitInformation.PerJobUserTimeLimit = int64(d / 100) // in 100 ns
+	}
+	if n := g.opt.MaxMemoryBytes; n > 0 {
+		info.BasicLimitInformation.LimitFlags |= jobObjectLimitJobMemory
+		info.JobMemoryLimit = uintptr(n)
+	}
+	if n := g.opt.MaxProcesses; n > 0 {
+		info.BasicLimitInformation.LimitFlags |= jobObjectLimitActiveProcess
+		info.BasicLimitInformation.ActiveProcessLimit = uint32(n)
+	}
+	if ok, _, err := procSetInformationJobObject.Call(job, jobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info)); ok == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return err
+	}
+	if ok, _, err := procAssignProcessToJobObject.Call(job, uintptr(h)); ok == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return err
+	}
+	g.job = syscall.Handle(job)
+	return nil
+}
+
+// signal fails: Windows has no signals to ask processes to stop.
+func (g *procGroup) signal(sig os.Signal) error { return syscall.EWINDOWS }
+
+// kill terminates every process of the job.
+func (g *procGroup) kill() error {
+	if g.job == 0 {
+		return g.p.Kill()
+	}
+	if ok, _, err := procTerminateJobObject.Call(uintptr(g.job), 1); ok == 0 {
+		return err
+	}
+	return nil
+}
+
+// close closes the job, killing what is left in it.
+func (g *procGroup) close() {
+	if g.job != 0 {
+		syscall.CloseHandle(g.job)
+		g.job = 0
+	}
+}
+
+// exitSignal returns "": Windows processes do not die of signals.
+func exitSignal(ps *os.ProcessState) string { return "" }
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package exec
+
+import (
+	"os"
+	"syscall"
+)
+
+func openPty(rows, cols uint16) (master, slave *os.File, err error) {
+	return nil, nil, ErrPtyUnsupported
+}
+
+// TermSize returns the size of the terminal f refers to; ok is false when
+// f is not a terminal.
+func TermSize(f *os.File) (rows, cols uint16, ok bool) { return 0, 0, false }
+
+func ptyAttr() *syscall.SysProcAttr { return nil }
@@ -0,0 +1,38 @@
+//go:build linux || darwin
+
+package exec
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ptyAttr makes the child a session leader with the pty, its stdin, as
+// the controlling terminal, so job control and /dev/tty work.
+func ptyAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+}
+
+// setWinsize sets the size of the terminal f belongs to.
+func setWinsize(f *os.File, rows, cols uint16) error {
+	ws := struct{ Row, Col, X, Y uint16 }{Row: rows, Col: cols}
+	return ioctl(f.Fd(), syscall.TIOCSWINSZ, uintptr(unsafe.Pointer(&ws)))
+}
+
+// TermSize returns the size of the terminal f refers to; ok is false when
+// f is not a terminal.
+func TermSize(f *os.File) (rows, cols uint16, ok bool) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	if err := ioctl(f.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws))); err != nil {
+		return 0, 0, false
+	}
+	return ws.Row, ws.Col, true
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
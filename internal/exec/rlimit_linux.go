@@ -0,0 +1,72 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// checkLimits returns why the resource limits of opt cannot be applied,
+// or nil.
+func checkLimits(opt Options) error { return nil }
+
+// limitExceededBy classifies exits by the status only Windows uses.
+func limitExceededBy(opt Options, exit Event) Limit { return "" }
+
+// gateLimits makes cmd, not yet started, wait until its limits are set:
+// it first runs sh, which reads from a pipe, then execs the command,
+// keeping its PID. Once cmd started, close r, set the limits on its PID
+// with setLimits, then close w to let it go on. This way it never runs
+// unlimited.
+func gateLimits(cmd *osexec.Cmd) (r, w *os.File, err error) {
+	r, w, err = os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+	script := fmt.Sprintf(`read -r _ <&%d; exec "$@" %d<&-`, fd, fd)
+	cmd.Args = append([]string{"sh", "-c", script, "sh"}, cmd.Args...)
+	cmd.Path = "/bin/sh"
+	return r, w, nil
+}
+
+// setLimits applies the resource limits of opt to the process pid:
+// prlimit(2) lets a parent set them on its child. The processes it starts
+// inherit them.
+func setLimits(pid int, opt Options) error {
+	set := func(resource int, cur, max uint64) error {
+		lim := syscall.Rlimit{Cur: cur, Max: max}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(&lim)), 0, 0, 0)
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+	if opt.MaxCPUTime > 0 {
+		// SIGXCPU at the limit, SIGKILL a second later for a process
+		// that ignores it.
+		sec := uint64((opt.MaxCPUTime + 999_999_999) / 1_000_000_000)
+		if err := set(syscall.RLIMIT_CPU, sec, sec+1); err != nil {
+			return fmt.Errorf("exec: limit cpu time: %w", err)
+		}
+	}
+	if n := opt.MaxMemoryBytes; n > 0 {
+		if err := set(syscall.RLIMIT_AS, uint64(n), uint64(n)); err != nil {
+			return fmt.Errorf("exec: limit memory: %w", err)
+		}
+	}
+	if n := opt.MaxOpenFiles; n > 0 {
+		if err := set(syscall.RLIMIT_NOFILE, uint64(n), uint64(n)); err != nil {
+			return fmt.Errorf("exec: limit open files: %w", err)
+		}
+	}
+	if n := opt.MaxProcesses; n > 0 {
+		if err := set(rlimitNproc, uint64(n), uint64(n)); err != nil {
+			return fmt.Errorf("exec: limit processes: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package exec
+
+// rlimitNproc is RLIMIT_NPROC, which package syscall does not define.
+const rlimitNproc = 6
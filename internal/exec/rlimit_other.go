@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+
+package exec
+
+import (
+	"os"
+	osexec "os/exec"
+)
+
+func checkLimits(opt Options) error { return ErrLimitsUnsupported }
+
+func limitExceededBy(opt Options, exit Event) Limit { return "" }
+
+func gateLimits(cmd *osexec.Cmd) (r, w *os.File, err error) { return nil, nil, ErrLimitsUnsupported }
+
+func setLimits(pid int, opt Options) error { return ErrLimitsUnsupported }
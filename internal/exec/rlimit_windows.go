@@ -0,0 +1,35 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+)
+
+// errorNotEnoughQuota is the exit status of processes a Job Object
+// terminated for exceeding its CPU time limit.
+const errorNotEnoughQuota = 1816
+
+// checkLimits returns why the resource limits of opt cannot be applied,
+// or nil: the command's Job Object enforces all but MaxOpenFiles.
+func checkLimits(opt Options) error {
+	if opt.MaxOpenFiles > 0 {
+		return fmt.Errorf("%w: MaxOpenFiles", ErrLimitsUnsupported)
+	}
+	return nil
+}
+
+// limitExceededBy tells whether the Job Object's CPU time limit ended
+// the process.
+func limitExceededBy(opt Options, exit Event) Limit {
+	if opt.MaxCPUTime > 0 && exit.Code == errorNotEnoughQuota {
+		return LimitCPU
+	}
+	return ""
+}
+
+// gateLimits does nothing: the command starts suspended until it is in
+// its Job Object, which carries the limits (see procGroup.started).
+func gateLimits(cmd *osexec.Cmd) (r, w *os.File, err error) { return nil, nil, nil }
+
+func setLimits(pid int, opt Options) error { return nil }
@@ -1,6 +1,17 @@
 package exec
 
-import "context"
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultKillGrace is how long a stopped process has to exit before it is
+// killed, unless Options.KillGrace says otherwise.
+const DefaultKillGrace = 2 * time.Second
 
 // Options controls how a command should be executed.
 // We keep the shape intentionally small so it's easy to extend later
@@ -10,10 +21,107 @@ type Options struct {
 	Cwd string
 	// Env is the environment as a list of KEY=VALUE entries. Empty means inherit.
 	Env []string
+	// EnvPolicy, if set, filters the environment (Env, or the inherited
+	// one) before the process sees it.
+	EnvPolicy *EnvPolicy
 	// TimeoutSec, if > 0, enforces a soft timeout for the process lifetime.
 	TimeoutSec int
+	// StopSignal is sent to stop the process on cancel or timeout. Nil
+	// means SIGTERM; where that cannot be sent (Windows), the process is
+	// killed at once.
+	StopSignal os.Signal
+	// KillGrace is how long a stopped process has to exit before it is
+	// killed; zero means DefaultKillGrace.
+	KillGrace time.Duration
+	// Pty runs the process on a pseudo-terminal instead of pipes, for
+	// commands that behave differently without a TTY: pagers, progress
+	// bars, prompts, colors. Its output arrives merged as EventPty, with
+	// the terminal's line discipline applied (e.g. "\n" becomes "\r\n").
+	// TERM defaults to xterm-256color.
+	Pty bool
+	// Rows and Cols are the size of the pseudo-terminal; zero means 24
+	// and 80.
+	Rows, Cols uint16
+	// Binary sends output chunks as they are read. By default (text
+	// mode) a chunk never ends inside a multi-byte UTF-8 rune: the start
+	// of a rune cut off by a read is held back and sent with the next
+	// chunk, so consumers can decode each chunk on its own.
+	Binary bool
+	// Stdin, if set, is read until EOF and fed to the process, whose
+	// stdin is then closed. An *os.File (such as os.Stdin) is handed to
+	// the process directly, unless it runs on a pty. Nil means no input:
+	// the process reads EOF (or waits, on a pty).
+	Stdin io.Reader
+	// MaxOutputBytes and MaxOutputLines, if > 0, cap the output of each
+	// stream (stdout, stderr, or the pty). Past half the cap, output is
+	// no longer sent as it arrives; only the last half is kept, and sent
+	// at the end after a "[... N bytes omitted]" marker. EventExit then
+	// reports Truncated. This keeps commands like `yes` from flooding
+	// whoever collects the output.
+	MaxOutputBytes int
+	MaxOutputLines int
+	// MaxCPUTime, MaxMemoryBytes, MaxOpenFiles and MaxProcesses, if > 0,
+	// limit the CPU time (rounded up to a second), address space, open
+	// file descriptors and processes of the command and of what it starts,
+	// as RLIMIT_CPU, RLIMIT_AS, RLIMIT_NOFILE and RLIMIT_NPROC do; note
+	// that the latter counts every process of the user, not just the
+	// command's. EventExit reports LimitExceeded when it can tell a limit
+	// ended the process. On Windows, the command's Job Object enforces
+	// them instead: CPU time is user time, memory is what all its
+	// processes committed, and MaxOpenFiles is not supported. Start
+	// returns ErrLimitsUnsupported where limits cannot be applied.
+	MaxCPUTime     time.Duration
+	MaxMemoryBytes int64
+	MaxOpenFiles   int
+	MaxProcesses   int
+	// Sandbox, if set, confines the command and what it starts to the
+	// policy (see SandboxPolicy): with Landlock and seccomp on Linux
+	// (amd64 and arm64), with Seatbelt (sandbox-exec) on macOS. Start
+	// returns ErrSandboxUnsupported where commands cannot be sandboxed.
+	Sandbox *SandboxPolicy
+	// RestrictedToken runs the command, on Windows, with a restricted
+	// version of our access token: without its privileges and, for an
+	// administrator, as a standard user. Start returns
+	// ErrRestrictedTokenUnsupported elsewhere, where Sandbox is the way to
+	// confine commands.
+	RestrictedToken bool
+	// NetworkDisabled cuts the command off the network: on Linux, it runs
+	// in a network namespace of its own (or, where none can be made,
+	// cannot create sockets other than Unix ones); on macOS, a Seatbelt
+	// profile denies it the network. A Sandbox without NetworkAccess
+	// implies it. EventExit reports NetworkBlocked when the command seems
+	// to have failed for it. Start returns ErrNetworkUnsupported on other
+	// platforms.
+	NetworkDisabled bool
 }
 
+// hasLimits reports whether o sets any resource limit.
+func (o Options) hasLimits() bool {
+	return o.MaxCPUTime > 0 || o.MaxMemoryBytes > 0 || o.MaxOpenFiles > 0 || o.MaxProcesses > 0
+}
+
+// Limit names the resource limit that ended a process.
+type Limit string
+
+const (
+	// LimitCPU is Options.MaxCPUTime.
+	LimitCPU Limit = "cpu"
+	// LimitMemory is Options.MaxMemoryBytes.
+	LimitMemory Limit = "memory"
+)
+
+// ErrRestrictedTokenUnsupported is returned by Start for
+// Options.RestrictedToken outside Windows.
+var ErrRestrictedTokenUnsupported = errors.New("exec: restricted tokens are only supported on Windows")
+
+// ErrLimitsUnsupported is returned by Start for resource limits on
+// platforms that cannot apply them.
+var ErrLimitsUnsupported = errors.New("exec: resource limits not supported on this platform")
+
+// ErrPtyUnsupported is returned by Start for Options.Pty on platforms
+// without pseudo-terminals.
+var ErrPtyUnsupported = errors.New("exec: pty not supported on this platform")
+
 // EventType describes the kind of stream event emitted by a running process.
 type EventType int
 
@@ -24,20 +132,145 @@ const (
 	EventStderr
 	// EventExit indicates the process has terminated; Code holds the exit status.
 	EventExit
+	// EventPty is a chunk of data read from the pseudo-terminal of a
+	// process run with Options.Pty: its stdout and stderr, interleaved.
+	EventPty
+	// EventStart is sent first, once the process is running; PID, Path
+	// and StartedAt describe it.
+	EventStart
 )
 
 // Event is a single item in the execution event stream.
-// For stdout/stderr, Data contains a text chunk (not necessarily line-aligned).
+// For stdout/stderr/pty, Data contains the raw bytes of a chunk, exactly as
+// the process wrote them (not necessarily line-aligned; rune-aligned unless
+// Options.Binary).
 // For exit, Code is populated.
 type Event struct {
 	Type EventType
-	Data string
+	Data []byte
 	Code int
+	// PID is, for start, the process ID of the command, e.g. to signal
+	// it or inspect /proc/<pid>.
+	PID int
+	// Path is, for start, the absolute path of the executable argv[0]
+	// resolved to.
+	Path string
+	// StartedAt is, for start, when the process was started.
+	StartedAt time.Time
+	// Stopped reports, for exit, that the process did not exit on its
+	// own: it was stopped by cancel, its context or the timeout.
+	Stopped bool
+	// Killed reports, for exit, that the process outlived the stop
+	// signal's grace period (see Options.KillGrace) and was killed.
+	Killed bool
+	// TimedOut reports, for exit, that Options.TimeoutSec stopped the
+	// process.
+	TimedOut bool
+	// Signal names, for exit, the signal that terminated the process,
+	// such as "SIGKILL"; empty if it exited on its own (Code is then its
+	// exit status) or on Windows.
+	Signal string
+	// Duration is, for exit, how long the process ran.
+	Duration time.Duration
+	// Truncated reports, for exit, that output was dropped to stay within
+	// Options.MaxOutputBytes or MaxOutputLines.
+	Truncated bool
+	// LimitExceeded names, for exit, the resource limit that ended the
+	// process, if that is what did: running out of CPU time (SIGXCPU, or
+	// SIGKILL past it), or crashing or being killed under a memory limit.
+	// Hitting the others makes system calls fail, for the process to
+	// report.
+	LimitExceeded Limit
+	// NetworkBlocked reports, for exit, that the command failed after
+	// printing what reads like a network error while it had no network
+	// (see Options.NetworkDisabled).
+	NetworkBlocked bool
+	// SandboxDenied reports, for exit, that the command failed after
+	// printing what reads like the sandbox denying it something, such as
+	// "Read-only file system" (see Options.Sandbox): running it outside
+	// the sandbox might succeed.
+	SandboxDenied bool
 }
 
+// Text returns Data as text (see Text).
+func (e Event) Text() string { return Text(e.Data) }
+
+// Text converts process output to valid UTF-8 text, replacing invalid
+// bytes with U+FFFD. With Options.Binary, convert the whole output rather
+// than each chunk: a chunk can end inside a multi-byte rune.
+func Text(b []byte) string { return strings.ToValidUTF8(string(b), "\uFFFD") }
+
 // Runner abstracts process execution behind a streaming interface.
 // Start should spawn the process and return a receive-only Event channel,
 // a cancel func (to terminate the process), and an error if startup failed.
+// Run is Start, waiting for the process and collecting its events into an
+// ExecResult; the error is Start's.
 type Runner interface {
 	Start(ctx context.Context, argv []string, opt Options) (<-chan Event, func() error, error)
+	Run(ctx context.Context, argv []string, opt Options) (ExecResult, error)
+}
+
+// ExecResult is the outcome of a command run to completion.
+type ExecResult struct {
+	// Stdout and Stderr are the raw output of each stream; a pty's output
+	// goes to Stdout. Output is both, interleaved in the order read.
+	Stdout, Stderr, Output []byte
+	// ExitCode is the exit status, or -1 if no exit was seen; see the
+	// EventExit fields of the same names for the others.
+	ExitCode  int
+	Signal    string
+	Duration  time.Duration
+	Stopped   bool
+	Killed    bool
+	TimedOut  bool
+	Truncated bool
+	// LimitExceeded, NetworkBlocked and SandboxDenied are EventExit's.
+	LimitExceeded  Limit
+	NetworkBlocked bool
+	SandboxDenied  bool
+	// PID is the process ID the command ran as.
+	PID int
+}
+
+// run implements Runner.Run on top of r.Start.
+func run(ctx context.Context, r Runner, argv []string, opt Options) (ExecResult, error) {
+	res := ExecResult{ExitCode: -1}
+	events, cancel, err := r.Start(ctx, argv, opt)
+	if err != nil {
+		return res, err
+	}
+	defer func() { _ = cancel() }()
+	for ev := range events {
+		switch ev.Type {
+		case EventStart:
+			res.PID = ev.PID
+		case EventStdout, EventPty:
+			res.Stdout = append(res.Stdout, ev.Data...)
+			res.Output = append(res.Output, ev.Data...)
+		case EventStderr:
+			res.Stderr = append(res.Stderr, ev.Data...)
+			res.Output = append(res.Output, ev.Data...)
+		case EventExit:
+			res.ExitCode = ev.Code
+			res.Signal = ev.Signal
+			res.Duration = ev.Duration
+			res.Stopped = ev.Stopped
+			res.Killed = ev.Killed
+			res.TimedOut = ev.TimedOut
+			res.Truncated = ev.Truncated
+			res.LimitExceeded = ev.LimitExceeded
+			res.NetworkBlocked = ev.NetworkBlocked
+			res.SandboxDenied = ev.SandboxDenied
+		}
+	}
+	return res, nil
+}
+
+// InputRunner is a Runner whose processes can be written to while they
+// run, e.g. to answer prompts. StartInput is Start, also returning the
+// process's stdin; closing it signals EOF (Ctrl-D on a pty). Options.Stdin
+// must not be set.
+type InputRunner interface {
+	Runner
+	StartInput(ctx context.Context, argv []string, opt Options) (<-chan Event, io.WriteCloser, func() error, error)
 }
@@ -0,0 +1,174 @@
+package exec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+
+	"codex-go/internal/protocol"
+)
+
+// SandboxPolicy confines a command run with Options.Sandbox, following the
+// sandbox modes of the protocol:
+//   - read-only: the command can read anything but write nowhere (except
+//     /dev/null) and has no network access;
+//   - workspace-write: it can also write in its Cwd, WritableRoots and,
+//     unless ExcludeTmpdir, the temporary directories; but .git and the
+//     other top-level dotfiles of these roots stay read-only, unless
+//     WriteDotfiles;
+//   - danger-full-access: it is not confined at all.
+//
+// On Linux, dotfiles are protected by read-only bind mounts in a mount
+// namespace of the command's own; where none can be made, they are as
+// writable as the rest of their root.
+type SandboxPolicy = protocol.SandboxPolicy
+
+// ErrSandboxUnsupported is returned by Start for Options.Sandbox, and by
+// SandboxAvailable, on platforms without a sandbox.
+var ErrSandboxUnsupported = errors.New("exec: sandbox not supported on this platform")
+
+// SandboxAvailable reports why commands cannot be sandboxed here, or nil
+// if they can.
+func SandboxAvailable() error { return sandboxAvailable() }
+
+// confines reports whether p restricts anything.
+func confines(p *SandboxPolicy) bool { return p != nil && p.Confines() }
+
+// sandboxSpec is a SandboxPolicy resolved for one command: the absolute
+// paths it may write to, unless it may write anywhere, and those below
+// them that stay read-only.
+type sandboxSpec struct {
+	Writable    []string `json:"writable"`
+	ReadOnly    []string `json:"read_only,omitempty"`
+	AnyWritable bool     `json:"any_writable,omitempty"`
+	Network     bool     `json:"network"`
+	// MountNS, on Linux, runs the command in a mount namespace of its own,
+	// where ReadOnly is mounted read-only.
+	MountNS bool `json:"mount_ns,omitempty"`
+}
+
+// policySpec resolves p for a command run in cwd.
+func policySpec(p *SandboxPolicy, cwd string) (sandboxSpec, error) {
+	s := sandboxSpec{Writable: []string{os.DevNull, "/dev/tty"}, Network: p.NetworkAccess}
+	if p.Mode != protocol.SandboxWorkspaceWrite {
+		return s, nil
+	}
+	if cwd == "" {
+		var err error
+		if cwd, err = os.Getwd(); err != nil {
+			return s, err
+		}
+	}
+	roots := p.Roots(cwd)
+	s.Writable = append(s.Writable, roots...)
+	s.Writable = append(s.Writable, p.TempDirs()...)
+	if !p.WriteDotfiles {
+		for _, root := range roots {
+			s.ReadOnly = append(s.ReadOnly, dotfiles(root)...)
+		}
+	}
+	return s, nil
+}
+
+// dotfiles returns the top-level dotfiles of root that exist, but not
+// symbolic links: what they point to is protected, or not, on its own.
+func dotfiles(root string) []string {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") && e.Type()&fs.ModeSymlink == 0 {
+			paths = append(paths, filepath.Join(root, e.Name()))
+		}
+	}
+	return paths
+}
+
+// sandboxErrors are what commands typically print when the sandbox denies
+// them something, lowercase; the sandbox helper's own errors start with
+// "codex sandbox:".
+var sandboxErrors = [][]byte{
+	[]byte("permission denied"),
+	[]byte("operation not permitted"),
+	[]byte("read-only file system"),
+	[]byte("codex sandbox:"),
+}
+
+// looksSandboxDenied reports whether output b reads like the sandbox
+// denying the command something.
+func looksSandboxDenied(b []byte) bool {
+	lower := bytes.ToLower(b)
+	for _, e := range sandboxErrors {
+		if bytes.Contains(lower, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxHelperArg, as the first argument of this very program, makes it
+// confine itself then exec the command that follows (see init): a process
+// can only sandbox itself, and a Go program cannot run code in its child
+// between fork and exec.
+const sandboxHelperArg = "--codex-exec-sandboxed"
+
+// namespaceProbeArg, as the only argument of this very program, makes it
+// exit at once: it is started in new namespaces to see whether that works.
+const namespaceProbeArg = "--codex-exec-ns-probe"
+
+// wrapSandbox makes cmd, not yet started, run under p, the way the
+// platform confines commands (see confine).
+func wrapSandbox(cmd *osexec.Cmd, p *SandboxPolicy) error {
+	if err := sandboxAvailable(); err != nil {
+		return err
+	}
+	spec, err := policySpec(p, cmd.Dir)
+	if err != nil {
+		return fmt.Errorf("exec: sandbox: %w", err)
+	}
+	return confine(cmd, spec)
+}
+
+// wrapHelper makes cmd, not yet started, run through this program again,
+// as a sandbox helper confining itself to spec.
+func wrapHelper(cmd *osexec.Cmd, spec sandboxSpec) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("exec: sandbox: %w", err)
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{self, sandboxHelperArg, string(b), cmd.Path}, cmd.Args...)
+	cmd.Path = self
+	return nil
+}
+
+// init turns any program that runs commands with Options.Sandbox into its
+// own sandbox helper: started with sandboxHelperArg, a sandbox spec, the
+// executable and its argv, it confines itself and execs the command, never
+// returning. 126 is the exit status when that fails, as for a shell.
+func init() {
+	if len(os.Args) == 2 && os.Args[1] == namespaceProbeArg {
+		os.Exit(0)
+	}
+	if len(os.Args) < 5 || os.Args[1] != sandboxHelperArg {
+		return
+	}
+	var spec sandboxSpec
+	err := json.Unmarshal([]byte(os.Args[2]), &spec)
+	if err == nil {
+		err = execSandboxed(spec, os.Args[3], os.Args[4:])
+	}
+	fmt.Fprintf(os.Stderr, "codex sandbox: %v\n", err)
+	os.Exit(126)
+}
@@ -0,0 +1,239 @@
+//go:build linux && (amd64 || arm64)
+
+package exec
+
+import (
+	"errors"
+	"fmt"
+	osexec "os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock restricts the filesystem writes of the helper and of what it
+// execs; read-only bind mounts protect dotfiles within what stays
+// writable; a seccomp filter takes its network away.
+
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+
+	landlockWriteFile  = 1 << 1
+	landlockRemoveDir  = 1 << 4
+	landlockRemoveFile = 1 << 5
+	landlockMakeChar   = 1 << 6
+	landlockMakeDir    = 1 << 7
+	landlockMakeReg    = 1 << 8
+	landlockMakeSock   = 1 << 9
+	landlockMakeFifo   = 1 << 10
+	landlockMakeBlock  = 1 << 11
+	landlockMakeSym    = 1 << 12
+	landlockRefer      = 1 << 13 // ABI 2
+	landlockTruncate   = 1 << 14 // ABI 3
+
+	// landlockFileAccess are the rights that apply to files, not only
+	// to directories.
+	landlockFileAccess = landlockWriteFile | landlockTruncate
+
+	prSetNoNewPrivs   = 38
+	prCapAmbient      = 47
+	prCapAmbientClear = 4
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+
+	seccompRetAllow = 0x7fff0000
+	seccompRetErrno = 0x00050000
+	seccompRetKill  = 0x80000000 // the whole process
+
+	sysIoUringSetup = 425
+
+	oPath = 0x200000 // O_PATH, which package syscall does not define
+
+	// stLocked are the statfs flags of a mount that a remount in a user
+	// namespace must keep, as the MS_ flags of the same values.
+	stLocked = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+		syscall.MS_NOATIME | syscall.MS_NODIRATIME
+	stRelatime = 1 << 12 // ST_RELATIME, MS_RELATIME for mount
+)
+
+// landlockABI returns the Landlock version the kernel supports.
+func landlockABI() (int, error) {
+	v, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0, fmt.Errorf("exec: sandbox needs Landlock (Linux 5.13+, enabled): %w", errno)
+	}
+	return int(v), nil
+}
+
+// seccompSupported reports whether the sandbox helper can take the network
+// away on its own (see denyNetwork).
+const seccompSupported = true
+
+func sandboxAvailable() error {
+	_, err := landlockABI()
+	return err
+}
+
+// confine runs cmd through the sandbox helper, which sets up Landlock and
+// seccomp for itself before it execs the command; in a mount namespace,
+// where it can have one, to protect spec.ReadOnly.
+func confine(cmd *osexec.Cmd, spec sandboxSpec) error {
+	if len(spec.ReadOnly) > 0 {
+		spec.MountNS = setNamespaces(cmd, syscall.CLONE_NEWNS)
+	}
+	return wrapHelper(cmd, spec)
+}
+
+// execSandboxed confines this process to spec and execs path with argv.
+// It only returns on failure.
+func execSandboxed(spec sandboxSpec, path string, argv []string) error {
+	// Landlock, seccomp and no_new_privs apply to the calling thread,
+	// which is the one exec keeps.
+	runtime.LockOSThread()
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("no_new_privs: %w", errno)
+	}
+	if spec.MountNS {
+		if err := mountReadOnly(spec.ReadOnly); err != nil {
+			return err
+		}
+	}
+	if !spec.AnyWritable {
+		if err := landlockRestrict(spec.Writable); err != nil {
+			return err
+		}
+	}
+	if !spec.Network {
+		if err := denyNetwork(); err != nil {
+			return err
+		}
+	}
+	return syscall.Exec(path, argv, syscall.Environ())
+}
+
+// mountReadOnly bind-mounts each path onto itself read-only, in the mount
+// namespace of this process, which it first keeps from propagating mounts
+// back to ours. Paths that do not exist are skipped. It then drops the
+// ambient capabilities it was started with for that (see addNamespaces),
+// so that the command does not inherit them.
+func mountReadOnly(paths []string) error {
+	defer syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClear, 0, 0, 0, 0)
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_SLAVE, ""); err != nil {
+		return fmt.Errorf("mount namespace: %w", err)
+	}
+	for _, p := range paths {
+		err := syscall.Mount(p, p, "", syscall.MS_BIND|syscall.MS_REC, "")
+		if errors.Is(err, syscall.ENOENT) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("mount %s: %w", p, err)
+		}
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(p, &st); err != nil {
+			return fmt.Errorf("mount %s: %w", p, err)
+		}
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		flags |= uintptr(st.Flags) & stLocked
+		if st.Flags&stRelatime != 0 {
+			flags |= syscall.MS_RELATIME
+		}
+		if err := syscall.Mount("", p, "", flags, ""); err != nil {
+			return fmt.Errorf("mount %s read-only: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// landlockRestrict forbids writes outside the writable paths, which
+// are skipped if they do not exist.
+func landlockRestrict(writable []string) error {
+	abi, err := landlockABI()
+	if err != nil {
+		return err
+	}
+	var handled uint64 = landlockWriteFile | landlockRemoveDir | landlockRemoveFile |
+		landlockMakeChar | landlockMakeDir | landlockMakeReg | landlockMakeSock |
+		landlockMakeFifo | landlockMakeBlock | landlockMakeSym
+	if abi >= 2 {
+		handled |= landlockRefer
+	}
+	if abi >= 3 {
+		handled |= landlockTruncate
+	}
+	ruleset, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&handled)), unsafe.Sizeof(handled), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock ruleset: %w", errno)
+	}
+	defer syscall.Close(int(ruleset))
+	for _, p := range writable {
+		fd, err := syscall.Open(p, oPath|syscall.O_CLOEXEC, 0)
+		if errors.Is(err, syscall.ENOENT) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("landlock: %s: %w", p, err)
+		}
+		access := handled
+		var st syscall.Stat_t
+		if syscall.Fstat(fd, &st) == nil && st.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+			access &= landlockFileAccess
+		}
+		// struct landlock_path_beneath_attr is packed: u64, then s32.
+		var attr [12]byte
+		*(*uint64)(unsafe.Pointer(&attr[0])) = access
+		*(*int32)(unsafe.Pointer(&attr[8])) = int32(fd)
+		_, _, errno := syscall.Syscall6(sysLandlockAddRule, ruleset, landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0)
+		syscall.Close(fd)
+		if errno != 0 {
+			return fmt.Errorf("landlock: %s: %w", p, errno)
+		}
+	}
+	if _, _, errno := syscall.Syscall(sysLandlockRestrictSelf, ruleset, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock: %w", errno)
+	}
+	return nil
+}
+
+// denyNetwork installs a seccomp filter under which creating a socket
+// other than a Unix one fails with EPERM, as does io_uring, which can
+// create sockets too. Other architectures' system calls kill the
+// process.
+func denyNetwork() error {
+	stmt := func(code uint16, k uint32) syscall.SockFilter { return syscall.SockFilter{Code: code, K: k} }
+	jump := func(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+		return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+	const (
+		ldAbs = syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS
+		jeq   = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+		jge   = syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K
+		ret   = syscall.BPF_RET | syscall.BPF_K
+	)
+	// Offsets in struct seccomp_data: nr, arch, then the arguments (the
+	// low half of the first one, little-endian).
+	const offNr, offArch, offArg0 = 0, 4, 16
+	filter := []syscall.SockFilter{
+		stmt(ldAbs, offArch),
+		jump(jeq, auditArch, 1, 0),
+		stmt(ret, seccompRetKill),
+		stmt(ldAbs, offNr),
+		jump(jge, x32SyscallBit, 4, 0),
+		jump(jeq, sysIoUringSetup, 3, 0),
+		jump(jeq, syscall.SYS_SOCKET, 0, 3),
+		stmt(ldAbs, offArg0),
+		jump(jeq, syscall.AF_UNIX, 1, 0),
+		stmt(ret, seccompRetErrno|uint32(syscall.EPERM)),
+		stmt(ret, seccompRetAllow),
+	}
+	prog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("seccomp: %w", errno)
+	}
+	return nil
+}
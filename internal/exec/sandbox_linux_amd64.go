@@ -0,0 +1,9 @@
+package exec
+
+const (
+	// auditArch is AUDIT_ARCH_X86_64.
+	auditArch = 0xc000003e
+	// x32SyscallBit marks x32 system calls, which the seccomp filter
+	// rejects rather than tell apart.
+	x32SyscallBit = 0x40000000
+)
@@ -0,0 +1,8 @@
+package exec
+
+const (
+	// auditArch is AUDIT_ARCH_AARCH64.
+	auditArch = 0xc00000b7
+	// x32SyscallBit is x86-64's; no arm64 system call has it.
+	x32SyscallBit = 0x40000000
+)
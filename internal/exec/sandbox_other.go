@@ -0,0 +1,15 @@
+//go:build !darwin && !(linux && (amd64 || arm64))
+
+package exec
+
+import osexec "os/exec"
+
+const seccompSupported = false
+
+func sandboxAvailable() error { return ErrSandboxUnsupported }
+
+func confine(cmd *osexec.Cmd, spec sandboxSpec) error { return ErrSandboxUnsupported }
+
+func execSandboxed(spec sandboxSpec, path string, argv []string) error {
+	return ErrSandboxUnsupported
+}
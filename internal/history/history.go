@@ -0,0 +1,93 @@
+// Package history persists the prompts users submit, across sessions, in
+// <codex home>/history.jsonl so clients can offer up-arrow recall. The file
+// holds one JSON object per line, oldest first, and is only ever appended to.
+package history
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "io"
+    "os"
+    "path/filepath"
+    "sync"
+
+    "codex-go/internal/codexhome"
+)
+
+// FileName is the history file inside the codex home directory.
+const FileName = "history.jsonl"
+
+// Entry is one recorded prompt.
+type Entry struct {
+    SessionID string `json:"session_id"`
+    Ts        int64  `json:"ts"` // unix seconds
+    Text      string `json:"text"`
+}
+
+// DefaultPath returns <codex home>/history.jsonl.
+func DefaultPath() (string, error) { return codexhome.Path(FileName) }
+
+// mu serializes appends from this process. Each entry is written with a
+// single O_APPEND write, which keeps lines from concurrent processes intact.
+var mu sync.Mutex
+
+// Append adds e to the history file at path, creating it (private to the
+// user) when missing.
+func Append(path string, e Entry) error {
+    line, err := json.Marshal(e)
+    if err != nil {
+        return err
+    }
+    line = append(line, '\n')
+    mu.Lock()
+    defer mu.Unlock()
+    if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(line); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// Read returns up to limit entries starting at offset (0 is the oldest),
+// plus the total number of entries. A missing file is an empty history;
+// lines that do not decode are skipped and not counted.
+func Read(path string, offset, limit int) ([]Entry, int, error) {
+    f, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, 0, nil
+    }
+    if err != nil {
+        return nil, 0, err
+    }
+    defer f.Close()
+
+    var out []Entry
+    total := 0
+    r := bufio.NewReader(f)
+    for {
+        line, err := r.ReadBytes('\n')
+        if len(line) > 0 {
+            var e Entry
+            if json.Unmarshal(line, &e) == nil {
+                if total >= offset && len(out) < limit {
+                    out = append(out, e)
+                }
+                total++
+            }
+        }
+        if err == io.EOF {
+            return out, total, nil
+        }
+        if err != nil {
+            return nil, 0, err
+        }
+    }
+}
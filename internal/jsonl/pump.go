@@ -0,0 +1,45 @@
+package jsonl
+
+import (
+    "context"
+    "errors"
+)
+
+// FrameReader is anything that yields whole frames: *Reader, or another
+// framing such as Content-Length headers.
+type FrameReader interface {
+    ReadFrame() ([]byte, error)
+}
+
+// Frame is one result of FrameReader.ReadFrame delivered by Pump.
+type Frame struct {
+    Data []byte
+    Err  error
+}
+
+// Pump reads frames from fr on its own goroutine and delivers them on the
+// returned channel, so protocol loops can select on ctx instead of blocking
+// inside a read. *FrameTooLargeError results are delivered and reading
+// continues; any other error is delivered last and the channel is closed.
+//
+// If ctx ends while the goroutine is blocked in ReadFrame it stays blocked
+// until the underlying reader returns (e.g. stdin is closed); it never
+// delivers after ctx is done.
+func Pump(ctx context.Context, fr FrameReader) <-chan Frame {
+    ch := make(chan Frame)
+    go func() {
+        defer close(ch)
+        for {
+            data, err := fr.ReadFrame()
+            select {
+            case ch <- Frame{Data: data, Err: err}:
+            case <-ctx.Done():
+                return
+            }
+            if err != nil && !errors.Is(err, ErrFrameTooLarge) {
+                return
+            }
+        }
+    }()
+    return ch
+}
@@ -0,0 +1,99 @@
+package jsonl
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+)
+
+// DefaultMaxFrameSize is the frame limit used when none is configured. It is
+// generous enough for submissions carrying base64-encoded images.
+const DefaultMaxFrameSize = 8 << 20
+
+// ErrFrameTooLarge is matched (via errors.Is) by *FrameTooLargeError.
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// FrameTooLargeError reports a line that exceeded the configured limit. The
+// offending line has been consumed, so reading may continue with the next one.
+type FrameTooLargeError struct {
+    Limit int
+}
+
+func (e *FrameTooLargeError) Error() string {
+    return fmt.Sprintf("frame too large: exceeds %d bytes", e.Limit)
+}
+
+// Is makes errors.Is(err, ErrFrameTooLarge) succeed.
+func (e *FrameTooLargeError) Is(target error) bool { return target == ErrFrameTooLarge }
+
+// Reader reads newline-delimited frames with an upper bound on frame size.
+// Unlike bufio.Scanner it survives oversized lines: they are skipped and
+// reported as *FrameTooLargeError instead of ending the stream.
+type Reader struct {
+    br  *bufio.Reader
+    max int
+}
+
+// NewReader wraps r. A max <= 0 selects DefaultMaxFrameSize.
+func NewReader(r io.Reader, max int) *Reader {
+    if max <= 0 {
+        max = DefaultMaxFrameSize
+    }
+    return &Reader{br: bufio.NewReaderSize(r, 64<<10), max: max}
+}
+
+// Max returns the effective frame size limit.
+func (r *Reader) Max() int { return r.max }
+
+// ReadFrame returns the next line without its trailing "\n" (or "\r\n").
+// A final line without a newline is returned before io.EOF.
+func (r *Reader) ReadFrame() ([]byte, error) {
+    var (
+        buf      []byte
+        tooLarge bool
+    )
+    for {
+        chunk, err := r.br.ReadSlice('\n')
+        if !tooLarge {
+            if len(buf)+len(chunk) > r.max+2 { // allow for the line terminator
+                tooLarge = true
+                buf = nil
+            } else {
+                buf = append(buf, chunk...)
+            }
+        }
+        switch {
+        case err == bufio.ErrBufferFull:
+            continue
+        case err == io.EOF:
+            if tooLarge {
+                return nil, &FrameTooLargeError{Limit: r.max}
+            }
+            if len(buf) == 0 {
+                return nil, io.EOF
+            }
+            return trimEOL(buf), nil
+        case err != nil:
+            return nil, err
+        }
+        if tooLarge {
+            return nil, &FrameTooLargeError{Limit: r.max}
+        }
+        line := trimEOL(buf)
+        if len(line) > r.max {
+            return nil, &FrameTooLargeError{Limit: r.max}
+        }
+        return line, nil
+    }
+}
+
+func trimEOL(b []byte) []byte {
+    if n := len(b); n > 0 && b[n-1] == '\n' {
+        b = b[:n-1]
+    }
+    if n := len(b); n > 0 && b[n-1] == '\r' {
+        b = b[:n-1]
+    }
+    return b
+}
@@ -0,0 +1,184 @@
+// Package jsonrepair recovers JSON objects from the slightly malformed
+// text models sometimes produce for tool-call arguments: a Markdown fence
+// around the object, raw control characters (newlines, tabs) inside
+// strings, trailing commas, mismatched or missing closing brackets, an
+// unterminated string at the end of a truncated stream, and garbage (such
+// as a repeated object) after the object ends.
+package jsonrepair
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// ErrNotObject is returned for text that does not start a JSON object.
+var ErrNotObject = errors.New("not a JSON object")
+
+// Object returns s as a valid JSON object. Valid input is returned as is
+// with repaired false; blank input is the empty object. Otherwise the
+// repairs described in the package comment are tried, and an error
+// returned when the result still does not parse.
+func Object(s string) (out string, repaired bool, err error) {
+    t := strings.TrimSpace(s)
+    if t == "" {
+        return "{}", false, nil
+    }
+    if isObject(t) {
+        return s, false, nil
+    }
+    t = stripFence(t)
+    if !strings.HasPrefix(t, "{") {
+        return "", false, ErrNotObject
+    }
+    fixed := repair(t)
+    if !isObject(fixed) {
+        return "", false, fmt.Errorf("malformed JSON object that could not be repaired: %s", excerpt(t))
+    }
+    return fixed, true, nil
+}
+
+func isObject(s string) bool {
+    var m map[string]json.RawMessage
+    return json.Unmarshal([]byte(s), &m) == nil && m != nil
+}
+
+// stripFence removes a ```json ... ``` fence around t.
+func stripFence(t string) string {
+    if !strings.HasPrefix(t, "```") {
+        return t
+    }
+    if i := strings.IndexByte(t, '\n'); i >= 0 {
+        t = t[i+1:]
+    } else {
+        t = strings.TrimPrefix(t, "```")
+    }
+    return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(t), "```"))
+}
+
+// repair rewrites t, which starts with '{', into what is most likely the
+// object meant. The result may still be invalid.
+func repair(t string) string {
+    var out bytes.Buffer
+    var stack []byte // open brackets
+    inString, escaped := false, false
+scan:
+    for i := 0; i < len(t); i++ {
+        c := t[i]
+        if inString {
+            switch {
+            case escaped:
+                escaped = false
+                out.WriteByte(c)
+            case c == '\\':
+                escaped = true
+                out.WriteByte(c)
+            case c == '"':
+                inString = false
+                out.WriteByte(c)
+            case c < 0x20:
+                out.WriteString(escapeControl(c))
+            default:
+                out.WriteByte(c)
+            }
+            continue
+        }
+        switch c {
+        case '"':
+            inString = true
+            out.WriteByte(c)
+        case '{', '[':
+            stack = append(stack, c)
+            out.WriteByte(c)
+        case '}', ']':
+            open := byte('{')
+            if c == ']' {
+                open = '['
+            }
+            // Close brackets left open inside this one.
+            for len(stack) > 0 && stack[len(stack)-1] != open {
+                closeTop(&out, &stack)
+            }
+            if len(stack) == 0 {
+                break scan
+            }
+            closeTop(&out, &stack)
+            if len(stack) == 0 {
+                // The object is complete; the rest is garbage.
+                break scan
+            }
+        default:
+            out.WriteByte(c)
+        }
+    }
+    if inString {
+        if escaped {
+            out.Truncate(out.Len() - 1)
+        }
+        out.WriteByte('"')
+    }
+    if len(stack) == 0 {
+        return out.String()
+    }
+
+    // A truncated stream: finish the member in progress, then close
+    // everything still open.
+    body := bytes.TrimRight(out.Bytes(), " \t\r\n")
+    switch {
+    case bytes.HasSuffix(body, []byte(",")):
+        body = body[:len(body)-1]
+    case bytes.HasSuffix(body, []byte(":")):
+        body = append(body, "null"...)
+    }
+    for _, suffix := range []string{"", ":null"} {
+        b := bytes.NewBuffer(append(append([]byte{}, body...), suffix...))
+        st := append([]byte{}, stack...)
+        for len(st) > 0 {
+            closeTop(b, &st)
+        }
+        if json.Valid(b.Bytes()) || stack[len(stack)-1] != '{' {
+            return b.String()
+        }
+    }
+    return string(body)
+}
+
+// closeTop writes the closing bracket of the innermost open one, dropping
+// a trailing comma before it, and pops it.
+func closeTop(out *bytes.Buffer, stack *[]byte) {
+    b := bytes.TrimRight(out.Bytes(), " \t\r\n")
+    if bytes.HasSuffix(b, []byte(",")) {
+        out.Truncate(len(b) - 1)
+    }
+    top := (*stack)[len(*stack)-1]
+    *stack = (*stack)[:len(*stack)-1]
+    if top == '{' {
+        out.WriteByte('}')
+    } else {
+        out.WriteByte(']')
+    }
+}
+
+// escapeControl returns the JSON escape of a control character.
+func escapeControl(c byte) string {
+    switch c {
+    case '\n':
+        return `\n`
+    case '\r':
+        return `\r`
+    case '\t':
+        return `\t`
+    }
+    return fmt.Sprintf(`\u%04x`, c)
+}
+
+// excerpt shortens t for an error message.
+func excerpt(t string) string {
+    const max = 80
+    if len(t) <= max {
+        return t
+    }
+    return t[:max] + "..."
+}
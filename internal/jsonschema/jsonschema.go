@@ -0,0 +1,490 @@
+// Package jsonschema validates JSON values against a JSON Schema. It covers
+// the keywords model-facing schemas use: type, enum, const, properties,
+// required, additionalProperties, items, the length, size and range bounds,
+// pattern, allOf/anyOf/oneOf/not and local $ref ("#/$defs/..."). Other
+// keywords, format among them, are ignored.
+package jsonschema
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "math"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Schema is a parsed schema, ready to validate values.
+type Schema struct {
+    root     any
+    patterns map[string]*regexp.Regexp
+}
+
+// ValidationError reports the first place a value breaks the schema.
+type ValidationError struct {
+    // Path locates the offending value, like $.items[2].name.
+    Path    string
+    Message string
+}
+
+func (e *ValidationError) Error() string { return e.Path + ": " + e.Message }
+
+// Compile parses a schema. It fails on malformed JSON, a schema that is
+// neither an object nor a boolean, a keyword of the wrong kind, a pattern
+// that is not a valid regular expression and an unresolvable $ref.
+func Compile(data []byte) (*Schema, error) {
+    root, err := decode(data)
+    if err != nil {
+        return nil, fmt.Errorf("schema: %w", err)
+    }
+    s := &Schema{root: root, patterns: map[string]*regexp.Regexp{}}
+    if err := s.check(root, "#"); err != nil {
+        return nil, fmt.Errorf("schema: %w", err)
+    }
+    return s, nil
+}
+
+// MustCompile is like Compile but panics on error, for schemas built into
+// the program.
+func MustCompile(data string) *Schema {
+    s, err := Compile([]byte(data))
+    if err != nil {
+        panic(err)
+    }
+    return s
+}
+
+// Validate checks the JSON document data against the schema.
+func (s *Schema) Validate(data []byte) error {
+    v, err := decode(data)
+    if err != nil {
+        return &ValidationError{Path: "$", Message: "not valid JSON: " + err.Error()}
+    }
+    return s.validate(s.root, v, "$", 0)
+}
+
+// decode parses one JSON value, keeping numbers exact.
+func decode(data []byte) (any, error) {
+    d := json.NewDecoder(bytes.NewReader(data))
+    d.UseNumber()
+    var v any
+    if err := d.Decode(&v); err != nil {
+        return nil, err
+    }
+    if d.More() {
+        return nil, fmt.Errorf("unexpected data after the value")
+    }
+    return v, nil
+}
+
+// maxDepth bounds $ref indirection, so a schema referring to itself
+// cannot recurse forever.
+const maxDepth = 64
+
+// check walks a schema node at pointer ptr.
+func (s *Schema) check(node any, ptr string) error {
+    if _, ok := node.(bool); ok {
+        return nil
+    }
+    m, ok := node.(map[string]any)
+    if !ok {
+        return fmt.Errorf("%s: a schema must be an object or a boolean", ptr)
+    }
+    if ref, ok := m["$ref"]; ok {
+        r, ok := ref.(string)
+        if !ok {
+            return fmt.Errorf("%s/$ref: must be a string", ptr)
+        }
+        if _, err := s.resolve(r); err != nil {
+            return fmt.Errorf("%s/$ref: %w", ptr, err)
+        }
+    }
+    if t, ok := m["type"]; ok {
+        names, ok := typeNames(t)
+        if !ok {
+            return fmt.Errorf("%s/type: must be a type name or a list of them", ptr)
+        }
+        for _, n := range names {
+            switch n {
+            case "null", "boolean", "object", "array", "number", "integer", "string":
+            default:
+                return fmt.Errorf("%s/type: unknown type %q", ptr, n)
+            }
+        }
+    }
+    if p, ok := m["pattern"]; ok {
+        src, ok := p.(string)
+        if !ok {
+            return fmt.Errorf("%s/pattern: must be a string", ptr)
+        }
+        re, err := regexp.Compile(src)
+        if err != nil {
+            return fmt.Errorf("%s/pattern: %w", ptr, err)
+        }
+        s.patterns[src] = re
+    }
+    if r, ok := m["required"]; ok {
+        list, ok := r.([]any)
+        for _, x := range list {
+            if _, isString := x.(string); !isString {
+                ok = false
+            }
+        }
+        if !ok {
+            return fmt.Errorf("%s/required: must be a list of strings", ptr)
+        }
+    }
+    for _, kw := range []string{"minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties", "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum"} {
+        if x, ok := m[kw]; ok {
+            if _, ok := x.(json.Number); !ok {
+                return fmt.Errorf("%s/%s: must be a number", ptr, kw)
+            }
+        }
+    }
+    for _, kw := range []string{"properties", "$defs", "definitions"} {
+        if x, ok := m[kw]; ok {
+            props, ok := x.(map[string]any)
+            if !ok {
+                return fmt.Errorf("%s/%s: must be an object", ptr, kw)
+            }
+            for name, sub := range props {
+                if err := s.check(sub, ptr+"/"+kw+"/"+name); err != nil {
+                    return err
+                }
+            }
+        }
+    }
+    for _, kw := range []string{"additionalProperties", "items", "not"} {
+        if sub, ok := m[kw]; ok {
+            if err := s.check(sub, ptr+"/"+kw); err != nil {
+                return err
+            }
+        }
+    }
+    for _, kw := range []string{"allOf", "anyOf", "oneOf"} {
+        if x, ok := m[kw]; ok {
+            list, ok := x.([]any)
+            if !ok || len(list) == 0 {
+                return fmt.Errorf("%s/%s: must be a non-empty list of schemas", ptr, kw)
+            }
+            for i, sub := range list {
+                if err := s.check(sub, fmt.Sprintf("%s/%s/%d", ptr, kw, i)); err != nil {
+                    return err
+                }
+            }
+        }
+    }
+    return nil
+}
+
+// resolve follows a local reference: "#" or a JSON pointer below it.
+func (s *Schema) resolve(ref string) (any, error) {
+    if ref != "#" && !strings.HasPrefix(ref, "#/") {
+        return nil, fmt.Errorf("only local references are supported: %q", ref)
+    }
+    node := s.root
+    for _, tok := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+        tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+        switch n := node.(type) {
+        case map[string]any:
+            next, ok := n[tok]
+            if !ok {
+                return nil, fmt.Errorf("%q not found", ref)
+            }
+            node = next
+        case []any:
+            i, err := strconv.Atoi(tok)
+            if err != nil || i < 0 || i >= len(n) {
+                return nil, fmt.Errorf("%q not found", ref)
+            }
+            node = n[i]
+        default:
+            return nil, fmt.Errorf("%q not found", ref)
+        }
+    }
+    return node, nil
+}
+
+func (s *Schema) validate(node, v any, path string, depth int) error {
+    fail := func(format string, args ...any) error {
+        return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+    }
+    if b, ok := node.(bool); ok {
+        if !b {
+            return fail("no value is allowed here")
+        }
+        return nil
+    }
+    m := node.(map[string]any)
+
+    if ref, ok := m["$ref"].(string); ok {
+        if depth >= maxDepth {
+            return fail("$ref nesting is too deep")
+        }
+        target, _ := s.resolve(ref)
+        if err := s.validate(target, v, path, depth+1); err != nil {
+            return err
+        }
+    }
+    if t, ok := m["type"]; ok {
+        names, _ := typeNames(t)
+        matched := false
+        for _, n := range names {
+            if hasType(v, n) {
+                matched = true
+                break
+            }
+        }
+        if !matched {
+            return fail("expected %s, got %s", strings.Join(names, " or "), typeOf(v))
+        }
+    }
+    if c, ok := m["const"]; ok && !equal(c, v) {
+        return fail("must be %s", compact(c))
+    }
+    if e, ok := m["enum"].([]any); ok {
+        found := false
+        for _, x := range e {
+            if equal(x, v) {
+                found = true
+                break
+            }
+        }
+        if !found {
+            vals := make([]string, len(e))
+            for i, x := range e {
+                vals[i] = compact(x)
+            }
+            return fail("must be one of %s", strings.Join(vals, ", "))
+        }
+    }
+
+    switch v := v.(type) {
+    case string:
+        n := utf8.RuneCountInString(v)
+        if lim, ok := bound(m, "minLength"); ok && float64(n) < lim {
+            return fail("must be at least %v characters long", lim)
+        }
+        if lim, ok := bound(m, "maxLength"); ok && float64(n) > lim {
+            return fail("must be at most %v characters long", lim)
+        }
+        if p, ok := m["pattern"].(string); ok && !s.patterns[p].MatchString(v) {
+            return fail("must match %q", p)
+        }
+    case json.Number:
+        f, _ := v.Float64()
+        if lim, ok := bound(m, "minimum"); ok && f < lim {
+            return fail("must be >= %v", lim)
+        }
+        if lim, ok := bound(m, "maximum"); ok && f > lim {
+            return fail("must be <= %v", lim)
+        }
+        if lim, ok := bound(m, "exclusiveMinimum"); ok && f <= lim {
+            return fail("must be > %v", lim)
+        }
+        if lim, ok := bound(m, "exclusiveMaximum"); ok && f >= lim {
+            return fail("must be < %v", lim)
+        }
+    case []any:
+        if lim, ok := bound(m, "minItems"); ok && float64(len(v)) < lim {
+            return fail("must have at least %v items", lim)
+        }
+        if lim, ok := bound(m, "maxItems"); ok && float64(len(v)) > lim {
+            return fail("must have at most %v items", lim)
+        }
+        if items, ok := m["items"]; ok {
+            for i, x := range v {
+                if err := s.validate(items, x, fmt.Sprintf("%s[%d]", path, i), depth); err != nil {
+                    return err
+                }
+            }
+        }
+    case map[string]any:
+        if lim, ok := bound(m, "minProperties"); ok && float64(len(v)) < lim {
+            return fail("must have at least %v properties", lim)
+        }
+        if lim, ok := bound(m, "maxProperties"); ok && float64(len(v)) > lim {
+            return fail("must have at most %v properties", lim)
+        }
+        if req, ok := m["required"].([]any); ok {
+            for _, r := range req {
+                if _, ok := v[r.(string)]; !ok {
+                    return fail("missing required property %q", r)
+                }
+            }
+        }
+        props, _ := m["properties"].(map[string]any)
+        extra, hasExtra := m["additionalProperties"]
+        // Visit properties in order so the reported error is stable.
+        names := make([]string, 0, len(v))
+        for name := range v {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        for _, name := range names {
+            sub, ok := props[name]
+            if !ok {
+                if !hasExtra {
+                    continue
+                }
+                if b, ok := extra.(bool); ok && !b {
+                    return fail("unexpected property %q", name)
+                }
+                sub = extra
+            }
+            if err := s.validate(sub, v[name], path+"."+name, depth); err != nil {
+                return err
+            }
+        }
+    }
+
+    if all, ok := m["allOf"].([]any); ok {
+        for _, sub := range all {
+            if err := s.validate(sub, v, path, depth); err != nil {
+                return err
+            }
+        }
+    }
+    if anyOf, ok := m["anyOf"].([]any); ok {
+        var first error
+        for _, sub := range anyOf {
+            err := s.validate(sub, v, path, depth)
+            if err == nil {
+                first = nil
+                break
+            }
+            if first == nil {
+                first = err
+            }
+        }
+        if first != nil {
+            return fail("matches none of anyOf (first: %v)", first)
+        }
+    }
+    if oneOf, ok := m["oneOf"].([]any); ok {
+        n := 0
+        for _, sub := range oneOf {
+            if s.validate(sub, v, path, depth) == nil {
+                n++
+            }
+        }
+        if n != 1 {
+            return fail("must match exactly one of oneOf, matches %d", n)
+        }
+    }
+    if not, ok := m["not"]; ok && s.validate(not, v, path, depth) == nil {
+        return fail("must not match the schema under not")
+    }
+    return nil
+}
+
+// typeNames returns the names of a type keyword: one name or a list.
+func typeNames(t any) ([]string, bool) {
+    switch t := t.(type) {
+    case string:
+        return []string{t}, true
+    case []any:
+        names := make([]string, 0, len(t))
+        for _, x := range t {
+            n, ok := x.(string)
+            if !ok {
+                return nil, false
+            }
+            names = append(names, n)
+        }
+        return names, len(names) > 0
+    }
+    return nil, false
+}
+
+func hasType(v any, name string) bool {
+    switch name {
+    case "integer":
+        n, ok := v.(json.Number)
+        if !ok {
+            return false
+        }
+        f, err := n.Float64()
+        return err == nil && f == math.Trunc(f)
+    case "number":
+        _, ok := v.(json.Number)
+        return ok
+    }
+    return typeOf(v) == name
+}
+
+func typeOf(v any) string {
+    switch v.(type) {
+    case nil:
+        return "null"
+    case bool:
+        return "boolean"
+    case json.Number:
+        return "number"
+    case string:
+        return "string"
+    case []any:
+        return "array"
+    }
+    return "object"
+}
+
+// bound returns the numeric keyword kw of schema m.
+func bound(m map[string]any, kw string) (float64, bool) {
+    n, ok := m[kw].(json.Number)
+    if !ok {
+        return 0, false
+    }
+    f, err := n.Float64()
+    return f, err == nil
+}
+
+// equal compares decoded JSON values; numbers compare by value.
+func equal(a, b any) bool {
+    switch a := a.(type) {
+    case json.Number:
+        bn, ok := b.(json.Number)
+        if !ok {
+            return false
+        }
+        fa, _ := a.Float64()
+        fb, _ := bn.Float64()
+        return fa == fb
+    case []any:
+        bl, ok := b.([]any)
+        if !ok || len(a) != len(bl) {
+            return false
+        }
+        for i := range a {
+            if !equal(a[i], bl[i]) {
+                return false
+            }
+        }
+        return true
+    case map[string]any:
+        bm, ok := b.(map[string]any)
+        if !ok || len(a) != len(bm) {
+            return false
+        }
+        for k, x := range a {
+            y, ok := bm[k]
+            if !ok || !equal(x, y) {
+                return false
+            }
+        }
+        return true
+    }
+    return a == b
+}
+
+// compact renders a decoded value as JSON for messages.
+func compact(v any) string {
+    b, err := json.Marshal(v)
+    if err != nil {
+        return fmt.Sprint(v)
+    }
+    return string(b)
+}
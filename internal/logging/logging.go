@@ -0,0 +1,38 @@
+package logging
+
+import (
+    "fmt"
+    "io"
+    "log/slog"
+    "strings"
+)
+
+// ParseLevel maps a level name (debug, info, warn/warning, error) to a
+// slog.Level. Matching is case-insensitive.
+func ParseLevel(s string) (slog.Level, error) {
+    switch strings.ToLower(strings.TrimSpace(s)) {
+    case "debug":
+        return slog.LevelDebug, nil
+    case "", "info":
+        return slog.LevelInfo, nil
+    case "warn", "warning":
+        return slog.LevelWarn, nil
+    case "error":
+        return slog.LevelError, nil
+    default:
+        return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", s)
+    }
+}
+
+// New returns a text logger writing to w. The returned LevelVar controls the
+// minimum level and may be changed at runtime.
+func New(w io.Writer, level slog.Level) (*slog.Logger, *slog.LevelVar) {
+    lv := new(slog.LevelVar)
+    lv.Set(level)
+    return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: lv})), lv
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+    return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.Level(1 << 20)}))
+}
@@ -0,0 +1,253 @@
+package mcpclient
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strconv"
+    "sync"
+    "sync/atomic"
+
+    "codex-go/internal/version"
+)
+
+// ErrClosed is returned for calls made after the connection went away.
+var ErrClosed = errors.New("mcp client closed")
+
+// transport moves encoded frames to the server. Incoming frames are handed
+// to the Client via its deliver method by the transport implementation.
+type transport interface {
+    send(ctx context.Context, frame []byte) error
+    close() error
+}
+
+// NotificationHandler receives server notifications (method + raw params).
+type NotificationHandler func(method string, params json.RawMessage)
+
+// Client is a connection to one external MCP server.
+type Client struct {
+    t      transport
+    nextID atomic.Int64
+
+    mu      sync.Mutex
+    pending map[int64]chan message
+    closed  bool
+    err     error // why the connection closed
+
+    onNotify NotificationHandler
+    server   *InitializeResult
+}
+
+func newClient(onNotify NotificationHandler) *Client {
+    return &Client{pending: map[int64]chan message{}, onNotify: onNotify}
+}
+
+// ServerInfo returns the initialize result, or nil before Initialize.
+func (c *Client) ServerInfo() *InitializeResult {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.server
+}
+
+// Close shuts down the transport and fails pending calls.
+func (c *Client) Close() error {
+    err := c.t.close()
+    c.shutdown(ErrClosed)
+    return err
+}
+
+// shutdown marks the client closed and wakes every pending call.
+func (c *Client) shutdown(cause error) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.closed {
+        return
+    }
+    c.closed = true
+    c.err = cause
+    for id, ch := range c.pending {
+        close(ch)
+        delete(c.pending, id)
+    }
+}
+
+// deliver routes one incoming frame. It is called by transports.
+func (c *Client) deliver(frame []byte) {
+    var msgs []message
+    if len(frame) > 0 && frame[0] == '[' {
+        if json.Unmarshal(frame, &msgs) != nil {
+            return
+        }
+    } else {
+        var m message
+        if json.Unmarshal(frame, &m) != nil {
+            return
+        }
+        msgs = []message{m}
+    }
+    for _, m := range msgs {
+        switch {
+        case m.Method != "" && len(m.ID) > 0:
+            c.answerServerRequest(m)
+        case m.Method != "":
+            if c.onNotify != nil {
+                c.onNotify(m.Method, m.Params)
+            }
+        default:
+            id, err := strconv.ParseInt(string(m.ID), 10, 64)
+            if err != nil {
+                continue
+            }
+            c.mu.Lock()
+            ch, ok := c.pending[id]
+            delete(c.pending, id)
+            c.mu.Unlock()
+            if ok {
+                ch <- m
+            }
+        }
+    }
+}
+
+// answerServerRequest replies to server-initiated requests. We answer ping
+// and decline everything else (sampling, roots, elicitation).
+func (c *Client) answerServerRequest(m message) {
+    r := reply{JSONRPC: "2.0", ID: m.ID}
+    if m.Method == "ping" {
+        r.Result = struct{}{}
+    } else {
+        r.Error = &RPCError{Code: -32601, Message: "method not found: " + m.Method}
+    }
+    b, err := json.Marshal(r)
+    if err != nil {
+        return
+    }
+    go func() { _ = c.t.send(context.Background(), b) }()
+}
+
+// call sends a request and waits for its response, decoding the result
+// into out (which may be nil).
+func (c *Client) call(ctx context.Context, method string, params any, out any) error {
+    id := c.nextID.Add(1)
+    ch := make(chan message, 1)
+    c.mu.Lock()
+    if c.closed {
+        err := c.err
+        c.mu.Unlock()
+        return err
+    }
+    c.pending[id] = ch
+    c.mu.Unlock()
+
+    b, err := json.Marshal(outgoing{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+    if err != nil {
+        return err
+    }
+    if err := c.t.send(ctx, b); err != nil {
+        c.mu.Lock()
+        delete(c.pending, id)
+        c.mu.Unlock()
+        return err
+    }
+
+    select {
+    case <-ctx.Done():
+        c.mu.Lock()
+        delete(c.pending, id)
+        c.mu.Unlock()
+        // Tell the server we gave up so it can stop working on it.
+        _ = c.notify(context.Background(), "notifications/cancelled", map[string]any{"requestId": id, "reason": ctx.Err().Error()})
+        return ctx.Err()
+    case m, ok := <-ch:
+        if !ok {
+            c.mu.Lock()
+            err := c.err
+            c.mu.Unlock()
+            return err
+        }
+        if m.Error != nil {
+            return m.Error
+        }
+        if out != nil && len(m.Result) > 0 {
+            if err := json.Unmarshal(m.Result, out); err != nil {
+                return fmt.Errorf("decode %s result: %w", method, err)
+            }
+        }
+        return nil
+    }
+}
+
+// notify sends a notification.
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+    b, err := json.Marshal(outgoing{JSONRPC: "2.0", Method: method, Params: params})
+    if err != nil {
+        return err
+    }
+    return c.t.send(ctx, b)
+}
+
+// Initialize performs the MCP handshake (initialize request followed by the
+// notifications/initialized notification).
+func (c *Client) Initialize(ctx context.Context) (*InitializeResult, error) {
+    params := map[string]any{
+        "protocolVersion": ProtocolVersion,
+        "capabilities":    map[string]any{},
+        "clientInfo":      Implementation{Name: "codex-go", Version: version.Version},
+    }
+    var res InitializeResult
+    if err := c.call(ctx, "initialize", params, &res); err != nil {
+        return nil, err
+    }
+    if err := c.notify(ctx, "notifications/initialized", nil); err != nil {
+        return nil, err
+    }
+    c.mu.Lock()
+    c.server = &res
+    c.mu.Unlock()
+    return &res, nil
+}
+
+// ListTools returns every tool the server offers, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+    var (
+        all    []Tool
+        cursor string
+    )
+    for {
+        var params any
+        if cursor != "" {
+            params = map[string]string{"cursor": cursor}
+        }
+        var page struct {
+            Tools      []Tool `json:"tools"`
+            NextCursor string `json:"nextCursor"`
+        }
+        if err := c.call(ctx, "tools/list", params, &page); err != nil {
+            return nil, err
+        }
+        all = append(all, page.Tools...)
+        if page.NextCursor == "" || page.NextCursor == cursor {
+            return all, nil
+        }
+        cursor = page.NextCursor
+    }
+}
+
+// CallTool invokes a tool with the given JSON arguments (nil for none).
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (*CallToolResult, error) {
+    params := map[string]any{"name": name}
+    if len(args) > 0 {
+        params["arguments"] = args
+    }
+    var res CallToolResult
+    if err := c.call(ctx, "tools/call", params, &res); err != nil {
+        return nil, err
+    }
+    return &res, nil
+}
+
+// Ping checks that the server is responsive.
+func (c *Client) Ping(ctx context.Context) error {
+    return c.call(ctx, "ping", nil, nil)
+}
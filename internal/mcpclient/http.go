@@ -0,0 +1,155 @@
+package mcpclient
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "sync"
+)
+
+// HTTPOptions configures a connection to a streamable-HTTP MCP server.
+type HTTPOptions struct {
+    // BearerToken, when set, is sent as "Authorization: Bearer <token>".
+    BearerToken string
+    // Header holds extra request headers.
+    Header http.Header
+    // Client is the HTTP client to use. nil means http.DefaultClient.
+    Client *http.Client
+    // OnNotify receives server notifications. May be nil.
+    OnNotify NotificationHandler
+}
+
+// httpTransport POSTs each frame and feeds the JSON or SSE response back to
+// the client.
+type httpTransport struct {
+    url  string
+    opts HTTPOptions
+    c    *Client
+
+    mu        sync.Mutex
+    sessionID string
+}
+
+// DialHTTP returns a client for the MCP endpoint at url. No request is sent
+// until Initialize.
+func DialHTTP(url string, opts HTTPOptions) *Client {
+    if opts.Client == nil {
+        opts.Client = http.DefaultClient
+    }
+    c := newClient(opts.OnNotify)
+    c.t = &httpTransport{url: url, opts: opts, c: c}
+    return c
+}
+
+func (t *httpTransport) send(ctx context.Context, frame []byte) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(frame))
+    if err != nil {
+        return err
+    }
+    for k, vs := range t.opts.Header {
+        for _, v := range vs {
+            req.Header.Add(k, v)
+        }
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("Accept", "application/json, text/event-stream")
+    if t.opts.BearerToken != "" {
+        req.Header.Set("Authorization", "Bearer "+t.opts.BearerToken)
+    }
+    t.mu.Lock()
+    if t.sessionID != "" {
+        req.Header.Set("Mcp-Session-Id", t.sessionID)
+    }
+    t.mu.Unlock()
+
+    resp, err := t.opts.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+        t.mu.Lock()
+        t.sessionID = id
+        t.mu.Unlock()
+    }
+    if resp.StatusCode == http.StatusAccepted {
+        return nil
+    }
+    if resp.StatusCode/100 != 2 {
+        body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+        // JSON-RPC errors may come with non-2xx statuses (e.g. 401); let the
+        // pending call see them when the body is a response frame.
+        if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+            t.c.deliver(bytes.TrimSpace(body))
+        }
+        return fmt.Errorf("mcp http %s: %s", resp.Status, strings.TrimSpace(string(body)))
+    }
+
+    if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+        return readSSE(resp.Body, t.c.deliver)
+    }
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return err
+    }
+    if b := bytes.TrimSpace(body); len(b) > 0 {
+        t.c.deliver(b)
+    }
+    return nil
+}
+
+// readSSE parses a text/event-stream body and delivers each event's data.
+func readSSE(r io.Reader, deliver func([]byte)) error {
+    sc := bufio.NewScanner(r)
+    sc.Buffer(make([]byte, 64<<10), 16<<20)
+    var data bytes.Buffer
+    flush := func() {
+        if data.Len() > 0 {
+            deliver(bytes.Clone(data.Bytes()))
+            data.Reset()
+        }
+    }
+    for sc.Scan() {
+        line := sc.Text()
+        switch {
+        case line == "":
+            flush()
+        case strings.HasPrefix(line, "data:"):
+            if data.Len() > 0 {
+                data.WriteByte('\n')
+            }
+            data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+        }
+    }
+    flush()
+    return sc.Err()
+}
+
+// close terminates the server-side session, if one was assigned.
+func (t *httpTransport) close() error {
+    t.mu.Lock()
+    id := t.sessionID
+    t.mu.Unlock()
+    if id == "" {
+        return nil
+    }
+    req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Mcp-Session-Id", id)
+    if t.opts.BearerToken != "" {
+        req.Header.Set("Authorization", "Bearer "+t.opts.BearerToken)
+    }
+    resp, err := t.opts.Client.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
@@ -0,0 +1,106 @@
+package mcpclient
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    osexec "os/exec"
+    "sync"
+
+    "codex-go/internal/jsonl"
+)
+
+// StdioOptions configures a server spawned as a child process.
+type StdioOptions struct {
+    // Env entries (KEY=VALUE) added to the inherited environment.
+    Env []string
+    // Cwd is the child's working directory. Empty means inherit.
+    Cwd string
+    // Stderr receives the child's stderr. nil discards it.
+    Stderr io.Writer
+    // OnNotify receives server notifications. May be nil.
+    OnNotify NotificationHandler
+}
+
+// stdioTransport speaks newline-delimited JSON over a child's stdin/stdout.
+type stdioTransport struct {
+    cmd   *osexec.Cmd
+    stdin io.WriteCloser
+
+    wmu  sync.Mutex
+    once sync.Once
+}
+
+// StartStdio spawns command with args and connects to it over stdio. The
+// handshake is not performed; call Initialize next.
+func StartStdio(command string, args []string, opts StdioOptions) (*Client, error) {
+    cmd := osexec.Command(command, args...)
+    cmd.Dir = opts.Cwd
+    if len(opts.Env) > 0 {
+        cmd.Env = append(os.Environ(), opts.Env...)
+    }
+    if opts.Stderr != nil {
+        cmd.Stderr = opts.Stderr
+    }
+    stdin, err := cmd.StdinPipe()
+    if err != nil {
+        return nil, err
+    }
+    stdout, err := cmd.StdoutPipe()
+    if err != nil {
+        return nil, err
+    }
+    if err := cmd.Start(); err != nil {
+        return nil, fmt.Errorf("start mcp server %q: %w", command, err)
+    }
+
+    c := newClient(opts.OnNotify)
+    t := &stdioTransport{cmd: cmd, stdin: stdin}
+    c.t = t
+
+    go func() {
+        fr := jsonl.NewReader(stdout, 0)
+        for {
+            frame, err := fr.ReadFrame()
+            if errors.Is(err, jsonl.ErrFrameTooLarge) {
+                continue
+            }
+            if err != nil {
+                break
+            }
+            if len(frame) > 0 {
+                c.deliver(frame)
+            }
+        }
+        werr := cmd.Wait()
+        if werr == nil {
+            werr = errors.New("mcp server exited")
+        } else {
+            werr = fmt.Errorf("mcp server exited: %w", werr)
+        }
+        c.shutdown(werr)
+    }()
+    return c, nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, frame []byte) error {
+    t.wmu.Lock()
+    defer t.wmu.Unlock()
+    _, err := t.stdin.Write(append(frame, '\n'))
+    return err
+}
+
+// close ends the child's stdin (the polite way to stop a stdio server) and
+// kills it if it is still around.
+func (t *stdioTransport) close() error {
+    var err error
+    t.once.Do(func() {
+        err = t.stdin.Close()
+        if t.cmd.Process != nil {
+            _ = t.cmd.Process.Kill()
+        }
+    })
+    return err
+}
@@ -0,0 +1,84 @@
+package mcpclient
+
+import (
+    "encoding/json"
+    "fmt"
+)
+
+// ProtocolVersion is the MCP revision requested during initialize.
+const ProtocolVersion = "2025-06-18"
+
+// Implementation identifies a client or server (name + version).
+type Implementation struct {
+    Name    string `json:"name"`
+    Version string `json:"version"`
+}
+
+// InitializeResult is the server half of the handshake.
+type InitializeResult struct {
+    ProtocolVersion string          `json:"protocolVersion"`
+    Capabilities    json.RawMessage `json:"capabilities"`
+    ServerInfo      Implementation  `json:"serverInfo"`
+    Instructions    string          `json:"instructions,omitempty"`
+}
+
+// Tool is a tool advertised by a server's tools/list.
+type Tool struct {
+    Name        string          `json:"name"`
+    Description string          `json:"description,omitempty"`
+    InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// ContentBlock is one piece of tool output. Text blocks set Text; image and
+// audio blocks set Data (base64) and MimeType; embedded resources keep their
+// raw JSON in Resource.
+type ContentBlock struct {
+    Type     string          `json:"type"`
+    Text     string          `json:"text,omitempty"`
+    Data     string          `json:"data,omitempty"`
+    MimeType string          `json:"mimeType,omitempty"`
+    Resource json.RawMessage `json:"resource,omitempty"`
+}
+
+// CallToolResult is the result of tools/call.
+type CallToolResult struct {
+    Content           []ContentBlock  `json:"content"`
+    StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+    IsError           bool            `json:"isError,omitempty"`
+}
+
+// RPCError is a JSON-RPC error returned by the server.
+type RPCError struct {
+    Code    int             `json:"code"`
+    Message string          `json:"message"`
+    Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string { return fmt.Sprintf("mcp server error %d: %s", e.Code, e.Message) }
+
+// message is any incoming JSON-RPC frame: a response (ID + Result/Error), a
+// notification (Method, no ID) or a server-to-client request (both).
+type message struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id,omitempty"`
+    Method  string          `json:"method,omitempty"`
+    Params  json.RawMessage `json:"params,omitempty"`
+    Result  json.RawMessage `json:"result,omitempty"`
+    Error   *RPCError       `json:"error,omitempty"`
+}
+
+// outgoing is a request or notification we send.
+type outgoing struct {
+    JSONRPC string `json:"jsonrpc"`
+    ID      *int64 `json:"id,omitempty"`
+    Method  string `json:"method"`
+    Params  any    `json:"params,omitempty"`
+}
+
+// reply is our response to a server-to-client request.
+type reply struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id"`
+    Result  any             `json:"result,omitempty"`
+    Error   *RPCError       `json:"error,omitempty"`
+}
@@ -0,0 +1,321 @@
+package model
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+)
+
+// AnthropicVersion is the Messages API version the client speaks.
+const AnthropicVersion = "2023-06-01"
+
+// anthropicMaxTokens bounds the reply, thinking included, of models of no
+// known family; the API requires a bound.
+const anthropicMaxTokens = 8192
+
+// anthropicThinking maps reasoning efforts to extended-thinking budgets.
+// "minimal" (and no effort) disables thinking.
+var anthropicThinking = map[string]int64{
+    "low":    2048,
+    "medium": 8192,
+    "high":   24576,
+}
+
+// AnthropicClient streams replies from the Anthropic Messages API.
+type AnthropicClient struct {
+    Endpoint Endpoint
+}
+
+// NewAnthropicClient returns a client sending requests to ep. The
+// anthropic-version header is added when ep does not set one.
+func NewAnthropicClient(ep Endpoint) *AnthropicClient {
+    if ep.Header == nil {
+        ep.Header = http.Header{}
+    }
+    if ep.Header.Get("anthropic-version") == "" {
+        ep.Header.Set("anthropic-version", AnthropicVersion)
+    }
+    return &AnthropicClient{Endpoint: ep}
+}
+
+type anthropicMessage struct {
+    Role    string          `json:"role"`
+    Content []anthropicPart `json:"content"`
+}
+
+type anthropicPart struct {
+    Type   string           `json:"type"`
+    Text   string           `json:"text,omitempty"`
+    Source *anthropicSource `json:"source,omitempty"`
+    // thinking
+    Thinking  string `json:"thinking,omitempty"`
+    Signature string `json:"signature,omitempty"`
+    // tool_use
+    ID    string          `json:"id,omitempty"`
+    Name  string          `json:"name,omitempty"`
+    Input json.RawMessage `json:"input,omitempty"`
+    // tool_result
+    ToolUseID string `json:"tool_use_id,omitempty"`
+    Content   string `json:"content,omitempty"`
+    // CacheControl marks the end of a prefix to cache.
+    CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicCacheControl struct {
+    Type string `json:"type"`
+}
+
+// anthropicCacheBreakpoint caches the prompt up to the part it is set on
+// for five minutes.
+var anthropicCacheBreakpoint = &anthropicCacheControl{Type: "ephemeral"}
+
+type anthropicTool struct {
+    Name        string          `json:"name"`
+    Description string          `json:"description,omitempty"`
+    InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicSource struct {
+    Type      string `json:"type"` // base64 or url
+    MediaType string `json:"media_type,omitempty"`
+    Data      string `json:"data,omitempty"`
+    URL       string `json:"url,omitempty"`
+}
+
+type anthropicRequest struct {
+    Model     string             `json:"model"`
+    MaxTokens int64              `json:"max_tokens"`
+    System    any                `json:"system,omitempty"` // string or []anthropicPart
+    Messages  []anthropicMessage `json:"messages"`
+    Thinking  any                `json:"thinking,omitempty"`
+    Tools     []anthropicTool    `json:"tools,omitempty"`
+    Stream    bool               `json:"stream"`
+}
+
+type anthropicEvent struct {
+    Type    string `json:"type"`
+    Index   int    `json:"index"`
+    Message struct {
+        Usage anthropicUsage `json:"usage"`
+    } `json:"message"`
+    Delta struct {
+        Type        string `json:"type"`
+        Text        string `json:"text"`
+        Thinking    string `json:"thinking"`
+        PartialJSON string `json:"partial_json"`
+        Signature   string `json:"signature"`
+    } `json:"delta"`
+    ContentBlock struct {
+        Type string `json:"type"`
+        ID   string `json:"id"`
+        Name string `json:"name"`
+    } `json:"content_block"`
+    Usage *anthropicUsage `json:"usage"`
+    Error *apiErrorBody   `json:"error"`
+}
+
+type anthropicUsage struct {
+    InputTokens              int64 `json:"input_tokens"`
+    CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+    CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+    OutputTokens             int64 `json:"output_tokens"`
+}
+
+// anthropicImage converts an image URL into a Messages API image source.
+// data: URIs become inline base64 sources.
+func anthropicImage(u string) *anthropicSource {
+    rest, ok := strings.CutPrefix(u, "data:")
+    if !ok {
+        return &anthropicSource{Type: "url", URL: u}
+    }
+    meta, data, _ := strings.Cut(rest, ",")
+    mt, _, _ := strings.Cut(meta, ";")
+    return &anthropicSource{Type: "base64", MediaType: mt, Data: data}
+}
+
+// anthropicMessages converts the prompt's messages. The system prompt is a
+// separate request field, and the API rejects empty text parts. Tool
+// outputs are tool_result parts of a user message; consecutive outputs
+// share one.
+func anthropicMessages(p Prompt) []anthropicMessage {
+    var out []anthropicMessage
+    for _, m := range p.Messages {
+        if m.Role == "tool" {
+            part := anthropicPart{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Text()}
+            if n := len(out); n > 0 && out[n-1].Role == "user" && out[n-1].Content[0].Type == "tool_result" {
+                out[n-1].Content = append(out[n-1].Content, part)
+            } else {
+                out = append(out, anthropicMessage{Role: "user", Content: []anthropicPart{part}})
+            }
+            continue
+        }
+        var parts []anthropicPart
+        // Thinking blocks must precede the tool_use blocks they led to,
+        // signature intact.
+        for _, r := range m.Reasoning {
+            if r.EncryptedContent != "" {
+                parts = append(parts, anthropicPart{Type: "thinking", Thinking: strings.Join(r.Summary, ""), Signature: r.EncryptedContent})
+            }
+        }
+        for _, c := range m.Content {
+            switch {
+            case c.Type == InputText && c.Text != "":
+                parts = append(parts, anthropicPart{Type: "text", Text: c.Text})
+            case c.Type == InputImage && m.Role == "user":
+                parts = append(parts, anthropicPart{Type: "image", Source: anthropicImage(c.ImageURL)})
+            }
+        }
+        for _, c := range m.ToolCalls {
+            input := json.RawMessage(c.Arguments)
+            if !json.Valid(input) {
+                input = json.RawMessage("{}")
+            }
+            parts = append(parts, anthropicPart{Type: "tool_use", ID: c.ID, Name: c.Name, Input: input})
+        }
+        if len(parts) > 0 {
+            out = append(out, anthropicMessage{Role: m.Role, Content: parts})
+        }
+    }
+    return out
+}
+
+// Stream implements Client.
+func (c *AnthropicClient) Stream(ctx context.Context, p Prompt, fn func(StreamEvent) error) (Response, error) {
+    req := anthropicRequest{
+        Model:     p.Model,
+        MaxTokens: p.MaxOutputTokens,
+        Messages:  anthropicMessages(p),
+        Stream:    true,
+    }
+    if p.Instructions != "" {
+        req.System = p.Instructions
+    }
+    if p.CacheKey != "" {
+        // The Messages API only caches up to explicit breakpoints: one
+        // after the tools and instructions, which rarely change, and one
+        // at the end of the conversation for the next request to reuse.
+        if p.Instructions != "" {
+            req.System = []anthropicPart{{Type: "text", Text: p.Instructions, CacheControl: anthropicCacheBreakpoint}}
+        }
+        if n := len(req.Messages); n > 0 {
+            parts := req.Messages[n-1].Content
+            parts[len(parts)-1].CacheControl = anthropicCacheBreakpoint
+        }
+    }
+    fam := LookupFamily(req.Model)
+    if req.MaxTokens == 0 {
+        req.MaxTokens = fam.MaxOutputTokens
+    }
+    if req.MaxTokens == 0 {
+        req.MaxTokens = anthropicMaxTokens
+    }
+    if budget, ok := anthropicThinking[p.ReasoningEffort]; ok && (fam.Reasoning || !fam.Known()) {
+        // The budget is part of max_tokens and must leave room for the
+        // answer.
+        budget = min(budget, req.MaxTokens/2)
+        req.Thinking = map[string]any{"type": "enabled", "budget_tokens": budget}
+    }
+    for _, t := range p.Tools {
+        req.Tools = append(req.Tools, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+    }
+    resp, err := postStream(ctx, c.Endpoint, "/messages", req)
+    if err != nil {
+        return Response{}, err
+    }
+    defer resp.Body.Close()
+
+    var text strings.Builder
+    var usage Usage
+    // calls maps a content block index to its tool_use block; its input
+    // is assembled in args.
+    calls := map[int]*ToolCall{}
+    args := map[int]*strings.Builder{}
+    var order []int
+    // thinking maps a content block index to its thinking block.
+    thinking := map[int]*Reasoning{}
+    var thinkingOrder []int
+    seenUsage := false
+    err = readSSE(resp.Body, func(_, data string) error {
+        var ev anthropicEvent
+        if err := json.Unmarshal([]byte(data), &ev); err != nil {
+            return fmt.Errorf("model api: bad stream event: %w", err)
+        }
+        switch ev.Type {
+        case "message_start":
+            u := ev.Message.Usage
+            usage.InputTokens = u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+            usage.CachedInputTokens = u.CacheReadInputTokens
+            usage.OutputTokens = u.OutputTokens
+            seenUsage = true
+        case "content_block_start":
+            switch ev.ContentBlock.Type {
+            case "tool_use":
+                calls[ev.Index] = &ToolCall{ID: ev.ContentBlock.ID, Name: ev.ContentBlock.Name}
+                args[ev.Index] = &strings.Builder{}
+                order = append(order, ev.Index)
+            case "thinking":
+                thinking[ev.Index] = &Reasoning{}
+                thinkingOrder = append(thinkingOrder, ev.Index)
+            }
+        case "content_block_delta":
+            switch ev.Delta.Type {
+            case "input_json_delta":
+                if b := args[ev.Index]; b != nil {
+                    b.WriteString(ev.Delta.PartialJSON)
+                }
+            case "text_delta":
+                text.WriteString(ev.Delta.Text)
+                return fn(StreamEvent{Type: TextDelta, Delta: ev.Delta.Text})
+            case "signature_delta":
+                if r := thinking[ev.Index]; r != nil {
+                    r.EncryptedContent += ev.Delta.Signature
+                }
+            case "thinking_delta":
+                if r := thinking[ev.Index]; r != nil {
+                    r.Summary = append(r.Summary, ev.Delta.Thinking)
+                }
+                return fn(StreamEvent{Type: ReasoningDelta, Delta: ev.Delta.Thinking})
+            }
+        case "message_delta":
+            if ev.Usage != nil {
+                usage.OutputTokens = ev.Usage.OutputTokens
+                seenUsage = true
+            }
+        case "message_stop":
+            return io.EOF
+        case "error":
+            e := &APIError{StatusCode: http.StatusInternalServerError, Message: "stream error"}
+            if ev.Error != nil {
+                e.Code, e.Message = ev.Error.Type, ev.Error.Message
+                if e.Code == "overloaded_error" {
+                    e.StatusCode = 529
+                }
+            }
+            return e
+        }
+        return nil
+    })
+    if err != nil && err != io.EOF {
+        return Response{}, err
+    }
+    out := Response{Text: text.String()}
+    for _, i := range thinkingOrder {
+        out.Reasoning = append(out.Reasoning, *thinking[i])
+    }
+    for _, i := range order {
+        c := *calls[i]
+        c.Arguments = args[i].String()
+        if c.Arguments == "" {
+            c.Arguments = "{}"
+        }
+        out.ToolCalls = append(out.ToolCalls, c)
+    }
+    if seenUsage {
+        usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+        out.Usage = &usage
+    }
+    return out, nil
+}
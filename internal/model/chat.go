@@ -0,0 +1,252 @@
+package model
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+)
+
+// ChatClient streams replies from the OpenAI Chat Completions API or a
+// compatible server.
+type ChatClient struct {
+    Endpoint Endpoint
+}
+
+// NewChatClient returns a client sending requests to ep.
+func NewChatClient(ep Endpoint) *ChatClient { return &ChatClient{Endpoint: ep} }
+
+type chatMessage struct {
+    Role       string         `json:"role"`
+    Content    any            `json:"content"` // string, []chatPart or nil
+    ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+    ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatToolCall struct {
+    ID       string           `json:"id,omitempty"`
+    Type     string           `json:"type,omitempty"`
+    Function chatFunctionCall `json:"function"`
+}
+
+type chatFunctionCall struct {
+    Name      string `json:"name,omitempty"`
+    Arguments string `json:"arguments"`
+}
+
+type chatTool struct {
+    Type     string           `json:"type"`
+    Function chatToolFunction `json:"function"`
+}
+
+type chatToolFunction struct {
+    Name        string          `json:"name"`
+    Description string          `json:"description,omitempty"`
+    Parameters  json.RawMessage `json:"parameters"`
+}
+
+type chatPart struct {
+    Type     string        `json:"type"`
+    Text     string        `json:"text,omitempty"`
+    ImageURL *chatImageURL `json:"image_url,omitempty"`
+}
+
+type chatImageURL struct {
+    URL string `json:"url"`
+}
+
+type chatRequest struct {
+    Model           string        `json:"model"`
+    Messages        []chatMessage `json:"messages"`
+    Stream          bool          `json:"stream"`
+    StreamOptions   any           `json:"stream_options,omitempty"`
+    ReasoningEffort string        `json:"reasoning_effort,omitempty"`
+    Tools           []chatTool    `json:"tools,omitempty"`
+    ResponseFormat  any           `json:"response_format,omitempty"`
+    PromptCacheKey  string        `json:"prompt_cache_key,omitempty"`
+    Verbosity       string        `json:"verbosity,omitempty"`
+    MaxTokens       int64         `json:"max_completion_tokens,omitempty"`
+}
+
+type chatChunk struct {
+    Choices []struct {
+        Delta struct {
+            Content string `json:"content"`
+            // ReasoningContent is sent by some compatible servers.
+            ReasoningContent string `json:"reasoning_content"`
+            ToolCalls        []struct {
+                // Index identifies the call across chunks.
+                Index int `json:"index"`
+                chatToolCall
+            } `json:"tool_calls"`
+        } `json:"delta"`
+    } `json:"choices"`
+    Usage *struct {
+        PromptTokens        int64 `json:"prompt_tokens"`
+        CompletionTokens    int64 `json:"completion_tokens"`
+        TotalTokens         int64 `json:"total_tokens"`
+        PromptTokensDetails *struct {
+            CachedTokens int64 `json:"cached_tokens"`
+        } `json:"prompt_tokens_details"`
+        CompletionTokensDetails *struct {
+            ReasoningTokens int64 `json:"reasoning_tokens"`
+        } `json:"completion_tokens_details"`
+    } `json:"usage"`
+    Error *apiErrorBody `json:"error"`
+}
+
+// chatMessages converts a prompt into Chat Completions messages.
+func chatMessages(p Prompt) []chatMessage {
+    var out []chatMessage
+    if p.Instructions != "" {
+        out = append(out, chatMessage{Role: "system", Content: p.Instructions})
+    }
+    for _, m := range p.Messages {
+        switch {
+        case m.Role == "tool":
+            out = append(out, chatMessage{Role: "tool", Content: m.Text(), ToolCallID: m.ToolCallID})
+            continue
+        case len(m.ToolCalls) > 0:
+            msg := chatMessage{Role: m.Role}
+            if text := m.Text(); text != "" {
+                msg.Content = text
+            }
+            for _, c := range m.ToolCalls {
+                msg.ToolCalls = append(msg.ToolCalls, chatToolCall{ID: c.ID, Type: "function", Function: chatFunctionCall{Name: c.Name, Arguments: c.Arguments}})
+            }
+            out = append(out, msg)
+            continue
+        }
+        hasImage := false
+        for _, c := range m.Content {
+            hasImage = hasImage || c.Type == InputImage
+        }
+        if !hasImage || m.Role != "user" {
+            out = append(out, chatMessage{Role: m.Role, Content: m.Text()})
+            continue
+        }
+        parts := make([]chatPart, 0, len(m.Content))
+        for _, c := range m.Content {
+            switch c.Type {
+            case InputText:
+                parts = append(parts, chatPart{Type: "text", Text: c.Text})
+            case InputImage:
+                parts = append(parts, chatPart{Type: "image_url", ImageURL: &chatImageURL{URL: c.ImageURL}})
+            }
+        }
+        out = append(out, chatMessage{Role: m.Role, Content: parts})
+    }
+    return out
+}
+
+// Stream implements Client.
+func (c *ChatClient) Stream(ctx context.Context, p Prompt, fn func(StreamEvent) error) (Response, error) {
+    req := chatRequest{
+        Model:           p.Model,
+        Messages:        chatMessages(p),
+        Stream:          true,
+        StreamOptions:   map[string]bool{"include_usage": true},
+        ReasoningEffort: p.ReasoningEffort,
+        PromptCacheKey:  p.CacheKey,
+    }
+    if req.Model == "" {
+        req.Model = DefaultModel
+    }
+    if fam := LookupFamily(req.Model); fam.Known() {
+        if !fam.Reasoning {
+            req.ReasoningEffort = ""
+        }
+        if fam.Verbosity {
+            req.Verbosity = p.Verbosity
+        }
+    }
+    req.MaxTokens = p.MaxOutputTokens
+    for _, t := range p.Tools {
+        req.Tools = append(req.Tools, chatTool{Type: "function", Function: chatToolFunction{Name: t.Name, Description: t.Description, Parameters: t.Parameters}})
+    }
+    if len(p.OutputSchema) > 0 {
+        // Not strict: strict mode rejects schemas with optional properties.
+        req.ResponseFormat = map[string]any{
+            "type":        "json_schema",
+            "json_schema": map[string]any{"name": outputSchemaName, "schema": p.OutputSchema, "strict": false},
+        }
+    }
+    resp, err := postStream(ctx, c.Endpoint.forModel(p.Model), "/chat/completions", req)
+    if err != nil {
+        return Response{}, err
+    }
+    defer resp.Body.Close()
+
+    var text strings.Builder
+    var out Response
+    // Tool calls arrive in pieces keyed by index: the first chunk carries
+    // id and name, later ones append to the arguments, which are assembled
+    // in args and checked only once complete.
+    var calls []ToolCall
+    var args []*strings.Builder
+    err = readSSE(resp.Body, func(_, data string) error {
+        if data == "[DONE]" {
+            return io.EOF
+        }
+        var chunk chatChunk
+        if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+            return fmt.Errorf("model api: bad stream chunk: %w", err)
+        }
+        if chunk.Error != nil {
+            return &APIError{StatusCode: http.StatusInternalServerError, Code: errorCode(chunk.Error.Code), Message: chunk.Error.Message}
+        }
+        for _, ch := range chunk.Choices {
+            if d := ch.Delta.ReasoningContent; d != "" {
+                if err := fn(StreamEvent{Type: ReasoningDelta, Delta: d}); err != nil {
+                    return err
+                }
+            }
+            if d := ch.Delta.Content; d != "" {
+                text.WriteString(d)
+                if err := fn(StreamEvent{Type: TextDelta, Delta: d}); err != nil {
+                    return err
+                }
+            }
+            for _, tc := range ch.Delta.ToolCalls {
+                switch {
+                case tc.Index == len(calls):
+                    calls = append(calls, ToolCall{})
+                    args = append(args, &strings.Builder{})
+                case tc.Index < 0 || tc.Index > len(calls):
+                    return fmt.Errorf("model api: bad tool call index %d", tc.Index)
+                }
+                c := &calls[tc.Index]
+                if tc.ID != "" {
+                    c.ID = tc.ID
+                }
+                if tc.Function.Name != "" {
+                    c.Name = tc.Function.Name
+                }
+                args[tc.Index].WriteString(tc.Function.Arguments)
+            }
+        }
+        if u := chunk.Usage; u != nil {
+            out.Usage = &Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+            if u.PromptTokensDetails != nil {
+                out.Usage.CachedInputTokens = u.PromptTokensDetails.CachedTokens
+            }
+            if u.CompletionTokensDetails != nil {
+                out.Usage.ReasoningOutputTokens = u.CompletionTokensDetails.ReasoningTokens
+            }
+        }
+        return nil
+    })
+    if err != nil && err != io.EOF {
+        return Response{}, err
+    }
+    out.Text = text.String()
+    for i, c := range calls {
+        c.Arguments = args[i].String()
+        if c.Name != "" {
+            out.ToolCalls = append(out.ToolCalls, c)
+        }
+    }
+    return out, nil
+}
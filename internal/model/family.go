@@ -0,0 +1,72 @@
+package model
+
+import "strings"
+
+// Family describes a family of models: what its API parameters accept and
+// the defaults the agent uses with it.
+type Family struct {
+    // Prefix matches the model names of the family; "" for an unknown
+    // model.
+    Prefix string
+    // ContextWindow is the context size in tokens. 0 means unknown.
+    ContextWindow int64
+    // MaxOutputTokens is the most the model can produce in one reply,
+    // reasoning included. 0 means unknown.
+    MaxOutputTokens int64
+    // Reasoning is set for models taking a reasoning effort (or, on the
+    // Anthropic API, extended thinking).
+    Reasoning bool
+    // ReasoningSummaries is set when the Responses API can stream a
+    // summary of the model's reasoning.
+    ReasoningSummaries bool
+    // Verbosity is set for models taking the verbosity parameter.
+    Verbosity bool
+    // ApplyPatchInstructions is set for models that were not trained on
+    // the apply_patch format and need it explained in the instructions.
+    ApplyPatchInstructions bool
+}
+
+// Known reports whether the model matched a family.
+func (f Family) Known() bool { return f.Prefix != "" }
+
+// families lists the known model families. The longest matching prefix
+// wins.
+var families = []Family{
+    {Prefix: "gpt-5", ContextWindow: 272_000, MaxOutputTokens: 128_000, Reasoning: true, ReasoningSummaries: true, Verbosity: true},
+    {Prefix: "codex-mini", ContextWindow: 200_000, MaxOutputTokens: 100_000, Reasoning: true, ReasoningSummaries: true},
+    {Prefix: "o1", ContextWindow: 200_000, MaxOutputTokens: 100_000, Reasoning: true},
+    {Prefix: "o3", ContextWindow: 200_000, MaxOutputTokens: 100_000, Reasoning: true, ReasoningSummaries: true},
+    {Prefix: "o4-mini", ContextWindow: 200_000, MaxOutputTokens: 100_000, Reasoning: true, ReasoningSummaries: true},
+    {Prefix: "gpt-4.1", ContextWindow: 1_047_576, MaxOutputTokens: 32_768, ApplyPatchInstructions: true},
+    {Prefix: "gpt-4o", ContextWindow: 128_000, MaxOutputTokens: 16_384, ApplyPatchInstructions: true},
+    {Prefix: "gpt-4-turbo", ContextWindow: 128_000, MaxOutputTokens: 4_096, ApplyPatchInstructions: true},
+    {Prefix: "gpt-4", ContextWindow: 8_192, MaxOutputTokens: 8_192, ApplyPatchInstructions: true},
+    {Prefix: "gpt-3.5-turbo", ContextWindow: 16_385, MaxOutputTokens: 4_096, ApplyPatchInstructions: true},
+    {Prefix: "claude-opus-4", ContextWindow: 200_000, MaxOutputTokens: 32_000, Reasoning: true, ApplyPatchInstructions: true},
+    {Prefix: "claude-sonnet-4", ContextWindow: 200_000, MaxOutputTokens: 64_000, Reasoning: true, ApplyPatchInstructions: true},
+    {Prefix: "claude-3-7-sonnet", ContextWindow: 200_000, MaxOutputTokens: 64_000, Reasoning: true, ApplyPatchInstructions: true},
+    {Prefix: "claude-3-5", ContextWindow: 200_000, MaxOutputTokens: 8_192, ApplyPatchInstructions: true},
+    {Prefix: "claude-", ContextWindow: 200_000, MaxOutputTokens: 4_096, ApplyPatchInstructions: true},
+    {Prefix: "gemini-2.5", ContextWindow: 1_048_576, MaxOutputTokens: 65_536, Reasoning: true, ApplyPatchInstructions: true},
+    {Prefix: "gemini-2", ContextWindow: 1_048_576, MaxOutputTokens: 8_192, ApplyPatchInstructions: true},
+    {Prefix: "gemini-1.5", ContextWindow: 1_048_576, MaxOutputTokens: 8_192, ApplyPatchInstructions: true},
+    {Prefix: "llama3", ContextWindow: 131_072, ApplyPatchInstructions: true},
+    {Prefix: "qwen", ContextWindow: 32_768, ApplyPatchInstructions: true},
+    {Prefix: "mistral", ContextWindow: 32_768, ApplyPatchInstructions: true},
+}
+
+// LookupFamily returns the family of the named model, or the zero Family
+// when it is unknown. Provider prefixes ("openai/gpt-4.1") and tags
+// ("llama3.1:8b") are ignored.
+func LookupFamily(name string) Family {
+    if i := strings.LastIndexByte(name, '/'); i >= 0 {
+        name = name[i+1:]
+    }
+    var best Family
+    for _, f := range families {
+        if strings.HasPrefix(name, f.Prefix) && len(f.Prefix) > len(best.Prefix) {
+            best = f
+        }
+    }
+    return best
+}
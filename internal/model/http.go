@@ -0,0 +1,123 @@
+package model
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type apiErrorBody struct {
+    Message string `json:"message"`
+    Type    string `json:"type"`
+    Code    any    `json:"code"` // string or number depending on server
+}
+
+// Endpoint says where a client sends requests and what they carry besides
+// the body: authorization and provider-specific headers, query parameters
+// such as Azure's api-version.
+type Endpoint struct {
+    BaseURL    string
+    Header     http.Header
+    Query      url.Values
+    HTTPClient *http.Client // nil means http.DefaultClient
+    // DeploymentURL, when set, returns the base URL of the requests for a
+    // model in place of BaseURL: Azure serves every deployment under its
+    // own URL.
+    DeploymentURL func(model string) string
+    // Authorize, when set, adds credentials to each request's header,
+    // for credentials that change over time such as OAuth access tokens.
+    Authorize func(ctx context.Context, h http.Header) error
+}
+
+// forModel returns e with the base URL of the requests for model.
+func (e Endpoint) forModel(model string) Endpoint {
+    if e.DeploymentURL != nil {
+        e.BaseURL = e.DeploymentURL(model)
+    }
+    return e
+}
+
+// url joins path onto the base URL and appends the query parameters.
+func (e Endpoint) url(path string) string {
+    u := strings.TrimRight(e.BaseURL, "/") + path
+    if len(e.Query) > 0 {
+        u += "?" + e.Query.Encode()
+    }
+    return u
+}
+
+// postStream POSTs body as JSON to path asking for an event stream. Non-2xx
+// answers are returned as *APIError; the caller closes the body otherwise.
+func postStream(ctx context.Context, ep Endpoint, path string, body any) (*http.Response, error) {
+    data, err := json.Marshal(body)
+    if err != nil {
+        return nil, err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.url(path), bytes.NewReader(data))
+    if err != nil {
+        return nil, err
+    }
+    for k, vs := range ep.Header {
+        req.Header[k] = vs
+    }
+    if ep.Authorize != nil {
+        if err := ep.Authorize(ctx, req.Header); err != nil {
+            return nil, err
+        }
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("Accept", "text/event-stream")
+    hc := ep.HTTPClient
+    if hc == nil {
+        hc = http.DefaultClient
+    }
+    resp, err := hc.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode/100 != 2 {
+        defer resp.Body.Close()
+        return nil, readAPIError(resp)
+    }
+    return resp, nil
+}
+
+// readAPIError builds an APIError from a failed response.
+func readAPIError(resp *http.Response) error {
+    e := &APIError{StatusCode: resp.StatusCode}
+    if s := resp.Header.Get("Retry-After"); s != "" {
+        if secs, err := strconv.ParseFloat(s, 64); err == nil && secs > 0 {
+            e.RetryAfter = time.Duration(secs * float64(time.Second))
+        }
+    }
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+    var wrapped struct {
+        Error *apiErrorBody `json:"error"`
+    }
+    if json.Unmarshal(body, &wrapped) == nil && wrapped.Error != nil {
+        e.Message = wrapped.Error.Message
+        e.Code = errorCode(wrapped.Error.Code)
+        if e.Code == "" {
+            e.Code = wrapped.Error.Type
+        }
+    } else {
+        e.Message = strings.TrimSpace(string(body))
+    }
+    return e
+}
+
+func errorCode(v any) string {
+    switch c := v.(type) {
+    case string:
+        return c
+    case float64:
+        return strconv.FormatFloat(c, 'f', -1, 64)
+    }
+    return ""
+}
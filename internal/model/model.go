@@ -0,0 +1,224 @@
+// Package model talks to language model APIs. Callers build a Prompt from
+// the conversation so far and receive the reply as a stream of deltas
+// followed by the complete Response.
+package model
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// DefaultModel is used when neither the session nor the config names one.
+const DefaultModel = "gpt-4.1"
+
+// ContentItem is one part of a message: text, or an image given by URL
+// (local images are passed as data: URIs).
+type ContentItem struct {
+    Type     string `json:"type"` // "input_text" or "input_image"
+    Text     string `json:"text,omitempty"`
+    ImageURL string `json:"image_url,omitempty"`
+}
+
+// Content types.
+const (
+    InputText  = "input_text"
+    InputImage = "input_image"
+)
+
+// Client streams replies from a model API.
+type Client interface {
+    // Stream sends p and calls fn with each delta as it arrives. It returns
+    // the complete reply once the stream ends. Errors from fn abort the
+    // request.
+    Stream(ctx context.Context, p Prompt, fn func(StreamEvent) error) (Response, error)
+}
+
+// Message is one conversation turn sent to the model. The JSON form is
+// how conversations are recorded in session rollouts.
+type Message struct {
+    Role    string        `json:"role"` // "user", "assistant" or "tool"
+    Content []ContentItem `json:"content,omitempty"`
+    // Reasoning holds the reasoning items that preceded an assistant
+    // message. The Responses and Anthropic APIs send them back; the Chat
+    // Completions API ignores them.
+    Reasoning []Reasoning `json:"reasoning,omitempty"`
+    // ToolCalls are the function calls an assistant message asked for.
+    ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+    // ToolCallID marks a "tool" message as the output of that call.
+    ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a function call requested by the model.
+type ToolCall struct {
+    ID   string `json:"id"`
+    Name string `json:"name"`
+    // Arguments is the JSON object of arguments, as sent by the model.
+    Arguments string `json:"arguments"`
+}
+
+// ToolSpec describes a function the model may call.
+type ToolSpec struct {
+    Name        string
+    Description string
+    // Parameters is the JSON Schema of the arguments object.
+    Parameters json.RawMessage
+}
+
+// ToolOutput returns the message reporting the output of call id.
+func ToolOutput(id, output string) Message {
+    m := TextMessage("tool", output)
+    m.ToolCallID = id
+    return m
+}
+
+// Reasoning is a reasoning item produced by a reasoning model. The content
+// is opaque (encrypted) and must be returned verbatim in later requests so
+// the model keeps its chain of thought across turns.
+type Reasoning struct {
+    ID               string   `json:"id,omitempty"`
+    Summary          []string `json:"summary,omitempty"`
+    EncryptedContent string   `json:"encrypted_content,omitempty"`
+}
+
+// TextMessage returns a message holding a single text part.
+func TextMessage(role, text string) Message {
+    return Message{Role: role, Content: []ContentItem{{Type: InputText, Text: text}}}
+}
+
+// Text concatenates the message's text parts.
+func (m Message) Text() string {
+    var sb strings.Builder
+    for _, c := range m.Content {
+        if c.Type == InputText {
+            sb.WriteString(c.Text)
+        }
+    }
+    return sb.String()
+}
+
+// Prompt is everything one model request is built from.
+type Prompt struct {
+    Model string
+    // Instructions become the system message.
+    Instructions string
+    // Messages is the conversation so far, oldest first, ending with the
+    // user's latest input.
+    Messages []Message
+    // Tools are the functions the model may call. Empty means none.
+    Tools []ToolSpec
+    // ReasoningEffort is sent to reasoning models when non-empty; models
+    // of a known family without reasoning do not get it.
+    ReasoningEffort string
+    // Verbosity ("low", "medium", "high") is sent to models taking it
+    // when non-empty.
+    Verbosity string
+    // MaxOutputTokens bounds the reply. 0 means the API's default, or the
+    // family's maximum where the API requires a bound.
+    MaxOutputTokens int64
+    // WebSearch lets the model search the web through the provider's own
+    // search tool. Clients that cannot (see SearchesWeb) ignore it.
+    WebSearch bool
+    // OutputSchema is the JSON Schema the final answer must conform to.
+    // Clients with a structured output mode constrain the reply with it;
+    // the caller also states it in the instructions. Empty means free text.
+    OutputSchema json.RawMessage
+    // CacheKey groups requests that share a prefix (those of one session),
+    // so the provider serves them from the same prompt cache. Empty means
+    // the provider decides alone.
+    CacheKey string
+}
+
+// outputSchemaName names the schema in structured output requests.
+const outputSchemaName = "final_answer"
+
+// SearchesWeb reports whether c honors Prompt.WebSearch.
+func SearchesWeb(c Client) bool {
+    s, ok := c.(interface{ SearchesWeb() bool })
+    return ok && s.SearchesWeb()
+}
+
+// Usage is the token accounting reported for one request.
+type Usage struct {
+    InputTokens           int64
+    CachedInputTokens     int64
+    OutputTokens          int64
+    ReasoningOutputTokens int64
+    TotalTokens           int64
+}
+
+// StreamEvent is one incremental piece of a reply.
+type StreamEvent struct {
+    Type  StreamEventType
+    Delta string
+    // CallID and Query describe a provider-side web search
+    // (WebSearchBegin, WebSearchEnd).
+    CallID string
+    Query  string
+}
+
+// StreamEventType distinguishes answer text from reasoning text and
+// reports web searches the provider runs for the model.
+type StreamEventType int
+
+const (
+    TextDelta StreamEventType = iota
+    ReasoningDelta
+    WebSearchBegin
+    WebSearchEnd
+)
+
+// Response is a complete reply.
+type Response struct {
+    Text      string
+    Reasoning []Reasoning
+    // ToolCalls are the function calls the model asked for; the caller
+    // runs them and sends their outputs with the next request.
+    ToolCalls []ToolCall
+    // Usage is nil when the server did not report it.
+    Usage *Usage
+}
+
+// Message returns the reply as an assistant message for the conversation.
+func (r Response) Message() Message {
+    m := Message{Role: "assistant", Reasoning: r.Reasoning, ToolCalls: r.ToolCalls}
+    if r.Text != "" {
+        m.Content = []ContentItem{{Type: InputText, Text: r.Text}}
+    }
+    return m
+}
+
+// APIError is a non-2xx answer from a model API.
+type APIError struct {
+    StatusCode int
+    // Code is the provider's machine-readable error code, if any (e.g.
+    // "context_length_exceeded").
+    Code    string
+    Message string
+    // RetryAfter is the server's requested delay; 0 when not given.
+    RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+    if e.Message == "" {
+        return fmt.Sprintf("model api: http %d", e.StatusCode)
+    }
+    return fmt.Sprintf("model api: http %d: %s", e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the same request may succeed later: rate
+// limits and server-side failures.
+func (e *APIError) Retryable() bool {
+    return e.StatusCode == 429 || e.StatusCode >= 500
+}
+
+// RateLimited reports an HTTP 429 answer.
+func (e *APIError) RateLimited() bool { return e.StatusCode == 429 }
+
+// ContextWindowExceeded reports a request rejected for being too long.
+func (e *APIError) ContextWindowExceeded() bool {
+    // Anthropic has no dedicated code and reports it in the message.
+    return e.Code == "context_length_exceeded" || strings.Contains(e.Message, "prompt is too long")
+}
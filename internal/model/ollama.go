@@ -0,0 +1,141 @@
+package model
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+)
+
+// Ollama talks to the native API of an Ollama server, which lists and
+// downloads the models its OpenAI-compatible API (the built-in "ollama"
+// provider) then serves.
+type Ollama struct {
+    // BaseURL is the server's root, e.g. http://localhost:11434.
+    BaseURL    string
+    HTTPClient *http.Client // nil means http.DefaultClient
+}
+
+// OllamaHost returns the root URL of the local Ollama server: $OLLAMA_HOST
+// (a URL or host:port, as the ollama CLI takes it), else the default port
+// on localhost.
+func OllamaHost() string {
+    h := strings.TrimRight(os.Getenv("OLLAMA_HOST"), "/")
+    switch {
+    case h == "":
+        return "http://localhost:11434"
+    case !strings.Contains(h, "://"):
+        return "http://" + h
+    }
+    return h
+}
+
+func (o Ollama) client() *http.Client {
+    if o.HTTPClient != nil {
+        return o.HTTPClient
+    }
+    return http.DefaultClient
+}
+
+// Models lists the names of the installed models ("llama3.1:latest").
+// An error means no server answered.
+func (o Ollama) Models(ctx context.Context) ([]string, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(o.BaseURL, "/")+"/api/tags", nil)
+    if err != nil {
+        return nil, err
+    }
+    resp, err := o.client().Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, readAPIError(resp)
+    }
+    var tags struct {
+        Models []struct {
+            Name string `json:"name"`
+        } `json:"models"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+        return nil, fmt.Errorf("%s is not an Ollama server: %w", o.BaseURL, err)
+    }
+    names := make([]string, 0, len(tags.Models))
+    for _, m := range tags.Models {
+        names = append(names, m.Name)
+    }
+    return names, nil
+}
+
+// OllamaProgress reports a model download: the current step ("pulling
+// manifest", "pulling <digest>", "success") and, while downloading a
+// layer, the bytes done out of total.
+type OllamaProgress struct {
+    Status    string
+    Completed int64
+    Total     int64
+}
+
+// Pull downloads the named model, calling progress (when not nil) with
+// every update the server streams.
+func (o Ollama) Pull(ctx context.Context, name string, progress func(OllamaProgress)) error {
+    body, _ := json.Marshal(map[string]any{"model": name, "stream": true})
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(o.BaseURL, "/")+"/api/pull", bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := o.client().Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return readAPIError(resp)
+    }
+    sc := bufio.NewScanner(resp.Body)
+    done := false
+    for sc.Scan() {
+        var line struct {
+            Status    string `json:"status"`
+            Completed int64  `json:"completed"`
+            Total     int64  `json:"total"`
+            Error     string `json:"error"`
+        }
+        if json.Unmarshal(sc.Bytes(), &line) != nil {
+            continue
+        }
+        if line.Error != "" {
+            return fmt.Errorf("pull %s: %s", name, line.Error)
+        }
+        done = line.Status == "success"
+        if progress != nil {
+            progress(OllamaProgress{Status: line.Status, Completed: line.Completed, Total: line.Total})
+        }
+    }
+    if err := sc.Err(); err != nil {
+        return err
+    }
+    if !done {
+        return fmt.Errorf("pull %s: the download did not complete", name)
+    }
+    return nil
+}
+
+// HasOllamaModel reports whether name is among the installed models; a
+// name without a tag means its "latest" tag.
+func HasOllamaModel(installed []string, name string) bool {
+    if !strings.Contains(name, ":") {
+        name += ":latest"
+    }
+    for _, m := range installed {
+        if m == name {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,243 @@
+package model
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "net/url"
+    "os"
+    "sort"
+    "strings"
+)
+
+// Wire APIs a provider can speak.
+const (
+    WireChat      = "chat"      // OpenAI Chat Completions and compatible servers
+    WireResponses = "responses" // OpenAI Responses API
+    WireAnthropic = "anthropic" // Anthropic Messages API
+)
+
+// Provider describes a model API: where it is, how to authenticate and
+// which wire format it speaks.
+type Provider struct {
+    // Name is shown to users ("OpenAI", "Ollama", ...).
+    Name    string
+    BaseURL string
+    // EnvKey names the environment variable holding the API key. Empty
+    // means the provider needs no key (e.g. a local Ollama).
+    EnvKey  string
+    // APIKey, when set, is used instead of the variable named by EnvKey
+    // (e.g. a key saved by `codex login`).
+    APIKey  string
+    // Token, when set, supplies a bearer token for each request instead,
+    // e.g. an OAuth access token refreshed before it expires.
+    Token   func(ctx context.Context) (string, error)
+    WireAPI string
+    // QueryParams are added to every request URL.
+    QueryParams map[string]string
+    // APIVersion is sent as the api-version query parameter. Empty on an
+    // Azure provider means DefaultAzureAPIVersion.
+    APIVersion string
+    // Azure marks an Azure OpenAI resource: the API key goes in the
+    // api-key header, and on the chat wire API requests for a model go to
+    // its deployment, <BaseURL>/deployments/<name>/chat/completions.
+    Azure bool
+    // Deployments maps a model to its Azure deployment: the deployment's
+    // name or its full URL (for deployments of other resources). Models
+    // not listed are deployed under their own name, unless BaseURL names
+    // a deployment already.
+    Deployments map[string]string
+    // HTTPHeaders are sent as is; EnvHTTPHeaders map a header to the
+    // environment variable holding its value and are skipped when unset.
+    HTTPHeaders    map[string]string
+    EnvHTTPHeaders map[string]string
+    // DefaultModel is used when neither the session nor the config names a
+    // model. Empty means DefaultModel.
+    DefaultModel string
+}
+
+// BuiltinProviders are available without configuration, keyed by the id
+// used in `model_provider`. Config entries with the same id override their
+// fields.
+func BuiltinProviders() map[string]Provider {
+    return map[string]Provider{
+        "openai": {
+            Name:    "OpenAI",
+            BaseURL: envOr("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+            EnvKey:  "OPENAI_API_KEY",
+            WireAPI: WireChat,
+        },
+        "anthropic": {
+            Name:         "Anthropic",
+            BaseURL:      "https://api.anthropic.com/v1",
+            EnvKey:       "ANTHROPIC_API_KEY",
+            WireAPI:      WireAnthropic,
+            DefaultModel: "claude-sonnet-4-20250514",
+        },
+        "gemini": {
+            // Gemini's OpenAI-compatible endpoint.
+            Name:         "Gemini",
+            BaseURL:      "https://generativelanguage.googleapis.com/v1beta/openai",
+            EnvKey:       "GEMINI_API_KEY",
+            WireAPI:      WireChat,
+            DefaultModel: "gemini-2.5-flash",
+        },
+        "ollama": {
+            Name:         "Ollama",
+            BaseURL:      OllamaHost() + "/v1",
+            WireAPI:      WireChat,
+            DefaultModel: "llama3.1",
+        },
+        "azure": {
+            // AZURE_OPENAI_ENDPOINT is the resource's endpoint,
+            // https://<resource>.openai.azure.com.
+            Name:    "Azure OpenAI",
+            BaseURL: azureBaseURL(os.Getenv("AZURE_OPENAI_ENDPOINT")),
+            EnvKey:  "AZURE_OPENAI_API_KEY",
+            WireAPI: WireChat,
+            Azure:   true,
+        },
+        "openrouter": {
+            Name:         "OpenRouter",
+            BaseURL:      "https://openrouter.ai/api/v1",
+            EnvKey:       "OPENROUTER_API_KEY",
+            WireAPI:      WireChat,
+            DefaultModel: "openai/gpt-4.1",
+        },
+    }
+}
+
+// ProviderIDs lists the built-in provider ids, sorted.
+func ProviderIDs() []string {
+    var ids []string
+    for id := range BuiltinProviders() {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+    return ids
+}
+
+// DefaultAzureAPIVersion is the api-version Azure providers send unless
+// configured otherwise.
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// azureBaseURL returns the API base URL of an Azure OpenAI resource
+// endpoint, or "" for none.
+func azureBaseURL(endpoint string) string {
+    if endpoint == "" {
+        return ""
+    }
+    return strings.TrimRight(endpoint, "/") + "/openai"
+}
+
+// deploymentURL returns the base URL of the requests for model on Azure.
+// A base URL that already names a deployment serves every model.
+func (p Provider) deploymentURL(model string) string {
+    base := strings.TrimRight(p.BaseURL, "/")
+    d, listed := p.Deployments[model]
+    if !listed && strings.Contains(base, "/deployments/") {
+        return base
+    }
+    if d == "" {
+        d = model
+    }
+    if strings.Contains(d, "://") {
+        return strings.TrimRight(d, "/")
+    }
+    return base + "/deployments/" + url.PathEscape(d)
+}
+
+func envOr(name, def string) string {
+    if v := os.Getenv(name); v != "" {
+        return v
+    }
+    return def
+}
+
+// Model returns model, or the provider's default when it is empty.
+func (p Provider) Model(model string) string {
+    switch {
+    case model != "":
+        return model
+    case p.DefaultModel != "":
+        return p.DefaultModel
+    }
+    return DefaultModel
+}
+
+// Client builds a client for the provider, reading credentials from
+// APIKey or the environment. It fails when the provider needs a key that
+// is not set.
+func (p Provider) Client() (Client, error) {
+    if p.BaseURL == "" {
+        return nil, fmt.Errorf("provider %s: missing base_url", p.Name)
+    }
+    ep := Endpoint{BaseURL: p.BaseURL, Header: http.Header{}, Query: url.Values{}}
+    for k, v := range p.QueryParams {
+        ep.Query.Set(k, v)
+    }
+    switch {
+    case p.APIVersion != "":
+        ep.Query.Set("api-version", p.APIVersion)
+    case p.Azure && !ep.Query.Has("api-version"):
+        ep.Query.Set("api-version", DefaultAzureAPIVersion)
+    }
+    for k, v := range p.HTTPHeaders {
+        ep.Header.Set(k, v)
+    }
+    for k, env := range p.EnvHTTPHeaders {
+        if v := os.Getenv(env); v != "" {
+            ep.Header.Set(k, v)
+        }
+    }
+    key := p.APIKey
+    if p.Token != nil {
+        if p.WireAPI == WireAnthropic {
+            return nil, fmt.Errorf("provider %s: token credentials need an OpenAI wire API", p.Name)
+        }
+        ep.Authorize = func(ctx context.Context, h http.Header) error {
+            tok, err := p.Token(ctx)
+            if err != nil {
+                return fmt.Errorf("provider %s: %w", p.Name, err)
+            }
+            h.Set("Authorization", "Bearer "+tok)
+            return nil
+        }
+    } else if key == "" && p.EnvKey != "" {
+        if key = os.Getenv(p.EnvKey); key == "" {
+            return nil, fmt.Errorf("provider %s: environment variable %s is not set", p.Name, p.EnvKey)
+        }
+    }
+
+    switch p.WireAPI {
+    case WireChat, "":
+        p.setKey(ep.Header, key)
+        if p.Azure {
+            ep.DeploymentURL = p.deploymentURL
+        }
+        return NewChatClient(ep), nil
+    case WireResponses:
+        // Azure's v1 Responses API is not per deployment: the model names
+        // the deployment.
+        p.setKey(ep.Header, key)
+        return NewResponsesClient(ep), nil
+    case WireAnthropic:
+        if key != "" {
+            ep.Header.Set("x-api-key", key)
+        }
+        return NewAnthropicClient(ep), nil
+    }
+    return nil, fmt.Errorf("provider %s: unknown wire_api %q", p.Name, p.WireAPI)
+}
+
+// setKey authorizes OpenAI-style requests with key: as a bearer token, or
+// in the api-key header on Azure.
+func (p Provider) setKey(h http.Header, key string) {
+    switch {
+    case key == "":
+    case p.Azure:
+        h.Set("api-key", key)
+    default:
+        h.Set("Authorization", "Bearer "+key)
+    }
+}
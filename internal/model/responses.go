@@ -0,0 +1,285 @@
+package model
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+)
+
+// ResponsesClient streams replies from the OpenAI Responses API. Unlike
+// ChatClient it carries reasoning across turns: requests are stateless
+// (store=false) and ask for encrypted reasoning items, which the caller
+// keeps in Message.Reasoning and sends back with the next request.
+type ResponsesClient struct {
+    Endpoint Endpoint
+}
+
+// NewResponsesClient returns a client sending requests to ep.
+func NewResponsesClient(ep Endpoint) *ResponsesClient { return &ResponsesClient{Endpoint: ep} }
+
+type responsesRequest struct {
+    Model           string              `json:"model"`
+    Instructions    string              `json:"instructions,omitempty"`
+    Input           []responsesItem     `json:"input"`
+    Stream          bool                `json:"stream"`
+    Store           bool                `json:"store"`
+    Reasoning       *responsesReasoning `json:"reasoning,omitempty"`
+    Include         []string            `json:"include,omitempty"`
+    Tools           []responsesTool     `json:"tools,omitempty"`
+    Text            *responsesText      `json:"text,omitempty"`
+    PromptCacheKey  string              `json:"prompt_cache_key,omitempty"`
+    MaxOutputTokens int64               `json:"max_output_tokens,omitempty"`
+}
+
+// responsesText sets the format and verbosity of the reply text.
+type responsesText struct {
+    Format    *responsesFormat `json:"format,omitempty"`
+    Verbosity string           `json:"verbosity,omitempty"`
+}
+
+type responsesFormat struct {
+    Type   string          `json:"type"`
+    Name   string          `json:"name,omitempty"`
+    Schema json.RawMessage `json:"schema,omitempty"`
+    Strict bool            `json:"strict"`
+}
+
+// responsesTool is a function tool, or a hosted tool such as web_search
+// that only has a type.
+type responsesTool struct {
+    Type        string          `json:"type"`
+    Name        string          `json:"name,omitempty"`
+    Description string          `json:"description,omitempty"`
+    Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type responsesReasoning struct {
+    Effort  string `json:"effort,omitempty"`
+    Summary string `json:"summary,omitempty"`
+}
+
+// responsesItem is an input or output item; fields are used per type.
+type responsesItem struct {
+    Type             string             `json:"type"`
+    Role             string             `json:"role,omitempty"`
+    Content          []responsesContent `json:"content,omitempty"`
+    ID               string             `json:"id,omitempty"`
+    Summary          []responsesContent `json:"summary,omitempty"`
+    EncryptedContent string             `json:"encrypted_content,omitempty"`
+    CallID           string             `json:"call_id,omitempty"`
+    Name             string             `json:"name,omitempty"`
+    Arguments        string             `json:"arguments,omitempty"`
+    Output           *string            `json:"output,omitempty"`
+    Action           *struct {
+        Query string `json:"query"`
+    } `json:"action,omitempty"`
+}
+
+type responsesContent struct {
+    Type     string `json:"type"`
+    Text     string `json:"text,omitempty"`
+    ImageURL string `json:"image_url,omitempty"`
+}
+
+type responsesUsage struct {
+    InputTokens        int64 `json:"input_tokens"`
+    InputTokensDetails *struct {
+        CachedTokens int64 `json:"cached_tokens"`
+    } `json:"input_tokens_details"`
+    OutputTokens        int64 `json:"output_tokens"`
+    OutputTokensDetails *struct {
+        ReasoningTokens int64 `json:"reasoning_tokens"`
+    } `json:"output_tokens_details"`
+    TotalTokens int64 `json:"total_tokens"`
+}
+
+// responsesEvent is the union of the stream events used here.
+type responsesEvent struct {
+    Type     string        `json:"type"`
+    Delta    string        `json:"delta"`
+    Item     responsesItem `json:"item"`
+    Code     string        `json:"code"`
+    Message  string        `json:"message"`
+    Response struct {
+        Usage             *responsesUsage `json:"usage"`
+        Error             *apiErrorBody   `json:"error"`
+        IncompleteDetails *struct {
+            Reason string `json:"reason"`
+        } `json:"incomplete_details"`
+    } `json:"response"`
+}
+
+// query returns the search query of a web_search_call item, if known.
+func (it responsesItem) query() string {
+    if it.Action == nil {
+        return ""
+    }
+    return it.Action.Query
+}
+
+// SearchesWeb reports true: the Responses API hosts a web_search tool.
+func (c *ResponsesClient) SearchesWeb() bool { return true }
+
+// responsesInput converts the conversation into Responses API input items.
+func responsesInput(msgs []Message) []responsesItem {
+    var out []responsesItem
+    for _, m := range msgs {
+        for _, r := range m.Reasoning {
+            item := responsesItem{Type: "reasoning", Summary: []responsesContent{}, EncryptedContent: r.EncryptedContent}
+            for _, s := range r.Summary {
+                item.Summary = append(item.Summary, responsesContent{Type: "summary_text", Text: s})
+            }
+            out = append(out, item)
+        }
+        if m.Role == "tool" {
+            output := m.Text()
+            out = append(out, responsesItem{Type: "function_call_output", CallID: m.ToolCallID, Output: &output})
+            continue
+        }
+        item := responsesItem{Type: "message", Role: m.Role}
+        for _, c := range m.Content {
+            switch {
+            case c.Type == InputImage:
+                item.Content = append(item.Content, responsesContent{Type: "input_image", ImageURL: c.ImageURL})
+            case m.Role == "assistant":
+                item.Content = append(item.Content, responsesContent{Type: "output_text", Text: c.Text})
+            default:
+                item.Content = append(item.Content, responsesContent{Type: "input_text", Text: c.Text})
+            }
+        }
+        if len(item.Content) > 0 {
+            out = append(out, item)
+        }
+        for _, c := range m.ToolCalls {
+            out = append(out, responsesItem{Type: "function_call", CallID: c.ID, Name: c.Name, Arguments: c.Arguments})
+        }
+    }
+    return out
+}
+
+// Stream implements Client. Reasoning summaries are streamed as
+// ReasoningDelta events, paragraphs separated by a blank line.
+func (c *ResponsesClient) Stream(ctx context.Context, p Prompt, fn func(StreamEvent) error) (Response, error) {
+    req := responsesRequest{
+        Model:          p.Model,
+        Instructions:   p.Instructions,
+        Input:          responsesInput(p.Messages),
+        Stream:         true,
+        PromptCacheKey: p.CacheKey,
+    }
+    if req.Model == "" {
+        req.Model = DefaultModel
+    }
+    req.MaxOutputTokens = p.MaxOutputTokens
+    fam := LookupFamily(req.Model)
+    if fam.Reasoning || p.ReasoningEffort != "" && !fam.Known() {
+        req.Reasoning = &responsesReasoning{Effort: p.ReasoningEffort}
+        if fam.ReasoningSummaries || !fam.Known() {
+            req.Reasoning.Summary = "auto"
+        }
+        req.Include = []string{"reasoning.encrypted_content"}
+    }
+    if fam.Verbosity && p.Verbosity != "" {
+        req.Text = &responsesText{Verbosity: p.Verbosity}
+    }
+    for _, t := range p.Tools {
+        req.Tools = append(req.Tools, responsesTool{Type: "function", Name: t.Name, Description: t.Description, Parameters: t.Parameters})
+    }
+    if p.WebSearch {
+        req.Tools = append(req.Tools, responsesTool{Type: "web_search"})
+    }
+    if len(p.OutputSchema) > 0 {
+        if req.Text == nil {
+            req.Text = &responsesText{}
+        }
+        req.Text.Format = &responsesFormat{Type: "json_schema", Name: outputSchemaName, Schema: p.OutputSchema}
+    }
+    resp, err := postStream(ctx, c.Endpoint, "/responses", req)
+    if err != nil {
+        return Response{}, err
+    }
+    defer resp.Body.Close()
+
+    var out Response
+    var text strings.Builder
+    completed := false
+    summaryParts := 0
+    err = readSSE(resp.Body, func(_, data string) error {
+        var ev responsesEvent
+        if err := json.Unmarshal([]byte(data), &ev); err != nil {
+            return fmt.Errorf("model api: bad stream event: %w", err)
+        }
+        switch ev.Type {
+        case "response.output_text.delta":
+            text.WriteString(ev.Delta)
+            return fn(StreamEvent{Type: TextDelta, Delta: ev.Delta})
+        case "response.reasoning_summary_part.added":
+            summaryParts++
+            if summaryParts > 1 {
+                return fn(StreamEvent{Type: ReasoningDelta, Delta: "\n\n"})
+            }
+        case "response.reasoning_summary_text.delta":
+            return fn(StreamEvent{Type: ReasoningDelta, Delta: ev.Delta})
+        case "response.output_item.added":
+            if ev.Item.Type == "web_search_call" {
+                return fn(StreamEvent{Type: WebSearchBegin, CallID: ev.Item.ID, Query: ev.Item.query()})
+            }
+        case "response.output_item.done":
+            switch ev.Item.Type {
+            case "web_search_call":
+                // The search ran server-side; its results only show in the
+                // answer, so the item is not kept for later requests.
+                return fn(StreamEvent{Type: WebSearchEnd, CallID: ev.Item.ID, Query: ev.Item.query()})
+            case "reasoning":
+                r := Reasoning{ID: ev.Item.ID, EncryptedContent: ev.Item.EncryptedContent}
+                for _, s := range ev.Item.Summary {
+                    r.Summary = append(r.Summary, s.Text)
+                }
+                out.Reasoning = append(out.Reasoning, r)
+            case "function_call":
+                out.ToolCalls = append(out.ToolCalls, ToolCall{ID: ev.Item.CallID, Name: ev.Item.Name, Arguments: ev.Item.Arguments})
+            }
+        case "response.completed", "response.incomplete":
+            if u := ev.Response.Usage; u != nil {
+                out.Usage = &Usage{InputTokens: u.InputTokens, OutputTokens: u.OutputTokens, TotalTokens: u.TotalTokens}
+                if u.InputTokensDetails != nil {
+                    out.Usage.CachedInputTokens = u.InputTokensDetails.CachedTokens
+                }
+                if u.OutputTokensDetails != nil {
+                    out.Usage.ReasoningOutputTokens = u.OutputTokensDetails.ReasoningTokens
+                }
+            }
+            if d := ev.Response.IncompleteDetails; ev.Type == "response.incomplete" && d != nil && d.Reason == "max_output_tokens" {
+                return &APIError{StatusCode: http.StatusBadRequest, Code: "max_output_tokens", Message: "response incomplete: max_output_tokens"}
+            }
+            completed = true
+            return io.EOF
+        case "response.failed":
+            e := &APIError{StatusCode: http.StatusInternalServerError, Message: "response failed"}
+            if b := ev.Response.Error; b != nil {
+                e.Code, e.Message = errorCode(b.Code), b.Message
+                if e.Code == "rate_limit_exceeded" {
+                    e.StatusCode = http.StatusTooManyRequests
+                }
+                if e.Code == "context_length_exceeded" {
+                    e.StatusCode = http.StatusBadRequest
+                }
+            }
+            return e
+        case "error":
+            return &APIError{StatusCode: http.StatusInternalServerError, Code: ev.Code, Message: ev.Message}
+        }
+        return nil
+    })
+    if err != nil && err != io.EOF {
+        return Response{}, err
+    }
+    if !completed {
+        return Response{}, fmt.Errorf("model api: stream closed before response.completed")
+    }
+    out.Text = text.String()
+    return out, nil
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+    "errors"
+    "math/rand/v2"
+    "time"
+)
+
+// DefaultMaxRetries is how often a failed request is retried when the
+// provider config does not say otherwise.
+const DefaultMaxRetries = 3
+
+// Backoff bounds.
+const (
+    baseBackoff = time.Second
+    maxBackoff  = 30 * time.Second
+)
+
+// Retryable reports whether a request that failed with err may succeed if
+// sent again unchanged: rate limits, server errors, and failures that got
+// no HTTP answer at all (network errors, a stream cut short).
+func Retryable(err error) bool {
+    var apiErr *APIError
+    if errors.As(err, &apiErr) {
+        return apiErr.Retryable()
+    }
+    return err != nil
+}
+
+// Backoff returns how long to wait before retry number attempt (1 for the
+// first) of a request that failed with err. A Retry-After given by the
+// server is honored as is; otherwise the delay doubles from one second up
+// to 30 seconds, jittered by ±10% so clients that failed together do not
+// retry together.
+func Backoff(attempt int, err error) time.Duration {
+    var apiErr *APIError
+    if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+        return apiErr.RetryAfter
+    }
+    d := maxBackoff
+    if attempt < 16 {
+        d = min(baseBackoff<<(attempt-1), maxBackoff)
+    }
+    jitter := 0.9 + 0.2*rand.Float64()
+    return time.Duration(float64(d) * jitter)
+}
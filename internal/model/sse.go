@@ -0,0 +1,52 @@
+package model
+
+import (
+    "bufio"
+    "io"
+    "strings"
+)
+
+// readSSE parses a text/event-stream body, calling fn with each event's
+// name ("" when unnamed) and its data lines joined by "\n". Returning an
+// error from fn stops reading.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+    br := bufio.NewReader(r)
+    var event string
+    var data []string
+    dispatch := func() error {
+        if len(data) == 0 {
+            event = ""
+            return nil
+        }
+        err := fn(event, strings.Join(data, "\n"))
+        event, data = "", nil
+        return err
+    }
+    for {
+        line, err := br.ReadString('\n')
+        if line == "" && err != nil {
+            if err == io.EOF {
+                return dispatch()
+            }
+            return err
+        }
+        line = strings.TrimRight(line, "\r\n")
+        switch {
+        case line == "":
+            if err := dispatch(); err != nil {
+                return err
+            }
+        case strings.HasPrefix(line, ":"):
+            // comment / keep-alive
+        default:
+            field, value, _ := strings.Cut(line, ":")
+            value = strings.TrimPrefix(value, " ")
+            switch field {
+            case "event":
+                event = value
+            case "data":
+                data = append(data, value)
+            }
+        }
+    }
+}
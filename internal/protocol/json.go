@@ -0,0 +1,247 @@
+package protocol
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "sort"
+)
+
+// tagged union 的 JSON 编解码：
+// - 编码：每个变体自己实现 MarshalJSON，把 "type" 放在第一个字段。
+// - 解码：Submission/Event 的 UnmarshalJSON 先读出 "type"，再按注册表解码到
+//   对应变体；未注册的 type 解码为 UnknownOp/UnknownEvent。
+// 变体若实现 Validate() error，解码后会调用它做变体级校验。
+
+// opDecoders: op type -> 变体（零值 + 解码函数）。新增 Op 变体时在这里注册。
+var opDecoders = map[string]opVariant{
+    OpUserInput:        opOf[UserInputOp](),
+    OpInterrupt:        opOf[InterruptOp](),
+    OpConfigureSession: opOf[ConfigureSessionOp](),
+    OpResetSession:     opOf[ResetSessionOp](),
+    OpResumeSession:    opOf[ResumeSessionOp](),
+    OpForkSession:      opOf[ForkSessionOp](),
+    OpCompact:          opOf[CompactOp](),
+    OpUndoTurn:         opOf[UndoTurnOp](),
+    OpPatchApproval:    opOf[PatchApprovalOp](),
+    OpExecApproval:     opOf[ExecApprovalOp](),
+    OpShutdown:         opOf[ShutdownOp](),
+    OpListMcpTools:     opOf[ListMcpToolsOp](),
+    OpAddToHistory:     opOf[AddToHistoryOp](),
+    OpGetHistory:       opOf[GetHistoryOp](),
+    OpGetUsage:         opOf[GetUsageOp](),
+    OpReviewRequest:    opOf[ReviewRequestOp](),
+}
+
+// eventDecoders: event type -> 变体（零值 + 解码函数）。新增 EventMsg 变体时在这里注册。
+var eventDecoders = map[string]eventVariant{
+    EventTaskStarted:               eventOf[TaskStartedEvent](),
+    EventAgentMessage:              eventOf[AgentMessageEvent](),
+    EventAgentMessageDelta:         eventOf[AgentMessageDeltaEvent](),
+    EventAgentReasoningDelta:       eventOf[AgentReasoningDeltaEvent](),
+    EventTaskComplete:              eventOf[TaskCompleteEvent](),
+    EventTurnAborted:               eventOf[TurnAbortedEvent](),
+    EventUserInputQueued:           eventOf[UserInputQueuedEvent](),
+    EventTurnUndone:                eventOf[TurnUndoneEvent](),
+    EventError:                     eventOf[ErrorEvent](),
+    EventExecCommandBegin:          eventOf[ExecCommandBeginEvent](),
+    EventExecCommandEnd:            eventOf[ExecCommandEndEvent](),
+    EventPatchApplyBegin:           eventOf[ApplyPatchBeginEvent](),
+    EventPatchApplyEnd:             eventOf[ApplyPatchEndEvent](),
+    EventTokenCount:                eventOf[TokenCountEvent](),
+    EventSessionConfigured:         eventOf[SessionConfiguredEvent](),
+    EventSessionReset:              eventOf[SessionResetEvent](),
+    EventSessionResumed:            eventOf[SessionResumedEvent](),
+    EventSessionForked:             eventOf[SessionForkedEvent](),
+    EventApplyPatchApprovalRequest: eventOf[ApplyPatchApprovalRequestEvent](),
+    EventExecApprovalRequest:       eventOf[ExecApprovalRequestEvent](),
+    EventShutdownComplete:          eventOf[ShutdownCompleteEvent](),
+    EventTurnDiff:                  eventOf[TurnDiffEvent](),
+    EventPlanUpdate:                eventOf[PlanUpdateEvent](),
+    EventMcpListToolsResponse:      eventOf[McpListToolsResponseEvent](),
+    EventGetHistoryResponse:        eventOf[GetHistoryResponseEvent](),
+    EventGetUsageResponse:          eventOf[GetUsageResponseEvent](),
+    EventToolCallError:             eventOf[ToolCallErrorEvent](),
+    EventWebSearchBegin:            eventOf[WebSearchBeginEvent](),
+    EventWebSearchEnd:              eventOf[WebSearchEndEvent](),
+    EventBackground:                eventOf[BackgroundEvent](),
+    EventStreamError:               eventOf[StreamErrorEvent](),
+    EventReviewOutput:              eventOf[ReviewOutputEvent](),
+}
+
+type opVariant struct {
+    zero   Op
+    decode func([]byte) (Op, error)
+}
+
+type eventVariant struct {
+    zero   EventMsg
+    decode func([]byte) (EventMsg, error)
+}
+
+func opOf[T Op]() opVariant {
+    var zero T
+    return opVariant{zero: zero, decode: decodeOp[T]}
+}
+
+func eventOf[T EventMsg]() eventVariant {
+    var zero T
+    return eventVariant{zero: zero, decode: decodeEvent[T]}
+}
+
+// OpVariants 返回所有已注册 Op 变体的零值，按 type 排序（供 schema 生成等使用）。
+func OpVariants() []Op {
+    out := make([]Op, 0, len(opDecoders))
+    for _, v := range opDecoders {
+        out = append(out, v.zero)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].OpType() < out[j].OpType() })
+    return out
+}
+
+// EventVariants 返回所有已注册 EventMsg 变体的零值，按 type 排序。
+func EventVariants() []EventMsg {
+    out := make([]EventMsg, 0, len(eventDecoders))
+    for _, v := range eventDecoders {
+        out = append(out, v.zero)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].EventType() < out[j].EventType() })
+    return out
+}
+
+// validator 由需要变体级校验的类型实现。
+type validator interface {
+    Validate() error
+}
+
+// marshalTagged 编码 v，并在最前面插入 "type":tag。
+func marshalTagged(tag string, v any) ([]byte, error) {
+    body, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    t, err := json.Marshal(tag)
+    if err != nil {
+        return nil, err
+    }
+    var buf bytes.Buffer
+    buf.WriteString(`{"type":`)
+    buf.Write(t)
+    if inner := bytes.TrimSpace(body[1 : len(body)-1]); len(inner) > 0 {
+        buf.WriteByte(',')
+        buf.Write(inner)
+    }
+    buf.WriteByte('}')
+    return buf.Bytes(), nil
+}
+
+// readType 取出对象的 "type" 字段。
+func readType(data []byte) (string, error) {
+    var head struct {
+        Type *string `json:"type"`
+    }
+    if err := json.Unmarshal(data, &head); err != nil {
+        return "", err
+    }
+    if head.Type == nil {
+        return "", fmt.Errorf("missing type")
+    }
+    return *head.Type, nil
+}
+
+func validate(v any) error {
+    if vv, ok := v.(validator); ok {
+        return vv.Validate()
+    }
+    return nil
+}
+
+func decodeOp[T Op](data []byte) (Op, error) {
+    var v T
+    if err := json.Unmarshal(data, &v); err != nil {
+        return nil, err
+    }
+    return v, validate(v)
+}
+
+func decodeEvent[T EventMsg](data []byte) (EventMsg, error) {
+    var v T
+    if err := json.Unmarshal(data, &v); err != nil {
+        return nil, err
+    }
+    return v, validate(v)
+}
+
+// DecodeOp 解码单个 op 对象。
+func DecodeOp(data []byte) (Op, error) {
+    t, err := readType(data)
+    if err != nil {
+        return nil, fmt.Errorf("op: %w", err)
+    }
+    v, ok := opDecoders[t]
+    if !ok {
+        return UnknownOp{Type: t, Raw: append([]byte(nil), data...)}, nil
+    }
+    op, err := v.decode(data)
+    if err != nil {
+        return nil, fmt.Errorf("op %s: %w", t, err)
+    }
+    return op, nil
+}
+
+// DecodeEventMsg 解码单个 msg 对象。
+func DecodeEventMsg(data []byte) (EventMsg, error) {
+    t, err := readType(data)
+    if err != nil {
+        return nil, fmt.Errorf("msg: %w", err)
+    }
+    v, ok := eventDecoders[t]
+    if !ok {
+        return UnknownEvent{Type: t, Raw: append([]byte(nil), data...)}, nil
+    }
+    msg, err := v.decode(data)
+    if err != nil {
+        return nil, fmt.Errorf("msg %s: %w", t, err)
+    }
+    return msg, nil
+}
+
+func (s *Submission) UnmarshalJSON(data []byte) error {
+    var raw struct {
+        ID string          `json:"id"`
+        Op json.RawMessage `json:"op"`
+    }
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return err
+    }
+    if len(raw.Op) == 0 || string(raw.Op) == "null" {
+        return fmt.Errorf("submission %q: missing op", raw.ID)
+    }
+    op, err := DecodeOp(raw.Op)
+    if err != nil {
+        return err
+    }
+    s.ID, s.Op = raw.ID, op
+    return nil
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+    var raw struct {
+        ID     string          `json:"id"`
+        Seq    uint64          `json:"seq"`
+        TurnID string          `json:"turn_id"`
+        Msg    json.RawMessage `json:"msg"`
+    }
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return err
+    }
+    if len(raw.Msg) == 0 || string(raw.Msg) == "null" {
+        return fmt.Errorf("event %q: missing msg", raw.ID)
+    }
+    msg, err := DecodeEventMsg(raw.Msg)
+    if err != nil {
+        return err
+    }
+    *e = Event{ID: raw.ID, Seq: raw.Seq, TurnID: raw.TurnID, Msg: msg}
+    return nil
+}
@@ -0,0 +1,117 @@
+package protocol
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+)
+
+// SandboxPolicy: 沙箱策略的完整形式，由 internal/exec（执行命令）、配置
+// （[sandbox_workspace_write]）、审批（apply_patch 何时需确认）共用。
+// Mode 即 sandbox_policy 的取值，空表示 read-only；其余字段只在
+// workspace-write 下生效：
+//   - WritableRoots：cwd 之外另外可写的目录（含其下所有内容）；
+//   - ExcludeTmpdir：临时目录（$TMPDIR 与 /tmp）不再可写；
+//   - WriteDotfiles：可写目录中的 .git 与顶层点文件（.env、.github 等）
+//     也可写；默认只读，以免命令改写历史、安装 hook 或改动项目配置；
+//   - NetworkAccess：允许访问网络（read-only 下也生效）。
+type SandboxPolicy struct {
+    Mode          string   `json:"mode"`
+    WritableRoots []string `json:"writable_roots,omitempty"`
+    NetworkAccess bool     `json:"network_access,omitempty"`
+    ExcludeTmpdir bool     `json:"exclude_tmpdir,omitempty"`
+    WriteDotfiles bool     `json:"write_dotfiles,omitempty"`
+}
+
+// Validate: Mode 必须是已知取值，WritableRoots 必须是绝对路径。
+func (p SandboxPolicy) Validate() error {
+    switch p.Mode {
+    case "", SandboxReadOnly, SandboxWorkspaceWrite, SandboxDangerFullAccess:
+    default:
+        return fmt.Errorf("unknown sandbox mode %q", p.Mode)
+    }
+    for _, r := range p.WritableRoots {
+        if !filepath.IsAbs(r) {
+            return fmt.Errorf("writable root %q is not an absolute path", r)
+        }
+    }
+    return nil
+}
+
+// Confines 表示策略是否限制命令（danger-full-access 不限制）。
+func (p SandboxPolicy) Confines() bool { return p.Mode != SandboxDangerFullAccess }
+
+// Roots 返回 workspace-write 下可写的工作目录：cwd 与 WritableRoots，
+// 均为绝对路径；其他模式返回 nil。点文件保护只针对这些目录。
+func (p SandboxPolicy) Roots(cwd string) []string {
+    if p.Mode != SandboxWorkspaceWrite {
+        return nil
+    }
+    var roots []string
+    for _, r := range append([]string{cwd}, p.WritableRoots...) {
+        if r == "" {
+            continue
+        }
+        if abs, err := filepath.Abs(r); err == nil {
+            roots = append(roots, abs)
+        }
+    }
+    return roots
+}
+
+// TempDirs 返回 workspace-write 下可写的临时目录（除非 ExcludeTmpdir）。
+func (p SandboxPolicy) TempDirs() []string {
+    if p.Mode != SandboxWorkspaceWrite || p.ExcludeTmpdir {
+        return nil
+    }
+    dirs := []string{os.TempDir()}
+    if runtime.GOOS != "windows" && dirs[0] != "/tmp" {
+        dirs = append(dirs, "/tmp")
+    }
+    return dirs
+}
+
+// IsWritable 表示在 cwd 中按此策略能否写 path（绝对路径）：
+// danger-full-access 处处可写，read-only 处处不可写，workspace-write
+// 只能写 Roots 与 TempDirs 之下、且不是受保护点文件的路径。
+func (p SandboxPolicy) IsWritable(cwd, path string) bool {
+    switch p.Mode {
+    case SandboxDangerFullAccess:
+        return true
+    case SandboxWorkspaceWrite:
+    default:
+        return false
+    }
+    roots := p.Roots(cwd)
+    if !p.WriteDotfiles {
+        for _, r := range roots {
+            if IsDotfilePath(r, path) {
+                return false
+            }
+        }
+    }
+    for _, d := range append(roots, p.TempDirs()...) {
+        if withinDir(d, path) {
+            return true
+        }
+    }
+    return false
+}
+
+// IsDotfilePath 表示 path 是否是 root 的顶层点文件（如 .git、.env）或在其之下。
+func IsDotfilePath(root, path string) bool {
+    rel, err := filepath.Rel(root, path)
+    if err != nil || rel == "." || !withinDir(root, path) {
+        return false
+    }
+    first, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+    return strings.HasPrefix(first, ".")
+}
+
+// withinDir 表示 path 是否是 dir 本身或在其之下。
+func withinDir(dir, path string) bool {
+    rel, err := filepath.Rel(dir, path)
+    return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,197 @@
+// Package schema 由 protocol 包的 Go 类型反射生成 JSON Schema（draft 2020-12），
+// 供非 Go 客户端生成类型或校验帧。仓库中的 schema/protocol.schema.json 由
+// go generate 产生，修改 protocol 后需重新生成。
+package schema
+
+//go:generate go run ../../../cmd/codex generate-schema -o ../../../schema/protocol.schema.json
+
+import (
+    "encoding/json"
+    "reflect"
+    "strings"
+
+    "codex-go/internal/protocol"
+)
+
+// Draft 是生成的文档所遵循的 JSON Schema 版本。
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// enums: 具名字符串类型的取值。反射无法列举常量，新增取值时需同步这里。
+var enums = map[reflect.Type][]string{
+    reflect.TypeOf(protocol.ReviewDecision("")): {
+        string(protocol.ReviewApproved),
+        string(protocol.ReviewApprovedForSession),
+        string(protocol.ReviewDenied),
+        string(protocol.ReviewAbort),
+    },
+    reflect.TypeOf(protocol.StepStatus("")): {
+        string(protocol.StepPending),
+        string(protocol.StepInProgress),
+        string(protocol.StepCompleted),
+    },
+    reflect.TypeOf(protocol.ReviewSeverity("")): {
+        string(protocol.SeverityCritical),
+        string(protocol.SeverityHigh),
+        string(protocol.SeverityMedium),
+        string(protocol.SeverityLow),
+    },
+    reflect.TypeOf(protocol.TurnAbortReason("")): {
+        string(protocol.TurnAbortInterrupted),
+    },
+    reflect.TypeOf(protocol.ErrorCode("")): {
+        string(protocol.ErrInvalidRequest),
+        string(protocol.ErrInterrupted),
+        string(protocol.ErrTimeout),
+        string(protocol.ErrModelRateLimited),
+        string(protocol.ErrModelUnavailable),
+        string(protocol.ErrContextWindowExceeded),
+        string(protocol.ErrSandboxDenied),
+        string(protocol.ErrInvalidOutput),
+        string(protocol.ErrInternal),
+    },
+}
+
+var (
+    opType       = reflect.TypeOf((*protocol.Op)(nil)).Elem()
+    eventMsgType = reflect.TypeOf((*protocol.EventMsg)(nil)).Elem()
+    rawType      = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// Schema 是一个 JSON Schema 节点。
+type Schema = map[string]any
+
+// Generate 返回完整的 schema 文档：根节点匹配一帧 Submission 或 Event，
+// 各类型定义在 $defs 中（以 Go 类型名命名）。
+func Generate() Schema {
+    g := &generator{defs: map[string]any{}}
+
+    ops := []any{}
+    for _, op := range protocol.OpVariants() {
+        ops = append(ops, g.variant(reflect.TypeOf(op), op.OpType()))
+    }
+    g.defs["Op"] = Schema{"oneOf": ops}
+
+    events := []any{}
+    for _, ev := range protocol.EventVariants() {
+        events = append(events, g.variant(reflect.TypeOf(ev), ev.EventType()))
+    }
+    g.defs["EventMsg"] = Schema{"oneOf": events}
+
+    return Schema{
+        "$schema": Draft,
+        "title":   "Codex SQ/EQ protocol",
+        "anyOf":   []any{g.ref(reflect.TypeOf(protocol.Submission{})), g.ref(reflect.TypeOf(protocol.Event{}))},
+        "$defs":   g.defs,
+    }
+}
+
+// JSON 返回缩进后的 Generate() 结果（键按字母序，输出稳定）。
+func JSON() ([]byte, error) {
+    b, err := json.MarshalIndent(Generate(), "", "  ")
+    if err != nil {
+        return nil, err
+    }
+    return append(b, '\n'), nil
+}
+
+type generator struct {
+    defs map[string]any
+}
+
+func defRef(name string) Schema { return Schema{"$ref": "#/$defs/" + name} }
+
+// variant 定义一个 tagged union 变体：结构体字段加上 "type" 常量。
+func (g *generator) variant(t reflect.Type, tag string) Schema {
+    s := g.object(t)
+    s["properties"].(Schema)["type"] = Schema{"const": tag}
+    s["required"] = append([]string{"type"}, s["required"].([]string)...)
+    g.defs[t.Name()] = s
+    return defRef(t.Name())
+}
+
+// ref 为具名结构体/枚举生成 $defs 条目并返回引用，其余类型内联。
+func (g *generator) ref(t reflect.Type) Schema {
+    switch {
+    case t == opType:
+        return defRef("Op")
+    case t == eventMsgType:
+        return defRef("EventMsg")
+    case t == rawType:
+        return Schema{}
+    }
+    if vals, ok := enums[t]; ok {
+        if _, done := g.defs[t.Name()]; !done {
+            g.defs[t.Name()] = Schema{"type": "string", "enum": vals}
+        }
+        return defRef(t.Name())
+    }
+    if t.Kind() == reflect.Struct && t.Name() != "" {
+        if _, done := g.defs[t.Name()]; !done {
+            g.defs[t.Name()] = Schema{} // 占位，防止递归
+            g.defs[t.Name()] = g.object(t)
+        }
+        return defRef(t.Name())
+    }
+    return g.inline(t)
+}
+
+func (g *generator) inline(t reflect.Type) Schema {
+    switch t.Kind() {
+    case reflect.Pointer:
+        return g.ref(t.Elem())
+    case reflect.String:
+        return Schema{"type": "string"}
+    case reflect.Bool:
+        return Schema{"type": "boolean"}
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return Schema{"type": "integer"}
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return Schema{"type": "integer", "minimum": 0}
+    case reflect.Float32, reflect.Float64:
+        return Schema{"type": "number"}
+    case reflect.Slice, reflect.Array:
+        return Schema{"type": "array", "items": g.ref(t.Elem())}
+    case reflect.Map:
+        return Schema{"type": "object", "additionalProperties": g.ref(t.Elem())}
+    case reflect.Struct:
+        return g.object(t)
+    }
+    return Schema{}
+}
+
+// object 按 encoding/json 的规则描述结构体：json tag 决定字段名，
+// 没有 omitempty 的字段为 required，匿名嵌入的结构体字段被展开。
+func (g *generator) object(t reflect.Type) Schema {
+    props := Schema{}
+    required := []string{}
+    g.fields(t, props, &required)
+    return Schema{"type": "object", "properties": props, "required": required}
+}
+
+func (g *generator) fields(t reflect.Type, props Schema, required *[]string) {
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        tag := f.Tag.Get("json")
+        if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+            continue
+        }
+        name, opts, _ := strings.Cut(tag, ",")
+        if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+            g.fields(f.Type, props, required)
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+        s := g.ref(f.Type)
+        omitempty := strings.Contains(","+opts+",", ",omitempty,")
+        if !omitempty {
+            *required = append(*required, name)
+            // encoding/json 把 nil 切片/映射编码为 null。
+            if k := f.Type.Kind(); (k == reflect.Slice || k == reflect.Map) && f.Type != rawType {
+                s = Schema{"anyOf": []any{s, Schema{"type": "null"}}}
+            }
+        }
+        props[name] = s
+    }
+}
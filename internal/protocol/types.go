@@ -1,68 +1,1368 @@
 package protocol
 
+import (
+    "encoding/json"
+    "fmt"
+)
+
 // Minimal protocol v1 core for a first learning iteration.
 // SQ/EQ 模型（最小实现）：
 // - UI -> Agent: Submission { id, op }
 // - Agent -> UI: Event { id, msg }
-// - Op/EventMsg 使用 "type" 作为判别字段；仅保留最少必要的几类。
+// - Op/EventMsg 使用 "type" 作为判别字段；每个变体对应一个具体的 struct，
+//   编解码见 json.go（线上格式与最初的扁平结构保持一致）。
 
 // Submission: UI 发送给 Agent 的一条请求。id 用于回溯匹配后续 Event。
 type Submission struct {
     ID string `json:"id"`
-    Op Op    `json:"op"`
+    Op Op     `json:"op"`
+}
+
+// Op: 提交的具体操作（tagged union）。具体类型：
+// - UserInputOp  ("user_input")
+// - InterruptOp  ("interrupt")：中止正在执行的一轮，该轮以 turn_aborted 结束
+// - ConfigureSessionOp ("configure_session")
+// - ResetSessionOp ("reset_session")：清空对话上下文，回应 session_reset
+// - CompactOp ("compact")：把之前的对话压缩为摘要，作为一轮执行
+// - UndoTurnOp ("undo_turn")：撤销最近一轮对文件的修改，回应 turn_undone
+// - ResumeSessionOp ("resume_session")：从 rollout 文件恢复之前的会话，回应 session_resumed
+// - ForkSessionOp ("fork_session")：从之前会话的某一轮分出新会话，回应 session_forked
+// - PatchApprovalOp ("patch_approval")：回应 apply_patch_approval_request
+// - ExecApprovalOp ("exec_approval")：回应 exec_approval_request
+// - ShutdownOp   ("shutdown")：处理完之前的提交后结束会话
+// - ListMcpToolsOp ("list_mcp_tools")：查询当前可用的工具
+// - ReviewRequestOp ("review_request")：审查一段改动，结果为 review_output
+// - AddToHistoryOp / GetHistoryOp ("add_to_history" / "get_history")：跨会话的输入历史
+// - GetUsageOp   ("get_usage")：查询会话累计的 token 用量与费用，回应 get_usage_response
+// - UnknownOp    (无法识别的 type，原样保留)
+type Op interface {
+    // OpType 返回线上的 "type" 判别值。
+    OpType() string
+}
+
+const (
+    OpUserInput        = "user_input"
+    OpInterrupt        = "interrupt"
+    OpConfigureSession = "configure_session"
+    OpResetSession     = "reset_session"
+    OpResumeSession    = "resume_session"
+    OpForkSession      = "fork_session"
+    OpCompact          = "compact"
+    OpUndoTurn         = "undo_turn"
+    OpPatchApproval    = "patch_approval"
+    OpExecApproval     = "exec_approval"
+    OpShutdown         = "shutdown"
+    OpListMcpTools     = "list_mcp_tools"
+    OpAddToHistory     = "add_to_history"
+    OpGetHistory       = "get_history"
+    OpGetUsage         = "get_usage"
+    OpReviewRequest    = "review_request"
+)
+
+// UserInputOp: 用户输入，items=[{type:"text", text:"..."}, ...]
+// 其余字段可选，只对这一轮生效（不改变会话设置）；生效值在 task_started 中回显。
+// output_schema 是最终回答须符合的 JSON Schema：Agent 校验回答，并把它放进
+// task_complete 的 output。
+type UserInputOp struct {
+    Items           []InputItem     `json:"items,omitempty"`
+    Model           string          `json:"model,omitempty"`
+    ReasoningEffort string          `json:"reasoning_effort,omitempty"`
+    Cwd             string          `json:"cwd,omitempty"`
+    ApprovalPolicy  string          `json:"approval_policy,omitempty"`
+    SandboxPolicy   string          `json:"sandbox_policy,omitempty"`
+    OutputSchema    json.RawMessage `json:"output_schema,omitempty"`
+}
+
+func (UserInputOp) OpType() string { return OpUserInput }
+
+// Validate: 每个输入项都必须带 type（不认识的 type 由 Agent 忽略），
+// 图片项必须带各自的 image_url / path；覆盖项必须是已知的枚举值。
+func (o UserInputOp) Validate() error {
+    if err := validateSettings(o.ApprovalPolicy, o.SandboxPolicy); err != nil {
+        return err
+    }
+    switch o.ReasoningEffort {
+    case "", EffortMinimal, EffortLow, EffortMedium, EffortHigh:
+    default:
+        return fmt.Errorf("unknown reasoning_effort %q", o.ReasoningEffort)
+    }
+    for i, it := range o.Items {
+        switch {
+        case it.Type == "":
+            return fmt.Errorf("items[%d]: missing type", i)
+        case it.Type == InputImage && it.ImageURL == "":
+            return fmt.Errorf("items[%d]: image requires image_url", i)
+        case it.Type == InputLocalImage && it.Path == "":
+            return fmt.Errorf("items[%d]: local_image requires path", i)
+        }
+    }
+    return nil
+}
+
+func (o UserInputOp) MarshalJSON() ([]byte, error) {
+    type plain UserInputOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// InterruptOp: 中断当前任务，无额外字段。
+type InterruptOp struct{}
+
+func (InterruptOp) OpType() string { return OpInterrupt }
+
+func (o InterruptOp) MarshalJSON() ([]byte, error) {
+    return marshalTagged(o.OpType(), struct{}{})
+}
+
+// 审批策略（approval_policy）：何时需要用户确认 Agent 执行的命令。
+const (
+    ApprovalUntrusted = "untrusted"  // 除已知安全的只读命令外都需确认
+    ApprovalOnFailure = "on-failure" // 沙箱内执行失败后才请求确认
+    ApprovalOnRequest = "on-request" // 由模型决定何时请求确认
+    ApprovalNever     = "never"      // 从不请求确认
+)
+
+// 沙箱策略（sandbox_policy）。
+const (
+    SandboxReadOnly         = "read-only"
+    SandboxWorkspaceWrite   = "workspace-write"
+    SandboxDangerFullAccess = "danger-full-access"
+)
+
+// 推理强度（reasoning_effort），仅对支持推理的模型有效；省略表示模型默认值。
+const (
+    EffortMinimal = "minimal"
+    EffortLow     = "low"
+    EffortMedium  = "medium"
+    EffortHigh    = "high"
+)
+
+// ConfigureSessionOp: 在发送 user_input 之前协商会话参数。所有字段可选，
+// 省略的字段保持当前值。Agent 以 session_configured 事件回复生效后的设置。
+type ConfigureSessionOp struct {
+    Model          string `json:"model,omitempty"`
+    Cwd            string `json:"cwd,omitempty"`
+    ApprovalPolicy string `json:"approval_policy,omitempty"`
+    SandboxPolicy  string `json:"sandbox_policy,omitempty"`
+    Instructions   string `json:"instructions,omitempty"` // 追加给模型的用户指令
+}
+
+func (ConfigureSessionOp) OpType() string { return OpConfigureSession }
+
+func (o ConfigureSessionOp) MarshalJSON() ([]byte, error) {
+    type plain ConfigureSessionOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// Validate: 策略取值必须是已知的枚举值。
+func (o ConfigureSessionOp) Validate() error {
+    return validateSettings(o.ApprovalPolicy, o.SandboxPolicy)
+}
+
+// validateSettings 检查可选的 approval_policy / sandbox_policy 取值。
+func validateSettings(approvalPolicy, sandboxPolicy string) error {
+    switch approvalPolicy {
+    case "", ApprovalUntrusted, ApprovalOnFailure, ApprovalOnRequest, ApprovalNever:
+    default:
+        return fmt.Errorf("unknown approval_policy %q", approvalPolicy)
+    }
+    switch sandboxPolicy {
+    case "", SandboxReadOnly, SandboxWorkspaceWrite, SandboxDangerFullAccess:
+    default:
+        return fmt.Errorf("unknown sandbox_policy %q", sandboxPolicy)
+    }
+    return nil
+}
+
+// ShutdownOp: 显式结束会话。Agent 先处理完排在它之前的提交，保存会话，
+// 然后发送 shutdown_complete 并退出；之后的输入不再处理。
+type ShutdownOp struct{}
+
+func (ShutdownOp) OpType() string { return OpShutdown }
+
+func (o ShutdownOp) MarshalJSON() ([]byte, error) {
+    return marshalTagged(o.OpType(), struct{}{})
+}
+
+// ListMcpToolsOp: 查询 Agent 当前可用的工具（内置 + 外部 MCP 服务器），
+// 以 mcp_list_tools_response 回应。不排在进行中的一轮之后。
+type ListMcpToolsOp struct{}
+
+func (ListMcpToolsOp) OpType() string { return OpListMcpTools }
+
+func (o ListMcpToolsOp) MarshalJSON() ([]byte, error) {
+    return marshalTagged(o.OpType(), struct{}{})
 }
 
-// Op: 提交的具体操作（最小子集）。
-// - "user_input": items=[{type:"text", text:"..."}, ...]
-// - "interrupt": 无额外字段
-type Op struct {
-    Type  string      `json:"type"`           // "user_input" | "interrupt"
-    Items []InputItem `json:"items,omitempty"` // 仅当 type=="user_input" 时使用
+// GetUsageOp: 查询会话至今按模型分列的 token 用量与估算费用，以
+// get_usage_response 回应。不排在进行中的一轮之后。
+type GetUsageOp struct{}
+
+func (GetUsageOp) OpType() string { return OpGetUsage }
+
+func (o GetUsageOp) MarshalJSON() ([]byte, error) {
+    return marshalTagged(o.OpType(), struct{}{})
+}
+
+// AddToHistoryOp: 把一条用户输入追加到持久化的历史文件（跨会话共享），
+// 供之后的 get_history 取回。成功时没有回应事件。
+type AddToHistoryOp struct {
+    Text string `json:"text"`
+}
+
+func (AddToHistoryOp) OpType() string { return OpAddToHistory }
+
+func (o AddToHistoryOp) MarshalJSON() ([]byte, error) {
+    type plain AddToHistoryOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// Validate: text 必填。
+func (o AddToHistoryOp) Validate() error {
+    if o.Text == "" {
+        return fmt.Errorf("missing text")
+    }
+    return nil
+}
+
+// GetHistoryOp: 读取历史记录，从 offset（0 为最早的一条）开始最多 limit 条
+// （0 表示默认值），以 get_history_response 回应。
+type GetHistoryOp struct {
+    Offset int `json:"offset"`
+    Limit  int `json:"limit,omitempty"`
+}
+
+func (GetHistoryOp) OpType() string { return OpGetHistory }
+
+func (o GetHistoryOp) MarshalJSON() ([]byte, error) {
+    type plain GetHistoryOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// Validate: offset/limit 不能为负。
+func (o GetHistoryOp) Validate() error {
+    if o.Offset < 0 || o.Limit < 0 {
+        return fmt.Errorf("offset and limit must not be negative")
+    }
+    return nil
+}
+
+// 审查对象（review target）的种类。
+const (
+    ReviewTargetDiff    = "diff"    // 工作区（含暂存区）相对 base 的改动，base 默认 HEAD
+    ReviewTargetCommits = "commits" // 提交区间的改动，range 形如 "main..HEAD"
+    ReviewTargetPaths   = "paths"   // 指定文件的当前内容
+)
+
+// ReviewTarget: 要审查的内容，按 type 使用对应字段。
+type ReviewTarget struct {
+    Type  string   `json:"type"`
+    Base  string   `json:"base,omitempty"`  // diff
+    Range string   `json:"range,omitempty"` // commits
+    Paths []string `json:"paths,omitempty"` // paths
+}
+
+// ReviewRequestOp: 以一轮的形式审查 target，产生 review_output 事件。
+// instructions 可追加审查重点（可选）。
+type ReviewRequestOp struct {
+    Target       ReviewTarget `json:"target"`
+    Instructions string       `json:"instructions,omitempty"`
+}
+
+func (ReviewRequestOp) OpType() string { return OpReviewRequest }
+
+func (o ReviewRequestOp) MarshalJSON() ([]byte, error) {
+    type plain ReviewRequestOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// Validate: target 的 type 必须已知，且带有该类型所需的字段。
+func (o ReviewRequestOp) Validate() error {
+    switch t := o.Target; t.Type {
+    case ReviewTargetDiff:
+    case ReviewTargetCommits:
+        if t.Range == "" {
+            return fmt.Errorf("target commits requires range")
+        }
+    case ReviewTargetPaths:
+        if len(t.Paths) == 0 {
+            return fmt.Errorf("target paths requires paths")
+        }
+    case "":
+        return fmt.Errorf("missing target type")
+    default:
+        return fmt.Errorf("unknown target type %q", t.Type)
+    }
+    return nil
 }
 
+// ReviewDecision: 用户对审批请求的决定。
+type ReviewDecision string
+
 const (
-    OpUserInput = "user_input"
-    OpInterrupt = "interrupt"
+    ReviewApproved           ReviewDecision = "approved"             // 本次允许
+    ReviewApprovedForSession ReviewDecision = "approved_for_session" // 本会话内同类请求不再询问
+    ReviewDenied             ReviewDecision = "denied"               // 拒绝，Agent 继续本轮
+    ReviewAbort              ReviewDecision = "abort"                // 拒绝并中止本轮
 )
 
-// InputItem: 用户输入项（最小实现只支持文本）。
+// Valid 报告 d 是否为已知取值。
+func (d ReviewDecision) Valid() bool {
+    switch d {
+    case ReviewApproved, ReviewApprovedForSession, ReviewDenied, ReviewAbort:
+        return true
+    }
+    return false
+}
+
+// PatchApprovalOp: 客户端对 apply_patch_approval_request 的答复，call_id 与请求相同。
+type PatchApprovalOp struct {
+    CallID   string         `json:"call_id"`
+    Decision ReviewDecision `json:"decision"`
+}
+
+func (PatchApprovalOp) OpType() string { return OpPatchApproval }
+
+func (o PatchApprovalOp) MarshalJSON() ([]byte, error) {
+    type plain PatchApprovalOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// Validate: call_id 必填，decision 必须是已知取值。
+func (o PatchApprovalOp) Validate() error {
+    if o.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    if !o.Decision.Valid() {
+        return fmt.Errorf("unknown decision %q", o.Decision)
+    }
+    return nil
+}
+
+// ResetSessionOp: 清空会话的对话上下文（之前各轮的消息、工具调用与结果），
+// 之后的 user_input 从空白对话开始。会话设置、本会话内的审批与累计
+// token 用量保持不变。排在之前提交的各轮之后执行。
+type ResetSessionOp struct{}
+
+func (ResetSessionOp) OpType() string { return OpResetSession }
+
+func (o ResetSessionOp) MarshalJSON() ([]byte, error) {
+    return marshalTagged(o.OpType(), struct{}{})
+}
+
+// CompactOp: 让模型把目前的对话总结为摘要，用摘要替换较早的各轮（最近
+// 一轮原样保留），以腾出上下文窗口。作为一轮执行：task_started、
+// background_event、token_count、background_event、task_complete。
+// 对话接近上下文窗口时也会在一轮结束后自动压缩。
+type CompactOp struct{}
+
+func (CompactOp) OpType() string { return OpCompact }
+
+func (o CompactOp) MarshalJSON() ([]byte, error) {
+    return marshalTagged(o.OpType(), struct{}{})
+}
+
+// UndoTurnOp: 撤销本会话最近一轮（尚未撤销的、修改过文件的一轮）对工作区
+// 的修改。每轮开始和结束时工作区都被记录为隐藏的 git 提交（ghost commit，
+// 位于 refs/codex/ghost/ 下，不改动用户的分支与暂存区），撤销时把该轮改动
+// 过的文件恢复为开始时的内容、删除该轮新建的文件（包括未跟踪的文件）。
+// 之后又被改动过的文件会使撤销整体失败（invalid_request），不修改任何文件。
+// 对话内容不变。再次提交则撤销更早的一轮。
+type UndoTurnOp struct{}
+
+func (UndoTurnOp) OpType() string { return OpUndoTurn }
+
+func (o UndoTurnOp) MarshalJSON() ([]byte, error) {
+    return marshalTagged(o.OpType(), struct{}{})
+}
+
+// ResumeSessionOp: 从记录的 rollout 文件恢复会话并继续：session_id、path
+// （rollout 文件路径）与 last（最近的一次会话）三者恰好指定一个。必须在
+// 第一轮之前提交。之前各轮的事件按原顺序重放（保留原 id 与 turn_id，
+// seq 重新编号，不含流式增量），最后回应 session_resumed；之后的各轮
+// 带着恢复的对话上下文继续，并追加记录到同一个 rollout 文件。
+type ResumeSessionOp struct {
+    SessionID string `json:"session_id,omitempty"`
+    Path      string `json:"path,omitempty"`
+    Last      bool   `json:"last,omitempty"`
+}
+
+func (ResumeSessionOp) OpType() string { return OpResumeSession }
+
+func (o ResumeSessionOp) MarshalJSON() ([]byte, error) {
+    type plain ResumeSessionOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// Validate: session_id、path、last 恰好指定一个。
+func (o ResumeSessionOp) Validate() error {
+    n := 0
+    for _, set := range []bool{o.SessionID != "", o.Path != "", o.Last} {
+        if set {
+            n++
+        }
+    }
+    if n != 1 {
+        return fmt.Errorf("exactly one of session_id, path and last is required")
+    }
+    return nil
+}
+
+// ForkSessionOp: 从记录的会话分出一个新会话：session_id、path、last 的含义
+// 与 resume_session 相同，恰好指定一个。turn_id 为分叉点，新会话包含原会话
+// 直到该轮结束的对话与事件；省略时复制整个会话。原 rollout 文件不受影响，
+// 新会话使用新的 session id 记录到新的 rollout 文件。必须在第一轮之前提交；
+// 之前的事件同 resume_session 一样重放，最后回应 session_forked。
+type ForkSessionOp struct {
+    SessionID string `json:"session_id,omitempty"`
+    Path      string `json:"path,omitempty"`
+    Last      bool   `json:"last,omitempty"`
+    TurnID    string `json:"turn_id,omitempty"`
+}
+
+func (ForkSessionOp) OpType() string { return OpForkSession }
+
+func (o ForkSessionOp) MarshalJSON() ([]byte, error) {
+    type plain ForkSessionOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// Validate: session_id、path、last 恰好指定一个。
+func (o ForkSessionOp) Validate() error {
+    return ResumeSessionOp{SessionID: o.SessionID, Path: o.Path, Last: o.Last}.Validate()
+}
+
+// ExecApprovalOp: 客户端对 exec_approval_request 的答复，call_id 与请求相同。
+type ExecApprovalOp struct {
+    CallID   string         `json:"call_id"`
+    Decision ReviewDecision `json:"decision"`
+}
+
+func (ExecApprovalOp) OpType() string { return OpExecApproval }
+
+func (o ExecApprovalOp) MarshalJSON() ([]byte, error) {
+    type plain ExecApprovalOp
+    return marshalTagged(o.OpType(), plain(o))
+}
+
+// Validate: call_id 必填，decision 必须是已知取值。
+func (o ExecApprovalOp) Validate() error {
+    if o.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    if !o.Decision.Valid() {
+        return fmt.Errorf("unknown decision %q", o.Decision)
+    }
+    return nil
+}
+
+// UnknownOp: 本端不认识的 op。保留原始 JSON 以便转发，交由 Agent 决定如何报错。
+type UnknownOp struct {
+    Type string
+    Raw  []byte
+}
+
+func (o UnknownOp) OpType() string { return o.Type }
+
+func (o UnknownOp) MarshalJSON() ([]byte, error) { return o.Raw, nil }
+
+// InputItem: 用户输入项。
+//   - text: 文本，text 必填
+//   - image: 远程或 data: URI 图片，image_url 必填
+//   - local_image: Agent 所在机器上的图片文件，path 必填（相对路径基于 cwd），
+//     由 Agent 读取并转换为 data: URI 后交给模型
 type InputItem struct {
-    Type string `json:"type"`           // 固定为 "text"
-    Text string `json:"text,omitempty"` // 文本内容
+    Type     string `json:"type"`
+    Text     string `json:"text,omitempty"`
+    ImageURL string `json:"image_url,omitempty"`
+    Path     string `json:"path,omitempty"`
 }
 
+const (
+    InputText       = "text"
+    InputImage      = "image"
+    InputLocalImage = "local_image"
+)
+
 // Event: Agent 发送给 UI 的响应消息。id 与 Submission.id 对应。
+// seq 在一个会话内从 1 开始严格递增，客户端可据此发现丢失或乱序的事件；
+// turn_id 标识事件所属的一轮（由一次 user_input 开启），不属于任何一轮的
+// 事件（如 session_configured）省略该字段。
 type Event struct {
-    ID  string   `json:"id"`
-    Msg EventMsg `json:"msg"`
+    ID     string   `json:"id"`
+    Seq    uint64   `json:"seq,omitempty"`
+    TurnID string   `json:"turn_id,omitempty"`
+    Msg    EventMsg `json:"msg"`
+}
+
+// EventMsg: Agent -> UI 的事件（tagged union）。具体类型：
+//   - TaskStartedEvent  ("task_started")：开始处理一次用户输入
+//   - UserInputQueuedEvent ("user_input_queued")：user_input 在前面的轮次结束后才开始
+//   - SessionResetEvent ("session_reset")：回应 reset_session
+//   - TurnUndoneEvent   ("turn_undone")：回应 undo_turn
+//   - SessionResumedEvent ("session_resumed")：回应 resume_session，在重放的事件之后
+//   - SessionForkedEvent ("session_forked")：回应 fork_session，在重放的事件之后
+//   - AgentMessageEvent ("agent_message")：Agent 的文本输出（一次或多次）
+//   - AgentMessageDeltaEvent / AgentReasoningDeltaEvent ("agent_message_delta" /
+//     "agent_reasoning_delta")：流式输出的增量片段，之后仍会发送完整的 agent_message
+//   - TaskCompleteEvent ("task_complete")：本次处理完成
+//   - TurnAbortedEvent  ("turn_aborted")：本轮被中止（如 interrupt），代替 task_complete
+//   - ErrorEvent        ("error")：出错信息
+//   - BackgroundEvent   ("background_event")：不影响本轮结果的运行提示
+//   - StreamErrorEvent  ("stream_error")：模型请求重试用尽或流中断，随后本轮以 error 结束
+//   - ToolCallErrorEvent ("tool_call_error")：模型的工具调用参数无法解析，该调用未执行，本轮继续
+//   - ReviewOutputEvent ("review_output")：review_request 的结构化结果
+//   - ExecCommandBeginEvent / ExecCommandEndEvent ("exec_command_begin/end")：命令执行的开始与结束
+//   - ExecApprovalRequestEvent ("exec_approval_request")：执行命令前请求用户确认
+//   - ApplyPatchBeginEvent / ApplyPatchEndEvent ("patch_apply_begin/end")：补丁应用的开始与结束
+//   - WebSearchBeginEvent / WebSearchEndEvent ("web_search_begin/end")：网页搜索的开始与结束
+//   - McpListToolsResponseEvent ("mcp_list_tools_response")：回应 list_mcp_tools
+//   - GetHistoryResponseEvent ("get_history_response")：回应 get_history
+//   - GetUsageResponseEvent ("get_usage_response")：回应 get_usage
+//   - UnknownEvent      (无法识别的 type，原样保留)
+type EventMsg interface {
+    // EventType 返回线上的 "type" 判别值。
+    EventType() string
+}
+
+const (
+    EventTaskStarted               = "task_started"
+    EventAgentMessage              = "agent_message"
+    EventTaskComplete              = "task_complete"
+    EventTurnAborted               = "turn_aborted"
+    EventUserInputQueued           = "user_input_queued"
+    EventTurnUndone                = "turn_undone"
+    EventError                     = "error"
+    EventAgentMessageDelta         = "agent_message_delta"
+    EventAgentReasoningDelta       = "agent_reasoning_delta"
+    EventExecCommandBegin          = "exec_command_begin"
+    EventExecCommandEnd            = "exec_command_end"
+    EventPatchApplyBegin           = "patch_apply_begin"
+    EventPatchApplyEnd             = "patch_apply_end"
+    EventTokenCount                = "token_count"
+    EventSessionConfigured         = "session_configured"
+    EventSessionReset              = "session_reset"
+    EventSessionResumed            = "session_resumed"
+    EventSessionForked             = "session_forked"
+    EventApplyPatchApprovalRequest = "apply_patch_approval_request"
+    EventExecApprovalRequest       = "exec_approval_request"
+    EventShutdownComplete          = "shutdown_complete"
+    EventTurnDiff                  = "turn_diff"
+    EventPlanUpdate                = "plan_update"
+    EventMcpListToolsResponse      = "mcp_list_tools_response"
+    EventGetHistoryResponse        = "get_history_response"
+    EventGetUsageResponse          = "get_usage_response"
+    EventWebSearchBegin            = "web_search_begin"
+    EventWebSearchEnd              = "web_search_end"
+    EventBackground                = "background_event"
+    EventStreamError               = "stream_error"
+    EventToolCallError             = "tool_call_error"
+    EventReviewOutput              = "review_output"
+)
+
+// TurnUndoneEvent: 回应 undo_turn。turn_id 为被撤销的一轮；restored 为恢复
+// 成该轮开始时内容的文件，removed 为该轮新建、已被删除的文件，路径相对于
+// git 仓库根目录。
+type TurnUndoneEvent struct {
+    TurnID   string   `json:"turn_id"`
+    Restored []string `json:"restored"`
+    Removed  []string `json:"removed"`
+}
+
+func (TurnUndoneEvent) EventType() string { return EventTurnUndone }
+
+func (e TurnUndoneEvent) MarshalJSON() ([]byte, error) {
+    type plain TurnUndoneEvent
+    return marshalTagged(e.EventType(), plain(e))
 }
 
-// EventMsg: Agent -> UI 的事件（最小子集）。
-// - "task_started": 开始处理一次用户输入
-// - "agent_message": Agent 的文本输出（一次或多次）
-// - "task_complete": 本次处理完成
-// - "error": 出错信息
-type EventMsg struct {
-    Type string `json:"type"` // "task_started" | "agent_message" | "task_complete" | "error"
+// SessionResetEvent: 回应 reset_session。cleared_items 为被丢弃的对话条目数。
+type SessionResetEvent struct {
+    ClearedItems int `json:"cleared_items"`
+}
+
+func (SessionResetEvent) EventType() string { return EventSessionReset }
+
+func (e SessionResetEvent) MarshalJSON() ([]byte, error) {
+    type plain SessionResetEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// SessionResumedEvent: 回应 resume_session。session_id 为恢复后的会话 id
+// （即原会话的 id），items 为恢复的对话条目数，replayed_events 为重放的事件数。
+type SessionResumedEvent struct {
+    SessionID      string `json:"session_id"`
+    RolloutPath    string `json:"rollout_path"`
+    Items          int    `json:"items"`
+    ReplayedEvents int    `json:"replayed_events"`
+}
+
+func (SessionResumedEvent) EventType() string { return EventSessionResumed }
+
+func (e SessionResumedEvent) MarshalJSON() ([]byte, error) {
+    type plain SessionResumedEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// SessionForkedEvent: 回应 fork_session。session_id 为新会话的 id，
+// forked_from 为原会话的 id，turn_id 为分叉点（复制整个会话时省略），
+// rollout_path 为新会话的 rollout 文件；items、replayed_events 同 session_resumed。
+type SessionForkedEvent struct {
+    SessionID      string `json:"session_id"`
+    ForkedFrom     string `json:"forked_from"`
+    TurnID         string `json:"turn_id,omitempty"`
+    RolloutPath    string `json:"rollout_path"`
+    Items          int    `json:"items"`
+    ReplayedEvents int    `json:"replayed_events"`
+}
+
+func (SessionForkedEvent) EventType() string { return EventSessionForked }
+
+func (e SessionForkedEvent) MarshalJSON() ([]byte, error) {
+    type plain SessionForkedEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// SessionConfiguredEvent: 回应 configure_session，回显生效后的会话设置。
+// session_id 在整个会话期间不变。project_docs 列出为该 cwd 加载到指令中的
+// AGENTS.md 文件，由外（git 仓库根目录）到内（cwd）。
+type SessionConfiguredEvent struct {
+    SessionID      string   `json:"session_id"`
+    Model          string   `json:"model,omitempty"`
+    Cwd            string   `json:"cwd"`
+    ApprovalPolicy string   `json:"approval_policy"`
+    SandboxPolicy  string   `json:"sandbox_policy"`
+    Instructions   string   `json:"instructions,omitempty"`
+    ProjectDocs    []string `json:"project_docs,omitempty"`
+}
+
+func (SessionConfiguredEvent) EventType() string { return EventSessionConfigured }
+
+func (e SessionConfiguredEvent) MarshalJSON() ([]byte, error) {
+    type plain SessionConfiguredEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// ShutdownCompleteEvent: 会话已保存并结束，是该连接上的最后一个事件。
+type ShutdownCompleteEvent struct{}
+
+func (ShutdownCompleteEvent) EventType() string { return EventShutdownComplete }
+
+func (e ShutdownCompleteEvent) MarshalJSON() ([]byte, error) {
+    return marshalTagged(e.EventType(), struct{}{})
+}
+
+// TaskStartedEvent: 开始处理一次用户输入，回显这一轮生效的设置
+// （会话设置叠加 user_input 中的覆盖项）。
+type TaskStartedEvent struct {
+    Model           string `json:"model,omitempty"`
+    ReasoningEffort string `json:"reasoning_effort,omitempty"`
+    Cwd             string `json:"cwd,omitempty"`
+    ApprovalPolicy  string `json:"approval_policy,omitempty"`
+    SandboxPolicy   string `json:"sandbox_policy,omitempty"`
+}
+
+func (TaskStartedEvent) EventType() string { return EventTaskStarted }
+
+func (e TaskStartedEvent) MarshalJSON() ([]byte, error) {
+    type plain TaskStartedEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// AgentMessageEvent: Agent 的文本输出。
+type AgentMessageEvent struct {
+    Text string `json:"text,omitempty"`
+}
+
+func (AgentMessageEvent) EventType() string { return EventAgentMessage }
+
+func (e AgentMessageEvent) MarshalJSON() ([]byte, error) {
+    type plain AgentMessageEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
 
-    // agent_message / error
-    Text    string `json:"text,omitempty"`    // agent_message 文本
-    Message string `json:"message,omitempty"` // error 文本
+// AgentMessageDeltaEvent: 模型流式输出的一段文本。按顺序拼接所有 delta
+// 即得到随后 agent_message 的完整文本；不渲染流式的 UI 可以忽略它。
+type AgentMessageDeltaEvent struct {
+    Delta string `json:"delta"`
+}
+
+func (AgentMessageDeltaEvent) EventType() string { return EventAgentMessageDelta }
+
+func (e AgentMessageDeltaEvent) MarshalJSON() ([]byte, error) {
+    type plain AgentMessageDeltaEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// AgentReasoningDeltaEvent: 模型推理（reasoning）内容的一段增量。
+type AgentReasoningDeltaEvent struct {
+    Delta string `json:"delta"`
+}
+
+func (AgentReasoningDeltaEvent) EventType() string { return EventAgentReasoningDelta }
+
+func (e AgentReasoningDeltaEvent) MarshalJSON() ([]byte, error) {
+    type plain AgentReasoningDeltaEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// StreamErrorEvent: 可重试的模型请求最终失败：重试次数用尽，或流在已有
+// 输出后中断（无法重试）。attempts 为发出的请求次数（含首次）；code、
+// retry_after_ms 与随后的 error 事件相同。不可重试的失败（如 400）只有
+// error 事件。
+type StreamErrorEvent struct {
+    Code         ErrorCode `json:"code,omitempty"`
+    Message      string    `json:"message"`
+    Attempts     int       `json:"attempts"`
+    RetryAfterMs int64     `json:"retry_after_ms,omitempty"`
+}
+
+func (StreamErrorEvent) EventType() string { return EventStreamError }
+
+func (e StreamErrorEvent) MarshalJSON() ([]byte, error) {
+    type plain StreamErrorEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// ToolCallErrorEvent: 模型请求的工具调用的参数不是 JSON 对象，修复（去掉
+// 代码块围栏、转义字符串中的控制字符、删除多余逗号与尾部内容、补全截断的
+// 字符串与括号）后仍无法解析。该调用不执行；模型收到说明后可以重新调用，
+// 本轮照常继续。可以修复的参数按修复后的内容执行，只发送 background_event。
+type ToolCallErrorEvent struct {
+    CallID  string `json:"call_id"`
+    Name    string `json:"name"`
+    Message string `json:"message"`
+}
+
+func (ToolCallErrorEvent) EventType() string { return EventToolCallError }
+
+func (e ToolCallErrorEvent) MarshalJSON() ([]byte, error) {
+    type plain ToolCallErrorEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// TaskCompleteEvent: 本次处理完成。
+// 该轮带 output_schema 时，output 是通过校验的最终回答（JSON 值）。
+// usage 为会话至今的用量汇总（同 get_usage_response）。
+type TaskCompleteEvent struct {
+    Output json.RawMessage `json:"output,omitempty"`
+    Usage  *UsageSummary   `json:"usage,omitempty"`
+}
+
+func (TaskCompleteEvent) EventType() string { return EventTaskComplete }
+
+func (e TaskCompleteEvent) MarshalJSON() ([]byte, error) {
+    type plain TaskCompleteEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// TurnAbortReason: 一轮被中止的原因。
+type TurnAbortReason string
+
+const (
+    TurnAbortInterrupted TurnAbortReason = "interrupted" // 客户端提交了 interrupt
+)
+
+// TurnAbortedEvent: 正在执行的一轮被中止：模型请求、待决的审批与工具启动的
+// 进程都被终止。作为该轮的最后一个事件，代替 task_complete；该轮的对话内容
+// 不计入会话，下一轮从中止前的状态继续。
+type TurnAbortedEvent struct {
+    Reason TurnAbortReason `json:"reason"`
+}
+
+func (TurnAbortedEvent) EventType() string { return EventTurnAborted }
+
+func (e TurnAbortedEvent) MarshalJSON() ([]byte, error) {
+    type plain TurnAbortedEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// UserInputQueuedEvent: 提交 user_input 时已有轮次在执行或排队，该输入排在
+// 它们之后，依次开始。position 为排在它前面的轮次数（含正在执行的一轮）。
+// 之后该输入照常以 task_started 开始；interrupt 只中止正在执行的一轮，
+// 不影响排队的输入。
+type UserInputQueuedEvent struct {
+    Position int `json:"position"`
+}
+
+func (UserInputQueuedEvent) EventType() string { return EventUserInputQueued }
+
+func (e UserInputQueuedEvent) MarshalJSON() ([]byte, error) {
+    type plain UserInputQueuedEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// ErrorCode: 机器可读的错误类别，客户端据此决定是否自动重试。
+type ErrorCode string
+
+const (
+    ErrInvalidRequest        ErrorCode = "invalid_request"         // 提交格式错误或不被支持
+    ErrInterrupted           ErrorCode = "interrupted"             // 被 interrupt 中止
+    ErrTimeout               ErrorCode = "timeout"                 // 超时
+    ErrModelRateLimited      ErrorCode = "model_rate_limited"      // 模型接口限流，见 retry_after_ms
+    ErrModelUnavailable      ErrorCode = "model_unavailable"       // 模型接口暂时不可用（5xx、网络错误）
+    ErrContextWindowExceeded ErrorCode = "context_window_exceeded" // 对话超出上下文窗口
+    ErrSandboxDenied         ErrorCode = "sandbox_denied"          // 沙箱拒绝了操作
+    ErrInvalidOutput         ErrorCode = "invalid_output"          // 最终回答不符合 output_schema
+    ErrInternal              ErrorCode = "internal"                // 其他内部错误
+)
+
+// Retryable 报告该类错误在不修改请求的情况下重试是否可能成功。
+func (c ErrorCode) Retryable() bool {
+    switch c {
+    case ErrTimeout, ErrModelRateLimited, ErrModelUnavailable:
+        return true
+    }
+    return false
+}
+
+// ErrorEvent: 出错信息，绑定到出错的 Submission id。
+// - code: 机器可读的类别（可能为空：来自旧版本的对端）
+// - message: 给人看的说明
+// - retryable: 是否值得自动重试
+// - retry_after_ms: 建议的最早重试时间（可选）
+type ErrorEvent struct {
+    Code         ErrorCode `json:"code,omitempty"`
+    Message      string    `json:"message,omitempty"`
+    Retryable    bool      `json:"retryable"`
+    RetryAfterMs int64     `json:"retry_after_ms,omitempty"`
+}
+
+// NewErrorEvent 构造 ErrorEvent，retryable 取 code 的默认值。
+func NewErrorEvent(code ErrorCode, format string, args ...any) ErrorEvent {
+    return ErrorEvent{Code: code, Message: fmt.Sprintf(format, args...), Retryable: code.Retryable()}
+}
+
+func (ErrorEvent) EventType() string { return EventError }
+
+func (e ErrorEvent) MarshalJSON() ([]byte, error) {
+    type plain ErrorEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// BackgroundEvent: 运行过程中的提示信息（限流后重试、压缩历史、沙箱降级等），
+// 不表示失败，客户端可以低调地显示或忽略。真正的错误使用 ErrorEvent。
+type BackgroundEvent struct {
+    Message string `json:"message"`
+}
+
+func (BackgroundEvent) EventType() string { return EventBackground }
+
+func (e BackgroundEvent) MarshalJSON() ([]byte, error) {
+    type plain BackgroundEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// ExecCommandBeginEvent: 即将执行一条命令。call_id 把 begin/end 配对，
+// 同一个 turn 内可能有多条命令交错执行。
+type ExecCommandBeginEvent struct {
+    CallID  string   `json:"call_id"`
+    Command []string `json:"command"` // argv
+    Cwd     string   `json:"cwd"`
+}
+
+func (ExecCommandBeginEvent) EventType() string { return EventExecCommandBegin }
+
+func (e ExecCommandBeginEvent) MarshalJSON() ([]byte, error) {
+    type plain ExecCommandBeginEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: call_id 与 command 必填。
+func (e ExecCommandBeginEvent) Validate() error {
+    if e.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    if len(e.Command) == 0 {
+        return fmt.Errorf("missing command")
+    }
+    return nil
+}
+
+// ExecCommandEndEvent: 命令执行结束。stdout/stderr 只保留末尾部分（tail），
+// 完整输出由产生方自行决定是否另行提供。
+// Signal 为终止进程的信号名（如 "SIGKILL"），正常退出时为空；
+// TimedOut 表示命令因超时被终止，用于区分 "exit 1" 与超时被杀。
+type ExecCommandEndEvent struct {
+    CallID     string   `json:"call_id"`
+    Command    []string `json:"command"`
+    Cwd        string   `json:"cwd"`
+    Stdout     string   `json:"stdout"`
+    Stderr     string   `json:"stderr"`
+    ExitCode   int      `json:"exit_code"`
+    DurationMs int64    `json:"duration_ms"` // 毫秒
+    Signal     string   `json:"signal,omitempty"`
+    TimedOut   bool     `json:"timed_out,omitempty"`
+}
+
+func (ExecCommandEndEvent) EventType() string { return EventExecCommandEnd }
+
+func (e ExecCommandEndEvent) MarshalJSON() ([]byte, error) {
+    type plain ExecCommandEndEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: call_id 必填。
+func (e ExecCommandEndEvent) Validate() error {
+    if e.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    return nil
+}
+
+// FileChange: 补丁对单个文件的修改。
+// - "add":    新文件，content 为完整内容
+// - "delete": 删除文件
+// - "update": 修改文件，unified_diff 为差异；move_path 非空表示同时重命名
+type FileChange struct {
+    Type        string `json:"type"`
+    Content     string `json:"content,omitempty"`
+    UnifiedDiff string `json:"unified_diff,omitempty"`
+    MovePath    string `json:"move_path,omitempty"`
 }
 
 const (
-    EventTaskStarted  = "task_started"
-    EventAgentMessage = "agent_message"
-    EventTaskComplete = "task_complete"
-    EventError        = "error"
+    FileChangeAdd    = "add"
+    FileChangeDelete = "delete"
+    FileChangeUpdate = "update"
 )
 
+// ApplyPatchBeginEvent: 即将应用补丁。changes 以文件路径为 key。
+type ApplyPatchBeginEvent struct {
+    CallID       string                `json:"call_id"`
+    AutoApproved bool                  `json:"auto_approved"` // 未经用户确认即应用
+    Changes      map[string]FileChange `json:"changes"`
+}
+
+func (ApplyPatchBeginEvent) EventType() string { return EventPatchApplyBegin }
+
+func (e ApplyPatchBeginEvent) MarshalJSON() ([]byte, error) {
+    type plain ApplyPatchBeginEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: call_id 必填，每个修改的 type 必须是 add/delete/update。
+func (e ApplyPatchBeginEvent) Validate() error {
+    if e.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    for path, c := range e.Changes {
+        switch c.Type {
+        case FileChangeAdd, FileChangeDelete, FileChangeUpdate:
+        default:
+            return fmt.Errorf("changes[%q]: unknown change type %q", path, c.Type)
+        }
+    }
+    return nil
+}
+
+// ApplyPatchApprovalRequestEvent: Agent 想要修改文件，等待客户端以
+// patch_approval op（相同 call_id）答复。在答复之前本轮处于阻塞状态。
+type ApplyPatchApprovalRequestEvent struct {
+    CallID      string   `json:"call_id"`
+    Paths       []string `json:"paths"`            // 受影响的文件
+    UnifiedDiff string   `json:"unified_diff"`     // 全部修改的 unified diff
+    Reason      string   `json:"reason,omitempty"` // 需要确认的原因（可选）
+}
+
+func (ApplyPatchApprovalRequestEvent) EventType() string { return EventApplyPatchApprovalRequest }
+
+func (e ApplyPatchApprovalRequestEvent) MarshalJSON() ([]byte, error) {
+    type plain ApplyPatchApprovalRequestEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: call_id 与 paths 必填。
+func (e ApplyPatchApprovalRequestEvent) Validate() error {
+    if e.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    if len(e.Paths) == 0 {
+        return fmt.Errorf("missing paths")
+    }
+    return nil
+}
+
+// ExecApprovalRequestEvent: Agent 想要执行一条命令，等待客户端以
+// exec_approval op（相同 call_id）答复。在答复之前本轮处于阻塞状态。
+type ExecApprovalRequestEvent struct {
+    CallID  string   `json:"call_id"`
+    Command []string `json:"command"`
+    Cwd     string   `json:"cwd"`
+    Reason  string   `json:"reason,omitempty"` // 需要确认的原因（可选）
+}
+
+func (ExecApprovalRequestEvent) EventType() string { return EventExecApprovalRequest }
+
+func (e ExecApprovalRequestEvent) MarshalJSON() ([]byte, error) {
+    type plain ExecApprovalRequestEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: call_id 与 command 必填。
+func (e ExecApprovalRequestEvent) Validate() error {
+    if e.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    if len(e.Command) == 0 {
+        return fmt.Errorf("missing command")
+    }
+    return nil
+}
+
+// ApplyPatchEndEvent: 补丁应用结束。
+type ApplyPatchEndEvent struct {
+    CallID  string `json:"call_id"`
+    Stdout  string `json:"stdout"`
+    Stderr  string `json:"stderr"`
+    Success bool   `json:"success"`
+}
+
+func (ApplyPatchEndEvent) EventType() string { return EventPatchApplyEnd }
+
+func (e ApplyPatchEndEvent) MarshalJSON() ([]byte, error) {
+    type plain ApplyPatchEndEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: call_id 必填。
+func (e ApplyPatchEndEvent) Validate() error {
+    if e.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    return nil
+}
+
+// WebSearchBeginEvent: Agent 开始一次网页搜索。
+type WebSearchBeginEvent struct {
+    CallID string `json:"call_id"`
+    Query  string `json:"query"`
+}
+
+func (WebSearchBeginEvent) EventType() string { return EventWebSearchBegin }
+
+func (e WebSearchBeginEvent) MarshalJSON() ([]byte, error) {
+    type plain WebSearchBeginEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: call_id 必填。
+func (e WebSearchBeginEvent) Validate() error {
+    if e.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    return nil
+}
+
+// WebSearchEndEvent: 网页搜索结束，call_id 与 web_search_begin 相同。
+// 搜索失败时 error 非空，result_count 为 0。
+type WebSearchEndEvent struct {
+    CallID      string `json:"call_id"`
+    Query       string `json:"query"`
+    ResultCount int    `json:"result_count"`
+    DurationMs  int64  `json:"duration_ms"` // 毫秒
+    Error       string `json:"error,omitempty"`
+}
+
+func (WebSearchEndEvent) EventType() string { return EventWebSearchEnd }
+
+func (e WebSearchEndEvent) MarshalJSON() ([]byte, error) {
+    type plain WebSearchEndEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: call_id 必填，计数和耗时不能为负。
+func (e WebSearchEndEvent) Validate() error {
+    if e.CallID == "" {
+        return fmt.Errorf("missing call_id")
+    }
+    if e.ResultCount < 0 || e.DurationMs < 0 {
+        return fmt.Errorf("result_count and duration_ms must not be negative")
+    }
+    return nil
+}
+
+// ReviewSeverity: 审查发现的严重程度。
+type ReviewSeverity string
+
+const (
+    SeverityCritical ReviewSeverity = "critical" // 必须修复（错误结果、数据丢失、安全问题）
+    SeverityHigh     ReviewSeverity = "high"     // 合并前应修复
+    SeverityMedium   ReviewSeverity = "medium"   // 值得修复
+    SeverityLow      ReviewSeverity = "low"      // 风格、可读性等小问题
+)
+
+// ReviewFinding: 一条审查发现。path 相对 cwd；line_end 省略表示单行，
+// line_start 也省略表示针对整个文件。
+type ReviewFinding struct {
+    Title     string         `json:"title"`
+    Body      string         `json:"body,omitempty"`
+    Severity  ReviewSeverity `json:"severity"`
+    Path      string         `json:"path"`
+    LineStart int            `json:"line_start,omitempty"`
+    LineEnd   int            `json:"line_end,omitempty"`
+}
+
+// ReviewOutputEvent: review_request 的结果，在 task_complete 之前发送。
+type ReviewOutputEvent struct {
+    Summary  string          `json:"summary"`
+    Findings []ReviewFinding `json:"findings"`
+}
+
+func (ReviewOutputEvent) EventType() string { return EventReviewOutput }
+
+func (e ReviewOutputEvent) MarshalJSON() ([]byte, error) {
+    type plain ReviewOutputEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// Validate: 每条发现都要有 title、path 和已知的 severity，行号不能倒置。
+func (e ReviewOutputEvent) Validate() error {
+    for i, f := range e.Findings {
+        switch {
+        case f.Title == "":
+            return fmt.Errorf("findings[%d]: missing title", i)
+        case f.Path == "":
+            return fmt.Errorf("findings[%d]: missing path", i)
+        case !f.Severity.Valid():
+            return fmt.Errorf("findings[%d]: unknown severity %q", i, f.Severity)
+        case f.LineEnd != 0 && f.LineEnd < f.LineStart:
+            return fmt.Errorf("findings[%d]: line_end before line_start", i)
+        }
+    }
+    return nil
+}
+
+// Valid 报告 s 是否为已知取值。
+func (s ReviewSeverity) Valid() bool {
+    switch s {
+    case SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow:
+        return true
+    }
+    return false
+}
+
+// TurnDiffEvent: 在修改过文件的一轮结束时（task_complete 之前）发送，
+// 包含本轮所有文件修改合并后的 unified diff（git diff 格式）。
+type TurnDiffEvent struct {
+    UnifiedDiff string `json:"unified_diff"`
+}
+
+func (TurnDiffEvent) EventType() string { return EventTurnDiff }
+
+func (e TurnDiffEvent) MarshalJSON() ([]byte, error) {
+    type plain TurnDiffEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// StepStatus: 计划中单个步骤的状态。
+type StepStatus string
+
+const (
+    StepPending    StepStatus = "pending"
+    StepInProgress StepStatus = "in_progress"
+    StepCompleted  StepStatus = "completed"
+)
+
+// PlanItem: 计划中的一个步骤。
+type PlanItem struct {
+    Step   string     `json:"step"`
+    Status StepStatus `json:"status"`
+}
+
+// UpdatePlanArgs: update_plan 工具的参数，也是 plan_update 事件的内容。
+// 每次调用都给出完整计划（而非增量），替换之前的计划；还有未完成的步骤时
+// 恰好一个步骤 in_progress，全部完成时没有。空计划表示清除计划。
+type UpdatePlanArgs struct {
+    Explanation string     `json:"explanation,omitempty"`
+    Plan        []PlanItem `json:"plan"`
+}
+
+// Validate: 步骤文本必填且不重复，状态必须是已知取值；有未完成的步骤时
+// 恰好一个 in_progress，全部完成时没有。
+func (a UpdatePlanArgs) Validate() error {
+    inProgress, completed := 0, 0
+    seen := make(map[string]bool, len(a.Plan))
+    for i, it := range a.Plan {
+        if it.Step == "" {
+            return fmt.Errorf("plan[%d]: missing step", i)
+        }
+        if seen[it.Step] {
+            return fmt.Errorf("plan[%d]: duplicate step %q", i, it.Step)
+        }
+        seen[it.Step] = true
+        switch it.Status {
+        case StepPending:
+        case StepCompleted:
+            completed++
+        case StepInProgress:
+            inProgress++
+        default:
+            return fmt.Errorf("plan[%d]: unknown status %q", i, it.Status)
+        }
+    }
+    switch {
+    case completed == len(a.Plan) && inProgress == 0:
+    case inProgress != 1:
+        return fmt.Errorf("exactly one step must be in_progress while steps remain, got %d", inProgress)
+    }
+    return nil
+}
+
+// PlanUpdateEvent: 当前任务的最新计划，客户端可据此渲染待办列表。
+type PlanUpdateEvent struct {
+    UpdatePlanArgs
+}
+
+func (PlanUpdateEvent) EventType() string { return EventPlanUpdate }
+
+func (e PlanUpdateEvent) MarshalJSON() ([]byte, error) {
+    return marshalTagged(e.EventType(), e.UpdatePlanArgs)
+}
+
+// TokenUsage: 一次或累计的 token 用量。
+// cached_input_tokens 是 input_tokens 中命中缓存的部分；
+// reasoning_output_tokens 是 output_tokens 中用于推理的部分。
+type TokenUsage struct {
+    InputTokens           int64 `json:"input_tokens"`
+    CachedInputTokens     int64 `json:"cached_input_tokens"`
+    OutputTokens          int64 `json:"output_tokens"`
+    ReasoningOutputTokens int64 `json:"reasoning_output_tokens"`
+    TotalTokens           int64 `json:"total_tokens"`
+}
+
+// Add 返回 u 与 o 之和。
+func (u TokenUsage) Add(o TokenUsage) TokenUsage {
+    return TokenUsage{
+        InputTokens:           u.InputTokens + o.InputTokens,
+        CachedInputTokens:     u.CachedInputTokens + o.CachedInputTokens,
+        OutputTokens:          u.OutputTokens + o.OutputTokens,
+        ReasoningOutputTokens: u.ReasoningOutputTokens + o.ReasoningOutputTokens,
+        TotalTokens:           u.TotalTokens + o.TotalTokens,
+    }
+}
+
+// TokenCountEvent: 每次模型调用之后发送。
+// - total_token_usage: 会话累计用量（计费/统计用）
+// - last_token_usage: 最近一次调用的用量；其 total_tokens 即当前上下文占用
+// - model_context_window: 模型上下文窗口大小，未知时省略
+// - model: 最近一次调用所用的模型，未指定模型时省略
+type TokenCountEvent struct {
+    Total              TokenUsage `json:"total_token_usage"`
+    Last               TokenUsage `json:"last_token_usage"`
+    ModelContextWindow int64      `json:"model_context_window,omitempty"`
+    Model              string     `json:"model,omitempty"`
+}
+
+func (TokenCountEvent) EventType() string { return EventTokenCount }
+
+func (e TokenCountEvent) MarshalJSON() ([]byte, error) {
+    type plain TokenCountEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// ContextUsedPercent 返回最近一次调用占用上下文窗口的百分比（0-100）；
+// 窗口未知时返回 -1。
+func (e TokenCountEvent) ContextUsedPercent() float64 {
+    if e.ModelContextWindow <= 0 {
+        return -1
+    }
+    p := float64(e.Last.TotalTokens) * 100 / float64(e.ModelContextWindow)
+    if p > 100 {
+        p = 100
+    }
+    return p
+}
+
+// ToolInfo: 一个可供模型调用的工具。外部 MCP 服务器的工具名为 "<server>__<tool>"；
+// input_schema 是参数的 JSON Schema。
+type ToolInfo struct {
+    Name        string          `json:"name"`
+    Description string          `json:"description,omitempty"`
+    InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// McpListToolsResponseEvent: 回应 list_mcp_tools，按名称排序列出所有工具。
+type McpListToolsResponseEvent struct {
+    Tools []ToolInfo `json:"tools"`
+}
+
+func (McpListToolsResponseEvent) EventType() string { return EventMcpListToolsResponse }
+
+func (e McpListToolsResponseEvent) MarshalJSON() ([]byte, error) {
+    type plain McpListToolsResponseEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// HistoryEntry: 历史文件中的一条记录。
+type HistoryEntry struct {
+    SessionID string `json:"session_id"`
+    Ts        int64  `json:"ts"` // unix 秒
+    Text      string `json:"text"`
+}
+
+// GetHistoryResponseEvent: 回应 get_history。total 是历史记录总数，
+// 客户端可据此从最新的一条（offset=total-1）向前翻。
+type GetHistoryResponseEvent struct {
+    Offset  int            `json:"offset"`
+    Total   int            `json:"total"`
+    Entries []HistoryEntry `json:"entries"`
+}
+
+func (GetHistoryResponseEvent) EventType() string { return EventGetHistoryResponse }
+
+func (e GetHistoryResponseEvent) MarshalJSON() ([]byte, error) {
+    type plain GetHistoryResponseEvent
+    return marshalTagged(e.EventType(), plain(e))
+}
+
+// UsageSummary: 会话累计的 token 用量。models 按模型名排序分列；
+// cost_usd 是按价格表估算的费用（美元），价格未知的模型省略该字段，
+// 此时会话的 cost_usd 也省略。
+type UsageSummary struct {
+    Total   TokenUsage   `json:"total_token_usage"`
+    CostUSD *float64     `json:"cost_usd,omitempty"`
+    Models  []ModelUsage `json:"models"`
+}
+
+// ModelUsage: 一个模型在会话中的累计用量。
+type ModelUsage struct {
+    Model   string     `json:"model"`
+    Usage   TokenUsage `json:"token_usage"`
+    CostUSD *float64   `json:"cost_usd,omitempty"`
+}
+
+// GetUsageResponseEvent: 回应 get_usage。
+type GetUsageResponseEvent struct {
+    UsageSummary
+}
+
+func (GetUsageResponseEvent) EventType() string { return EventGetUsageResponse }
+
+func (e GetUsageResponseEvent) MarshalJSON() ([]byte, error) {
+    return marshalTagged(e.EventType(), e.UsageSummary)
+}
+
+// UnknownEvent: 本端不认识的事件，保留原始 JSON。
+type UnknownEvent struct {
+    Type string
+    Raw  []byte
+}
+
+func (e UnknownEvent) EventType() string { return e.Type }
+
+func (e UnknownEvent) MarshalJSON() ([]byte, error) { return e.Raw, nil }
+
 // 示例 JSON（最小）：
 // Submission (user_input):
 // {"id":"sub-1","op":{"type":"user_input","items":[{"type":"text","text":"Hello"}]}}
 // Submission (interrupt):
 // {"id":"sub-2","op":{"type":"interrupt"}}
+// Submission (configure_session) 与回复:
+// {"id":"sub-0","op":{"type":"configure_session","cwd":"/src","sandbox_policy":"workspace-write"}}
+// {"id":"sub-0","msg":{"type":"session_configured","session_id":"…","cwd":"/src","approval_policy":"on-request","sandbox_policy":"workspace-write"}}
 // Event 序列:
-// {"id":"sub-1","msg":{"type":"task_started"}}
+// {"id":"sub-1","seq":1,"turn_id":"turn-1","msg":{"type":"task_started"}}
+// {"id":"sub-1","seq":2,"turn_id":"turn-1","msg":{"type":"agent_message_delta","delta":"Hi "}}
+// {"id":"sub-1","msg":{"type":"agent_message_delta","delta":"there"}}
 // {"id":"sub-1","msg":{"type":"agent_message","text":"Hi there"}}
 // {"id":"sub-1","msg":{"type":"task_complete"}}
@@ -0,0 +1,81 @@
+package rollout
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+)
+
+// Fork starts a new rollout under dir for session id holding the session
+// recorded at src up to the end of turn turnID, or all of it when turnID
+// is empty. The lines are copied as they were recorded, so loading the
+// fork yields the conversation and events of the original at that turn;
+// the original is not modified. The new metadata names the original in
+// ForkedFrom. The returned recorder continues the fork.
+func Fork(dir, src, id, turnID string) (*Recorder, error) {
+    data, err := os.ReadFile(src)
+    if err != nil {
+        return nil, err
+    }
+    var meta SessionMeta
+    var lines [][]byte
+    cut := -1
+    r := bufio.NewReader(bytes.NewReader(data))
+    for n := 0; ; n++ {
+        line, err := r.ReadBytes('\n')
+        line = bytes.TrimRight(line, "\n")
+        if len(line) > 0 {
+            var l Line
+            ok := json.Unmarshal(line, &l) == nil
+            switch {
+            case n == 0:
+                if !ok || l.Type != TypeSessionMeta || json.Unmarshal(l.Payload, &meta) != nil || meta.ID == "" {
+                    return nil, fmt.Errorf("%s: not a session rollout", src)
+                }
+            case ok:
+                lines = append(lines, line)
+                if l.Type == TypeEventMsg && turnID != "" {
+                    var ev struct {
+                        TurnID string `json:"turn_id"`
+                    }
+                    if json.Unmarshal(l.Payload, &ev) == nil && ev.TurnID == turnID {
+                        cut = len(lines)
+                    }
+                }
+            }
+        }
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    if meta.ID == "" {
+        return nil, fmt.Errorf("%s: not a session rollout", src)
+    }
+    if turnID != "" {
+        if cut < 0 {
+            return nil, fmt.Errorf("session %s has no turn %s", meta.ID, turnID)
+        }
+        lines = lines[:cut]
+    }
+
+    forkedFrom := meta.ID
+    meta.ID, meta.Timestamp, meta.ForkedFrom = id, "", forkedFrom
+    rec, err := Create(dir, meta)
+    if err != nil {
+        return nil, err
+    }
+    for _, line := range lines {
+        if err := rec.writeLine(line); err != nil {
+            rec.Close()
+            os.Remove(rec.Path())
+            return nil, err
+        }
+    }
+    return rec, nil
+}
@@ -0,0 +1,154 @@
+package rollout
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// ErrNotFound is returned by Find and Latest when no rollout matches.
+var ErrNotFound = errors.New("no recorded session found")
+
+// Rollout is a recorded session read back from its file.
+type Rollout struct {
+    Path string
+    Meta SessionMeta
+    // Items is the conversation as the model last saw it: the items
+    // recorded after the last session_reset event or compaction, the
+    // latter's replacement items first.
+    Items []model.Message
+    // Events are the recorded events, in order.
+    Events []protocol.Event
+}
+
+// Load reads the rollout at path. Lines that do not decode (such as a
+// line cut short by a crash) are skipped; a file that does not start with
+// session metadata is an error.
+func Load(path string) (*Rollout, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    out := &Rollout{Path: path}
+    r := bufio.NewReader(f)
+    for n := 0; ; n++ {
+        data, err := r.ReadBytes('\n')
+        if len(data) > 0 {
+            var line Line
+            if json.Unmarshal(data, &line) != nil {
+                if n == 0 {
+                    return nil, fmt.Errorf("%s: not a session rollout", path)
+                }
+                continue
+            }
+            if n == 0 {
+                if line.Type != TypeSessionMeta || json.Unmarshal(line.Payload, &out.Meta) != nil || out.Meta.ID == "" {
+                    return nil, fmt.Errorf("%s: not a session rollout", path)
+                }
+                continue
+            }
+            switch line.Type {
+            case TypeResponseItem:
+                var item model.Message
+                if json.Unmarshal(line.Payload, &item) == nil {
+                    out.Items = append(out.Items, item)
+                }
+            case TypeCompacted:
+                var c Compacted
+                if json.Unmarshal(line.Payload, &c) == nil {
+                    out.Items = c.Items
+                }
+            case TypeEventMsg:
+                var ev protocol.Event
+                if json.Unmarshal(line.Payload, &ev) == nil {
+                    out.Events = append(out.Events, ev)
+                    if _, ok := ev.Msg.(protocol.SessionResetEvent); ok {
+                        out.Items = nil
+                    }
+                }
+            }
+        }
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    if out.Meta.ID == "" {
+        return nil, fmt.Errorf("%s: not a session rollout", path)
+    }
+    return out, nil
+}
+
+// Usage returns the tokens the recorded model calls used, per model.
+// Calls recorded without a model name count for the session's model.
+func (r *Rollout) Usage() map[string]protocol.TokenUsage {
+    out := map[string]protocol.TokenUsage{}
+    for _, ev := range r.Events {
+        if tc, ok := ev.Msg.(protocol.TokenCountEvent); ok {
+            name := tc.Model
+            if name == "" {
+                name = r.Meta.Model
+            }
+            out[name] = out[name].Add(tc.Last)
+        }
+    }
+    return out
+}
+
+// Find returns the newest rollout under dir recorded for session id.
+func Find(dir, id string) (string, error) {
+    files := list(dir, "-"+id+".jsonl")
+    if len(files) == 0 {
+        return "", fmt.Errorf("%w for session %s", ErrNotFound, id)
+    }
+    return files[0], nil
+}
+
+// Latest returns the most recently written rollout under dir.
+func Latest(dir string) (string, error) {
+    files := list(dir, ".jsonl")
+    if len(files) == 0 {
+        return "", ErrNotFound
+    }
+    return files[0], nil
+}
+
+// list returns the rollout files under dir whose names end in suffix,
+// most recently modified first. A missing dir has none.
+func list(dir, suffix string) []string {
+    type file struct {
+        path    string
+        modTime int64
+    }
+    var files []file
+    _ = filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+        if err != nil || d.IsDir() || !strings.HasPrefix(d.Name(), "rollout-") || !strings.HasSuffix(d.Name(), suffix) {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil {
+            return nil
+        }
+        files = append(files, file{p, info.ModTime().UnixNano()})
+        return nil
+    })
+    sort.Slice(files, func(i, j int) bool { return files[i].modTime > files[j].modTime })
+    out := make([]string, len(files))
+    for i, f := range files {
+        out[i] = f.path
+    }
+    return out
+}
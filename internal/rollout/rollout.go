@@ -0,0 +1,182 @@
+// Package rollout records sessions as JSONL files under
+// <codex home>/sessions/YYYY/MM/DD/rollout-<time>-<session id>.jsonl so
+// conversations outlive the process and can be inspected or resumed. The
+// first line holds the session metadata; every later line is a
+// conversation item, an event, or a compaction replacing the conversation
+// so far, in the order they happened:
+//
+//	{"timestamp":"...","type":"session_meta","payload":{"id":"3f2a…","cwd":"/src",...}}
+//	{"timestamp":"...","type":"event_msg","payload":{"id":"sub-1","seq":1,"msg":{"type":"task_started",...}}}
+//	{"timestamp":"...","type":"response_item","payload":{"role":"user","content":[...]}}
+package rollout
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+
+    "codex-go/internal/codexhome"
+    "codex-go/internal/model"
+    "codex-go/internal/protocol"
+)
+
+// DirName is the sessions directory inside the codex home directory.
+const DirName = "sessions"
+
+// Line types.
+const (
+    TypeSessionMeta  = "session_meta"
+    TypeResponseItem = "response_item"
+    TypeEventMsg     = "event_msg"
+    TypeCompacted    = "compacted"
+)
+
+// Line is one line of a rollout file. Payload is a SessionMeta, a
+// model.Message, a protocol.Event or a Compacted depending on Type.
+type Line struct {
+    Timestamp string          `json:"timestamp"`
+    Type      string          `json:"type"`
+    Payload   json.RawMessage `json:"payload"`
+}
+
+// SessionMeta describes the session a rollout records, as it was when the
+// recording started.
+type SessionMeta struct {
+    ID             string `json:"id"`
+    Timestamp      string `json:"timestamp"`
+    Cwd            string `json:"cwd"`
+    CLIVersion     string `json:"cli_version"`
+    Model          string `json:"model,omitempty"`
+    ApprovalPolicy string `json:"approval_policy,omitempty"`
+    SandboxPolicy  string `json:"sandbox_policy,omitempty"`
+    Instructions   string `json:"instructions,omitempty"`
+    // ForkedFrom is the id of the session this one was forked from.
+    ForkedFrom string `json:"forked_from,omitempty"`
+}
+
+// Compacted records that the conversation was replaced by Items, a
+// summary of the earlier turns plus the turns kept verbatim.
+type Compacted struct {
+    Items []model.Message `json:"items"`
+}
+
+// DefaultDir returns <codex home>/sessions.
+func DefaultDir() (string, error) { return codexhome.Path(DirName) }
+
+// Recorder appends to one rollout file. Every line is written with a single
+// unbuffered write, so a crash loses at most the line being written.
+type Recorder struct {
+    mu   sync.Mutex
+    f    *os.File
+    path string
+    err  error // first write error; later records are dropped
+}
+
+// timestampFormat is used for line timestamps: UTC with milliseconds.
+const timestampFormat = "2006-01-02T15:04:05.000Z"
+
+// Create starts a rollout for meta under dir, creating the date
+// directories (private to the user) as needed. meta.Timestamp is set from
+// the current time when empty.
+func Create(dir string, meta SessionMeta) (*Recorder, error) {
+    now := time.Now()
+    if meta.Timestamp == "" {
+        meta.Timestamp = now.UTC().Format(timestampFormat)
+    }
+    day := filepath.Join(dir, now.Format("2006"), now.Format("01"), now.Format("02"))
+    if err := os.MkdirAll(day, 0o700); err != nil {
+        return nil, err
+    }
+    path := filepath.Join(day, fmt.Sprintf("rollout-%s-%s.jsonl", now.Format("2006-01-02T15-04-05"), meta.ID))
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o600)
+    if err != nil {
+        return nil, err
+    }
+    r := &Recorder{f: f, path: path}
+    if err := r.write(TypeSessionMeta, meta); err != nil {
+        f.Close()
+        os.Remove(path)
+        return nil, err
+    }
+    return r, nil
+}
+
+// Append continues the existing rollout at path, e.g. for a resumed
+// session.
+func Append(path string) (*Recorder, error) {
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+    if err != nil {
+        return nil, err
+    }
+    return &Recorder{f: f, path: path}, nil
+}
+
+// Path returns the rollout file's path.
+func (r *Recorder) Path() string { return r.path }
+
+// RecordItems appends conversation items.
+func (r *Recorder) RecordItems(items ...model.Message) error {
+    for _, it := range items {
+        if err := r.write(TypeResponseItem, it); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// RecordCompacted appends a compaction; the conversation continues from
+// items.
+func (r *Recorder) RecordCompacted(items []model.Message) error {
+    return r.write(TypeCompacted, Compacted{Items: items})
+}
+
+// RecordEvent appends an event.
+func (r *Recorder) RecordEvent(ev protocol.Event) error { return r.write(TypeEventMsg, ev) }
+
+func (r *Recorder) write(typ string, payload any) error {
+    p, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+    line, err := json.Marshal(Line{Timestamp: time.Now().UTC().Format(timestampFormat), Type: typ, Payload: p})
+    if err != nil {
+        return err
+    }
+    return r.writeLine(line)
+}
+
+// writeLine appends one encoded line, without its newline.
+func (r *Recorder) writeLine(line []byte) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.err != nil {
+        return r.err
+    }
+    if r.f == nil {
+        return os.ErrClosed
+    }
+    if _, err := r.f.Write(append(line, '\n')); err != nil {
+        r.err = fmt.Errorf("rollout %s: %w", r.path, err)
+        return r.err
+    }
+    return nil
+}
+
+// Close closes the file. It returns the first write error, if any, so a
+// recording that stopped early is reported once. Close is idempotent.
+func (r *Recorder) Close() error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.f == nil {
+        return r.err
+    }
+    err := r.f.Close()
+    r.f = nil
+    if r.err != nil {
+        return r.err
+    }
+    return err
+}
@@ -0,0 +1,207 @@
+// Package safety classifies commands the agent wants to run. A command is
+// "known safe" when it only reads state, so it can run without asking the
+// user even under the untrusted approval policy.
+package safety
+
+import (
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+// alwaysSafe are commands that never write, whatever their arguments.
+var alwaysSafe = map[string]bool{
+    "cat":    true,
+    "cd":     true,
+    "echo":   true,
+    "false":  true,
+    "grep":   true,
+    "head":   true,
+    "ls":     true,
+    "nl":     true,
+    "pwd":    true,
+    "tail":   true,
+    "true":   true,
+    "uname":  true,
+    "wc":     true,
+    "which":  true,
+    "whoami": true,
+}
+
+// unsafeFindOptions make find execute commands or write files.
+var unsafeFindOptions = map[string]bool{
+    "-exec": true, "-execdir": true, "-ok": true, "-okdir": true,
+    "-delete": true, "-fls": true, "-fprint": true, "-fprint0": true, "-fprintf": true,
+}
+
+// unsafeRgOptions make ripgrep run external programs.
+var unsafeRgOptions = map[string]bool{
+    "--pre": true, "--hostname-bin": true, "--search-zip": true, "-z": true,
+}
+
+// readOnlyGit are git subcommands that only inspect the repository.
+var readOnlyGit = map[string]bool{
+    "status": true, "log": true, "diff": true, "show": true, "branch": true,
+    "rev-parse": true, "ls-files": true, "blame": true,
+}
+
+// sedPrint matches the line selection of `sed -n 10p` / `sed -n 1,20p`.
+var sedPrint = regexp.MustCompile(`^\d+(,\d+)?p$`)
+
+// IsKnownSafe reports whether argv is a read-only command. A shell
+// invocation (`bash -lc "..."`) is safe when its script is a plain list of
+// safe commands joined by &&, ||, ; or |, without redirections,
+// substitutions or other expansions.
+func IsKnownSafe(argv []string) bool {
+    if script, ok := shellScript(argv); ok {
+        cmds, ok := ParseScript(script)
+        if !ok {
+            return false
+        }
+        for _, c := range cmds {
+            if !isSafeCommand(c) {
+                return false
+            }
+        }
+        return true
+    }
+    return isSafeCommand(argv)
+}
+
+// shellScript returns the script of `bash -c script` (or -lc, sh, zsh).
+func shellScript(argv []string) (string, bool) {
+    if len(argv) != 3 {
+        return "", false
+    }
+    switch filepath.Base(argv[0]) {
+    case "bash", "sh", "zsh":
+    default:
+        return "", false
+    }
+    if argv[1] != "-c" && argv[1] != "-lc" {
+        return "", false
+    }
+    return argv[2], true
+}
+
+func isSafeCommand(argv []string) bool {
+    if len(argv) == 0 {
+        return false
+    }
+    name, args := filepath.Base(argv[0]), argv[1:]
+    if alwaysSafe[name] {
+        return true
+    }
+    switch name {
+    case "find":
+        for _, a := range args {
+            if unsafeFindOptions[a] {
+                return false
+            }
+        }
+        return true
+    case "rg":
+        for _, a := range args {
+            opt, _, _ := strings.Cut(a, "=")
+            if unsafeRgOptions[opt] {
+                return false
+            }
+        }
+        return true
+    case "git":
+        if len(args) == 0 || !readOnlyGit[args[0]] {
+            return false
+        }
+        for _, a := range args[1:] {
+            // --output writes the diff to a file; branch arguments other
+            // than flags create or rename branches.
+            if strings.HasPrefix(a, "--output") || (args[0] == "branch" && !strings.HasPrefix(a, "-")) {
+                return false
+            }
+            if args[0] == "branch" && (a == "-d" || a == "-D" || a == "-m" || a == "-M" || a == "-c" || a == "-C" || strings.HasPrefix(a, "--delete") || strings.HasPrefix(a, "--move") || strings.HasPrefix(a, "--copy")) {
+                return false
+            }
+        }
+        return true
+    case "sed":
+        return len(args) >= 2 && len(args) <= 3 && args[0] == "-n" && sedPrint.MatchString(args[1])
+    }
+    return false
+}
+
+// ParseScript splits a shell script into commands when it only uses words,
+// quoted strings and the operators &&, ||, ; and |. It reports false for
+// anything that could run or write something not visible in the words:
+// redirections, variable and command substitution, subshells, background
+// jobs and the like.
+func ParseScript(script string) ([][]string, bool) {
+    var (
+        cmds   [][]string
+        cur    []string
+        word   strings.Builder
+        inWord bool
+    )
+    endWord := func() {
+        if inWord {
+            cur = append(cur, word.String())
+            word.Reset()
+            inWord = false
+        }
+    }
+    endCmd := func() {
+        endWord()
+        if len(cur) > 0 {
+            cmds = append(cmds, cur)
+            cur = nil
+        }
+    }
+
+    for i := 0; i < len(script); i++ {
+        c := script[i]
+        switch {
+        case c == ' ' || c == '\t':
+            endWord()
+        case c == '\n' || c == ';':
+            endCmd()
+        case c == '&' || c == '|':
+            if c == '&' && (i+1 >= len(script) || script[i+1] != '&') {
+                return nil, false // background job
+            }
+            if i+1 < len(script) && script[i+1] == c {
+                i++
+            }
+            endWord()
+            if len(cur) == 0 {
+                return nil, false
+            }
+            endCmd()
+        case c == '\'':
+            j := strings.IndexByte(script[i+1:], '\'')
+            if j < 0 {
+                return nil, false
+            }
+            word.WriteString(script[i+1 : i+1+j])
+            inWord = true
+            i += j + 1
+        case c == '"':
+            j := strings.IndexByte(script[i+1:], '"')
+            if j < 0 {
+                return nil, false
+            }
+            s := script[i+1 : i+1+j]
+            if strings.ContainsAny(s, "$`\\") {
+                return nil, false
+            }
+            word.WriteString(s)
+            inWord = true
+            i += j + 1
+        case strings.IndexByte("$`\\<>(){}#!~", c) >= 0:
+            return nil, false
+        default:
+            word.WriteByte(c)
+            inWord = true
+        }
+    }
+    endCmd()
+    return cmds, len(cmds) > 0
+}
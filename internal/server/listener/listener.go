@@ -0,0 +1,194 @@
+package listener
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "os"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+)
+
+// maxAcceptDelay caps the backoff between retries of a failing Accept.
+const maxAcceptDelay = time.Second
+
+// ConnHandler runs one protocol loop (mcp.Serve, agent.Serve, ...) over a
+// single connection. Each accepted connection gets its own call, and thus its
+// own session state.
+type ConnHandler func(ctx context.Context, r io.Reader, w io.Writer) error
+
+// Parse splits a listen spec into a network and address for net.Listen.
+// Accepted forms:
+//
+//	unix:///tmp/codex.sock
+//	tcp://127.0.0.1:9900
+func Parse(spec string) (network, address string, err error) {
+    switch {
+    case strings.HasPrefix(spec, "unix://"):
+        address = strings.TrimPrefix(spec, "unix://")
+        network = "unix"
+    case strings.HasPrefix(spec, "tcp://"):
+        address = strings.TrimPrefix(spec, "tcp://")
+        network = "tcp"
+    default:
+        return "", "", fmt.Errorf("unsupported listen address %q (want unix:///path or tcp://host:port)", spec)
+    }
+    if address == "" {
+        return "", "", fmt.Errorf("missing address in %q", spec)
+    }
+    return network, address, nil
+}
+
+// Loopback reports whether spec only accepts connections from this
+// machine: a unix socket, or TCP on a loopback address. A TCP address
+// without a host listens on every interface.
+func Loopback(spec string) (bool, error) {
+    network, address, err := Parse(spec)
+    if err != nil {
+        return false, err
+    }
+    if network == "unix" {
+        return true, nil
+    }
+    host, _, err := net.SplitHostPort(address)
+    if err != nil {
+        return false, err
+    }
+    if strings.EqualFold(host, "localhost") {
+        return true, nil
+    }
+    ip := net.ParseIP(host)
+    return ip != nil && ip.IsLoopback(), nil
+}
+
+// Serve listens on spec and runs h for every accepted connection until ctx
+// is canceled. Per-connection errors are reported through logf (which may be
+// nil) and never stop the listener; nor do temporary Accept errors, such as
+// running out of file descriptors, which are retried with backoff. On return
+// all connections are closed and their handlers have finished.
+func Serve(ctx context.Context, spec string, h ConnHandler, logf func(format string, args ...any)) error {
+    if logf == nil {
+        logf = func(string, ...any) {}
+    }
+    network, address, err := Parse(spec)
+    if err != nil {
+        return err
+    }
+    if network == "unix" {
+        // A stale socket from a previous run would make Listen fail. One a
+        // server still accepts on is left alone, and Listen reports it.
+        if fi, err := os.Lstat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+            if conn, err := net.Dial("unix", address); err == nil {
+                _ = conn.Close()
+                return fmt.Errorf("%s: a server is already listening there", address)
+            } else if errors.Is(err, syscall.ECONNREFUSED) {
+                _ = os.Remove(address)
+            }
+        }
+    }
+    ln, err := net.Listen(network, address)
+    if err != nil {
+        return err
+    }
+    if network == "unix" {
+        defer os.Remove(address)
+    }
+    return serve(ctx, ln, h, logf)
+}
+
+// serve runs Serve's accept loop on ln, which it closes.
+func serve(ctx context.Context, ln net.Listener, h ConnHandler, logf func(format string, args ...any)) error {
+    var (
+        wg    sync.WaitGroup
+        mu    sync.Mutex
+        conns = map[net.Conn]struct{}{}
+    )
+    closeAll := func() {
+        _ = ln.Close()
+        // Closing the connections unblocks handlers stuck in Read.
+        mu.Lock()
+        for c := range conns {
+            _ = c.Close()
+        }
+        mu.Unlock()
+    }
+    stop := make(chan struct{})
+    defer close(stop)
+    go func() {
+        select {
+        case <-ctx.Done():
+            closeAll()
+        case <-stop:
+        }
+    }()
+
+    var delay time.Duration // backoff after a temporary Accept error
+    for {
+        conn, err := ln.Accept()
+        if err != nil {
+            if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) && temporary(err) {
+                // Out of file descriptors or buffers: wait for handlers to
+                // release some, as net/http.Server.Serve does.
+                if delay == 0 {
+                    delay = 5 * time.Millisecond
+                } else if delay *= 2; delay > maxAcceptDelay {
+                    delay = maxAcceptDelay
+                }
+                logf("accept: %v; retrying in %v", err, delay)
+                select {
+                case <-time.After(delay):
+                case <-ctx.Done():
+                }
+                continue
+            }
+            closeAll()
+            wg.Wait()
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            if errors.Is(err, net.ErrClosed) {
+                return nil
+            }
+            return err
+        }
+        delay = 0
+        mu.Lock()
+        conns[conn] = struct{}{}
+        mu.Unlock()
+        if ctx.Err() != nil {
+            // Accepted while shutting down; the closer may have missed it.
+            _ = conn.Close()
+        }
+
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            defer func() {
+                mu.Lock()
+                delete(conns, conn)
+                mu.Unlock()
+                _ = conn.Close()
+            }()
+            if err := h(ctx, conn, conn); err != nil && ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+                logf("connection %s: %v", conn.RemoteAddr(), err)
+            }
+        }()
+    }
+}
+
+// temporary reports whether an Accept error is worth retrying: the process
+// or system ran out of file descriptors or memory, or the peer gave up on a
+// pending connection. Anything else ends the listener.
+func temporary(err error) bool {
+    for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED, syscall.ECONNRESET} {
+        if errors.Is(err, errno) {
+            return true
+        }
+    }
+    var ne interface{ Timeout() bool }
+    return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,93 @@
+package mcp
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "strings"
+)
+
+// AuthTokenEnv names the environment variable holding the bearer token for
+// networked transports.
+const AuthTokenEnv = "CODEX_MCP_AUTH_TOKEN"
+
+// ResolveAuthToken picks the bearer token from, in order of precedence, the
+// explicit flag value, a token file, or $CODEX_MCP_AUTH_TOKEN. It returns ""
+// when none is configured.
+func ResolveAuthToken(flagValue, tokenFile string) (string, error) {
+    if flagValue != "" {
+        return flagValue, nil
+    }
+    if tokenFile != "" {
+        b, err := os.ReadFile(tokenFile)
+        if err != nil {
+            return "", fmt.Errorf("read auth token file: %w", err)
+        }
+        tok := strings.TrimSpace(string(b))
+        if tok == "" {
+            return "", fmt.Errorf("auth token file %s is empty", tokenFile)
+        }
+        return tok, nil
+    }
+    return os.Getenv(AuthTokenEnv), nil
+}
+
+// tokenMatches compares a presented "Bearer <token>" credential against the
+// configured token in constant time.
+func tokenMatches(want, authorization string) bool {
+    got, ok := strings.CutPrefix(strings.TrimSpace(authorization), "Bearer ")
+    if !ok {
+        return false
+    }
+    return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(want)) == 1
+}
+
+// unauthorizedError is returned for requests lacking valid credentials.
+func unauthorizedError() *Error {
+    return NewError(CodeUnauthorized, "unauthorized: missing or invalid bearer token")
+}
+
+// authorizeHTTP checks the Authorization header and writes a 401 response
+// when it does not carry the configured token.
+func (h *HTTPHandler) authorizeHTTP(w http.ResponseWriter, r *http.Request) bool {
+    want := h.srv.opts.AuthToken
+    if want == "" || tokenMatches(want, r.Header.Get("Authorization")) {
+        return true
+    }
+    w.Header().Set("WWW-Authenticate", `Bearer realm="codex-go"`)
+    writeHTTPError(w, http.StatusUnauthorized, unauthorizedError())
+    return false
+}
+
+// authorizeStream authenticates a stream connection (socket listener).
+// Without HTTP headers, the client presents the token in the initialize
+// request as params._meta.authorization = "Bearer <token>". Until then every
+// request is rejected.
+func (s *Server) authorizeStream(sess *session, req *Request) *Error {
+    want := s.opts.AuthToken
+    if want == "" {
+        return nil
+    }
+    sess.mu.Lock()
+    ok := sess.authenticated
+    sess.mu.Unlock()
+    if ok {
+        return nil
+    }
+    if req.Method == "initialize" {
+        var p struct {
+            Meta struct {
+                Authorization string `json:"authorization"`
+            } `json:"_meta"`
+        }
+        if json.Unmarshal(req.Params, &p) == nil && tokenMatches(want, p.Meta.Authorization) {
+            sess.mu.Lock()
+            sess.authenticated = true
+            sess.mu.Unlock()
+            return nil
+        }
+    }
+    return unauthorizedError()
+}
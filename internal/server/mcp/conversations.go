@@ -0,0 +1,246 @@
+package mcp
+
+import (
+    "context"
+    "encoding/json"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+
+    "codex-go/internal/agent"
+    "codex-go/internal/protocol"
+)
+
+// Bounds of the conversations a Server keeps when Options do not say.
+const (
+    DefaultMaxConversations        = 32
+    DefaultConversationIdleTimeout = time.Hour
+)
+
+// conversation is a live agent conversation started through the codex tool.
+// turnMu serializes turns so concurrent codex-reply calls for the same id
+// cannot interleave.
+type conversation struct {
+    id     string
+    agent  *agent.Agent
+    owner  *session // started it; the conversation ends with it
+    turnMu sync.Mutex
+    // closed is set, under turnMu, once the conversation was ended.
+    closed bool
+
+    mu         sync.Mutex
+    transcript []transcriptEntry
+    lastUsed   time.Time // when it started or its last turn ended
+}
+
+// transcriptEntry is one recorded item of a conversation: either the
+// submission sent to the agent or an event it produced.
+type transcriptEntry struct {
+    Submission *protocol.Submission `json:"submission,omitempty"`
+    Event      *protocol.Event      `json:"event,omitempty"`
+}
+
+// record appends e to the transcript.
+func (c *conversation) record(e transcriptEntry) {
+    c.mu.Lock()
+    c.transcript = append(c.transcript, e)
+    c.mu.Unlock()
+}
+
+// transcriptSnapshot returns a copy of the transcript so far.
+func (c *conversation) transcriptSnapshot() []transcriptEntry {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return append([]transcriptEntry{}, c.transcript...)
+}
+
+// used returns when c was last used.
+func (c *conversation) used() time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.lastUsed
+}
+
+// touch records that c was just used.
+func (c *conversation) touch() {
+    c.mu.Lock()
+    c.lastUsed = time.Now()
+    c.mu.Unlock()
+}
+
+// conversationRegistry tracks live conversations by id. It is shared by all
+// sessions of a Server so a conversation can be continued from any of them.
+// Conversations end, and their agents shut down, when the session that
+// started them ends, after idle without a turn, or, least recently used
+// first, when more than max would be kept; one running a turn is left to
+// finish it.
+type conversationRegistry struct {
+    max  int
+    idle time.Duration
+
+    mu   sync.Mutex
+    byID map[string]*conversation
+}
+
+// newConversationRegistry returns a registry keeping up to max
+// conversations, each for up to idle without a turn; zero values select
+// the defaults.
+func newConversationRegistry(max int, idle time.Duration) *conversationRegistry {
+    if max <= 0 {
+        max = DefaultMaxConversations
+    }
+    if idle <= 0 {
+        idle = DefaultConversationIdleTimeout
+    }
+    return &conversationRegistry{max: max, idle: idle, byID: map[string]*conversation{}}
+}
+
+// start registers a new conversation around a, started by owner.
+func (r *conversationRegistry) start(a *agent.Agent, owner *session) *conversation {
+    r.evict(r.max - 1)
+    conv := &conversation{id: a.SessionID(), agent: a, owner: owner, lastUsed: time.Now()}
+    r.mu.Lock()
+    r.byID[conv.id] = conv
+    r.mu.Unlock()
+    return conv
+}
+
+// get returns the conversation with the given id.
+func (r *conversationRegistry) get(id string) (*conversation, bool) {
+    r.evict(r.max)
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    conv, ok := r.byID[id]
+    return conv, ok
+}
+
+// list returns all live conversations ordered by id.
+func (r *conversationRegistry) list() []*conversation {
+    r.evict(r.max)
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    out := make([]*conversation, 0, len(r.byID))
+    for _, c := range r.byID {
+        out = append(out, c)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].id < out[j].id })
+    return out
+}
+
+// evict ends the conversations idle for too long, then the least recently
+// used ones until at most keep remain.
+func (r *conversationRegistry) evict(keep int) {
+    r.mu.Lock()
+    convs := make([]*conversation, 0, len(r.byID))
+    for _, c := range r.byID {
+        convs = append(convs, c)
+    }
+    r.mu.Unlock()
+    sort.Slice(convs, func(i, j int) bool { return convs[i].used().Before(convs[j].used()) })
+    now, n := time.Now(), len(convs)
+    for _, c := range convs {
+        if n <= keep && now.Sub(c.used()) <= r.idle {
+            break
+        }
+        if c.turnMu.TryLock() {
+            r.end(c)
+            c.turnMu.Unlock()
+            n--
+        }
+    }
+}
+
+// endSession ends the conversations sess started, once their turns
+// finished.
+func (r *conversationRegistry) endSession(sess *session) {
+    r.mu.Lock()
+    var owned []*conversation
+    for _, c := range r.byID {
+        if c.owner == sess {
+            owned = append(owned, c)
+        }
+    }
+    r.mu.Unlock()
+    for _, c := range owned {
+        go func(c *conversation) {
+            c.turnMu.Lock()
+            defer c.turnMu.Unlock()
+            r.end(c)
+        }(c)
+    }
+}
+
+// end forgets c and shuts its agent down. The caller holds c.turnMu.
+func (r *conversationRegistry) end(c *conversation) {
+    if c.closed {
+        return
+    }
+    c.closed = true
+    r.mu.Lock()
+    delete(r.byID, c.id)
+    r.mu.Unlock()
+    shutdown := protocol.Submission{ID: "mcp-shutdown", Op: protocol.ShutdownOp{}}
+    _ = c.agent.Submit(context.Background(), shutdown, func(protocol.Event) error { return nil })
+}
+
+// codexReplyToolSchema is the JSON Schema for the codex-reply tool arguments.
+const codexReplyToolSchema = `{
+  "type": "object",
+  "properties": {
+    "conversationId": {"type": "string", "description": "The id returned by a previous codex tool call."},
+    "prompt": {"type": "string", "description": "The next user prompt to continue the Codex conversation."}
+  },
+  "required": ["conversationId", "prompt"]
+}`
+
+// newCodexReplyTool returns the "codex-reply" tool, which runs another turn
+// of a conversation previously started with the codex tool.
+func (s *Server) newCodexReplyTool() *serverTool {
+    return &serverTool{
+        def: Tool{
+            Name:        "codex-reply",
+            Description: "Continue a Codex conversation by providing the conversation id and the next prompt.",
+            InputSchema: json.RawMessage(codexReplyToolSchema),
+        },
+        call: s.callCodexReplyTool,
+    }
+}
+
+func (s *Server) callCodexReplyTool(ctx context.Context, c *toolCall) (*CallToolResult, error) {
+    var args struct {
+        ConversationID string `json:"conversationId"`
+        Prompt         string `json:"prompt"`
+    }
+    if err := decodeParams(c.args, &args); err != nil {
+        return nil, err
+    }
+    if args.ConversationID == "" {
+        return nil, NewError(CodeInvalidParams, "missing conversationId")
+    }
+    if strings.TrimSpace(args.Prompt) == "" {
+        return nil, NewError(CodeInvalidParams, "missing prompt")
+    }
+    conv, ok := s.conversations.get(args.ConversationID)
+    if !ok {
+        return textResult("unknown conversation: "+args.ConversationID, true), nil
+    }
+    return runConversationTurn(ctx, c, conv, args.Prompt)
+}
+
+// runConversationTurn runs one turn of conv and tags the result with the
+// conversation id so clients can keep replying.
+func runConversationTurn(ctx context.Context, c *toolCall, conv *conversation, prompt string) (*CallToolResult, error) {
+    conv.turnMu.Lock()
+    defer conv.turnMu.Unlock()
+    if conv.closed {
+        return textResult("conversation has ended: "+conv.id, true), nil
+    }
+    defer conv.touch()
+    res, err := runAgentTurn(ctx, c, conv.agent, prompt, conv.record)
+    if err != nil {
+        return nil, err
+    }
+    res.StructuredContent = map[string]any{"conversationId": conv.id}
+    return res, nil
+}
@@ -0,0 +1,149 @@
+package mcp
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "net/textproto"
+    "strconv"
+    "strings"
+
+    "codex-go/internal/jsonl"
+)
+
+// Framing selects how JSON-RPC messages are delimited on a byte stream.
+type Framing string
+
+const (
+    // FramingAuto picks NDJSON or LSP framing from the first bytes received.
+    FramingAuto Framing = "auto"
+    // FramingNDJSON is one JSON message per line (the MCP stdio default).
+    FramingNDJSON Framing = "ndjson"
+    // FramingLSP prefixes each message with LSP-style headers
+    // ("Content-Length: N\r\n\r\n").
+    FramingLSP Framing = "lsp"
+)
+
+// ParseFraming validates a framing name as accepted on the command line.
+func ParseFraming(s string) (Framing, error) {
+    switch Framing(strings.ToLower(s)) {
+    case "", FramingAuto:
+        return FramingAuto, nil
+    case FramingNDJSON, "jsonl":
+        return FramingNDJSON, nil
+    case FramingLSP, "content-length":
+        return FramingLSP, nil
+    default:
+        return "", fmt.Errorf("unknown framing %q (want auto, ndjson or lsp)", s)
+    }
+}
+
+// framer reads and writes frames for one connection. In auto mode the
+// concrete framing is fixed on the first read, before any reply is written.
+type framer struct {
+    mode Framing
+    br   *bufio.Reader
+    w    io.Writer
+    max  int
+
+    lines *jsonl.Reader // set once mode is NDJSON
+}
+
+func newFramer(mode Framing, r io.Reader, w io.Writer, max int) *framer {
+    if mode == "" {
+        mode = FramingAuto
+    }
+    f := &framer{mode: mode, br: bufio.NewReader(r), w: w, max: max}
+    if mode == FramingNDJSON {
+        f.lines = jsonl.NewReader(f.br, max)
+    }
+    return f
+}
+
+// detect resolves FramingAuto by peeking at the first non-blank bytes.
+func (f *framer) detect() error {
+    for {
+        b, err := f.br.Peek(1)
+        if err != nil {
+            return err
+        }
+        if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+            _, _ = f.br.ReadByte()
+            continue
+        }
+        break
+    }
+    const prefix = "content-length"
+    head, _ := f.br.Peek(len(prefix))
+    if strings.EqualFold(string(head), prefix) {
+        f.mode = FramingLSP
+    } else {
+        f.mode = FramingNDJSON
+        f.lines = jsonl.NewReader(f.br, f.max)
+    }
+    return nil
+}
+
+// ReadFrame returns the next message body. Oversized frames are consumed and
+// reported as *jsonl.FrameTooLargeError so the caller can keep reading.
+func (f *framer) ReadFrame() ([]byte, error) {
+    if f.mode == FramingAuto {
+        if err := f.detect(); err != nil {
+            return nil, err
+        }
+    }
+    if f.mode == FramingNDJSON {
+        return f.lines.ReadFrame()
+    }
+    return f.readLSP()
+}
+
+// readLSP reads one header block followed by a Content-Length body.
+func (f *framer) readLSP() ([]byte, error) {
+    tp := textproto.NewReader(f.br)
+    var hdr textproto.MIMEHeader
+    for {
+        h, err := tp.ReadMIMEHeader()
+        if err != nil {
+            return nil, err
+        }
+        // Tolerate stray blank lines between messages.
+        if len(h) > 0 {
+            hdr = h
+            break
+        }
+    }
+    cl := hdr.Get("Content-Length")
+    n, err := strconv.Atoi(strings.TrimSpace(cl))
+    if err != nil || n < 0 {
+        return nil, fmt.Errorf("invalid Content-Length header %q", cl)
+    }
+    if n > f.max {
+        if _, err := io.CopyN(io.Discard, f.br, int64(n)); err != nil {
+            return nil, err
+        }
+        return nil, &jsonl.FrameTooLargeError{Limit: f.max}
+    }
+    body := make([]byte, n)
+    if _, err := io.ReadFull(f.br, body); err != nil {
+        return nil, err
+    }
+    return body, nil
+}
+
+// WriteFrame writes one message using the connection's framing.
+func (f *framer) WriteFrame(frame []byte) error {
+    if f.mode == FramingLSP {
+        var buf bytes.Buffer
+        fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(frame))
+        buf.Write(frame)
+        _, err := f.w.Write(buf.Bytes())
+        return err
+    }
+    _, err := f.w.Write(append(frame, '\n'))
+    return err
+}
+
+// Max returns the frame size limit.
+func (f *framer) Max() int { return f.max }
@@ -0,0 +1,402 @@
+package mcp
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+// sessionHeader carries the session id assigned on initialize, as defined
+// by the MCP streamable-HTTP transport.
+const sessionHeader = "Mcp-Session-Id"
+
+// HTTPHandler serves MCP over the streamable-HTTP transport:
+//   - POST carries client messages; requests are answered either with a
+//     single JSON body or an SSE stream (when the client accepts
+//     text/event-stream) that also carries notifications for that request.
+//   - GET opens an SSE stream for server-initiated messages.
+//   - DELETE terminates the session.
+//
+// Sessions also end after Options.SessionIdleTimeout without requests or
+// open streams. Requests from browsers must come from an allowed origin
+// (see Options.AllowedOrigins), so that web pages cannot use a server on
+// the user's machine, even through DNS rebinding.
+type HTTPHandler struct {
+    srv *Server
+
+    mu       sync.Mutex
+    sessions map[string]*httpSession
+}
+
+// httpSession is a session of an HTTPHandler and what keeps it alive.
+type httpSession struct {
+    sess     *session
+    active   int       // requests and streams in progress
+    lastUsed time.Time // when the last of them ended
+}
+
+// DefaultSessionIdleTimeout ends HTTP sessions when
+// Options.SessionIdleTimeout does not.
+const DefaultSessionIdleTimeout = 30 * time.Minute
+
+// NewHTTPHandler returns an http.Handler exposing srv.
+func NewHTTPHandler(srv *Server) *HTTPHandler {
+    return &HTTPHandler{srv: srv, sessions: map[string]*httpSession{}}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if !h.allowOrigin(r) {
+        http.Error(w, "origin not allowed", http.StatusForbidden)
+        return
+    }
+    if !h.authorizeHTTP(w, r) {
+        return
+    }
+    h.expire(time.Now())
+    switch r.Method {
+    case http.MethodPost:
+        h.handlePost(w, r)
+    case http.MethodGet:
+        h.handleGet(w, r)
+    case http.MethodDelete:
+        h.handleDelete(w, r)
+    default:
+        w.Header().Set("Allow", "GET, POST, DELETE")
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// writeHTTPError writes a JSON-RPC error body with the given HTTP status.
+func writeHTTPError(w http.ResponseWriter, status int, e *Error) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(errorResponse(nil, e))
+}
+
+// allowOrigin reports whether r may be served: it carries no Origin
+// header, as from clients other than browsers, or one of a loopback host
+// or listed in Options.AllowedOrigins.
+func (h *HTTPHandler) allowOrigin(r *http.Request) bool {
+    origin := r.Header.Get("Origin")
+    if origin == "" {
+        return true
+    }
+    for _, o := range h.srv.opts.AllowedOrigins {
+        if strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+            return true
+        }
+    }
+    u, err := url.Parse(origin)
+    return err == nil && (u.Scheme == "http" || u.Scheme == "https") && isLoopbackHost(u.Hostname())
+}
+
+// isLoopbackHost reports whether host names this machine's loopback
+// interface.
+func isLoopbackHost(host string) bool {
+    if strings.EqualFold(host, "localhost") {
+        return true
+    }
+    ip := net.ParseIP(host)
+    return ip != nil && ip.IsLoopback()
+}
+
+// add registers sess under a new id, in use by the request adding it until
+// release is called.
+func (h *HTTPHandler) add(sess *session) (id string, release func()) {
+    id = newSessionID()
+    hs := &httpSession{sess: sess, active: 1}
+    h.mu.Lock()
+    h.sessions[id] = hs
+    h.mu.Unlock()
+    return id, func() { h.release(hs) }
+}
+
+// lookup returns the session named by the request header, in use by the
+// request until release is called.
+func (h *HTTPHandler) lookup(r *http.Request) (sess *session, release func(), ok bool) {
+    id := r.Header.Get(sessionHeader)
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    hs, ok := h.sessions[id]
+    if !ok {
+        return nil, nil, false
+    }
+    hs.active++
+    return hs.sess, func() { h.release(hs) }, true
+}
+
+func (h *HTTPHandler) release(hs *httpSession) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    hs.active--
+    hs.lastUsed = time.Now()
+}
+
+// expire ends the sessions idle for longer than the session idle timeout
+// at now.
+func (h *HTTPHandler) expire(now time.Time) {
+    timeout := h.srv.opts.SessionIdleTimeout
+    if timeout <= 0 {
+        timeout = DefaultSessionIdleTimeout
+    }
+    var expired []*session
+    h.mu.Lock()
+    for id, hs := range h.sessions {
+        if hs.active == 0 && now.Sub(hs.lastUsed) > timeout {
+            delete(h.sessions, id)
+            expired = append(expired, hs.sess)
+        }
+    }
+    h.mu.Unlock()
+    for _, sess := range expired {
+        h.srv.endSession(sess)
+    }
+}
+
+// newSessionID returns a random, URL-safe session identifier.
+func newSessionID() string {
+    var b [16]byte
+    _, _ = rand.Read(b[:])
+    return hex.EncodeToString(b[:])
+}
+
+// frameInfo summarizes a POST body without dispatching it.
+type frameInfo struct {
+    hasRequests  bool // at least one message expects a response
+    isInitialize bool // the body is a single initialize request
+}
+
+func inspectFrame(body []byte) (frameInfo, error) {
+    var msgs []Request
+    if body[0] == '[' {
+        if err := json.Unmarshal(body, &msgs); err != nil {
+            return frameInfo{}, err
+        }
+    } else {
+        var one Request
+        if err := json.Unmarshal(body, &one); err != nil {
+            return frameInfo{}, err
+        }
+        msgs = []Request{one}
+    }
+    var fi frameInfo
+    for _, m := range msgs {
+        if m.Method != "" && !m.IsNotification() {
+            fi.hasRequests = true
+        }
+    }
+    fi.isInitialize = len(msgs) == 1 && msgs[0].Method == "initialize"
+    return fi, nil
+}
+
+func (h *HTTPHandler) handlePost(w http.ResponseWriter, r *http.Request) {
+    limit := h.srv.opts.maxFrameSize()
+    body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(limit)))
+    if err != nil {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            resp := frameTooLargeResponse(limit)
+            w.Header().Set("Content-Type", "application/json")
+            w.WriteHeader(http.StatusRequestEntityTooLarge)
+            _ = json.NewEncoder(w).Encode(resp)
+            return
+        }
+        writeHTTPError(w, http.StatusBadRequest, NewError(CodeInvalidRequest, "read body: %v", err))
+        return
+    }
+    body = bytes.TrimSpace(body)
+    if len(body) == 0 {
+        writeHTTPError(w, http.StatusBadRequest, NewError(CodeInvalidRequest, "empty body"))
+        return
+    }
+    fi, err := inspectFrame(body)
+    if err != nil {
+        writeHTTPError(w, http.StatusBadRequest, NewError(CodeParseError, "parse error: %v", err))
+        return
+    }
+
+    var sess *session
+    var release func()
+    if fi.isInitialize && r.Header.Get(sessionHeader) == "" {
+        sess = h.srv.newSession(nil)
+        // The Authorization header was already checked for this request.
+        sess.authenticated = true
+        var id string
+        id, release = h.add(sess)
+        w.Header().Set(sessionHeader, id)
+    } else {
+        var ok bool
+        if r.Header.Get(sessionHeader) == "" {
+            writeHTTPError(w, http.StatusBadRequest, NewError(CodeInvalidRequest, "missing %s header", sessionHeader))
+            return
+        }
+        if sess, release, ok = h.lookup(r); !ok {
+            writeHTTPError(w, http.StatusNotFound, NewError(CodeInvalidRequest, "unknown session"))
+            return
+        }
+    }
+    defer release()
+
+    ctx := r.Context()
+    if !fi.hasRequests {
+        // Only notifications/responses: process them and acknowledge.
+        _ = h.srv.handleFrame(ctx, sess, body)
+        w.WriteHeader(http.StatusAccepted)
+        return
+    }
+
+    flusher, canStream := w.(http.Flusher)
+    if !canStream || !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+        out := h.srv.handleFrame(ctx, sess, body)
+        w.Header().Set("Content-Type", "application/json")
+        if out == nil {
+            w.WriteHeader(http.StatusAccepted)
+            return
+        }
+        _ = json.NewEncoder(w).Encode(out)
+        return
+    }
+
+    // SSE response: notifications emitted while handling this POST are sent
+    // on the same stream, followed by the response(s).
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+    sink := sseSink(w, flusher)
+    ctx = withSink(ctx, sink)
+    if out := h.srv.handleFrame(ctx, sess, body); out != nil {
+        _ = sess.writeFrame(ctx, out)
+    }
+}
+
+// sseSink writes frames as SSE "message" events and flushes after each.
+func sseSink(w io.Writer, f http.Flusher) frameSink {
+    return func(frame []byte) error {
+        if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", frame); err != nil {
+            return err
+        }
+        f.Flush()
+        return nil
+    }
+}
+
+// handleGet opens the standalone SSE stream for server-initiated messages.
+// Only one such stream is kept per session; a new GET replaces the old one,
+// which ends.
+func (h *HTTPHandler) handleGet(w http.ResponseWriter, r *http.Request) {
+    if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+        http.Error(w, "GET requires Accept: text/event-stream", http.StatusNotAcceptable)
+        return
+    }
+    sess, release, ok := h.lookup(r)
+    if !ok {
+        writeHTTPError(w, http.StatusNotFound, NewError(CodeInvalidRequest, "unknown session"))
+        return
+    }
+    defer release()
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    replaced, closeStream := sess.openStream(sseSink(w, flusher))
+    defer closeStream()
+    select {
+    case <-r.Context().Done():
+    case <-replaced:
+    }
+}
+
+func (h *HTTPHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
+    id := r.Header.Get(sessionHeader)
+    h.mu.Lock()
+    hs, ok := h.sessions[id]
+    delete(h.sessions, id)
+    h.mu.Unlock()
+    if !ok {
+        writeHTTPError(w, http.StatusNotFound, NewError(CodeInvalidRequest, "unknown session"))
+        return
+    }
+    h.srv.endSession(hs.sess)
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeHTTP listens on addr and serves MCP over streamable HTTP at /mcp
+// until ctx is canceled. An addr without a host, like ":8080", listens on
+// the loopback interface only (see HTTPAddr); any other host than a
+// loopback one needs Options.AuthToken.
+func ServeHTTP(ctx context.Context, addr string, opts Options) error {
+    return NewServer(opts).ListenHTTP(ctx, addr)
+}
+
+// HTTPAddr returns the address ServeHTTP listens on for addr.
+func HTTPAddr(addr string) string {
+    host, port, err := net.SplitHostPort(addr)
+    if err == nil && host == "" {
+        return net.JoinHostPort("127.0.0.1", port)
+    }
+    return addr
+}
+
+// ErrHTTPNeedsAuth is returned by ServeHTTP for a non-loopback address
+// without Options.AuthToken.
+var ErrHTTPNeedsAuth = errors.New("mcp: serving HTTP beyond the loopback interface needs an auth token")
+
+// ListenHTTP is ServeHTTP for an existing Server.
+func (s *Server) ListenHTTP(ctx context.Context, addr string) error {
+    addr = HTTPAddr(addr)
+    host, _, err := net.SplitHostPort(addr)
+    if err != nil {
+        return err
+    }
+    if !isLoopbackHost(host) && s.opts.AuthToken == "" {
+        return ErrHTTPNeedsAuth
+    }
+    mux := http.NewServeMux()
+    mux.Handle("/mcp", NewHTTPHandler(s))
+
+    ln, err := net.Listen("tcp", addr)
+    if err != nil {
+        return err
+    }
+    hs := &http.Server{
+        Handler:           mux,
+        ReadHeaderTimeout: 10 * time.Second,
+        // Tie request contexts to ctx so open SSE streams end on shutdown.
+        BaseContext: func(net.Listener) context.Context { return ctx },
+    }
+
+    errc := make(chan error, 1)
+    go func() { errc <- hs.Serve(ln) }()
+
+    select {
+    case err := <-errc:
+        if errors.Is(err, http.ErrServerClosed) {
+            return nil
+        }
+        return err
+    case <-ctx.Done():
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        _ = hs.Shutdown(shutdownCtx)
+        return ctx.Err()
+    }
+}
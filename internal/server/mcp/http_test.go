@@ -0,0 +1,71 @@
+package mcp
+
+import (
+    "bufio"
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestHTTPGetStreamReplaced(t *testing.T) {
+    h := NewHTTPHandler(NewServer(Options{}))
+    sess := h.srv.newSession(nil)
+    id, release := h.add(sess)
+    release()
+    ts := httptest.NewServer(h)
+    defer ts.Close()
+
+    open := func() *http.Response {
+        t.Helper()
+        req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+        if err != nil {
+            t.Fatal(err)
+        }
+        req.Header.Set("Accept", "text/event-stream")
+        req.Header.Set(sessionHeader, id)
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if resp.StatusCode != http.StatusOK {
+            t.Fatalf("GET status %d", resp.StatusCode)
+        }
+        return resp
+    }
+    first := open()
+    second := open()
+    defer second.Body.Close()
+
+    // The client drops the replaced stream; its handler must not take the
+    // second stream's sink along.
+    first.Body.Close()
+    time.Sleep(500 * time.Millisecond)
+
+    if err := sess.notify(context.Background(), "notifications/test", nil); err != nil {
+        t.Fatal(err)
+    }
+    lines := make(chan string)
+    go func() {
+        sc := bufio.NewScanner(second.Body)
+        for sc.Scan() {
+            lines <- sc.Text()
+        }
+        close(lines)
+    }()
+    for {
+        select {
+        case line, ok := <-lines:
+            if !ok {
+                t.Fatal("second stream ended without the notification")
+            }
+            if strings.Contains(line, "notifications/test") {
+                return
+            }
+        case <-time.After(2 * time.Second):
+            t.Fatal("notification not delivered on the second stream")
+        }
+    }
+}
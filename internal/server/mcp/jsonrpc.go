@@ -0,0 +1,113 @@
+package mcp
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+)
+
+// jsonrpcVersion is the only protocol version we speak. Every request and
+// response frame must carry it verbatim in the "jsonrpc" member.
+const jsonrpcVersion = "2.0"
+
+// Standard JSON-RPC 2.0 error codes (see https://www.jsonrpc.org/specification).
+const (
+    CodeParseError     = -32700
+    CodeInvalidRequest = -32600
+    CodeMethodNotFound = -32601
+    CodeInvalidParams  = -32602
+    CodeInternalError  = -32603
+)
+
+// Implementation-defined server errors (-32000 to -32099).
+const (
+    // CodeFrameTooLarge reports an incoming frame above the size limit.
+    CodeFrameTooLarge = -32000
+    // CodeUnauthorized rejects requests without valid credentials.
+    CodeUnauthorized = -32001
+    // CodeResourceNotFound is the MCP code for an unknown resource URI.
+    CodeResourceNotFound = -32002
+)
+
+// Request is a JSON-RPC 2.0 request or notification. A request without an
+// "id" member is a notification and must never receive a response.
+type Request struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id,omitempty"`
+    Method  string          `json:"method"`
+    Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// IsNotification reports whether the request carries no id.
+func (r *Request) IsNotification() bool { return len(r.ID) == 0 }
+
+// Response is a JSON-RPC 2.0 response. Exactly one of Result or Error is set.
+// Result is kept as raw JSON so that a successful "null" result still
+// serializes as a present member.
+type Response struct {
+    JSONRPC string          `json:"jsonrpc"`
+    ID      json.RawMessage `json:"id"`
+    Result  json.RawMessage `json:"result,omitempty"`
+    Error   *Error          `json:"error,omitempty"`
+}
+
+// Notification is a server-to-client message that expects no reply.
+type Notification struct {
+    JSONRPC string `json:"jsonrpc"`
+    Method  string `json:"method"`
+    Params  any    `json:"params,omitempty"`
+}
+
+// Error is the structured error object carried in a Response. It also
+// implements the error interface so handlers can return it directly.
+type Error struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+    Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message) }
+
+// NewError builds an Error with a formatted message.
+func NewError(code int, format string, args ...any) *Error {
+    return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// nullID is used when the request id could not be determined (parse errors,
+// invalid requests), as mandated by the spec.
+var nullID = json.RawMessage("null")
+
+// validID reports whether raw is an acceptable id: a string, a number or null.
+func validID(raw json.RawMessage) bool {
+    raw = bytes.TrimSpace(raw)
+    if len(raw) == 0 {
+        return true
+    }
+    switch raw[0] {
+    case '"':
+        var s string
+        return json.Unmarshal(raw, &s) == nil
+    case 'n':
+        return string(raw) == "null"
+    default:
+        var n json.Number
+        return json.Unmarshal(raw, &n) == nil
+    }
+}
+
+// resultResponse encodes v as the result member of a response for id.
+func resultResponse(id json.RawMessage, v any) Response {
+    b, err := json.Marshal(v)
+    if err != nil {
+        return errorResponse(id, NewError(CodeInternalError, "marshal result: %v", err))
+    }
+    return Response{JSONRPC: jsonrpcVersion, ID: id, Result: b}
+}
+
+// errorResponse wraps e in a response for id (or null when id is unknown).
+func errorResponse(id json.RawMessage, e *Error) Response {
+    if len(id) == 0 {
+        id = nullID
+    }
+    return Response{JSONRPC: jsonrpcVersion, ID: id, Error: e}
+}
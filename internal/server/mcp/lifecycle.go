@@ -0,0 +1,115 @@
+package mcp
+
+import (
+    "context"
+    "encoding/json"
+
+    "codex-go/internal/version"
+)
+
+// serverName is reported to clients in the initialize result.
+const serverName = "codex-go"
+
+// supportedProtocolVersions lists the MCP revisions we understand, newest
+// first. When a client asks for something else we answer with the newest
+// one and let the client decide whether to disconnect.
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// preInitMethods may be called before the initialize handshake completed.
+var preInitMethods = map[string]bool{
+    "initialize": true,
+    "ping":       true,
+    "echo":       true,
+}
+
+// Implementation identifies a client or server (name + version).
+type Implementation struct {
+    Name    string `json:"name"`
+    Version string `json:"version"`
+}
+
+// ServerCapabilities advertises the optional features this server offers.
+// Empty objects mean "supported without sub-options".
+type ServerCapabilities struct {
+    Tools     *ToolsCapability     `json:"tools,omitempty"`
+    Resources *ResourcesCapability `json:"resources,omitempty"`
+    Prompts   *PromptsCapability   `json:"prompts,omitempty"`
+    Logging   *struct{}            `json:"logging,omitempty"`
+    // Experimental lists non-standard extensions, e.g. codex/event.
+    Experimental map[string]any `json:"experimental,omitempty"`
+}
+
+// ToolsCapability describes tool-related server features.
+type ToolsCapability struct {
+    ListChanged bool `json:"listChanged"`
+}
+
+// initializeParams is the client half of the handshake.
+type initializeParams struct {
+    ProtocolVersion string          `json:"protocolVersion"`
+    Capabilities    json.RawMessage `json:"capabilities,omitempty"`
+    ClientInfo      Implementation  `json:"clientInfo"`
+}
+
+// InitializeResult is returned to the client in response to initialize.
+type InitializeResult struct {
+    ProtocolVersion string             `json:"protocolVersion"`
+    Capabilities    ServerCapabilities `json:"capabilities"`
+    ServerInfo      Implementation     `json:"serverInfo"`
+    Instructions    string             `json:"instructions,omitempty"`
+}
+
+// negotiateVersion picks the protocol version to answer with.
+func negotiateVersion(requested string) string {
+    for _, v := range supportedProtocolVersions {
+        if v == requested {
+            return v
+        }
+    }
+    return supportedProtocolVersions[0]
+}
+
+// handleInitialize performs the server side of the MCP handshake.
+func handleInitialize(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    var p initializeParams
+    if err := decodeParams(params, &p); err != nil {
+        return nil, err
+    }
+    if p.ProtocolVersion == "" {
+        return nil, NewError(CodeInvalidParams, "missing protocolVersion")
+    }
+
+    sess.mu.Lock()
+    if sess.initialized {
+        sess.mu.Unlock()
+        return nil, NewError(CodeInvalidRequest, "session already initialized")
+    }
+    sess.initialized = true
+    sess.protocolVersion = negotiateVersion(p.ProtocolVersion)
+    sess.clientInfo = p.ClientInfo
+    pv := sess.protocolVersion
+    sess.mu.Unlock()
+
+    return InitializeResult{
+        ProtocolVersion: pv,
+        Capabilities: ServerCapabilities{
+            Tools:     &ToolsCapability{},
+            Resources: &ResourcesCapability{},
+            Prompts:   &PromptsCapability{},
+            Logging:   &struct{}{},
+            Experimental: map[string]any{
+                codexEventMethod: struct{}{},
+            },
+        },
+        ServerInfo: Implementation{Name: serverName, Version: version.Version},
+    }, nil
+}
+
+// handleInitialized records the client's notifications/initialized, after
+// which the server may start sending its own requests and notifications.
+func handleInitialized(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    sess.mu.Lock()
+    sess.ready = true
+    sess.mu.Unlock()
+    return nil, nil
+}
@@ -0,0 +1,121 @@
+package mcp
+
+import (
+    "context"
+    "encoding/json"
+    "log/slog"
+)
+
+// loggerName is reported as the "logger" of every notifications/message.
+const loggerName = "codex-go"
+
+// mcpLevels maps MCP (RFC 5424) log level names onto slog levels. slog only
+// defines debug/info/warn/error, so the remaining syslog levels are spaced
+// around them.
+var mcpLevels = map[string]slog.Level{
+    "debug":     slog.LevelDebug,
+    "info":      slog.LevelInfo,
+    "notice":    slog.LevelInfo + 2,
+    "warning":   slog.LevelWarn,
+    "error":     slog.LevelError,
+    "critical":  slog.LevelError + 4,
+    "alert":     slog.LevelError + 8,
+    "emergency": slog.LevelError + 12,
+}
+
+// mcpLevelName returns the MCP name of the highest MCP level not above l.
+func mcpLevelName(l slog.Level) string {
+    name, best := "debug", slog.LevelDebug
+    for n, v := range mcpLevels {
+        if v <= l && v >= best {
+            name, best = n, v
+        }
+    }
+    return name
+}
+
+// handleSetLevel implements logging/setLevel. Until the client calls it no
+// log notifications are sent.
+func handleSetLevel(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    var p struct {
+        Level string `json:"level"`
+    }
+    if err := decodeParams(params, &p); err != nil {
+        return nil, err
+    }
+    lvl, ok := mcpLevels[p.Level]
+    if !ok {
+        return nil, NewError(CodeInvalidParams, "unknown log level: %q", p.Level)
+    }
+    sess.mu.Lock()
+    sess.logLevel = lvl
+    sess.logEnabled = true
+    sess.mu.Unlock()
+    return struct{}{}, nil
+}
+
+// clientLogLevel reports the level requested by the client, if any.
+func (s *session) clientLogLevel() (slog.Level, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.logLevel, s.logEnabled && s.initialized
+}
+
+// sessionLogHandler is a slog.Handler that passes records to the shared
+// server logger and mirrors them to the client as notifications/message
+// when they meet the level chosen via logging/setLevel.
+type sessionLogHandler struct {
+    base  slog.Handler
+    sess  *session
+    attrs []slog.Attr
+}
+
+func newSessionLogger(base *slog.Logger, sess *session) *slog.Logger {
+    return slog.New(&sessionLogHandler{base: base.Handler(), sess: sess})
+}
+
+func (h *sessionLogHandler) Enabled(ctx context.Context, l slog.Level) bool {
+    if h.base.Enabled(ctx, l) {
+        return true
+    }
+    min, ok := h.sess.clientLogLevel()
+    return ok && l >= min
+}
+
+func (h *sessionLogHandler) Handle(ctx context.Context, r slog.Record) error {
+    if h.base.Enabled(ctx, r.Level) {
+        _ = h.base.Handle(ctx, r)
+    }
+    min, ok := h.sess.clientLogLevel()
+    if !ok || r.Level < min {
+        return nil
+    }
+    data := map[string]any{"message": r.Message}
+    add := func(a slog.Attr) bool {
+        data[a.Key] = a.Value.Resolve().Any()
+        return true
+    }
+    for _, a := range h.attrs {
+        add(a)
+    }
+    r.Attrs(add)
+    return h.sess.notify(ctx, "notifications/message", map[string]any{
+        "level":  mcpLevelName(r.Level),
+        "logger": loggerName,
+        "data":   data,
+    })
+}
+
+func (h *sessionLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return &sessionLogHandler{
+        base:  h.base.WithAttrs(attrs),
+        sess:  h.sess,
+        attrs: append(append([]slog.Attr{}, h.attrs...), attrs...),
+    }
+}
+
+// WithGroup is not meaningful for the flat MCP payload; groups only affect
+// the shared logger.
+func (h *sessionLogHandler) WithGroup(name string) slog.Handler {
+    return &sessionLogHandler{base: h.base.WithGroup(name), sess: h.sess, attrs: h.attrs}
+}
@@ -0,0 +1,183 @@
+package mcp
+
+import (
+    "context"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strings"
+
+    "codex-go/internal/codexhome"
+)
+
+// Prompt templates live in <codex home>/prompts/<name>.md. A file may start
+// with a small front matter block:
+//
+//	---
+//	description: Review a file for bugs
+//	arguments: file, focus?
+//	---
+//	Review {{file}} carefully. Pay special attention to {{focus}}.
+//
+// Arguments ending in "?" are optional. Placeholders used in the body but
+// not declared are treated as required arguments. Missing optional
+// arguments expand to the empty string.
+
+// placeholderRE matches {{name}} placeholders in a prompt body.
+var placeholderRE = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+)\s*\}\}`)
+
+// PromptArgument describes one template argument.
+type PromptArgument struct {
+    Name        string `json:"name"`
+    Description string `json:"description,omitempty"`
+    Required    bool   `json:"required"`
+}
+
+// Prompt describes a template as advertised by prompts/list.
+type Prompt struct {
+    Name        string           `json:"name"`
+    Description string           `json:"description,omitempty"`
+    Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+// PromptMessage is one message of an expanded prompt.
+type PromptMessage struct {
+    Role    string       `json:"role"`
+    Content ContentBlock `json:"content"`
+}
+
+// PromptsCapability describes prompt-related server features.
+type PromptsCapability struct {
+    ListChanged bool `json:"listChanged"`
+}
+
+// promptTemplate is a parsed prompt file.
+type promptTemplate struct {
+    Prompt
+    body string
+}
+
+// promptsDir returns the directory holding prompt files.
+func promptsDir() (string, error) { return codexhome.Path("prompts") }
+
+// parsePromptFile splits front matter from the body and derives arguments.
+func parsePromptFile(name, content string) promptTemplate {
+    t := promptTemplate{Prompt: Prompt{Name: name}}
+    body := content
+    if rest, ok := strings.CutPrefix(strings.ReplaceAll(content, "\r\n", "\n"), "---\n"); ok {
+        if fm, after, ok := strings.Cut(rest, "\n---"); ok {
+            body = strings.TrimPrefix(after, "\n")
+            for _, line := range strings.Split(fm, "\n") {
+                key, val, ok := strings.Cut(line, ":")
+                if !ok {
+                    continue
+                }
+                val = strings.TrimSpace(val)
+                switch strings.TrimSpace(key) {
+                case "description":
+                    t.Description = val
+                case "arguments":
+                    for _, a := range strings.Split(val, ",") {
+                        a = strings.TrimSpace(a)
+                        if a == "" {
+                            continue
+                        }
+                        optional := strings.HasSuffix(a, "?")
+                        t.Arguments = append(t.Arguments, PromptArgument{Name: strings.TrimSuffix(a, "?"), Required: !optional})
+                    }
+                }
+            }
+        }
+    }
+    t.body = body
+
+    declared := map[string]bool{}
+    for _, a := range t.Arguments {
+        declared[a.Name] = true
+    }
+    for _, m := range placeholderRE.FindAllStringSubmatch(body, -1) {
+        if !declared[m[1]] {
+            declared[m[1]] = true
+            t.Arguments = append(t.Arguments, PromptArgument{Name: m[1], Required: true})
+        }
+    }
+    return t
+}
+
+// loadPrompts reads every *.md template, sorted by name. A missing prompts
+// directory yields no templates.
+func loadPrompts() ([]promptTemplate, error) {
+    dir, err := promptsDir()
+    if err != nil {
+        return nil, err
+    }
+    entries, err := os.ReadDir(dir)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    var out []promptTemplate
+    for _, e := range entries {
+        if e.IsDir() || filepath.Ext(e.Name()) != ".md" {
+            continue
+        }
+        b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+        if err != nil {
+            return nil, err
+        }
+        out = append(out, parsePromptFile(strings.TrimSuffix(e.Name(), ".md"), string(b)))
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+    return out, nil
+}
+
+func handlePromptsList(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    templates, err := loadPrompts()
+    if err != nil {
+        return nil, err
+    }
+    out := make([]Prompt, 0, len(templates))
+    for _, t := range templates {
+        out = append(out, t.Prompt)
+    }
+    return map[string]any{"prompts": out}, nil
+}
+
+func handlePromptsGet(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    var p struct {
+        Name      string            `json:"name"`
+        Arguments map[string]string `json:"arguments"`
+    }
+    if err := decodeParams(params, &p); err != nil {
+        return nil, err
+    }
+    templates, err := loadPrompts()
+    if err != nil {
+        return nil, err
+    }
+    for _, t := range templates {
+        if t.Name != p.Name {
+            continue
+        }
+        for _, a := range t.Arguments {
+            if _, ok := p.Arguments[a.Name]; a.Required && !ok {
+                return nil, NewError(CodeInvalidParams, "missing required argument: %s", a.Name)
+            }
+        }
+        text := placeholderRE.ReplaceAllStringFunc(t.body, func(m string) string {
+            return p.Arguments[placeholderRE.FindStringSubmatch(m)[1]]
+        })
+        return map[string]any{
+            "description": t.Description,
+            "messages": []PromptMessage{{
+                Role:    "user",
+                Content: ContentBlock{Type: "text", Text: strings.TrimSpace(text)},
+            }},
+        }, nil
+    }
+    return nil, NewError(CodeInvalidParams, "unknown prompt: %s", p.Name)
+}
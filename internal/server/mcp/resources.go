@@ -0,0 +1,233 @@
+package mcp
+
+import (
+    "context"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+
+    "codex-go/internal/agent"
+    "codex-go/internal/codexhome"
+    "codex-go/internal/config"
+    "codex-go/internal/version"
+)
+
+// Resource URIs served by this server.
+const (
+    configURI             = "codex://config"
+    conversationURIPrefix = "codex://conversations/"
+    transcriptSuffix      = "/transcript"
+    rolloutURIPrefix      = "codex://rollouts/"
+)
+
+// maxListedRollouts caps how many recent rollout files resources/list shows.
+const maxListedRollouts = 20
+
+// Resource describes a readable resource as advertised by resources/list.
+type Resource struct {
+    URI         string `json:"uri"`
+    Name        string `json:"name"`
+    Description string `json:"description,omitempty"`
+    MimeType    string `json:"mimeType,omitempty"`
+}
+
+// ResourceContents is one entry of a resources/read result.
+type ResourceContents struct {
+    URI      string `json:"uri"`
+    MimeType string `json:"mimeType,omitempty"`
+    Text     string `json:"text"`
+}
+
+// ResourcesCapability describes resource-related server features.
+type ResourcesCapability struct {
+    Subscribe   bool `json:"subscribe"`
+    ListChanged bool `json:"listChanged"`
+}
+
+// rolloutFile is a recorded session found under <codex home>/sessions.
+type rolloutFile struct {
+    name    string // path relative to the sessions dir, slash-separated
+    path    string
+    modTime int64
+}
+
+// recentRollouts returns the newest rollout files, newest first. A missing
+// sessions directory simply yields no files.
+func recentRollouts(limit int) []rolloutFile {
+    root, err := codexhome.Path("sessions")
+    if err != nil {
+        return nil
+    }
+    var files []rolloutFile
+    _ = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+        if err != nil || d.IsDir() || !strings.HasSuffix(p, ".jsonl") {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil {
+            return nil
+        }
+        rel, _ := filepath.Rel(root, p)
+        files = append(files, rolloutFile{name: filepath.ToSlash(rel), path: p, modTime: info.ModTime().UnixNano()})
+        return nil
+    })
+    sort.Slice(files, func(i, j int) bool { return files[i].modTime > files[j].modTime })
+    if len(files) > limit {
+        files = files[:limit]
+    }
+    return files
+}
+
+// effectiveConfig is the document served at codex://config.
+func (s *Server) effectiveConfig() map[string]any {
+    cwd, _ := os.Getwd()
+    home, _ := codexhome.Dir()
+    framing := s.opts.Framing
+    if framing == "" {
+        framing = FramingAuto
+    }
+    out := map[string]any{
+        "version":        version.Version,
+        "cwd":            cwd,
+        "codex_home":     home,
+        "framing":        framing,
+        "max_frame_size": s.opts.maxFrameSize(),
+    }
+    cfg := s.opts.Config
+    if cfg == nil {
+        cfg = &config.EffectiveConfig{}
+    }
+    // The settings that decide what the agent may do, each with the layer
+    // that set it ("default" when none did).
+    effective := map[string]any{}
+    setting := func(name, key, value, def string) {
+        source := cfg.Sources[key]
+        if value == "" {
+            value, source = def, "default"
+        } else if source == "" {
+            source = config.LayerFlags
+        }
+        effective[name] = map[string]any{"value": value, "source": source}
+    }
+    setting("model", "model", cfg.Model, "")
+    setting("model_provider", "model_provider", cfg.ModelProvider, config.DefaultModelProvider)
+    setting("sandbox_mode", "sandbox_mode", cfg.SandboxMode, agent.DefaultSandboxMode)
+    setting("approval_policy", "approval_policy", cfg.ApprovalPolicy, agent.DefaultApprovalPolicy)
+    setting("profile", "default_profile", cfg.Profile, "")
+    out["profile"] = cfg.Profile
+    out["effective"] = effective
+    out["settings"] = config.RedactSecrets(cfg.Values)
+    sources := cfg.Sources
+    if sources == nil {
+        sources = map[string]string{}
+    }
+    out["sources"] = sources
+    out["config_layers"] = configLayers(cfg.Layers)
+    return out
+}
+
+// configLayers describes the config layers, lowest precedence first.
+func configLayers(layers []config.Layer) []map[string]any {
+    out := make([]map[string]any, 0, len(layers))
+    for _, l := range layers {
+        m := map[string]any{"name": l.Name}
+        if l.Path != "" {
+            m["path"] = l.Path
+        }
+        if len(l.Ignored) > 0 {
+            m["ignored"] = l.Ignored
+        }
+        out = append(out, m)
+    }
+    return out
+}
+
+func (s *Server) handleResourcesList(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    out := []Resource{{
+        URI:         configURI,
+        Name:        "config",
+        Description: "Effective codex-go server configuration.",
+        MimeType:    "application/json",
+    }}
+    for _, conv := range s.conversations.list() {
+        out = append(out, Resource{
+            URI:         conversationURIPrefix + conv.id + transcriptSuffix,
+            Name:        "conversation " + conv.id,
+            Description: "Transcript of submissions and events for a live conversation.",
+            MimeType:    "application/json",
+        })
+    }
+    for _, f := range recentRollouts(maxListedRollouts) {
+        out = append(out, Resource{
+            URI:         rolloutURIPrefix + f.name,
+            Name:        "rollout " + f.name,
+            Description: "Recorded session rollout.",
+            MimeType:    "application/x-ndjson",
+        })
+    }
+    return map[string]any{"resources": out}, nil
+}
+
+func (s *Server) handleResourcesRead(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    var p struct {
+        URI string `json:"uri"`
+    }
+    if err := decodeParams(params, &p); err != nil {
+        return nil, err
+    }
+    if p.URI == "" {
+        return nil, NewError(CodeInvalidParams, "missing uri")
+    }
+    contents, err := s.readResource(p.URI)
+    if err != nil {
+        return nil, err
+    }
+    return map[string]any{"contents": []ResourceContents{contents}}, nil
+}
+
+// readResource resolves uri to its contents.
+func (s *Server) readResource(uri string) (ResourceContents, error) {
+    notFound := func() error {
+        e := NewError(CodeResourceNotFound, "resource not found")
+        e.Data = map[string]string{"uri": uri}
+        return e
+    }
+    switch {
+    case uri == configURI:
+        b, err := json.MarshalIndent(s.effectiveConfig(), "", "  ")
+        if err != nil {
+            return ResourceContents{}, err
+        }
+        return ResourceContents{URI: uri, MimeType: "application/json", Text: string(b)}, nil
+
+    case strings.HasPrefix(uri, conversationURIPrefix) && strings.HasSuffix(uri, transcriptSuffix):
+        id := strings.TrimSuffix(strings.TrimPrefix(uri, conversationURIPrefix), transcriptSuffix)
+        conv, ok := s.conversations.get(id)
+        if !ok {
+            return ResourceContents{}, notFound()
+        }
+        b, err := json.MarshalIndent(conv.transcriptSnapshot(), "", "  ")
+        if err != nil {
+            return ResourceContents{}, err
+        }
+        return ResourceContents{URI: uri, MimeType: "application/json", Text: string(b)}, nil
+
+    case strings.HasPrefix(uri, rolloutURIPrefix):
+        name := strings.TrimPrefix(uri, rolloutURIPrefix)
+        // Only files currently listed may be read; this also rules out
+        // path traversal outside the sessions directory.
+        for _, f := range recentRollouts(maxListedRollouts) {
+            if f.name == name {
+                b, err := os.ReadFile(f.path)
+                if err != nil {
+                    return ResourceContents{}, err
+                }
+                return ResourceContents{URI: uri, MimeType: "application/x-ndjson", Text: string(b)}, nil
+            }
+        }
+        return ResourceContents{}, notFound()
+    }
+    return ResourceContents{}, notFound()
+}
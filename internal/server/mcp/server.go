@@ -1,83 +1,502 @@
 package mcp
 
 import (
-    "bufio"
+    "bytes"
     "context"
     "encoding/json"
-    "fmt"
+    "errors"
     "io"
+    "log/slog"
+    "sync"
+    "time"
+
+    "codex-go/internal/agent"
+    "codex-go/internal/config"
+    iexec "codex-go/internal/exec"
+    "codex-go/internal/jsonl"
+    "codex-go/internal/logging"
+    "codex-go/internal/protocol"
 )
 
-// request is a minimal shape for line-delimited JSON requests to MCP.
-// In a full JSON-RPC implementation we'd parse id/version, but for learning
-// we start with a tiny method switch that keeps I/O simple and observable.
-type request struct {
-    Method string `json:"method"`
-    // Optional text payload for echo requests.
-    Text   string `json:"text,omitempty"`
+// handlerFunc serves a single JSON-RPC method. It returns either a result
+// value (marshaled into the response) or an error; *Error values are sent to
+// the client as-is, anything else becomes an internal error.
+type handlerFunc func(ctx context.Context, sess *session, params json.RawMessage) (any, error)
+
+// Server is a JSON-RPC 2.0 dispatcher speaking MCP over newline-delimited
+// JSON. One Server may serve many connections; per-connection state lives
+// in session.
+type Server struct {
+    opts      Options
+    methods   map[string]handlerFunc
+    tools     map[string]*serverTool
+    toolOrder []string
+
+    conversations *conversationRegistry
+
+    agentMu sync.Mutex // guards opts.Agent, which Reconfigure changes
+
+    sessMu   sync.Mutex
+    sessions map[*session]struct{} // connected clients, for broadcasts
 }
 
-// pong is the success payload we return when Method=="ping".
-type pong struct {
-    Result string `json:"result"`
+// Options tunes a Server. The zero value selects sensible defaults.
+type Options struct {
+    // MaxFrameSize bounds a single incoming frame (line or HTTP body) in
+    // bytes. <= 0 selects jsonl.DefaultMaxFrameSize.
+    MaxFrameSize int
+    // AuthToken, when set, is the bearer token clients must present:
+    // in the Authorization header over HTTP, or in the initialize request's
+    // _meta.authorization over stream transports.
+    AuthToken string
+    // Framing selects message delimiting on byte streams (stdio, sockets).
+    // Empty means FramingAuto.
+    Framing Framing
+    // Agent is the base configuration of agents started by the codex tool;
+    // tool arguments (cwd, sandbox) override it per conversation.
+    Agent agent.Config
+    // Logger is the shared structured logger. Records are also mirrored to
+    // clients that enabled logging via logging/setLevel. nil discards.
+    Logger *slog.Logger
+    // ToolLimits bounds every tools/call; zero fields select
+    // DefaultToolTimeout and agent.DefaultMaxToolResultBytes. ToolLimitsByName
+    // overrides them for individual tools.
+    ToolLimits       agent.ToolLimits
+    ToolLimitsByName map[string]agent.ToolLimits
+    // Config is the configuration the agent settings were taken from,
+    // reported at codex://config with its secrets redacted. nil reports
+    // none.
+    Config *config.EffectiveConfig
+    // MaxConversations bounds the conversations of the codex tool kept
+    // for codex-reply; past it the least recently used idle one ends.
+    // <= 0 selects DefaultMaxConversations.
+    MaxConversations int
+    // ConversationIdleTimeout ends conversations without a turn for this
+    // long. <= 0 selects DefaultConversationIdleTimeout.
+    ConversationIdleTimeout time.Duration
+    // AllowedOrigins are the origins, like "https://app.example.com", from
+    // which browsers may use the HTTP transport besides loopback ones.
+    AllowedOrigins []string
+    // SessionIdleTimeout ends HTTP sessions without requests or open
+    // streams for this long. <= 0 selects DefaultSessionIdleTimeout.
+    SessionIdleTimeout time.Duration
+    // AllowUnsandboxedShell lets the shell tool run commands without a
+    // sandbox: under danger-full-access, or where the host cannot sandbox
+    // them. Otherwise such calls fail.
+    AllowUnsandboxedShell bool
 }
 
-// errResp is a small error envelope for malformed input or unknown methods.
-type errResp struct {
-    Error string `json:"error"`
+// toolLimits returns the effective limits for the named tool.
+func (o Options) toolLimits(name string) agent.ToolLimits {
+    l, ok := o.ToolLimitsByName[name]
+    if !ok {
+        l = o.ToolLimits
+    }
+    if l.Timeout <= 0 {
+        l.Timeout = o.ToolLimits.Timeout
+    }
+    if l.Timeout <= 0 {
+        l.Timeout = DefaultToolTimeout
+    }
+    if l.MaxResultBytes <= 0 {
+        l.MaxResultBytes = o.ToolLimits.MaxResultBytes
+    }
+    if l.MaxResultBytes <= 0 {
+        l.MaxResultBytes = agent.DefaultMaxToolResultBytes
+    }
+    return l
 }
 
-// Serve implements a minimal JSON-over-stdio handler.
-// Each input line is expected to be a JSON object with at least a "method" field.
-// Supported: {"method":"ping"} -> {"result":"pong"}\n
-// The function is streaming: it reads until EOF/caller closes stdin. This makes
-// it easy to later evolve into a proper JSON-RPC loop without changing the
-// high-level control flow in cmd/codex.
-func Serve(ctx context.Context, r io.Reader, w io.Writer) error {
-    scanner := bufio.NewScanner(r)
-    for scanner.Scan() {
-        line := scanner.Bytes()
-
-        var req request
-        if err := json.Unmarshal(line, &req); err != nil {
-            // For invalid JSON, reply with a one-line error and keep the loop alive.
-            if _, werr := fmt.Fprintln(w, `{"error":"invalid json"}`); werr != nil {
-                return werr
-            }
-            continue
+// maxFrameSize returns the effective frame limit.
+func (o Options) maxFrameSize() int {
+    if o.MaxFrameSize <= 0 {
+        return jsonl.DefaultMaxFrameSize
+    }
+    return o.MaxFrameSize
+}
+
+// NewServer constructs a Server with the built-in methods registered.
+func NewServer(opts Options) *Server {
+    if opts.Logger == nil {
+        opts.Logger = logging.Discard()
+    }
+    s := &Server{opts: opts, methods: map[string]handlerFunc{}, conversations: newConversationRegistry(opts.MaxConversations, opts.ConversationIdleTimeout), sessions: map[*session]struct{}{}}
+    s.methods["ping"] = handlePing
+    s.methods["echo"] = handleEcho
+    s.methods["initialize"] = handleInitialize
+    s.methods["notifications/initialized"] = handleInitialized
+    s.methods["logging/setLevel"] = handleSetLevel
+    s.methods["tools/list"] = s.handleToolsList
+    s.methods["tools/call"] = s.handleToolsCall
+    s.methods["resources/list"] = s.handleResourcesList
+    s.methods["resources/read"] = s.handleResourcesRead
+    s.methods["prompts/list"] = handlePromptsList
+    s.methods["prompts/get"] = handlePromptsGet
+    s.addTool(s.newCodexTool())
+    s.addTool(s.newCodexReplyTool())
+    s.addTool(s.newShellTool(iexec.NewLocalRunner()))
+    return s
+}
+
+// frameSink delivers one encoded JSON-RPC frame to the client.
+type frameSink func(frame []byte) error
+
+// sinkKey scopes a frameSink to a single request via its context. Transports
+// that answer each request on its own stream (streamable HTTP) use it so that
+// notifications emitted while handling a request travel with its response.
+type sinkKey struct{}
+
+// withSink returns a context whose frames are routed to sink.
+func withSink(ctx context.Context, sink frameSink) context.Context {
+    return context.WithValue(ctx, sinkKey{}, sink)
+}
+
+// detachSink returns ctx with the request-scoped sink of sess, if any,
+// replaced by one that detach cuts off: later frames are dropped instead of
+// reaching a stream whose request may have been answered. It is for work
+// that can outlive its request, like a tool ignoring its deadline.
+func detachSink(ctx context.Context, sess *session) (context.Context, func()) {
+    sink, ok := ctx.Value(sinkKey{}).(frameSink)
+    if !ok || sink == nil {
+        return ctx, func() {}
+    }
+    detached := false // guarded by sess.wmu, under which sinks are called
+    ctx = withSink(ctx, func(frame []byte) error {
+        if detached {
+            return nil
         }
+        return sink(frame)
+    })
+    return ctx, func() {
+        sess.wmu.Lock()
+        detached = true
+        sess.wmu.Unlock()
+    }
+}
+
+// requestIDKey carries the id of the request being handled in its context.
+type requestIDKey struct{}
+
+// requestIDFrom returns the id of the request handled under ctx, if any.
+func requestIDFrom(ctx context.Context) json.RawMessage {
+    id, _ := ctx.Value(requestIDKey{}).(json.RawMessage)
+    return id
+}
+
+// session is the state of a single client connection. Writes are serialized
+// so handlers may emit notifications while responses are being written.
+type session struct {
+    wmu    sync.Mutex    // serializes frame writes
+    send   frameSink     // default destination; nil drops frames
+    stream chan struct{} // closed when the stream set by openStream is replaced
+
+    mu              sync.Mutex // guards the handshake state below
+    initialized     bool       // initialize request answered
+    ready           bool       // notifications/initialized received
+    protocolVersion string
+    clientInfo      Implementation
+    logLevel        slog.Level // minimum level forwarded to the client
+    logEnabled      bool       // client called logging/setLevel
+    authenticated   bool       // presented the bearer token (if one is required)
+
+    log *slog.Logger // shared logger, mirrored to the client
+}
+
+// isInitialized reports whether the initialize request has been answered.
+func (s *session) isInitialized() bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.initialized
+}
+
+// newSession returns a session delivering frames to send (nil drops them).
+// It receives broadcasts until passed to endSession.
+func (s *Server) newSession(send frameSink) *session {
+    sess := &session{send: send}
+    sess.log = newSessionLogger(s.opts.Logger, sess)
+    s.sessMu.Lock()
+    s.sessions[sess] = struct{}{}
+    s.sessMu.Unlock()
+    return sess
+}
+
+// endSession forgets a disconnected session and ends the conversations it
+// started.
+func (s *Server) endSession(sess *session) {
+    s.sessMu.Lock()
+    delete(s.sessions, sess)
+    s.sessMu.Unlock()
+    s.conversations.endSession(sess)
+}
+
+// baseAgentConfig returns the configuration new conversations start from.
+func (s *Server) baseAgentConfig() agent.Config {
+    s.agentMu.Lock()
+    defer s.agentMu.Unlock()
+    return s.opts.Agent
+}
+
+// Reconfigure applies update to the configuration of new conversations and
+// of every live one, then tells each initialized client what changed with a
+// background_event in a codex/event notification. It is how settings of a
+// config file edited while serving take effect.
+func (s *Server) Reconfigure(ctx context.Context, update func(*agent.Config), message string) {
+    s.agentMu.Lock()
+    update(&s.opts.Agent)
+    s.agentMu.Unlock()
+    for _, conv := range s.conversations.list() {
+        conv.agent.Reconfigure(update)
+    }
+
+    s.sessMu.Lock()
+    sessions := make([]*session, 0, len(s.sessions))
+    for sess := range s.sessions {
+        sessions = append(sessions, sess)
+    }
+    s.sessMu.Unlock()
+    ev := protocol.Event{ID: "config-reload", Msg: protocol.BackgroundEvent{Message: message}}
+    for _, sess := range sessions {
+        if sess.isInitialized() {
+            forwardEvent(ctx, sess, nil, ev)
+        }
+    }
+}
+
+// writeFrame marshals v and delivers it to the request-scoped sink in ctx,
+// falling back to the session's default destination.
+func (s *session) writeFrame(ctx context.Context, v any) error {
+    b, err := json.Marshal(v)
+    if err != nil {
+        return err
+    }
+    s.wmu.Lock()
+    defer s.wmu.Unlock()
+    if sink, ok := ctx.Value(sinkKey{}).(frameSink); ok && sink != nil {
+        return sink(b)
+    }
+    if s.send == nil {
+        return nil
+    }
+    return s.send(b)
+}
+
+// openStream makes sink the session's default destination, replacing the
+// stream opened before, whose replaced channel is closed. closeStream drops
+// frames again, unless a later stream replaced this one.
+func (s *session) openStream(sink frameSink) (replaced <-chan struct{}, closeStream func()) {
+    done := make(chan struct{})
+    s.wmu.Lock()
+    if s.stream != nil {
+        close(s.stream)
+    }
+    s.stream, s.send = done, sink
+    s.wmu.Unlock()
+    return done, func() {
+        s.wmu.Lock()
+        defer s.wmu.Unlock()
+        if s.stream == done {
+            s.stream, s.send = nil, nil
+        }
+    }
+}
+
+// notify sends a server-to-client notification.
+func (s *session) notify(ctx context.Context, method string, params any) error {
+    return s.writeFrame(ctx, Notification{JSONRPC: jsonrpcVersion, Method: method, Params: params})
+}
+
+// Serve implements a JSON-RPC 2.0 loop over newline-delimited JSON or
+// Content-Length framed messages (auto-detected).
+// Each frame is a request object, a notification, or a batch array.
+// Supported: {"jsonrpc":"2.0","id":1,"method":"ping"} -> {"jsonrpc":"2.0","id":1,"result":{}}
+// The function is streaming: it reads until EOF/caller closes stdin.
+func Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+    return NewServer(Options{}).Serve(ctx, r, w)
+}
 
-        switch req.Method {
-        case "ping":
-            // Happy path: reply with pong.
-            b, _ := json.Marshal(pong{Result: "pong"})
-            if _, err := w.Write(append(b, '\n')); err != nil {
+// Serve runs the protocol loop for one connection until r is exhausted or
+// ctx ends. Cancellation unblocks the loop even while waiting for input: the
+// request being handled (if any) completes with the canceled context, its
+// response is written and flushed, and ctx.Err() is returned.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+    fr := newFramer(s.opts.Framing, r, w, s.opts.maxFrameSize())
+    sess := s.newSession(fr.WriteFrame)
+    defer s.endSession(sess)
+    defer flushWriter(w)
+
+    frames := jsonl.Pump(ctx, fr)
+    for {
+        var f jsonl.Frame
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case f = <-frames:
+        }
+        if errors.Is(f.Err, jsonl.ErrFrameTooLarge) {
+            // Oversized frames are skipped; the loop stays alive.
+            if err := sess.writeFrame(ctx, frameTooLargeResponse(fr.Max())); err != nil {
                 return err
             }
-        case "echo":
-            // Minimal echo route: return an agent_message with the provided text.
-            // Shape mirrors a tiny slice of our EventMsg for learning purposes.
-            type agentMsg struct {
-                Type string `json:"type"`
-                Text string `json:"text,omitempty"`
-            }
-            if req.Text == "" {
-                if _, err := fmt.Fprintln(w, `{"error":"missing text"}`); err != nil {
-                    return err
-                }
-                continue
-            }
-            b, _ := json.Marshal(agentMsg{Type: "agent_message", Text: req.Text})
-            if _, err := w.Write(append(b, '\n')); err != nil {
+            continue
+        }
+        if f.Err == io.EOF {
+            return nil
+        }
+        if f.Err != nil {
+            return f.Err
+        }
+        line := bytes.TrimSpace(f.Data)
+        if len(line) == 0 {
+            continue
+        }
+        if out := s.handleFrame(ctx, sess, line); out != nil {
+            if err := sess.writeFrame(ctx, out); err != nil {
                 return err
             }
-        default:
-            // Unrecognized method – respond with a small error message.
-            b, _ := json.Marshal(errResp{Error: "method not implemented"})
-            if _, err := w.Write(append(b, '\n')); err != nil {
-                return err
+        }
+    }
+}
+
+// flushWriter flushes w if it buffers output (e.g. *bufio.Writer).
+func flushWriter(w io.Writer) {
+    if f, ok := w.(interface{ Flush() error }); ok {
+        _ = f.Flush()
+    }
+}
+
+// frameTooLargeResponse reports a frame that exceeded limit. The id is
+// unknown because the frame was never parsed.
+func frameTooLargeResponse(limit int) Response {
+    e := NewError(CodeFrameTooLarge, "frame too large: exceeds %d bytes", limit)
+    e.Data = map[string]int{"max_bytes": limit}
+    return errorResponse(nil, e)
+}
+
+// handleFrame processes one decoded frame (single request or batch) and
+// returns the value to write back, or nil when no reply is due.
+func (s *Server) handleFrame(ctx context.Context, sess *session, frame []byte) any {
+    if frame[0] == '[' {
+        var batch []json.RawMessage
+        if err := json.Unmarshal(frame, &batch); err != nil {
+            return errorResponse(nil, NewError(CodeParseError, "parse error: %v", err))
+        }
+        if len(batch) == 0 {
+            return errorResponse(nil, NewError(CodeInvalidRequest, "empty batch"))
+        }
+        var out []Response
+        for _, raw := range batch {
+            if resp := s.handleMessage(ctx, sess, raw); resp != nil {
+                out = append(out, *resp)
             }
         }
+        if len(out) == 0 {
+            return nil
+        }
+        return out
+    }
+    if resp := s.handleMessage(ctx, sess, frame); resp != nil {
+        return resp
+    }
+    return nil
+}
+
+// handleMessage validates and dispatches a single request object.
+func (s *Server) handleMessage(ctx context.Context, sess *session, raw json.RawMessage) *Response {
+    var req Request
+    if err := json.Unmarshal(raw, &req); err != nil {
+        var syn *json.SyntaxError
+        if errors.As(err, &syn) {
+            resp := errorResponse(nil, NewError(CodeParseError, "parse error: %v", err))
+            return &resp
+        }
+        resp := errorResponse(nil, NewError(CodeInvalidRequest, "invalid request: %v", err))
+        return &resp
+    }
+    if !validID(req.ID) {
+        resp := errorResponse(nil, NewError(CodeInvalidRequest, "invalid request: id must be a string, number or null"))
+        return &resp
+    }
+    if req.JSONRPC != jsonrpcVersion || req.Method == "" {
+        resp := errorResponse(req.ID, NewError(CodeInvalidRequest, "invalid request"))
+        return &resp
+    }
+
+    sess.log.DebugContext(ctx, "request received", "method", req.Method, "id", string(req.ID))
+
+    if rpcErr := s.authorizeStream(sess, &req); rpcErr != nil {
+        sess.log.WarnContext(ctx, "unauthorized request rejected", "method", req.Method)
+        if req.IsNotification() {
+            return nil
+        }
+        resp := errorResponse(req.ID, rpcErr)
+        return &resp
+    }
+
+    h, ok := s.methods[req.Method]
+    if !ok {
+        if req.IsNotification() {
+            return nil
+        }
+        resp := errorResponse(req.ID, NewError(CodeMethodNotFound, "method not found: %s", req.Method))
+        return &resp
+    }
+    if !preInitMethods[req.Method] && !req.IsNotification() && !sess.isInitialized() {
+        resp := errorResponse(req.ID, NewError(CodeInvalidRequest, "session not initialized: send initialize first"))
+        return &resp
+    }
+
+    if !req.IsNotification() {
+        ctx = context.WithValue(ctx, requestIDKey{}, req.ID)
+    }
+    result, err := h(ctx, sess, req.Params)
+    if req.IsNotification() {
+        // Notifications never get a reply, even when the handler failed.
+        return nil
+    }
+    if err != nil {
+        var rpcErr *Error
+        if !errors.As(err, &rpcErr) {
+            rpcErr = NewError(CodeInternalError, "%v", err)
+            sess.log.ErrorContext(ctx, "request failed", "method", req.Method, "error", err.Error())
+        }
+        resp := errorResponse(req.ID, rpcErr)
+        return &resp
+    }
+    resp := resultResponse(req.ID, result)
+    return &resp
+}
+
+// decodeParams unmarshals params into v, mapping failures to InvalidParams.
+func decodeParams(params json.RawMessage, v any) error {
+    if len(params) == 0 {
+        return nil
+    }
+    if err := json.Unmarshal(params, v); err != nil {
+        return NewError(CodeInvalidParams, "invalid params: %v", err)
+    }
+    return nil
+}
+
+// handlePing answers the MCP liveness check with an empty result object.
+func handlePing(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    return struct{}{}, nil
+}
+
+// handleEcho returns an agent_message carrying the provided text.
+// Shape mirrors a tiny slice of our EventMsg for learning purposes.
+func handleEcho(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    var p struct {
+        Text string `json:"text"`
+    }
+    if err := decodeParams(params, &p); err != nil {
+        return nil, err
+    }
+    if p.Text == "" {
+        return nil, NewError(CodeInvalidParams, "missing text")
+    }
+    type agentMsg struct {
+        Type string `json:"type"`
+        Text string `json:"text,omitempty"`
     }
-    return scanner.Err()
+    return agentMsg{Type: "agent_message", Text: p.Text}, nil
 }
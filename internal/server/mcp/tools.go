@@ -0,0 +1,454 @@
+package mcp
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "codex-go/internal/agent"
+    iexec "codex-go/internal/exec"
+    "codex-go/internal/protocol"
+)
+
+// DefaultToolTimeout bounds a tools/call when Options.ToolLimits does not.
+// It is generous because the codex tool runs a whole agent turn.
+const DefaultToolTimeout = 10 * time.Minute
+
+// Tool describes a callable tool as advertised by tools/list.
+type Tool struct {
+    Name        string          `json:"name"`
+    Description string          `json:"description,omitempty"`
+    InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// ContentBlock is a single piece of tool output. Only text is produced today.
+type ContentBlock struct {
+    Type string `json:"type"`
+    Text string `json:"text,omitempty"`
+}
+
+// CallToolResult is the result of tools/call. Tool-level failures are
+// reported with IsError rather than as JSON-RPC errors, per the MCP spec.
+type CallToolResult struct {
+    Content           []ContentBlock `json:"content"`
+    StructuredContent map[string]any `json:"structuredContent,omitempty"`
+    IsError           bool           `json:"isError,omitempty"`
+}
+
+// textResult is a shorthand for a single-text-block result.
+func textResult(text string, isError bool) *CallToolResult {
+    return &CallToolResult{Content: []ContentBlock{{Type: "text", Text: text}}, IsError: isError}
+}
+
+// toolCall bundles what a tool implementation needs from the request.
+type toolCall struct {
+    sess          *session
+    args          json.RawMessage
+    progressToken json.RawMessage
+}
+
+// progress reports an intermediate message to the client when it asked for
+// progress via _meta.progressToken; otherwise it is a no-op.
+func (c *toolCall) progress(ctx context.Context, n int, message string) {
+    if len(c.progressToken) == 0 {
+        return
+    }
+    _ = c.sess.notify(ctx, "notifications/progress", map[string]any{
+        "progressToken": c.progressToken,
+        "progress":      n,
+        "message":       message,
+    })
+}
+
+// serverTool pairs a tool definition with its implementation.
+type serverTool struct {
+    def  Tool
+    call func(ctx context.Context, c *toolCall) (*CallToolResult, error)
+}
+
+// addTool registers t; tools/list reports tools in registration order.
+func (s *Server) addTool(t *serverTool) {
+    if s.tools == nil {
+        s.tools = map[string]*serverTool{}
+    }
+    s.tools[t.def.Name] = t
+    s.toolOrder = append(s.toolOrder, t.def.Name)
+}
+
+// handleToolsList answers tools/list. We never paginate, so nextCursor is
+// always omitted.
+func (s *Server) handleToolsList(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    out := make([]Tool, 0, len(s.toolOrder))
+    for _, name := range s.toolOrder {
+        out = append(out, s.tools[name].def)
+    }
+    return map[string]any{"tools": out}, nil
+}
+
+// handleToolsCall dispatches tools/call to the named tool.
+func (s *Server) handleToolsCall(ctx context.Context, sess *session, params json.RawMessage) (any, error) {
+    var p struct {
+        Name      string          `json:"name"`
+        Arguments json.RawMessage `json:"arguments"`
+        Meta      struct {
+            ProgressToken json.RawMessage `json:"progressToken"`
+        } `json:"_meta"`
+    }
+    if err := decodeParams(params, &p); err != nil {
+        return nil, err
+    }
+    t, ok := s.tools[p.Name]
+    if !ok {
+        return nil, NewError(CodeInvalidParams, "unknown tool: %s", p.Name)
+    }
+    limits := s.opts.toolLimits(p.Name)
+    callCtx, cancel := context.WithTimeout(ctx, limits.Timeout)
+    defer cancel()
+
+    // Run the tool on its own goroutine so one that ignores cancellation
+    // still cannot hold the request past its deadline. Whatever it sends
+    // once we returned is dropped.
+    toolCtx, detach := detachSink(callCtx, sess)
+    defer detach()
+    type outcome struct {
+        res *CallToolResult
+        err error
+    }
+    done := make(chan outcome, 1)
+    go func() {
+        res, err := t.call(toolCtx, &toolCall{sess: sess, args: p.Arguments, progressToken: p.Meta.ProgressToken})
+        done <- outcome{res, err}
+    }()
+    var o outcome
+    select {
+    case o = <-done:
+    case <-callCtx.Done():
+    }
+    if ctx.Err() != nil {
+        return nil, ctx.Err()
+    }
+    if errors.Is(callCtx.Err(), context.DeadlineExceeded) && (o.res == nil || o.err != nil) {
+        sess.log.Warn("tool call timed out", "tool", p.Name, "timeout", limits.Timeout)
+        return timeoutResult(p.Name, limits.Timeout), nil
+    }
+    if o.err != nil {
+        return nil, o.err
+    }
+    return truncateResult(o.res, limits.MaxResultBytes), nil
+}
+
+// timeoutResult reports a tool that exceeded its time limit. The structured
+// error lets clients distinguish it from the tool's own failures.
+func timeoutResult(name string, d time.Duration) *CallToolResult {
+    res := textResult(fmt.Sprintf("tool %s timed out after %s", name, d), true)
+    res.StructuredContent = map[string]any{
+        "error": map[string]any{
+            "type":       "timeout",
+            "tool":       name,
+            "timeoutSec": d.Seconds(),
+        },
+    }
+    return res
+}
+
+// truncateResult caps the combined text of res at max bytes. Blocks past
+// the budget are dropped and the last kept one carries a truncation marker.
+func truncateResult(res *CallToolResult, max int) *CallToolResult {
+    if res == nil {
+        return nil
+    }
+    total := 0
+    for _, c := range res.Content {
+        total += len(c.Text)
+    }
+    if total <= max {
+        return res
+    }
+    out := *res
+    out.Content = nil
+    budget := max
+    for i, c := range res.Content {
+        if len(c.Text) <= budget {
+            budget -= len(c.Text)
+            out.Content = append(out.Content, c)
+            continue
+        }
+        dropped := len(res.Content) - i - 1
+        if budget > 0 {
+            c.Text = agent.TruncateOutput(c.Text, budget)
+            out.Content = append(out.Content, c)
+        } else {
+            dropped++
+        }
+        if dropped > 0 {
+            out.Content = append(out.Content, ContentBlock{
+                Type: "text",
+                Text: fmt.Sprintf("[... output exceeded %d bytes; %d more content blocks omitted]", max, dropped),
+            })
+        }
+        break
+    }
+    return &out
+}
+
+// codexToolSchema is the JSON Schema for the codex tool arguments.
+const codexToolSchema = `{
+  "type": "object",
+  "properties": {
+    "prompt": {"type": "string", "description": "The initial user prompt to start the Codex conversation."},
+    "cwd": {"type": "string", "description": "Working directory for the session. Defaults to the server's cwd."},
+    "sandbox": {"type": "string", "enum": ["read-only", "workspace-write", "danger-full-access"], "description": "Sandbox mode for commands run by the agent."}
+  },
+  "required": ["prompt"]
+}`
+
+// codexToolArgs are the decoded arguments of a codex tool call.
+type codexToolArgs struct {
+    Prompt  string `json:"prompt"`
+    Cwd     string `json:"cwd,omitempty"`
+    Sandbox string `json:"sandbox,omitempty"`
+}
+
+// submissionSeq generates ids for submissions originating from tool calls.
+var submissionSeq atomic.Int64
+
+// newCodexTool returns the "codex" tool, which starts a conversation, runs
+// its first turn for the given prompt and returns the agent's messages plus
+// the conversationId to continue it with codex-reply.
+func (s *Server) newCodexTool() *serverTool {
+    return &serverTool{
+        def: Tool{
+            Name:        "codex",
+            Description: "Run a Codex session. Accepts a prompt plus optional cwd and sandbox settings.",
+            InputSchema: json.RawMessage(codexToolSchema),
+        },
+        call: s.callCodexTool,
+    }
+}
+
+func (s *Server) callCodexTool(ctx context.Context, c *toolCall) (*CallToolResult, error) {
+    var args codexToolArgs
+    if err := decodeParams(c.args, &args); err != nil {
+        return nil, err
+    }
+    if strings.TrimSpace(args.Prompt) == "" {
+        return nil, NewError(CodeInvalidParams, "missing prompt")
+    }
+    switch args.Sandbox {
+    case "", "read-only", "workspace-write", "danger-full-access":
+    default:
+        return nil, NewError(CodeInvalidParams, "invalid sandbox mode: %s", args.Sandbox)
+    }
+    if args.Cwd != "" {
+        if fi, err := os.Stat(args.Cwd); err != nil || !fi.IsDir() {
+            return textResult(fmt.Sprintf("cwd is not a directory: %s", args.Cwd), true), nil
+        }
+    }
+
+    cfg := s.baseAgentConfig()
+    if args.Cwd != "" {
+        cfg.Cwd = args.Cwd
+    }
+    if args.Sandbox != "" {
+        cfg.Sandbox.Mode = args.Sandbox
+    }
+    if err := cfg.Allows(args.Sandbox, ""); err != nil {
+        return textResult(err.Error(), true), nil
+    }
+    c.sess.log.InfoContext(ctx, "codex conversation started", "cwd", args.Cwd, "sandbox", args.Sandbox)
+    a := agent.New(cfg)
+    // Turns are only submitted through tools/call, which has no way to
+    // answer an approval request: abort them instead of waiting for the
+    // tool timeout.
+    a.CloseInput()
+    conv := s.conversations.start(a, c.sess)
+    return runConversationTurn(ctx, c, conv, args.Prompt)
+}
+
+// runAgentTurn submits prompt to a, forwarding agent messages as progress
+// notifications while the turn runs and collecting them into the result.
+// The submission and every event are also passed to record.
+func runAgentTurn(ctx context.Context, c *toolCall, a *agent.Agent, prompt string, record func(transcriptEntry)) (*CallToolResult, error) {
+    sub := protocol.Submission{
+        ID: fmt.Sprintf("mcp-%d", submissionSeq.Add(1)),
+        Op: protocol.UserInputOp{
+            Items: []protocol.InputItem{{Type: "text", Text: prompt}},
+        },
+    }
+
+    record(transcriptEntry{Submission: &sub})
+
+    var (
+        messages []string
+        failure  string
+        n        int
+    )
+    requestID := requestIDFrom(ctx)
+    err := a.Submit(ctx, sub, func(ev protocol.Event) error {
+        record(transcriptEntry{Event: &ev})
+        forwardEvent(ctx, c.sess, requestID, ev)
+        n++
+        switch msg := ev.Msg.(type) {
+        case protocol.AgentMessageEvent:
+            messages = append(messages, msg.Text)
+            c.progress(ctx, n, msg.Text)
+        case protocol.ErrorEvent:
+            failure = msg.Message
+            c.sess.log.ErrorContext(ctx, "agent error", "submission", sub.ID, "code", msg.Code, "message", failure)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    if failure != "" {
+        return textResult(failure, true), nil
+    }
+    return textResult(strings.Join(messages, "\n"), false), nil
+}
+
+// codexEventMethod is the (experimental) notification carrying raw agent
+// events while a codex tool call is running.
+const codexEventMethod = "codex/event"
+
+// codexEventParams is the payload of a codex/event notification: the
+// protocol.Event fields plus _meta.requestId naming the tools/call request
+// the event belongs to.
+type codexEventParams struct {
+    Meta struct {
+        RequestID json.RawMessage `json:"requestId,omitempty"`
+    } `json:"_meta"`
+    protocol.Event
+}
+
+// forwardEvent sends ev to the client as a codex/event notification so rich
+// clients can render the whole turn, not only the final tool result.
+func forwardEvent(ctx context.Context, sess *session, requestID json.RawMessage, ev protocol.Event) {
+    var p codexEventParams
+    p.Meta.RequestID = requestID
+    p.Event = ev
+    _ = sess.notify(ctx, codexEventMethod, p)
+}
+
+// shellToolSchema is the JSON Schema for the shell tool arguments.
+const shellToolSchema = `{
+  "type": "object",
+  "properties": {
+    "command": {"type": "array", "items": {"type": "string"}, "minItems": 1, "description": "The command to execute as an argv list, e.g. [\"ls\", \"-la\"]."},
+    "cwd": {"type": "string", "description": "Working directory for the command. Defaults to the server's cwd."},
+    "timeout_sec": {"type": "integer", "minimum": 0, "description": "Kill the command after this many seconds (0 = no timeout)."}
+  },
+  "required": ["command"]
+}`
+
+// shellToolArgs are the decoded arguments of a shell tool call.
+type shellToolArgs struct {
+    Command    []string `json:"command"`
+    Cwd        string   `json:"cwd,omitempty"`
+    TimeoutSec int      `json:"timeout_sec,omitempty"`
+}
+
+// newShellTool returns the "shell" tool, which runs argv and returns the
+// aggregated stdout, stderr and exit code. Commands run with the sandbox,
+// runner and environment policy of the agent configuration, through local
+// when it has no runner; the sandbox is read-only unless configured
+// otherwise.
+func (s *Server) newShellTool(local iexec.Runner) *serverTool {
+    return &serverTool{
+        def: Tool{
+            Name:        "shell",
+            Description: "Run a command through codex-go's execution layer, in the server's sandbox, and return its stdout, stderr and exit code.",
+            InputSchema: json.RawMessage(shellToolSchema),
+        },
+        call: func(ctx context.Context, c *toolCall) (*CallToolResult, error) {
+            cfg := s.baseAgentConfig()
+            runner := cfg.Runner
+            if runner == nil {
+                runner = local
+            }
+            sandbox, err := s.shellSandbox(cfg, runner == local)
+            if err != nil {
+                return textResult(err.Error(), true), nil
+            }
+            return callShellTool(ctx, c, runner, cfg.ShellEnvironmentPolicy, sandbox)
+        },
+    }
+}
+
+// shellSandbox returns the sandbox policy of shell tool commands under cfg,
+// nil for none, which needs Options.AllowUnsandboxedShell. host says
+// whether commands run on the host, rather than through a runner confining
+// them its own way.
+func (s *Server) shellSandbox(cfg agent.Config, host bool) (*iexec.SandboxPolicy, error) {
+    p := cfg.Sandbox
+    if p.Mode == "" {
+        p.Mode = agent.DefaultSandboxMode
+    }
+    if !p.Confines() {
+        if !s.opts.AllowUnsandboxedShell {
+            return nil, errors.New("the shell tool does not run commands without a sandbox (sandbox_mode is danger-full-access); start the server with --allow-unsandboxed-shell to allow it")
+        }
+        return nil, nil
+    }
+    if err := iexec.SandboxAvailable(); err != nil && host {
+        if !s.opts.AllowUnsandboxedShell {
+            return nil, fmt.Errorf("the shell tool does not run commands without a sandbox (%v); start the server with --allow-unsandboxed-shell to allow it", err)
+        }
+        return nil, nil
+    }
+    if p.Mode == protocol.SandboxWorkspaceWrite && cfg.Cwd != "" {
+        p.WritableRoots = append([]string{cfg.Cwd}, p.WritableRoots...)
+    }
+    return &p, nil
+}
+
+func callShellTool(ctx context.Context, c *toolCall, runner iexec.Runner, env iexec.EnvPolicy, sandbox *iexec.SandboxPolicy) (*CallToolResult, error) {
+    var args shellToolArgs
+    if err := decodeParams(c.args, &args); err != nil {
+        return nil, err
+    }
+    if len(args.Command) == 0 || args.Command[0] == "" {
+        return nil, NewError(CodeInvalidParams, "missing command")
+    }
+    if args.TimeoutSec < 0 {
+        return nil, NewError(CodeInvalidParams, "timeout_sec must be >= 0")
+    }
+
+    c.sess.log.InfoContext(ctx, "exec started", "command", args.Command, "cwd", args.Cwd)
+    res, err := runner.Run(ctx, args.Command, iexec.Options{Cwd: args.Cwd, TimeoutSec: args.TimeoutSec, EnvPolicy: &env, Sandbox: sandbox})
+    if err != nil {
+        c.sess.log.ErrorContext(ctx, "exec failed to start", "command", args.Command, "error", err.Error())
+        return textResult(fmt.Sprintf("failed to start command: %v", err), true), nil
+    }
+    code := res.ExitCode
+
+    c.sess.log.InfoContext(ctx, "exec finished", "command", args.Command, "exit_code", code, "signal", res.Signal, "timed_out", res.TimedOut, "duration", res.Duration)
+
+    var b strings.Builder
+    fmt.Fprintf(&b, "exit_code: %d\n", code)
+    if res.Signal != "" {
+        fmt.Fprintf(&b, "signal: %s\n", res.Signal)
+    }
+    if res.TimedOut {
+        fmt.Fprintf(&b, "timed_out: true\n")
+    }
+    if res.SandboxDenied {
+        fmt.Fprintf(&b, "sandbox_denied: true\n")
+    }
+    if len(res.Stdout) > 0 {
+        fmt.Fprintf(&b, "stdout:\n%s", iexec.Text(res.Stdout))
+        if !bytes.HasSuffix(res.Stdout, []byte("\n")) {
+            b.WriteByte('\n')
+        }
+    }
+    if len(res.Stderr) > 0 {
+        fmt.Fprintf(&b, "stderr:\n%s", iexec.Text(res.Stderr))
+    }
+    return textResult(strings.TrimRight(b.String(), "\n"), code != 0), nil
+}
@@ -0,0 +1,57 @@
+package mcp
+
+import (
+    "context"
+    "encoding/json"
+    "sync"
+    "testing"
+    "time"
+
+    "codex-go/internal/agent"
+)
+
+func TestToolsCallTimeoutDetachesSink(t *testing.T) {
+    s := NewServer(Options{ToolLimits: agent.ToolLimits{Timeout: 20 * time.Millisecond}})
+    late := make(chan struct{})
+    s.addTool(&serverTool{
+        def: Tool{Name: "stubborn", InputSchema: json.RawMessage(`{"type":"object"}`)},
+        call: func(ctx context.Context, c *toolCall) (*CallToolResult, error) {
+            // Ignores its deadline, then reports progress on the request.
+            defer close(late)
+            time.Sleep(200 * time.Millisecond)
+            c.progress(ctx, 1, "late")
+            return textResult("done", false), nil
+        },
+    })
+    sess := s.newSession(nil)
+
+    var mu sync.Mutex
+    var answered bool
+    var lateFrames []string
+    ctx := withSink(context.Background(), func(frame []byte) error {
+        mu.Lock()
+        defer mu.Unlock()
+        if answered {
+            lateFrames = append(lateFrames, string(frame))
+        }
+        return nil
+    })
+    out, err := s.handleToolsCall(ctx, sess, json.RawMessage(`{"name":"stubborn","_meta":{"progressToken":1}}`))
+    mu.Lock()
+    answered = true
+    mu.Unlock()
+    if err != nil {
+        t.Fatal(err)
+    }
+    res, ok := out.(*CallToolResult)
+    if !ok || !res.IsError || res.StructuredContent == nil {
+        t.Fatalf("result = %#v, want a timeout error", out)
+    }
+
+    <-late
+    mu.Lock()
+    defer mu.Unlock()
+    if len(lateFrames) != 0 {
+        t.Errorf("frames sent to the request after it was answered: %q", lateFrames)
+    }
+}
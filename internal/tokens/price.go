@@ -0,0 +1,91 @@
+package tokens
+
+import (
+    "sort"
+    "strings"
+
+    "codex-go/internal/protocol"
+)
+
+// Price is what a model charges, in US dollars per million tokens.
+// Reasoning tokens are billed as output.
+type Price struct {
+    Input       float64
+    CachedInput float64
+    Output      float64
+}
+
+// Cost returns what u costs at p, in US dollars.
+func (p Price) Cost(u protocol.TokenUsage) float64 {
+    cached := min(u.CachedInputTokens, u.InputTokens)
+    return (float64(u.InputTokens-cached)*p.Input +
+        float64(cached)*p.CachedInput +
+        float64(u.OutputTokens)*p.Output) / 1e6
+}
+
+// prices lists the list prices of known models by name prefix. The
+// longest matching prefix wins.
+var prices = map[string]Price{
+    "gpt-5":             {Input: 1.25, CachedInput: 0.125, Output: 10},
+    "gpt-5-mini":        {Input: 0.25, CachedInput: 0.025, Output: 2},
+    "gpt-5-nano":        {Input: 0.05, CachedInput: 0.005, Output: 0.4},
+    "codex-mini":        {Input: 1.5, CachedInput: 0.375, Output: 6},
+    "o3":                {Input: 2, CachedInput: 0.5, Output: 8},
+    "o4-mini":           {Input: 1.1, CachedInput: 0.275, Output: 4.4},
+    "gpt-4.1":           {Input: 2, CachedInput: 0.5, Output: 8},
+    "gpt-4.1-mini":      {Input: 0.4, CachedInput: 0.1, Output: 1.6},
+    "gpt-4.1-nano":      {Input: 0.1, CachedInput: 0.025, Output: 0.4},
+    "gpt-4o":            {Input: 2.5, CachedInput: 1.25, Output: 10},
+    "gpt-4o-mini":       {Input: 0.15, CachedInput: 0.075, Output: 0.6},
+    "claude-opus-4":     {Input: 15, CachedInput: 1.5, Output: 75},
+    "claude-sonnet-4":   {Input: 3, CachedInput: 0.3, Output: 15},
+    "claude-3-7-sonnet": {Input: 3, CachedInput: 0.3, Output: 15},
+    "claude-3-5-haiku":  {Input: 0.8, CachedInput: 0.08, Output: 4},
+}
+
+// LookupPrice returns the price of the named model: the entry of table
+// with the longest prefix of the name, else the built-in list price. ok
+// is false when neither knows the model. Provider prefixes
+// ("openai/gpt-4.1") are ignored.
+func LookupPrice(name string, table map[string]Price) (p Price, ok bool) {
+    if i := strings.LastIndexByte(name, '/'); i >= 0 {
+        name = name[i+1:]
+    }
+    for _, t := range []map[string]Price{table, prices} {
+        best := -1
+        for prefix, tp := range t {
+            if strings.HasPrefix(name, prefix) && len(prefix) > best {
+                p, best = tp, len(prefix)
+            }
+        }
+        if best >= 0 {
+            return p, true
+        }
+    }
+    return Price{}, false
+}
+
+// Summarize reports the token usage per model, priced from table (see
+// LookupPrice). The session cost is left out when a model has no price.
+func Summarize(byModel map[string]protocol.TokenUsage, table map[string]Price) protocol.UsageSummary {
+    s := protocol.UsageSummary{Models: []protocol.ModelUsage{}}
+    var cost float64
+    priced := true
+    for name, u := range byModel {
+        m := protocol.ModelUsage{Model: name, Usage: u}
+        if p, ok := LookupPrice(name, table); ok {
+            c := p.Cost(u)
+            m.CostUSD = &c
+            cost += c
+        } else {
+            priced = false
+        }
+        s.Total = s.Total.Add(u)
+        s.Models = append(s.Models, m)
+    }
+    sort.Slice(s.Models, func(i, j int) bool { return s.Models[i].Model < s.Models[j].Model })
+    if priced && len(s.Models) > 0 {
+        s.CostUSD = &cost
+    }
+    return s
+}
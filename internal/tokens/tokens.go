@@ -0,0 +1,89 @@
+// Package tokens estimates how many tokens a conversation takes and how many
+// fit in a model's context window. Estimates stand in for the counts model
+// APIs report: they size the conversation when a server does not report
+// usage (or there is no server), and decide when it must be compacted.
+package tokens
+
+import (
+    "unicode/utf8"
+
+    "codex-go/internal/model"
+)
+
+// Per-item overheads, in tokens, approximating how APIs frame content.
+const (
+    messageOverhead = 4   // role and separators of one message
+    toolCallTokens  = 8   // framing of one function call
+    toolSpecTokens  = 16  // framing of one function definition
+    imageTokens     = 765 // a 1024x1024 image at high detail
+)
+
+// Estimate approximates a tokenizer: about four bytes of ASCII per token,
+// and one token per non-ASCII character (CJK text, symbols), which
+// tokenizers rarely merge.
+func Estimate(s string) int64 {
+    var ascii, other int64
+    for i := 0; i < len(s); {
+        if s[i] < utf8.RuneSelf {
+            ascii++
+            i++
+            continue
+        }
+        _, size := utf8.DecodeRuneInString(s[i:])
+        other++
+        i += size
+    }
+    return (ascii+3)/4 + other
+}
+
+// EstimateMessages approximates the tokens msgs take in a request: their
+// text, images, tool calls and reasoning summaries plus framing. Encrypted
+// reasoning content is not counted; providers do not bill it as input.
+func EstimateMessages(msgs []model.Message) int64 {
+    var n int64
+    for _, m := range msgs {
+        n += messageOverhead
+        for _, c := range m.Content {
+            if c.Type == model.InputImage {
+                n += imageTokens
+                continue
+            }
+            n += Estimate(c.Text)
+        }
+        for _, c := range m.ToolCalls {
+            n += toolCallTokens + Estimate(c.Name) + Estimate(c.Arguments)
+        }
+        for _, r := range m.Reasoning {
+            for _, s := range r.Summary {
+                n += Estimate(s)
+            }
+        }
+    }
+    return n
+}
+
+// EstimatePrompt approximates the input tokens of a request for p.
+func EstimatePrompt(p model.Prompt) int64 {
+    n := Estimate(p.Instructions) + EstimateMessages(p.Messages)
+    for _, t := range p.Tools {
+        n += toolSpecTokens + Estimate(t.Name) + Estimate(t.Description) + Estimate(string(t.Parameters))
+    }
+    return n
+}
+
+// ContextWindow returns the context size of the named model, or 0 when it
+// is unknown (see model.LookupFamily).
+func ContextWindow(name string) int64 { return model.LookupFamily(name).ContextWindow }
+
+// DefaultCompactPercent is the share of the context window a conversation
+// may fill before it is compacted.
+const DefaultCompactPercent = 90
+
+// CompactLimit returns the conversation size at which it is compacted:
+// limit when set, otherwise DefaultCompactPercent of window. 0 means never.
+func CompactLimit(window, limit int64) int64 {
+    if limit > 0 {
+        return limit
+    }
+    return window * DefaultCompactPercent / 100
+}